@@ -97,7 +97,7 @@ func (c *Client) handshake() error {
 }
 
 func (c *Client) SendCommand(ctx *appcontext.AppContext, cmd subcommands.RPC, storeConfig map[string]string) (int, error) {
-	if err := subcommands.EncodeRPC(c.enc, cmd, storeConfig); err != nil {
+	if err := subcommands.EncodeRPC(c.enc, cmd, storeConfig, subcommands.NewRPCContext(ctx)); err != nil {
 		return 1, err
 	}
 
@@ -2,6 +2,7 @@ package appcontext
 
 import (
 	"context"
+	"crypto/ed25519"
 	"io"
 	"os"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/PlakarKorp/plakar/encryption/keypair"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/tracing"
 	"github.com/google/uuid"
 )
 
@@ -19,6 +21,7 @@ type AppContext struct {
 	logger  *logging.Logger  `msgpack:"-"`
 	context context.Context  `msgpack:"-"`
 	secret  []byte           `msgpack:"-"`
+	tracer  *tracing.Tracer  `msgpack:"-"`
 	Config  *config.Config   `msgpack:"-"`
 
 	Stdout io.Writer `msgpack:"-"`
@@ -43,6 +46,17 @@ type AppContext struct {
 	CWD            string
 	MaxConcurrency int
 
+	AccessStats  bool
+	OTelEndpoint string
+
+	// StrictSignatures fails loading a snapshot which isn't signed by a
+	// trusted key, instead of warning about it.
+	StrictSignatures bool
+
+	// TrustedKeys are the public keys, besides the one of Keypair, whose
+	// snapshot signatures are trusted.
+	TrustedKeys []ed25519.PublicKey
+
 	Identity uuid.UUID
 	Keypair  *keypair.KeyPair
 }
@@ -90,6 +104,14 @@ func (c *AppContext) GetLogger() *logging.Logger {
 	return c.logger
 }
 
+func (c *AppContext) SetTracer(tracer *tracing.Tracer) {
+	c.tracer = tracer
+}
+
+func (c *AppContext) GetTracer() *tracing.Tracer {
+	return c.tracer
+}
+
 func (c *AppContext) SetContext(ctx context.Context) {
 	c.context = ctx
 }
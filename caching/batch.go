@@ -0,0 +1,49 @@
+package caching
+
+import (
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// DeltaBatch accumulates deltas in memory and writes them to the cache
+// at once on Flush, which is much cheaper than a write per delta when
+// loading a state.
+type DeltaBatch struct {
+	counter *deltaCounter
+	batch   leveldb.Batch
+	keys    map[string]resources.Type
+}
+
+func newDeltaBatch(counter *deltaCounter) *DeltaBatch {
+	return &DeltaBatch{
+		counter: counter,
+		keys:    make(map[string]resources.Type),
+	}
+}
+
+// PutDelta records a delta to write, data is copied and can be reused by
+// the caller.
+func (b *DeltaBatch) PutDelta(blobType resources.Type, blobCsum, packfile objects.MAC, data []byte) {
+	key := deltaKey(blobType, blobCsum, packfile)
+	b.batch.Put(key, data)
+	b.keys[string(key)] = blobType
+}
+
+// Len returns the number of deltas waiting to be written.
+func (b *DeltaBatch) Len() int {
+	return b.batch.Len()
+}
+
+// Flush writes the pending deltas atomically and empties the batch.
+func (b *DeltaBatch) Flush() error {
+	if b.batch.Len() == 0 {
+		return nil
+	}
+	if err := b.counter.write(&b.batch, b.keys, true); err != nil {
+		return err
+	}
+	b.batch.Reset()
+	clear(b.keys)
+	return nil
+}
@@ -7,12 +7,15 @@ import (
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/google/uuid"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
 const CACHE_VERSION = "1.0.0"
 
 type Manager struct {
 	cacheDir string
+	inMemory bool
 
 	repositoryCache      map[uuid.UUID]*_RepositoryCache
 	repositoryCacheMutex sync.Mutex
@@ -34,6 +37,28 @@ func NewManager(cacheDir string) *Manager {
 	}
 }
 
+// NewMemoryManager returns a manager whose caches are held in memory and
+// lost once closed, for tests and short-lived processes which should not
+// write to disk.
+func NewMemoryManager() *Manager {
+	return &Manager{
+		inMemory: true,
+
+		repositoryCache:  make(map[uuid.UUID]*_RepositoryCache),
+		vfsCache:         make(map[string]*_VFSCache),
+		maintenanceCache: make(map[uuid.UUID]*MaintenanceCache),
+	}
+}
+
+// open opens the database of a cache, elems locate it below the cache
+// directory.
+func (m *Manager) open(elems ...string) (*leveldb.DB, error) {
+	if m.inMemory {
+		return leveldb.Open(storage.NewMemStorage(), nil)
+	}
+	return leveldb.OpenFile(filepath.Join(append([]string{m.cacheDir}, elems...)...), nil)
+}
+
 func (m *Manager) Close() error {
 	m.vfsCacheMutex.Lock()
 	defer m.vfsCacheMutex.Unlock()
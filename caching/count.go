@@ -0,0 +1,189 @@
+package caching
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// deltaCountsKey marks a cache whose delta counts were saved when it was
+// last closed.  It is removed while the cache is open, so that the counts
+// of a cache which was not closed properly, or created before the counts
+// existed, are computed again when opened.
+const deltaCountsKey = "__deltacount__"
+
+func deltaKey(blobType resources.Type, blobCsum, packfile objects.MAC) []byte {
+	return []byte(fmt.Sprintf("__delta__:%d:%x:%x", blobType, blobCsum, packfile))
+}
+
+func deltaCountKey(blobType resources.Type) []byte {
+	return []byte(fmt.Sprintf("%s:%d", deltaCountsKey, blobType))
+}
+
+// deltaLocks is the number of locks the delta keys are spread over.
+const deltaLocks = 256
+
+// deltaCounter keeps the number of deltas of each type of a cache so that
+// they can be counted without iterating.  Writes of deltas go through it:
+// those of the same key are serialized so that each key is counted once,
+// the others proceed concurrently.  The counts are held in memory and
+// saved when the cache is closed.
+type deltaCounter struct {
+	db    *leveldb.DB
+	locks [deltaLocks]sync.Mutex
+
+	mu     sync.Mutex
+	counts map[resources.Type]uint64
+}
+
+func newDeltaCounter(db *leveldb.DB) (*deltaCounter, error) {
+	dc := &deltaCounter{db: db, counts: make(map[resources.Type]uint64)}
+
+	exists, err := db.Has([]byte(deltaCountsKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		err = dc.load()
+	} else {
+		err = dc.recount()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the saved counts are stale as soon as a delta is written
+	if err := db.Delete([]byte(deltaCountsKey), nil); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// load reads the counts saved when the cache was closed.
+func (dc *deltaCounter) load() error {
+	iter := dc.db.NewIterator(util.BytesPrefix([]byte(deltaCountsKey+":")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		blobType, err := strconv.Atoi(string(iter.Key()[len(deltaCountsKey)+1:]))
+		if err != nil || len(iter.Value()) != 8 {
+			return fmt.Errorf("malformed delta count %q", iter.Key())
+		}
+		dc.counts[resources.Type(blobType)] = binary.LittleEndian.Uint64(iter.Value())
+	}
+	return iter.Error()
+}
+
+// recount computes the counts from the deltas present in the cache.
+func (dc *deltaCounter) recount() error {
+	iter := dc.db.NewIterator(util.BytesPrefix([]byte("__delta__:")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		blobType, _, _, err := parseDeltaKey(iter.Key())
+		if err != nil {
+			continue
+		}
+		dc.counts[blobType]++
+	}
+	return iter.Error()
+}
+
+// save writes the counts to the cache, it is called when closing it.
+func (dc *deltaCounter) save() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	batch := new(leveldb.Batch)
+	for blobType, count := range dc.counts {
+		batch.Put(deltaCountKey(blobType), binary.LittleEndian.AppendUint64(nil, count))
+	}
+	batch.Put([]byte(deltaCountsKey), nil)
+	return dc.db.Write(batch, nil)
+}
+
+// reset computes the counts again, after deltas were removed from the
+// cache without going through the counter.
+func (dc *deltaCounter) reset() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	clear(dc.counts)
+	return dc.recount()
+}
+
+func (dc *deltaCounter) get(blobType resources.Type) (uint64, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.counts[blobType], nil
+}
+
+func (dc *deltaCounter) lockIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % deltaLocks)
+}
+
+// write applies batch, in which keys are the deltas to insert when added
+// is true or to remove otherwise, and updates the counts of the deltas
+// that were actually added or removed.
+func (dc *deltaCounter) write(batch *leveldb.Batch, keys map[string]resources.Type, added bool) error {
+	// the locks are taken in order, so that writers of overlapping keys
+	// don't deadlock
+	var locked [deltaLocks]bool
+	for key := range keys {
+		locked[dc.lockIndex(key)] = true
+	}
+	for i := range locked {
+		if locked[i] {
+			dc.locks[i].Lock()
+			defer dc.locks[i].Unlock()
+		}
+	}
+
+	changed := make(map[resources.Type]uint64)
+	for key, blobType := range keys {
+		exists, err := dc.db.Has([]byte(key), nil)
+		if err != nil {
+			return err
+		}
+		if exists != added {
+			changed[blobType]++
+		}
+	}
+
+	if err := dc.db.Write(batch, nil); err != nil {
+		return err
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	for blobType, n := range changed {
+		if added {
+			dc.counts[blobType] += n
+		} else {
+			dc.counts[blobType] -= min(dc.counts[blobType], n)
+		}
+	}
+	return nil
+}
+
+func (dc *deltaCounter) put(blobType resources.Type, blobCsum, packfile objects.MAC, data []byte) error {
+	key := deltaKey(blobType, blobCsum, packfile)
+
+	batch := new(leveldb.Batch)
+	batch.Put(key, data)
+	return dc.write(batch, map[string]resources.Type{string(key): blobType}, true)
+}
+
+func (dc *deltaCounter) delete(blobType resources.Type, blobCsum, packfile objects.MAC) error {
+	key := deltaKey(blobType, blobCsum, packfile)
+
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	return dc.write(batch, map[string]resources.Type{string(key): blobType}, false)
+}
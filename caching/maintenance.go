@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"iter"
-	"path/filepath"
 	"strings"
 
 	"github.com/PlakarKorp/plakar/objects"
@@ -20,9 +19,7 @@ type MaintenanceCache struct {
 }
 
 func newMaintenanceCache(cacheManager *Manager, repositoryID uuid.UUID) (*MaintenanceCache, error) {
-	cacheDir := filepath.Join(cacheManager.cacheDir, "maintenance", repositoryID.String())
-
-	db, err := leveldb.OpenFile(cacheDir, nil)
+	db, err := cacheManager.open("maintenance", repositoryID.String())
 	if err != nil {
 		return nil, err
 	}
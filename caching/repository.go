@@ -2,6 +2,7 @@ package caching
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/PlakarKorp/plakar/objects"
@@ -23,16 +25,23 @@ type _RepositoryCache struct {
 	manager    *Manager
 	cookiesDir string
 	db         *leveldb.DB
+	counter    *deltaCounter
+
+	// cookies replaces cookiesDir for in-memory caches
+	cookies      map[string]struct{}
+	cookiesMutex sync.Mutex
 }
 
 func newRepositoryCache(cacheManager *Manager, repositoryID uuid.UUID) (*_RepositoryCache, error) {
-	cookiesDir := filepath.Join(cacheManager.cacheDir, "cookies", repositoryID.String())
-	if err := os.MkdirAll(cookiesDir, 0700); err != nil {
-		return nil, err
+	var cookiesDir string
+	if !cacheManager.inMemory {
+		cookiesDir = filepath.Join(cacheManager.cacheDir, "cookies", repositoryID.String())
+		if err := os.MkdirAll(cookiesDir, 0700); err != nil {
+			return nil, err
+		}
 	}
 
-	cacheDir := filepath.Join(cacheManager.cacheDir, "repository", repositoryID.String())
-	db, err := leveldb.OpenFile(cacheDir, nil)
+	db, err := cacheManager.open("repository", repositoryID.String())
 	if err != nil {
 		if errors.Is(err, syscall.EAGAIN) {
 			return nil, ErrInUse
@@ -40,25 +49,49 @@ func newRepositoryCache(cacheManager *Manager, repositoryID uuid.UUID) (*_Reposi
 		return nil, err
 	}
 
+	counter, err := newDeltaCounter(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &_RepositoryCache{
 		manager:    cacheManager,
 		cookiesDir: cookiesDir,
 		db:         db,
+		counter:    counter,
+		cookies:    make(map[string]struct{}),
 	}, nil
 }
 
 func (c *_RepositoryCache) Close() error {
-	return c.db.Close()
+	err := c.counter.save()
+	if cerr := c.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 func (c *_RepositoryCache) HasCookie(name string) bool {
 	name = strings.ReplaceAll(name, "/", "_")
+	if c.manager.inMemory {
+		c.cookiesMutex.Lock()
+		defer c.cookiesMutex.Unlock()
+		_, exists := c.cookies[name]
+		return exists
+	}
 	_, err := os.Stat(filepath.Join(c.cookiesDir, name))
 	return err == nil
 }
 
 func (c *_RepositoryCache) PutCookie(name string) error {
 	name = strings.ReplaceAll(name, "/", "_")
+	if c.manager.inMemory {
+		c.cookiesMutex.Lock()
+		defer c.cookiesMutex.Unlock()
+		c.cookies[name] = struct{}{}
+		return nil
+	}
 	_, err := os.Create(filepath.Join(c.cookiesDir, name))
 	return err
 }
@@ -152,12 +185,32 @@ func (c *_RepositoryCache) GetDelta(blobType resources.Type, blobCsum objects.MA
 	return c.getObjects(fmt.Sprintf("__delta__:%d:%x:", blobType, blobCsum))
 }
 
+// GetDeltaByCsum returns the first delta recorded for blobCsum whatever
+// its type, along with the type it was recorded under.
+func (c *_RepositoryCache) GetDeltaByCsum(blobCsum objects.MAC) ([]byte, resources.Type, bool, error) {
+	for _, blobType := range resources.Types() {
+		for _, data := range c.GetDelta(blobType, blobCsum) {
+			return data, blobType, true, nil
+		}
+	}
+	return nil, 0, false, nil
+}
+
 func (c *_RepositoryCache) HasDelta(blobType resources.Type, blobCsum objects.MAC) (bool, error) {
 	return c.has("__delta__", fmt.Sprintf("%d:%x", blobType, blobCsum))
 }
 
 func (c *_RepositoryCache) PutDelta(blobType resources.Type, blobCsum, packfile objects.MAC, data []byte) error {
-	return c.put("__delta__", fmt.Sprintf("%d:%x:%x", blobType, blobCsum, packfile), data)
+	return c.counter.put(blobType, blobCsum, packfile, data)
+}
+
+func (c *_RepositoryCache) NewDeltaBatch() *DeltaBatch {
+	return newDeltaBatch(c.counter)
+}
+
+// CountDeltas returns the number of deltas of type blobType in the cache.
+func (c *_RepositoryCache) CountDeltas(blobType resources.Type) (uint64, error) {
+	return c.counter.get(blobType)
 }
 
 func (c *_RepositoryCache) GetDeltasByType(blobType resources.Type) iter.Seq2[objects.MAC, []byte] {
@@ -189,7 +242,7 @@ func (c *_RepositoryCache) GetDeltas() iter.Seq2[objects.MAC, []byte] {
 }
 
 func (c *_RepositoryCache) DelDelta(blobType resources.Type, blobCsum, packfileMAC objects.MAC) error {
-	return c.delete("__delta__", fmt.Sprintf("%d:%x:%x", blobType, blobCsum, packfileMAC))
+	return c.counter.delete(blobType, blobCsum, packfileMAC)
 }
 
 func (c *_RepositoryCache) PutDeleted(blobType resources.Type, blobCsum objects.MAC, data []byte) error {
@@ -270,3 +323,87 @@ func (c *_RepositoryCache) GetSnapshot(stateID objects.MAC) ([]byte, error) {
 func (c *_RepositoryCache) DelSnapshot(stateID objects.MAC) error {
 	return c.delete("__snapshot__", fmt.Sprintf("%x", stateID))
 }
+
+func (c *_RepositoryCache) AddAccessCount(blobType resources.Type, blobCsum objects.MAC, count uint64) error {
+	key := fmt.Sprintf("%d:%x", blobType, blobCsum)
+
+	data, err := c.get("__access__", key)
+	if err != nil {
+		return err
+	}
+	if len(data) == 8 {
+		count += binary.LittleEndian.Uint64(data)
+	}
+
+	return c.put("__access__", key, binary.LittleEndian.AppendUint64(nil, count))
+}
+
+func (c *_RepositoryCache) GetAccessCount(blobType resources.Type, blobCsum objects.MAC) (uint64, error) {
+	data, err := c.get("__access__", fmt.Sprintf("%d:%x", blobType, blobCsum))
+	if err != nil || len(data) != 8 {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(data), nil
+}
+
+func (c *_RepositoryCache) GetAccessCountsByType(blobType resources.Type) iter.Seq2[objects.MAC, uint64] {
+	return func(yield func(objects.MAC, uint64) bool) {
+		for csum, data := range c.getObjects(fmt.Sprintf("__access__:%d:", blobType)) {
+			if len(data) != 8 {
+				continue
+			}
+			if !yield(csum, binary.LittleEndian.Uint64(data)) {
+				return
+			}
+		}
+	}
+}
+
+// AccessNextMax is how many distinct successors are remembered for a
+// blob: reads interleave when they are done concurrently, a blob is not
+// always followed by the same one.
+const AccessNextMax = 4
+
+const accessNextSize = 4 + len(objects.MAC{})
+
+// AddAccessNext records that the blob next was read right after blob, the
+// oldest successor being forgotten if there are more than AccessNextMax.
+func (c *_RepositoryCache) AddAccessNext(blobType resources.Type, blobCsum objects.MAC, nextType resources.Type, nextCsum objects.MAC) error {
+	key := fmt.Sprintf("%d:%x", blobType, blobCsum)
+
+	data, err := c.get("__access_next__", key)
+	if err != nil {
+		return err
+	}
+
+	successor := binary.LittleEndian.AppendUint32(nil, uint32(nextType))
+	successor = append(successor, nextCsum[:]...)
+
+	// most recent first
+	updated := successor
+	for len(data) >= accessNextSize && len(updated) < AccessNextMax*accessNextSize {
+		if !bytes.Equal(data[:accessNextSize], successor) {
+			updated = append(updated, data[:accessNextSize]...)
+		}
+		data = data[accessNextSize:]
+	}
+	return c.put("__access_next__", key, updated)
+}
+
+// GetAccessNext returns the blobs recorded as read right after blob, most
+// recent first.
+func (c *_RepositoryCache) GetAccessNext(blobType resources.Type, blobCsum objects.MAC) iter.Seq2[resources.Type, objects.MAC] {
+	return func(yield func(resources.Type, objects.MAC) bool) {
+		data, err := c.get("__access_next__", fmt.Sprintf("%d:%x", blobType, blobCsum))
+		if err != nil {
+			return
+		}
+		for ; len(data) >= accessNextSize; data = data[accessNextSize:] {
+			var next objects.MAC
+			copy(next[:], data[4:accessNextSize])
+			if !yield(resources.Type(binary.LittleEndian.Uint32(data)), next) {
+				return
+			}
+		}
+	}
+}
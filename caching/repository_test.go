@@ -0,0 +1,307 @@
+package caching
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeltaByCsum(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	chunk := objects.MAC{1}
+	snapshot := objects.MAC{2}
+	packfile := objects.MAC{3}
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, chunk, packfile, []byte("chunk")))
+	require.NoError(t, cache.PutDelta(resources.RT_SNAPSHOT, snapshot, packfile, []byte("snapshot")))
+
+	data, Type, exists, err := cache.GetDeltaByCsum(chunk)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, resources.RT_CHUNK, Type)
+	require.Equal(t, []byte("chunk"), data)
+
+	data, Type, exists, err = cache.GetDeltaByCsum(snapshot)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, resources.RT_SNAPSHOT, Type)
+	require.Equal(t, []byte("snapshot"), data)
+
+	_, _, exists, err = cache.GetDeltaByCsum(objects.MAC{4})
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func BenchmarkPutDelta(b *testing.B) {
+	const count = 500000
+
+	data := make([]byte, 64)
+	mac := func(i int) objects.MAC {
+		var ret objects.MAC
+		binary.LittleEndian.PutUint64(ret[:], uint64(i))
+		return ret
+	}
+
+	b.Run("single", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			manager := NewManager(b.TempDir())
+			cache, err := manager.Repository(uuid.New())
+			require.NoError(b, err)
+
+			for i := 0; i < count; i++ {
+				require.NoError(b, cache.PutDelta(resources.RT_CHUNK, mac(i), objects.MAC{}, data))
+			}
+			manager.Close()
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			manager := NewManager(b.TempDir())
+			cache, err := manager.Repository(uuid.New())
+			require.NoError(b, err)
+
+			batch := cache.NewDeltaBatch()
+			for i := 0; i < count; i++ {
+				batch.PutDelta(resources.RT_CHUNK, mac(i), objects.MAC{}, data)
+				if batch.Len() >= 10000 {
+					require.NoError(b, batch.Flush())
+				}
+			}
+			require.NoError(b, batch.Flush())
+			manager.Close()
+		}
+	})
+}
+
+func TestDeltaBatch(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	batch := cache.NewDeltaBatch()
+	data := []byte("first")
+	batch.PutDelta(resources.RT_CHUNK, objects.MAC{1}, objects.MAC{3}, data)
+	copy(data, "reuse")
+	batch.PutDelta(resources.RT_OBJECT, objects.MAC{2}, objects.MAC{3}, data)
+	require.Equal(t, 2, batch.Len())
+
+	_, _, exists, err := cache.GetDeltaByCsum(objects.MAC{1})
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, batch.Flush())
+	require.Equal(t, 0, batch.Len())
+
+	value, Type, exists, err := cache.GetDeltaByCsum(objects.MAC{1})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, resources.RT_CHUNK, Type)
+	require.Equal(t, []byte("first"), value)
+
+	value, Type, exists, err = cache.GetDeltaByCsum(objects.MAC{2})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, resources.RT_OBJECT, Type)
+	require.Equal(t, []byte("reuse"), value)
+}
+
+func TestStats(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	batch := cache.NewDeltaBatch()
+	for i := 0; i < 1000; i++ {
+		var mac objects.MAC
+		binary.LittleEndian.PutUint64(mac[:], uint64(i))
+		batch.PutDelta(resources.RT_CHUNK, mac, objects.MAC{}, make([]byte, 128))
+	}
+	require.NoError(t, batch.Flush())
+	require.NoError(t, cache.PutState(objects.MAC{1}, []byte("state")))
+
+	// data only shows in the on-disk size once it leaves the journal
+	require.NoError(t, cache.Compact())
+
+	stats, err := cache.Stats()
+	require.NoError(t, err)
+	require.NotZero(t, stats.Size)
+
+	keys := map[string]uint64{}
+	for _, prefix := range stats.Prefixes {
+		keys[prefix.Prefix] = prefix.Keys
+	}
+	require.Equal(t, uint64(1000), keys["__delta__"])
+	require.Equal(t, uint64(1), keys["__state__"])
+	require.Equal(t, uint64(0), keys["__packfile__"])
+}
+
+func TestAccessNext(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	collect := func(blob objects.MAC) []objects.MAC {
+		var successors []objects.MAC
+		for Type, mac := range cache.GetAccessNext(resources.RT_OBJECT, blob) {
+			require.Equal(t, resources.RT_CHUNK, Type)
+			successors = append(successors, mac)
+		}
+		return successors
+	}
+
+	blob := objects.MAC{1}
+	require.Empty(t, collect(blob))
+
+	for i := byte(2); i < 2+AccessNextMax; i++ {
+		require.NoError(t, cache.AddAccessNext(resources.RT_OBJECT, blob, resources.RT_CHUNK, objects.MAC{i}))
+	}
+	require.Equal(t, []objects.MAC{{5}, {4}, {3}, {2}}, collect(blob))
+
+	// a known successor moves first, the oldest one is forgotten
+	require.NoError(t, cache.AddAccessNext(resources.RT_OBJECT, blob, resources.RT_CHUNK, objects.MAC{3}))
+	require.NoError(t, cache.AddAccessNext(resources.RT_OBJECT, blob, resources.RT_CHUNK, objects.MAC{6}))
+	require.Equal(t, []objects.MAC{{6}, {3}, {5}, {4}}, collect(blob))
+}
+
+func TestReset(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	// more records than are removed at once
+	batch := cache.NewDeltaBatch()
+	for i := 0; i < 2*resetBatchSize+1; i++ {
+		var mac objects.MAC
+		binary.LittleEndian.PutUint64(mac[:], uint64(i))
+		batch.PutDelta(resources.RT_CHUNK, mac, objects.MAC{}, []byte("chunk"))
+	}
+	require.NoError(t, batch.Flush())
+	require.NoError(t, cache.PutState(objects.MAC{1}, []byte("state")))
+
+	require.NoError(t, cache.Reset())
+
+	stats, err := cache.Stats()
+	require.NoError(t, err)
+	for _, prefix := range stats.Prefixes {
+		require.Zero(t, prefix.Keys, prefix.Prefix)
+	}
+	n, err := cache.CountDeltas(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestMemoryManager(t *testing.T) {
+	manager := NewMemoryManager()
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	require.False(t, cache.HasCookie("some/cookie"))
+	require.NoError(t, cache.PutCookie("some/cookie"))
+	require.True(t, cache.HasCookie("some/cookie"))
+
+	require.NoError(t, cache.PutState(objects.MAC{1}, []byte("state")))
+	data, err := cache.GetState(objects.MAC{1})
+	require.NoError(t, err)
+	require.Equal(t, []byte("state"), data)
+
+	// caches of another repository are distinct
+	other, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	require.False(t, other.HasCookie("some/cookie"))
+	data, err = other.GetState(objects.MAC{1})
+	require.NoError(t, err)
+	require.Nil(t, data)
+}
+
+func TestCountDeltasRecount(t *testing.T) {
+	dir := t.TempDir()
+	repositoryID := uuid.New()
+
+	manager := NewManager(dir)
+	cache, err := manager.Repository(repositoryID)
+	require.NoError(t, err)
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, objects.MAC{1}, objects.MAC{3}, []byte("chunk")))
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, objects.MAC{2}, objects.MAC{3}, []byte("chunk")))
+	manager.Close()
+
+	// the counts saved on close are loaded
+	manager = NewManager(dir)
+	cache, err = manager.Repository(repositoryID)
+	require.NoError(t, err)
+	n, err := cache.CountDeltas(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+
+	// the cache is not closed properly, the counts are not saved
+	require.NoError(t, cache.PutDelta(resources.RT_OBJECT, objects.MAC{1}, objects.MAC{3}, []byte("object")))
+	require.NoError(t, cache.db.Close())
+	manager.Close()
+
+	manager = NewManager(dir)
+	defer manager.Close()
+	cache, err = manager.Repository(repositoryID)
+	require.NoError(t, err)
+
+	n, err = cache.CountDeltas(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+	n, err = cache.CountDeltas(resources.RT_OBJECT)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), n)
+}
+
+func TestCountDeltasConcurrent(t *testing.T) {
+	manager := NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	// the writers put the same deltas, each is counted once
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				var mac objects.MAC
+				binary.LittleEndian.PutUint64(mac[:], uint64(i))
+				require.NoError(t, cache.PutDelta(resources.RT_CHUNK, mac, objects.MAC{}, []byte("chunk")))
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := cache.CountDeltas(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Equal(t, uint64(500), n)
+
+	for i := range 100 {
+		var mac objects.MAC
+		binary.LittleEndian.PutUint64(mac[:], uint64(i))
+		require.NoError(t, cache.DelDelta(resources.RT_CHUNK, mac, objects.MAC{}))
+	}
+	n, err = cache.CountDeltas(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Equal(t, uint64(400), n)
+}
@@ -19,13 +19,18 @@ type ScanCache struct {
 	snapshotID [32]byte
 	manager    *Manager
 	db         *leveldb.DB
+	counter    *deltaCounter
 }
 
 func newScanCache(cacheManager *Manager, snapshotID [32]byte) (*ScanCache, error) {
-	cacheDir := filepath.Join(cacheManager.cacheDir, "scan", fmt.Sprintf("%x", snapshotID))
+	db, err := cacheManager.open("scan", fmt.Sprintf("%x", snapshotID))
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := leveldb.OpenFile(cacheDir, nil)
+	counter, err := newDeltaCounter(db)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -33,11 +38,15 @@ func newScanCache(cacheManager *Manager, snapshotID [32]byte) (*ScanCache, error
 		snapshotID: snapshotID,
 		manager:    cacheManager,
 		db:         db,
+		counter:    counter,
 	}, nil
 }
 
 func (c *ScanCache) Close() error {
 	c.db.Close()
+	if c.manager.inMemory {
+		return nil
+	}
 	return os.RemoveAll(filepath.Join(c.manager.cacheDir, "scan", fmt.Sprintf("%x", c.snapshotID)))
 }
 
@@ -158,7 +167,16 @@ func (c *ScanCache) HasDelta(blobType resources.Type, blobCsum objects.MAC) (boo
 }
 
 func (c *ScanCache) PutDelta(blobType resources.Type, blobCsum, packfile objects.MAC, data []byte) error {
-	return c.put("__delta__", fmt.Sprintf("%d:%x:%x", blobType, blobCsum, packfile), data)
+	return c.counter.put(blobType, blobCsum, packfile, data)
+}
+
+func (c *ScanCache) NewDeltaBatch() *DeltaBatch {
+	return newDeltaBatch(c.counter)
+}
+
+// CountDeltas returns the number of deltas of type blobType in the cache.
+func (c *ScanCache) CountDeltas(blobType resources.Type) (uint64, error) {
+	return c.counter.get(blobType)
 }
 
 func (c *ScanCache) GetDeltasByType(blobType resources.Type) iter.Seq2[objects.MAC, []byte] {
@@ -190,7 +208,7 @@ func (c *ScanCache) GetDeltas() iter.Seq2[objects.MAC, []byte] {
 }
 
 func (c *ScanCache) DelDelta(blobType resources.Type, blobCsum, packfileMAC objects.MAC) error {
-	return c.delete("__delta__", fmt.Sprintf("%d:%x:%x", blobType, blobCsum, packfileMAC))
+	return c.counter.delete(blobType, blobCsum, packfileMAC)
 }
 
 func (c *ScanCache) PutDeleted(blobType resources.Type, blobCsum objects.MAC, data []byte) error {
@@ -20,6 +20,8 @@ type StateCache interface {
 	GetDeltasByType(blobType resources.Type) iter.Seq2[objects.MAC, []byte]
 	GetDeltas() iter.Seq2[objects.MAC, []byte]
 	DelDelta(blobType resources.Type, blobCsum objects.MAC, packfileMAC objects.MAC) error
+	NewDeltaBatch() *DeltaBatch
+	CountDeltas(blobType resources.Type) (uint64, error)
 
 	PutDeleted(blobType resources.Type, blobCsum objects.MAC, data []byte) error
 	HasDeleted(blobType resources.Type, blobCsum objects.MAC) (bool, error)
@@ -0,0 +1,107 @@
+package caching
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// repositoryCachePrefixes lists the kinds of records kept in the
+// repository cache.
+var repositoryCachePrefixes = []string{
+	"__state__",
+	"__delta__",
+	"__deltacount__",
+	"__deleted__",
+	"__packfile__",
+	"__snapshot__",
+	"__configuration__",
+	"__access__",
+	"__access_next__",
+}
+
+// CachePrefixStats describes the records of a kind.  Size is the space
+// used on disk as estimated by LevelDB, it lags behind recent writes.
+type CachePrefixStats struct {
+	Prefix string
+	Keys   uint64
+	Size   uint64
+}
+
+type CacheStats struct {
+	Prefixes []CachePrefixStats
+	Size     uint64
+}
+
+func (c *_RepositoryCache) Stats() (CacheStats, error) {
+	var stats CacheStats
+
+	for _, prefix := range repositoryCachePrefixes {
+		r := util.BytesPrefix([]byte(prefix + ":"))
+
+		var keys uint64
+		iter := c.db.NewIterator(r, nil)
+		for iter.Next() {
+			keys++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return CacheStats{}, err
+		}
+
+		sizes, err := c.db.SizeOf([]util.Range{*r})
+		if err != nil {
+			return CacheStats{}, err
+		}
+
+		stats.Prefixes = append(stats.Prefixes, CachePrefixStats{
+			Prefix: prefix,
+			Keys:   keys,
+			Size:   uint64(sizes.Sum()),
+		})
+		stats.Size += uint64(sizes.Sum())
+	}
+
+	return stats, nil
+}
+
+// Compact rewrites the whole cache, reclaiming the space of the records
+// that were overwritten or deleted.
+func (c *_RepositoryCache) Compact() error {
+	return c.db.CompactRange(util.Range{})
+}
+
+// resetBatchSize bounds the records removed at once by Reset.
+const resetBatchSize = 1000
+
+// Reset removes every record from the cache, which is then refilled from
+// the repository states.  The records are removed in batches, so that a
+// large cache isn't held in memory: if it fails, some records may remain.
+func (c *_RepositoryCache) Reset() error {
+	err := c.deleteAll()
+
+	// recount what is left, nothing unless deleting failed
+	if cerr := c.counter.reset(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *_RepositoryCache) deleteAll() error {
+	iter := c.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+		if batch.Len() == resetBatchSize {
+			if err := c.db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return c.db.Write(batch, nil)
+}
@@ -0,0 +1,79 @@
+package caching
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// DeltaDecoder decodes a delta record and returns the type, blob and
+// packfile it describes.  The cache can't decode the records itself, their
+// format belongs to the state package.
+type DeltaDecoder func(data []byte) (resources.Type, objects.MAC, objects.MAC, error)
+
+// parseDeltaKey splits a "__delta__:type:blob:packfile" key.
+func parseDeltaKey(key []byte) (resources.Type, objects.MAC, objects.MAC, error) {
+	var blob, packfile objects.MAC
+
+	parts := bytes.Split(key, []byte(":"))
+	if len(parts) != 4 || string(parts[0]) != "__delta__" {
+		return 0, blob, packfile, fmt.Errorf("malformed key")
+	}
+
+	typ, err := strconv.ParseUint(string(parts[1]), 10, 32)
+	if err != nil {
+		return 0, blob, packfile, fmt.Errorf("malformed type")
+	}
+
+	if n, err := hex.Decode(blob[:], parts[2]); err != nil || n != len(blob) {
+		return 0, blob, packfile, fmt.Errorf("malformed blob")
+	}
+	if n, err := hex.Decode(packfile[:], parts[3]); err != nil || n != len(packfile) {
+		return 0, blob, packfile, fmt.Errorf("malformed packfile")
+	}
+
+	return resources.Type(typ), blob, packfile, nil
+}
+
+// Verify decodes every delta record and reports those that can't be
+// decoded or that don't describe the blob they are recorded under.  The
+// returned error is set if the cache itself couldn't be walked.
+func (c *_RepositoryCache) Verify(decode DeltaDecoder) ([]error, error) {
+	var problems []error
+
+	iter := c.db.NewIterator(util.BytesPrefix([]byte("__delta__:")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := string(iter.Key())
+
+		keyType, keyBlob, keyPackfile, err := parseDeltaKey(iter.Key())
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+
+		typ, blob, packfile, err := decode(iter.Value())
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: failed to decode entry: %w", key, err))
+			continue
+		}
+
+		if typ != keyType {
+			problems = append(problems, fmt.Errorf("%s: entry has type %s", key, typ))
+		}
+		if blob != keyBlob {
+			problems = append(problems, fmt.Errorf("%s: entry has blob %x", key, blob))
+		}
+		if packfile != keyPackfile {
+			problems = append(problems, fmt.Errorf("%s: entry has packfile %x", key, packfile))
+		}
+	}
+
+	return problems, iter.Error()
+}
@@ -2,7 +2,6 @@ package caching
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -14,9 +13,7 @@ type _VFSCache struct {
 }
 
 func newVFSCache(cacheManager *Manager, repositoryID uuid.UUID, scheme string, origin string) (*_VFSCache, error) {
-	cacheDir := filepath.Join(cacheManager.cacheDir, "vfs", repositoryID.String(), scheme, origin)
-
-	db, err := leveldb.OpenFile(cacheDir, nil)
+	db, err := cacheManager.open("vfs", repositoryID.String(), scheme, origin)
 	if err != nil {
 		return nil, err
 	}
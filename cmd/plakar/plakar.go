@@ -23,6 +23,7 @@ import (
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/tracing"
 	"github.com/PlakarKorp/plakar/versioning"
 	"github.com/denisbrodbeck/machineid"
 	"github.com/google/uuid"
@@ -38,11 +39,14 @@ import (
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/ftp"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/s3"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/sftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/tar"
 
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/ftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/null"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/s3"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/sftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/tar"
 
 	_ "github.com/PlakarKorp/plakar/classifier/backend/noop"
 )
@@ -107,6 +111,9 @@ func entryPoint() int {
 	var opt_quiet bool
 	var opt_keyfile string
 	var opt_agentless bool
+	var opt_accessStats bool
+	var opt_otelEndpoint string
+	var opt_strictSignatures bool
 
 	flag.StringVar(&opt_configfile, "config", opt_configDefault, "configuration file")
 	flag.IntVar(&opt_cpuCount, "cpu", opt_cpuDefault, "limit the number of usable cores")
@@ -119,6 +126,9 @@ func entryPoint() int {
 	flag.BoolVar(&opt_quiet, "quiet", false, "no output except errors")
 	flag.StringVar(&opt_keyfile, "keyfile", "", "use passphrase from key file when prompted")
 	flag.BoolVar(&opt_agentless, "no-agent", false, "run without agent")
+	flag.BoolVar(&opt_accessStats, "access-stats", false, "record blob access statistics in the cache")
+	flag.StringVar(&opt_otelEndpoint, "otel-endpoint", "", "export OpenTelemetry traces to this OTLP/HTTP endpoint")
+	flag.BoolVar(&opt_strictSignatures, "strict-signatures", false, "fail on snapshots not signed by a trusted key")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTIONS] [at REPOSITORY] COMMAND [COMMAND_OPTIONS]...\n", flag.CommandLine.Name())
@@ -144,6 +154,12 @@ func entryPoint() int {
 	}
 	ctx.Config = cfg
 
+	ctx.TrustedKeys, err = cfg.GetTrustedKeys()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: could not load trusted keys: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	}
+
 	ctx.Client = "plakar/" + utils.GetVersion()
 	ctx.CWD = cwd
 	ctx.KeyringDir = filepath.Join(opt_userDefault.HomeDir, ".plakar-keyring")
@@ -153,6 +169,21 @@ func entryPoint() int {
 		opt_agentless = true
 	}
 
+	// these are forwarded to the agent along with the command, the
+	// process running the command records the access counters and spans.
+	ctx.StrictSignatures = opt_strictSignatures
+	ctx.AccessStats = opt_accessStats
+
+	var spanExporter tracing.Exporter
+	if opt_otelEndpoint != "" {
+		spanExporter, err = tracing.NewOTLPExporter(opt_otelEndpoint, "plakar")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: invalid -otel-endpoint: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		ctx.OTelEndpoint = opt_otelEndpoint
+	}
+
 	cacheSubDir := "plakar"
 	if opt_agentless {
 		cacheSubDir = "plakar-agentless"
@@ -251,6 +282,10 @@ func entryPoint() int {
 
 	ctx.SetLogger(logger)
 
+	if spanExporter != nil {
+		ctx.SetTracer(tracing.NewTracer(spanExporter, logger))
+	}
+
 	var repositoryPath string
 
 	command, args := flag.Args()[0], flag.Args()[1:]
@@ -313,6 +348,12 @@ func entryPoint() int {
 		return retval
 	}
 
+	repoMode, err := repository.ModeFromConfig(storeConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	}
+
 	store, serializedConfig, err := storage.Open(storeConfig)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: failed to open the repository at %s: %s\n", flag.CommandLine.Name(), storeConfig["location"], err)
@@ -403,6 +444,8 @@ func entryPoint() int {
 		}
 	}
 
+	repo.SetMode(repoMode)
+
 	// commands below all operate on an open repository
 	t0 := time.Now()
 
@@ -435,6 +478,7 @@ func entryPoint() int {
 				}
 				return 1
 			}
+			repo.SetMode(repoMode)
 
 			status, err = cmd.Execute(ctx, repo)
 		}
@@ -456,6 +500,11 @@ func entryPoint() int {
 		logger.Warn("could not close repository: %s", err)
 	}
 
+	err = ctx.GetTracer().Close()
+	if err != nil {
+		logger.Warn("could not export traces: %s", err)
+	}
+
 	ctx.Close()
 
 	if opt_time {
@@ -4,6 +4,7 @@ import (
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/agent"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/archive"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cache"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cat"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/check"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clone"
@@ -13,16 +14,27 @@ import (
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diff"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/digest"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exec"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exportcatalog"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/find"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/fsck"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/help"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/info"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/layout"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/locate"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ls"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/maintenance"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/mount"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/packfile"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/prune"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restoreimage"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/server"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/stats"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/tag"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ui"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/verify"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/version"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/xattr"
 )
@@ -36,6 +36,7 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/archive"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/backup"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cache"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cat"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/check"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clone"
@@ -43,22 +44,34 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diff"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/digest"
 	cmd_exec "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exec"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exportcatalog"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/find"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/fsck"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/info"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/layout"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/locate"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ls"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/maintenance"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/mount"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/packfile"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/prune"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restoreimage"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/server"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/stats"
 	cmd_sync "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/tag"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ui"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/verify"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/xattr"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/scheduler"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/tracing"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/vmihailenco/msgpack/v5"
 )
@@ -346,7 +359,7 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 			logger.EnableInfo()
 			clientContext.SetLogger(logger)
 
-			name, storeConfig, request, err := subcommands.DecodeRPC(decoder)
+			name, storeConfig, request, rpcContext, err := subcommands.DecodeRPC(decoder)
 			if err != nil {
 				if isDisconnectError(err) {
 					fmt.Fprintf(os.Stderr, "Client disconnected during initial request\n")
@@ -376,6 +389,17 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &AgentStop{}
 				os.Exit(0)
+			case (&cache.Cache{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand cache.Cache
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&cat.Cat{}).Name():
 				var cmd struct {
 					Name       string
@@ -442,6 +466,17 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&info.InfoUsage{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand info.InfoUsage
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&diag.DiagContentType{}).Name():
 				var cmd struct {
 					Name       string
@@ -563,6 +598,28 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&diag.DiagBlobs{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand diag.DiagBlobs
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&diag.DiagAccess{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand diag.DiagAccess
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&rm.Rm{}).Name():
 				var cmd struct {
 					Name       string
@@ -618,6 +675,39 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&layout.Layout{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand layout.Layout
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&packfile.PackfileShow{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand packfile.PackfileShow
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&packfile.PackfileRefs{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand packfile.PackfileRefs
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&clone.Clone{}).Name():
 				var cmd struct {
 					Name       string
@@ -662,6 +752,39 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&exportcatalog.ExportCatalog{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand exportcatalog.ExportCatalog
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&find.Find{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand find.Find
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&fsck.Fsck{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand fsck.Fsck
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&mount.Mount{}).Name():
 				var cmd struct {
 					Name       string
@@ -684,6 +807,17 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&restoreimage.RestoreImage{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand restoreimage.RestoreImage
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&server.Server{}).Name():
 				var cmd struct {
 					Name       string
@@ -706,6 +840,39 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.SourceRepositorySecret
+			case (&prune.Prune{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand prune.Prune
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&stats.Stats{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand stats.Stats
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&tag.Tag{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand tag.Tag
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			case (&ui.Ui{}).Name():
 				var cmd struct {
 					Name       string
@@ -717,6 +884,28 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				}
 				subcommand = &cmd.Subcommand
 				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&verify.Verify{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand verify.Verify
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
+			case (&xattr.Xattr{}).Name():
+				var cmd struct {
+					Name       string
+					Subcommand xattr.Xattr
+				}
+				if err := msgpack.Unmarshal(request, &cmd); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to decode client request: %s\n", err)
+					return
+				}
+				subcommand = &cmd.Subcommand
+				repositorySecret = cmd.Subcommand.RepositorySecret
 			}
 
 			var repo *repository.Repository
@@ -725,6 +914,25 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				clientContext.SetSecret(repositorySecret)
 			}
 
+			// the command runs with the global options of the client
+			rpcContext.Apply(clientContext)
+			var tracer *tracing.Tracer
+			if rpcContext.OTelEndpoint != "" {
+				spanExporter, err := tracing.NewOTLPExporter(rpcContext.OTelEndpoint, "plakar")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to create span exporter: %s\n", err)
+					return
+				}
+				tracer = tracing.NewTracer(spanExporter, logger)
+				clientContext.SetTracer(tracer)
+			}
+
+			repoMode, err := repository.ModeFromConfig(storeConfig)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to open repository: %s\n", err)
+				return
+			}
+
 			store, serializedConfig, err := storage.Open(storeConfig)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to open storage: %s\n", err)
@@ -738,6 +946,7 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 				return
 			}
 			defer repo.Close()
+			repo.SetMode(repoMode)
 
 			eventsDone := make(chan struct{})
 			eventsChan := clientContext.Events().Listen()
@@ -759,6 +968,12 @@ func (cmd *Agent) ListenAndServe(ctx *appcontext.AppContext) error {
 
 			status, err := subcommand.Execute(clientContext, repo)
 
+			if tracer != nil {
+				if err := tracer.Close(); err != nil {
+					logger.Warn("could not export traces: %s", err)
+				}
+			}
+
 			if status == 0 {
 				SuccessInc(subcommand.Name())
 			} else if status == 1 {
@@ -47,7 +47,7 @@ func parse_cmd_archive(ctx *appcontext.AppContext, args []string) (subcommands.S
 
 	flags.StringVar(&opt_output, "output", "", "archive pathname")
 	flags.BoolVar(&opt_rebase, "rebase", false, "strip pathname when pulling")
-	flags.StringVar(&opt_format, "format", "tarball", "archive format: tar, tarball, zip")
+	flags.StringVar(&opt_format, "format", "tarball", "archive format: tar, tarball, zip, concat")
 	flags.Parse(args)
 
 	if flags.NArg() == 0 {
@@ -58,6 +58,7 @@ func parse_cmd_archive(ctx *appcontext.AppContext, args []string) (subcommands.S
 		"tar":     ".tar",
 		"tarball": ".tar.gz",
 		"zip":     ".zip",
+		"concat":  ".concat",
 	}
 	if _, ok := supportedFormats[opt_format]; !ok {
 		return nil, fmt.Errorf("unsupported format %s", opt_format)
@@ -18,8 +18,11 @@ package backup
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -51,11 +54,18 @@ func (e *excludeFlags) Set(value string) error {
 func parse_cmd_backup(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	var opt_tags string
 	var opt_excludes string
+	var opt_exclude_from string
 	var opt_exclude excludeFlags
+	var opt_cleartext excludeFlags
 	var opt_concurrency uint64
 	var opt_quiet bool
 	var opt_silent bool
 	var opt_check bool
+	var opt_resume bool
+	var opt_deterministic bool
+	var opt_force bool
+	var opt_oneFileSystem bool
+	var opt_skipIfUnchanged bool
 	// var opt_stdio bool
 
 	excludes := []string{}
@@ -64,6 +74,7 @@ func parse_cmd_backup(ctx *appcontext.AppContext, args []string) (subcommands.Su
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] path\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] s3://path\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] tar://archive.tar\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
 		flags.PrintDefaults()
 	}
@@ -71,10 +82,17 @@ func parse_cmd_backup(ctx *appcontext.AppContext, args []string) (subcommands.Su
 	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
 	flags.StringVar(&opt_tags, "tag", "", "tag to assign to this snapshot")
 	flags.StringVar(&opt_excludes, "excludes", "", "path to a file containing newline-separated regex patterns, treated as -exclude")
+	flags.StringVar(&opt_exclude_from, "exclude-from", "", "path to a file containing gitignore-style patterns matched relative to the backup root")
 	flags.Var(&opt_exclude, "exclude", "glob pattern to exclude files, can be specified multiple times to add several exclusion patterns")
+	flags.Var(&opt_cleartext, "cleartext", "glob pattern of public files to store without encryption, can be specified multiple times")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
 	flags.BoolVar(&opt_silent, "silent", false, "suppress ALL output")
 	flags.BoolVar(&opt_check, "check", false, "check the snapshot after creating it")
+	flags.BoolVar(&opt_resume, "resume", false, "checkpoint progress so that an interrupted backup can be resumed by running it again")
+	flags.BoolVar(&opt_deterministic, "deterministic", false, "pack blobs in a canonical order so that identical content yields identical packfiles with -concurrency 1")
+	flags.BoolVar(&opt_force, "force", false, "break the repository lock held by another writer")
+	flags.BoolVar(&opt_oneFileSystem, "one-file-system", false, "skip the entries on another file system than the backup root")
+	flags.BoolVar(&opt_skipIfUnchanged, "skip-if-unchanged", false, "don't create a snapshot if nothing changed since the latest snapshot of the same source")
 	//flags.BoolVar(&opt_stdio, "stdio", false, "output one line per file to stdout instead of the default interactive output")
 	flags.Parse(args)
 
@@ -85,6 +103,12 @@ func parse_cmd_backup(ctx *appcontext.AppContext, args []string) (subcommands.Su
 		excludes = append(excludes, item)
 	}
 
+	for _, item := range opt_cleartext {
+		if _, err := glob.Compile(item); err != nil {
+			return nil, fmt.Errorf("failed to compile cleartext pattern: %s", item)
+		}
+	}
+
 	if opt_excludes != "" {
 		fp, err := os.Open(opt_excludes)
 		if err != nil {
@@ -106,14 +130,34 @@ func parse_cmd_backup(ctx *appcontext.AppContext, args []string) (subcommands.Su
 			return nil, err
 		}
 	}
+
+	excludeList := []string{}
+	if opt_exclude_from != "" {
+		data, err := os.ReadFile(opt_exclude_from)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open exclude-from file: %w", err)
+		}
+		if err := snapshot.NewExcludeList().Load(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		excludeList = strings.Split(string(data), "\n")
+	}
+
 	return &Backup{
 		RepositorySecret: ctx.GetSecret(),
 		Concurrency:      opt_concurrency,
 		Tags:             opt_tags,
 		Excludes:         excludes,
+		ExcludeList:      excludeList,
+		Cleartext:        opt_cleartext,
 		Quiet:            opt_quiet,
 		Path:             flags.Arg(0),
 		OptCheck:         opt_check,
+		Resume:           opt_resume,
+		Deterministic:    opt_deterministic,
+		Force:            opt_force,
+		OneFileSystem:    opt_oneFileSystem,
+		SkipIfUnchanged:  opt_skipIfUnchanged,
 	}, nil
 }
 
@@ -121,13 +165,20 @@ type Backup struct {
 	RepositorySecret []byte
 	Job              string
 
-	Concurrency uint64
-	Tags        string
-	Excludes    []string
-	Silent      bool
-	Quiet       bool
-	Path        string
-	OptCheck    bool
+	Concurrency     uint64
+	Tags            string
+	Excludes        []string
+	ExcludeList     []string
+	Cleartext       []string
+	Silent          bool
+	Quiet           bool
+	Path            string
+	OptCheck        bool
+	Resume          bool
+	Deterministic   bool
+	Force           bool
+	OneFileSystem   bool
+	SkipIfUnchanged bool
 }
 
 func (cmd *Backup) Name() string {
@@ -162,11 +213,35 @@ func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		excludes = append(excludes, g)
 	}
 
+	excludeList := snapshot.NewExcludeList()
+	if err := excludeList.Load(strings.NewReader(strings.Join(cmd.ExcludeList, "\n"))); err != nil {
+		return 1, err
+	}
+
+	cleartext := []glob.Glob{}
+	for _, item := range cmd.Cleartext {
+		g, err := glob.Compile(item)
+		if err != nil {
+			return 1, fmt.Errorf("failed to compile cleartext pattern: %s", item)
+		}
+		cleartext = append(cleartext, g)
+	}
+	if len(cleartext) != 0 && repo.Configuration().Encryption != nil {
+		ctx.GetLogger().Warn("files matching %s are stored unencrypted: their content can be read by anyone with access to the repository storage",
+			strings.Join(cmd.Cleartext, ", "))
+	}
+
 	opts := &snapshot.BackupOptions{
-		MaxConcurrency: cmd.Concurrency,
-		Name:           "default",
-		Tags:           tags,
-		Excludes:       excludes,
+		MaxConcurrency:  cmd.Concurrency,
+		Name:            "default",
+		Tags:            tags,
+		Excludes:        excludes,
+		ExcludeList:     excludeList,
+		Cleartext:       cleartext,
+		Resume:          cmd.Resume,
+		Deterministic:   cmd.Deterministic,
+		ForceLock:       cmd.Force,
+		SkipIfUnchanged: cmd.SkipIfUnchanged,
 	}
 
 	scanDir := ctx.CWD
@@ -185,34 +260,46 @@ func (cmd *Backup) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		if _, ok := remote["location"]; !ok {
 			return 1, fmt.Errorf("could not resolve importer location: %s", scanDir)
 		} else {
-			importerConfig = remote
+			importerConfig = maps.Clone(remote)
 		}
 	}
+	if cmd.OneFileSystem {
+		importerConfig["one_file_system"] = "true"
+	}
 
 	imp, err := importer.NewImporter(importerConfig)
 	if err != nil {
 		if !filepath.IsAbs(scanDir) {
 			scanDir = filepath.Join(ctx.CWD, scanDir)
 		}
-		imp, err = importer.NewImporter(map[string]string{"location": "fs://" + scanDir})
+		importerConfig = map[string]string{"location": "fs://" + scanDir}
+		if cmd.OneFileSystem {
+			importerConfig["one_file_system"] = "true"
+		}
+		imp, err = importer.NewImporter(importerConfig)
 		if err != nil {
 			return 1, fmt.Errorf("failed to create an importer for %s: %s", scanDir, err)
 		}
 	}
 	defer imp.Close()
 
+	if cmd.OneFileSystem && imp.Type() != "fs" {
+		return 1, fmt.Errorf("-one-file-system is not supported by the %s importer", imp.Type())
+	}
+
 	if cmd.Silent {
-		if err := snap.Backup(imp, opts); err != nil {
-			return 1, fmt.Errorf("failed to create snapshot: %w", err)
-		}
+		err = snap.Backup(imp, opts)
 	} else {
 		ep := startEventsProcessor(ctx, imp.Root(), true, cmd.Quiet)
-		if err := snap.Backup(imp, opts); err != nil {
-			ep.Close()
-			return 1, fmt.Errorf("failed to create snapshot: %w", err)
-		}
+		err = snap.Backup(imp, opts)
 		ep.Close()
 	}
+	if errors.Is(err, snapshot.ErrUnchanged) {
+		ctx.GetLogger().Info("%s: %s unchanged since its latest snapshot, skipped", cmd.Name(), imp.Root())
+		return 0, nil
+	} else if err != nil {
+		return 1, fmt.Errorf("failed to create snapshot: %w", err)
+	}
 
 	if cmd.OptCheck {
 		repo.RebuildState()
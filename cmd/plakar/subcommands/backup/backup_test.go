@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -14,7 +16,9 @@ import (
 	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/tar"
 	"github.com/PlakarKorp/plakar/storage"
 	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
 	"github.com/PlakarKorp/plakar/versioning"
@@ -169,3 +173,71 @@ func TestExecuteCmdCreateDefaultWithExcludes(t *testing.T) {
 	lastline := lines[len(lines)-1]
 	require.Contains(t, lastline, "created unsigned snapshot")
 }
+
+func TestExecuteCmdCreateDefaultWithExcludeFrom(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	excludeFrom := filepath.Join(t.TempDir(), "excludes")
+	err := os.WriteFile(excludeFrom, []byte("# excluded\nto_exclude\n/another_subdir/\n"), 0644)
+	require.NoError(t, err)
+	args := []string{"-exclude-from", excludeFrom, tmpBackupDir}
+
+	subcommand, err := parse_cmd_backup(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	require.NoError(t, repo.RebuildState())
+	snapshotIDs := slices.Collect(repo.ListSnapshots())
+	require.Len(t, snapshotIDs, 1)
+	snap, err := snapshot.Load(repo, snapshotIDs[0])
+	require.NoError(t, err)
+	defer snap.Close()
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	_, err = fs.GetEntry(filepath.Join(tmpBackupDir, "subdir/dummy.txt"))
+	require.NoError(t, err)
+	for _, excluded := range []string{"subdir/to_exclude", "another_subdir", "another_subdir/bar"} {
+		_, err = fs.GetEntry(filepath.Join(tmpBackupDir, excluded))
+		require.Error(t, err, excluded)
+	}
+}
+
+func TestExecuteCmdCreateOneFileSystemUnsupported(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, _ := generateFixtures(t, bufOut, bufErr)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	archive := filepath.Join(t.TempDir(), "archive.tar")
+	require.NoError(t, os.WriteFile(archive, nil, 0644))
+	args := []string{"-one-file-system", "tar://" + archive}
+
+	subcommand, err := parse_cmd_backup(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.EqualError(t, err, "-one-file-system is not supported by the tar importer")
+	require.Equal(t, 1, status)
+
+	require.NoError(t, repo.RebuildState())
+	require.Empty(t, slices.Collect(repo.ListSnapshots()))
+}
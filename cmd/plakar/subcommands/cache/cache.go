@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package cache
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("cache", parse_cmd_cache)
+}
+
+func parse_cmd_cache(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [compact | rebuild]\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 1 || (flags.NArg() == 1 && flags.Arg(0) != "compact" && flags.Arg(0) != "rebuild") {
+		return nil, fmt.Errorf("usage: %s [compact | rebuild]", flags.Name())
+	}
+
+	return &Cache{
+		RepositorySecret: ctx.GetSecret(),
+		Compact:          flags.Arg(0) == "compact",
+		Rebuild:          flags.Arg(0) == "rebuild",
+	}, nil
+}
+
+type Cache struct {
+	RepositorySecret []byte
+
+	Compact bool
+	Rebuild bool
+}
+
+func (cmd *Cache) Name() string {
+	return "cache"
+}
+
+func (cmd *Cache) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	cache, err := repo.AppContext().GetCache().Repository(repo.Configuration().RepositoryID)
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.Rebuild {
+		if err := cache.Reset(); err != nil {
+			return 1, fmt.Errorf("failed to reset the cache: %w", err)
+		}
+		if err := repo.RebuildState(); err != nil {
+			return 1, fmt.Errorf("failed to rebuild the cache: %w", err)
+		}
+		states, err := repo.GetStates()
+		if err != nil {
+			return 1, err
+		}
+		ctx.GetLogger().Info("%s: rebuilt from %d states", cmd.Name(), len(states))
+		return 0, nil
+	}
+
+	before, err := cache.Stats()
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.Compact {
+		if err := cache.Compact(); err != nil {
+			return 1, fmt.Errorf("failed to compact the cache: %w", err)
+		}
+		after, err := cache.Stats()
+		if err != nil {
+			return 1, err
+		}
+		ctx.GetLogger().Info("%s: compacted from %s to %s", cmd.Name(),
+			humanize.IBytes(before.Size), humanize.IBytes(after.Size))
+		return 0, nil
+	}
+
+	for _, prefix := range before.Prefixes {
+		fmt.Fprintf(ctx.Stdout, "%-15s %10d keys %10s\n",
+			strings.Trim(prefix.Prefix, "_"), prefix.Keys, humanize.IBytes(prefix.Size))
+	}
+	fmt.Fprintf(ctx.Stdout, "%-15s %15s %10s\n", "total", "", humanize.IBytes(before.Size))
+	return 0, nil
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCmdCache(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	require.NoError(t, repo.RebuildState())
+
+	_, err := parse_cmd_cache(ctx, []string{"defrag"})
+	require.Error(t, err)
+
+	subcommand, err := parse_cmd_cache(ctx, []string{})
+	require.NoError(t, err)
+	require.Equal(t, "cache", subcommand.(*Cache).Name())
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	keys := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(bufOut.String(), "\n"), "\n") {
+		fields := strings.Fields(line)
+		keys[fields[0]] = fields[1]
+	}
+	require.Contains(t, keys, "total")
+	require.NotEqual(t, "0", keys["delta"])
+	require.NotEqual(t, "0", keys["packfile"])
+
+	subcommand, err = parse_cmd_cache(ctx, []string{"compact"})
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "cache: compacted from")
+}
+
+func TestExecuteCmdCacheRebuild(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	require.NoError(t, repo.RebuildState())
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	var entry *vfs.Entry
+	for e, err := range fs.Files("/") {
+		require.NoError(t, err)
+		if e.Name() == "dummy.txt" {
+			entry = e
+		}
+	}
+	require.NotNil(t, entry)
+	chunk := entry.ResolvedObject.Chunks[0].ContentMAC
+	require.True(t, repo.BlobExists(resources.RT_CHUNK, chunk))
+
+	// lose the content of the cache
+	cache, err := ctx.GetCache().Repository(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	require.NoError(t, cache.Reset())
+	require.False(t, repo.BlobExists(resources.RT_CHUNK, chunk))
+
+	subcommand, err := parse_cmd_cache(ctx, []string{"rebuild"})
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "cache: rebuilt from 1 states")
+
+	require.True(t, repo.BlobExists(resources.RT_CHUNK, chunk))
+	snapshotIDs := slices.Collect(repo.ListSnapshots())
+	require.Equal(t, []objects.MAC{snap.Header.Identifier}, snapshotIDs)
+
+	rd, err := snap.NewReader(entry.Path())
+	require.NoError(t, err)
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(data))
+}
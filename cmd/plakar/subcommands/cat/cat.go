@@ -27,6 +27,8 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/alecthomas/chroma/formatters"
 	"github.com/alecthomas/chroma/lexers"
 	"github.com/alecthomas/chroma/styles"
@@ -39,6 +41,8 @@ func init() {
 func parse_cmd_cat(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	var opt_nodecompress bool
 	var opt_highlight bool
+	var opt_offset int64
+	var opt_length int64
 
 	flags := flag.NewFlagSet("cat", flag.ExitOnError)
 	flags.Usage = func() {
@@ -49,16 +53,26 @@ func parse_cmd_cat(ctx *appcontext.AppContext, args []string) (subcommands.Subco
 
 	flags.BoolVar(&opt_nodecompress, "no-decompress", false, "do not try to decompress output")
 	flags.BoolVar(&opt_highlight, "highlight", false, "highlight output")
+	flags.Int64Var(&opt_offset, "offset", 0, "start output at this byte offset, implies -no-decompress")
+	flags.Int64Var(&opt_length, "length", -1, "output at most this many bytes, implies -no-decompress")
 	flags.Parse(args)
 
 	if flags.NArg() == 0 {
 		return nil, fmt.Errorf("at least one parameter is required")
 	}
+	if opt_offset < 0 {
+		return nil, fmt.Errorf("invalid offset: %d", opt_offset)
+	}
+	if opt_length < -1 {
+		return nil, fmt.Errorf("invalid length: %d", opt_length)
+	}
 
 	return &Cat{
 		RepositorySecret: ctx.GetSecret(),
 		NoDecompress:     opt_nodecompress,
 		Highlight:        opt_highlight,
+		Offset:           opt_offset,
+		Length:           opt_length,
 		Paths:            flags.Args(),
 	}, nil
 }
@@ -68,6 +82,8 @@ type Cat struct {
 
 	NoDecompress bool
 	Highlight    bool
+	Offset       int64
+	Length       int64
 	Paths        []string
 }
 
@@ -78,122 +94,115 @@ func (cmd *Cat) Name() string {
 func (cmd *Cat) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
 	errors := 0
 	for _, snapPath := range cmd.Paths {
-		snap, pathname, err := utils.OpenSnapshotByPath(repo, snapPath)
+		snap, pathnames, err := utils.OpenSnapshotByPattern(repo, snapPath)
 		if err != nil {
 			ctx.GetLogger().Error("cat: %s: %s", snapPath, err)
 			errors++
 			continue
 		}
 
-		if pathname == "" {
-			ctx.GetLogger().Error("cat: missing filename for snapshot")
-			errors++
-			snap.Close()
-			continue
-		}
-
 		fs, err := snap.Filesystem()
 		if err != nil {
-			ctx.GetLogger().Error("cat: %s: %s", pathname, err)
+			ctx.GetLogger().Error("cat: %s: %s", snapPath, err)
 			errors++
 			snap.Close()
 			continue
 		}
 
-		entry, err := fs.GetEntry(pathname)
+		for _, pathname := range pathnames {
+			if err := cmd.cat(ctx, snap, fs, pathname); err != nil {
+				ctx.GetLogger().Error("cat: %s", err)
+				errors++
+			}
+		}
+		snap.Close()
+	}
 
+	if errors != 0 {
+		return 1, fmt.Errorf("errors occurred")
+	}
+	return 0, nil
+}
+
+func (cmd *Cat) cat(ctx *appcontext.AppContext, snap *snapshot.Snapshot, fs *vfs.Filesystem, pathname string) error {
+	entry, err := fs.GetEntry(pathname)
+	if err != nil {
+		return fmt.Errorf("%s: no such file", pathname)
+	}
+
+	if !entry.Stat().Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", pathname)
+	}
+
+	// a range of a compressed file can't be decompressed
+	var file io.ReadCloser
+	ranged := cmd.Offset != 0 || cmd.Length >= 0
+	if ranged {
+		length := cmd.Length
+		if length < 0 {
+			length = entry.Stat().Size()
+		}
+		file, err = snap.ReadRange(pathname, cmd.Offset, length)
 		if err != nil {
-			ctx.GetLogger().Error("cat: %s: no such file", pathname)
-			errors++
-			snap.Close()
-			continue
+			return fmt.Errorf("%s: %w", pathname, err)
 		}
-
-		if !entry.Stat().Mode().IsRegular() {
-			ctx.GetLogger().Error("cat: %s: not a regular file", pathname)
-			errors++
-			snap.Close()
-			continue
+	} else {
+		file = entry.Open(fs, pathname)
+	}
+	defer file.Close()
+	var rd io.Reader = file
+
+	if !cmd.NoDecompress && !ranged {
+		if entry.ResolvedObject.ContentType == "application/gzip" {
+			gzRd, err := gzip.NewReader(rd)
+			if err != nil {
+				return fmt.Errorf("%s: %w", pathname, err)
+			}
+			rd = gzRd
 		}
+	}
 
-		file := entry.Open(fs, pathname)
-		var rd io.ReadCloser = file
-
-		if !cmd.NoDecompress {
-			if entry.ResolvedObject.ContentType == "application/gzip" && !cmd.NoDecompress {
-				gzRd, err := gzip.NewReader(rd)
-				if err != nil {
-					ctx.GetLogger().Error("cat: %s: %s", pathname, err)
-					errors++
-					file.Close()
-					snap.Close()
-					continue
-				}
-				rd = gzRd
-			}
+	if !cmd.Highlight {
+		if _, err := io.Copy(ctx.Stdout, rd); err != nil {
+			return fmt.Errorf("%s: %w", pathname, err)
 		}
+		return nil
+	}
 
-		if cmd.Highlight {
-			lexer := lexers.Match(pathname)
-			if lexer == nil {
-				lexer = lexers.Get(entry.ResolvedObject.ContentType)
-			}
-			if lexer == nil {
-				lexer = lexers.Fallback // Fallback if no lexer is found
+	lexer := lexers.Match(pathname)
+	if lexer == nil {
+		lexer = lexers.Get(entry.ResolvedObject.ContentType)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback // Fallback if no lexer is found
+	}
+	formatter := formatters.Get("terminal")
+	style := styles.Get("dracula")
+
+	reader := bufio.NewReader(rd)
+	buffer := make([]byte, 4096) // Fixed-size buffer for chunked reading
+	for {
+		n, err := reader.Read(buffer) // Read up to the size of the buffer
+		if n > 0 {
+			chunk := string(buffer[:n])
+
+			// Tokenize the chunk and apply syntax highlighting
+			iterator, errTokenize := lexer.Tokenise(nil, chunk)
+			if errTokenize != nil {
+				return fmt.Errorf("%s: %w", pathname, errTokenize)
 			}
-			formatter := formatters.Get("terminal")
-			style := styles.Get("dracula")
-
-			reader := bufio.NewReader(rd)
-			buffer := make([]byte, 4096) // Fixed-size buffer for chunked reading
-			for {
-				n, err := reader.Read(buffer) // Read up to the size of the buffer
-				if n > 0 {
-					chunk := string(buffer[:n])
-
-					// Tokenize the chunk and apply syntax highlighting
-					iterator, errTokenize := lexer.Tokenise(nil, chunk)
-					if errTokenize != nil {
-						ctx.GetLogger().Error("cat: %s: %s", pathname, errTokenize)
-						errors++
-						snap.Close()
-						break
-					}
-
-					errFormat := formatter.Format(ctx.Stdout, style, iterator)
-					if errFormat != nil {
-						ctx.GetLogger().Error("cat: %s: %s", pathname, errFormat)
-						errors++
-						snap.Close()
-						break
-					}
-				}
-
-				// Check for end of file (EOF)
-				if err == io.EOF {
-					break
-				} else if err != nil {
-					ctx.GetLogger().Error("cat: %s: %s", pathname, err)
-					errors++
-					snap.Close()
-					break
-				}
+
+			errFormat := formatter.Format(ctx.Stdout, style, iterator)
+			if errFormat != nil {
+				return fmt.Errorf("%s: %w", pathname, errFormat)
 			}
-		} else {
-			_, err = io.Copy(ctx.Stdout, rd)
-		}
-		file.Close()
-		if err != nil {
-			ctx.GetLogger().Error("cat: %s: %s", pathname, err)
-			errors++
-			snap.Close()
-			continue
 		}
-		snap.Close()
-	}
 
-	if errors != 0 {
-		return 1, fmt.Errorf("errors occurred")
+		// Check for end of file (EOF)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", pathname, err)
+		}
 	}
-	return 0, nil
 }
@@ -130,6 +130,100 @@ func TestExecuteCmdCatDefault(t *testing.T) {
 	require.Equal(t, "hello dummy", output)
 }
 
+func TestExecuteCmdCatMultiple(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	snapshotID := hex.EncodeToString(snap.Header.GetIndexShortID())
+	args := []string{
+		fmt.Sprintf("%s:%s/subdir/dummy.txt", snapshotID, tmpBackupDir),
+		fmt.Sprintf("%s:%s/subdir", snapshotID, tmpBackupDir),
+		fmt.Sprintf("%s:%s/another_subdir/bar", snapshotID, tmpBackupDir),
+	}
+
+	subcommand, err := parse_cmd_cat(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	// the directory is reported, the files are still output in order
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Equal(t, "hello dummyhello bar", bufOut.String())
+	require.Contains(t, bufErr.String(), fmt.Sprintf("cat: %s/subdir: not a regular file", tmpBackupDir))
+}
+
+func TestExecuteCmdCatGlob(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+	err := os.WriteFile(tmpBackupDir+"/subdir/file[1].md", []byte("hello literal"), 0644)
+	require.NoError(t, err)
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	snapshotID := hex.EncodeToString(snap.Header.GetIndexShortID())
+
+	// matches are output in sorted order, subdir/to_exclude is left out
+	subcommand, err := parse_cmd_cat(ctx, []string{snapshotID + ":subdir/*.txt"})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, "hello dummyhello foo", bufOut.String())
+
+	// an existing pathname is not taken as a pattern
+	bufOut.Reset()
+	subcommand, err = parse_cmd_cat(ctx, []string{snapshotID + ":subdir/file[1].md"})
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, "hello literal", bufOut.String())
+
+	bufOut.Reset()
+	subcommand, err = parse_cmd_cat(ctx, []string{snapshotID + ":subdir/*.csv"})
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Empty(t, bufOut.String())
+	require.Contains(t, bufErr.String(), fmt.Sprintf("%s/subdir/*.csv: no matching file", tmpBackupDir))
+}
+
 func TestExecuteCmdCatErrorAmbiguous(t *testing.T) {
 	bufOut := bytes.NewBuffer(nil)
 	bufErr := bytes.NewBuffer(nil)
@@ -303,3 +397,50 @@ func TestExecuteCmdCatHighlight(t *testing.T) {
 	output := bufOut.String()
 	require.Equal(t, "\x1b[1m\x1b[37mhello dummy\x1b[0m", output)
 }
+
+func TestExecuteCmdCatRange(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// create a snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--offset", "6", "--length", "3"}, "dum"},
+		{[]string{"-offset", "6"}, "dummy"},
+		{[]string{"-length", "5"}, "hello"},
+		{[]string{"-offset", "100"}, ""},
+	}
+	for _, test := range tests {
+		bufOut.Reset()
+		subcommand, err := parse_cmd_cat(ctx, append(test.args, tmpBackupDir+"/subdir/dummy.txt"))
+		require.NoError(t, err)
+
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+		require.Equal(t, test.expected, bufOut.String())
+	}
+
+	_, err = parse_cmd_cat(ctx, []string{"-offset", "-1", tmpBackupDir + "/subdir/dummy.txt"})
+	require.EqualError(t, err, "invalid offset: -1")
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/google/uuid"
 )
@@ -49,6 +50,8 @@ func parse_cmd_check(ctx *appcontext.AppContext, args []string) (subcommands.Sub
 	var opt_noVerify bool
 	var opt_quiet bool
 	var opt_silent bool
+	var opt_roots bool
+	var opt_cache bool
 
 	flags := flag.NewFlagSet("check", flag.ExitOnError)
 	flags.Usage = func() {
@@ -69,6 +72,8 @@ func parse_cmd_check(ctx *appcontext.AppContext, args []string) (subcommands.Sub
 	flags.BoolVar(&opt_latest, "latest", false, "use latest snapshot")
 	flags.BoolVar(&opt_noVerify, "no-verify", false, "disable signature verification")
 	flags.BoolVar(&opt_fastCheck, "fast", false, "enable fast checking (no digest verification)")
+	flags.BoolVar(&opt_roots, "roots", false, "only check that snapshot headers reference existing roots")
+	flags.BoolVar(&opt_cache, "cache", false, "only check the consistency of the local cache of the repository state")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
 	flags.BoolVar(&opt_quiet, "silent", false, "suppress ALL output")
 	flags.Parse(args)
@@ -113,6 +118,8 @@ func parse_cmd_check(ctx *appcontext.AppContext, args []string) (subcommands.Sub
 
 		Concurrency: opt_concurrency,
 		FastCheck:   opt_fastCheck,
+		RootsOnly:   opt_roots,
+		CacheOnly:   opt_cache,
 		NoVerify:    opt_noVerify,
 		Quiet:       opt_quiet,
 		Snapshots:   flags.Args(),
@@ -136,6 +143,8 @@ type Check struct {
 
 	Concurrency uint64
 	FastCheck   bool
+	RootsOnly   bool
+	CacheOnly   bool
 	NoVerify    bool
 	Quiet       bool
 	Snapshots   []string
@@ -147,6 +156,10 @@ func (cmd *Check) Name() string {
 }
 
 func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.CacheOnly {
+		return cmd.checkCache(ctx, repo)
+	}
+
 	if !cmd.Silent {
 		go eventsProcessorStdio(ctx, cmd.Quiet)
 	}
@@ -223,15 +236,29 @@ func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 			} else if !ok {
 				ctx.GetLogger().Info("snapshot %x signature verification failed", snap.Header.Identifier)
 				failures = true
+			} else if !snap.Trusted() {
+				ctx.GetLogger().Info("snapshot %x is signed by an untrusted key", snap.Header.Identifier)
+				failures = true
 			} else {
 				ctx.GetLogger().Info("snapshot %x signature verification succeeded", snap.Header.Identifier)
 			}
 		}
 
-		if ok, err := snap.Check(pathname, opts); err != nil {
-			ctx.GetLogger().Warn("%s", err)
-		} else if !ok {
+		if dangling := snap.DanglingRoots(); len(dangling) != 0 {
+			for _, name := range dangling {
+				ctx.GetLogger().Warn("snapshot %x has a dangling %s reference", snap.Header.GetIndexShortID(), name)
+			}
 			failures = true
+			snap.Close()
+			continue
+		}
+
+		if !cmd.RootsOnly {
+			if ok, err := snap.Check(pathname, opts); err != nil {
+				ctx.GetLogger().Warn("%s", err)
+			} else if !ok {
+				failures = true
+			}
 		}
 
 		if !failures {
@@ -250,3 +277,29 @@ func (cmd *Check) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 
 	return 0, nil
 }
+
+// checkCache verifies that every delta record of the repository cache
+// decodes and describes the blob it is recorded under.
+func (cmd *Check) checkCache(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	cache, err := ctx.GetCache().Repository(repo.Configuration().RepositoryID)
+	if err != nil {
+		return 1, err
+	}
+
+	problems, err := cache.Verify(state.DecodeDeltaKey)
+	if err != nil {
+		return 1, err
+	}
+
+	for _, problem := range problems {
+		ctx.GetLogger().Warn("%s: cache: %s", cmd.Name(), problem)
+	}
+	if len(problems) != 0 {
+		return 1, fmt.Errorf("check failed: %d corrupted cache entries", len(problems))
+	}
+
+	if !cmd.Silent {
+		ctx.GetLogger().Info("%s: verification of the cache completed successfully", cmd.Name())
+	}
+	return 0, nil
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	ptesting "github.com/PlakarKorp/plakar/testing"
@@ -112,3 +114,35 @@ func TestExecuteCmdCheckSpecificSnapshot(t *testing.T) {
 	lastline := lines[len(lines)-1]
 	require.Contains(t, lastline, fmt.Sprintf("info: check: verification of %s:%s completed successfully", hex.EncodeToString(snap.Header.GetIndexShortID()[:]), snap.Header.GetSource(0).Importer.Directory))
 }
+
+func TestExecuteCmdCheckCache(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	subcommand, err := parse_cmd_check(ctx, []string{"-cache"})
+	require.NoError(t, err)
+	require.True(t, subcommand.(*Check).CacheOnly)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "info: check: verification of the cache completed successfully")
+
+	cache, err := ctx.GetCache().Repository(repo.Configuration().RepositoryID)
+	require.NoError(t, err)
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, objects.MAC{1}, objects.MAC{2}, []byte("garbage")))
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), fmt.Sprintf("__delta__:%d:%x:%x: failed to decode entry", resources.RT_CHUNK, objects.MAC{1}, objects.MAC{2}))
+}
@@ -23,15 +23,19 @@ import (
 	"hash"
 	"io"
 	"os"
-	"sync"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
@@ -41,27 +45,37 @@ func init() {
 func parse_cmd_clone(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	flags := flag.NewFlagSet("clone", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s to /path/to/repository\n", flags.Name())
-		fmt.Fprintf(flags.Output(), "       %s to s3://bucket/path\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s to /path/to/repository [SNAPSHOT]...\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s to s3://bucket/path [SNAPSHOT]...\n", flags.Name())
 		flags.PrintDefaults()
 	}
 
+	var opt_concurrency uint64
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel transfers")
 	flags.Parse(args)
 
-	if flags.NArg() != 2 || flags.Arg(0) != "to" {
+	if opt_concurrency == 0 {
+		return nil, fmt.Errorf("invalid concurrency: 0")
+	}
+
+	if flags.NArg() < 2 || flags.Arg(0) != "to" {
 		return nil, fmt.Errorf("usage: %s to <repository>. See '%s -h' or 'help %s'", flags.Name(), flags.Name(), flags.Name())
 	}
 
 	return &Clone{
 		RepositorySecret: ctx.GetSecret(),
+		Concurrency:      opt_concurrency,
 		Dest:             flags.Arg(1),
+		Snapshots:        flags.Args()[2:],
 	}, nil
 }
 
 type Clone struct {
 	RepositorySecret []byte
 
-	Dest string
+	Concurrency uint64
+	Dest        string
+	Snapshots   []string
 }
 
 func (cmd *Clone) Name() string {
@@ -101,62 +115,242 @@ func (cmd *Clone) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 		return 1, err
 	}
 
-	cloneStore, err := storage.Create(storeConfig, wrappedSerializedConfig)
+	cloneStore, err := openClone(storeConfig, wrappedSerializedConfig, configuration)
 	if err != nil {
-		return 1, fmt.Errorf("could not create repository: %w", err)
+		return 1, err
 	}
 
-	packfileMACs, err := sourceStore.GetPackfiles()
+	// packfiles and states are immutable once written, those already
+	// present come from a previous clone and don't need to be copied again
+	clonePackfiles, err := cloneStore.GetPackfiles()
+	if err != nil {
+		return 1, fmt.Errorf("could not get packfiles list from clone: %w", err)
+	}
+	cloneStates, err := cloneStore.GetStates()
 	if err != nil {
-		return 1, fmt.Errorf("could not get packfiles list from repository: %w", err)
+		return 1, fmt.Errorf("could not get states list from clone: %w", err)
 	}
 
-	wg := sync.WaitGroup{}
-	for _, _packfileMAC := range packfileMACs {
-		wg.Add(1)
-		go func(packfileMAC objects.MAC) {
-			defer wg.Done()
+	var packfileMACs []objects.MAC
+	var deltas []state.DeltaEntry
+	if len(cmd.Snapshots) == 0 {
+		packfileMACs, err = sourceStore.GetPackfiles()
+		if err != nil {
+			return 1, fmt.Errorf("could not get packfiles list from repository: %w", err)
+		}
+	} else {
+		packfileMACs, deltas, err = cmd.selectSnapshots(repo)
+		if err != nil {
+			return 1, err
+		}
+	}
 
-			rd, err := sourceStore.GetPackfile(packfileMAC)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "could not get packfile from repository: %s\n", err)
-				return
+	t := newTransfers(cmd.Concurrency)
+
+	missingPackfiles, skippedPackfiles := missing(packfileMACs, clonePackfiles)
+	t.run(missingPackfiles, func(packfileMAC objects.MAC) (int64, error) {
+		prd := newPackfileReader(repo, sourceStore, packfileMAC)
+		defer prd.Close()
+
+		crd := &countingReader{rd: prd}
+		if err := cloneStore.PutPackfile(packfileMAC, crd); err != nil {
+			if prd.err != nil && prd.err != io.EOF {
+				ctx.GetLogger().Error("%s: could not get packfile %x from repository: %s", cmd.Name(), packfileMAC, err)
+			} else {
+				ctx.GetLogger().Error("%s: could not put packfile %x to repository: %s", cmd.Name(), packfileMAC, err)
 			}
+			return crd.n, err
+		}
+		return crd.n, nil
+	})
+	packfiles := t.done()
+
+	var states transferStats
+	var skippedStates int
+	if len(cmd.Snapshots) != 0 {
+		states.transferred = 1
+		if err := putSelectedState(ctx, repo, cloneStore, packfileMACs, deltas); err != nil {
+			ctx.GetLogger().Error("%s: could not put state to repository: %s", cmd.Name(), err)
+			states = transferStats{failed: 1}
+		}
+	} else {
+		indexesMACs, err := sourceStore.GetStates()
+		if err != nil {
+			return 1, fmt.Errorf("could not get states list from repository: %w", err)
+		}
 
-			err = cloneStore.PutPackfile(packfileMAC, rd)
+		var missingStates []objects.MAC
+		missingStates, skippedStates = missing(indexesMACs, cloneStates)
+		t.run(missingStates, func(indexMAC objects.MAC) (int64, error) {
+			data, err := sourceStore.GetState(indexMAC)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "could not put packfile to repository: %s\n", err)
-				return
+				ctx.GetLogger().Error("%s: could not get state %x from repository: %s", cmd.Name(), indexMAC, err)
+				return 0, err
+			}
+
+			crd := &countingReader{rd: data}
+			if err := cloneStore.PutState(indexMAC, crd); err != nil {
+				ctx.GetLogger().Error("%s: could not put state %x to repository: %s", cmd.Name(), indexMAC, err)
+				return crd.n, err
 			}
-		}(_packfileMAC)
+			return crd.n, nil
+		})
+		states = t.done()
 	}
-	wg.Wait()
 
-	indexesMACs, err := sourceStore.GetStates()
+	fmt.Fprintf(ctx.Stdout, "%s: %d packfiles and %d states transferred (%s), %d packfiles and %d states failed, %d packfiles and %d states already present\n",
+		cmd.Name(), packfiles.transferred, states.transferred,
+		humanize.Bytes(uint64(packfiles.size+states.size)), packfiles.failed, states.failed,
+		skippedPackfiles, skippedStates)
+
+	if failed := packfiles.failed + states.failed; failed != 0 {
+		return 1, fmt.Errorf("%d transfers failed, the clone is incomplete", failed)
+	}
+	return 0, nil
+}
+
+// openClone creates the clone, or opens it if it exists which is only
+// allowed if it was cloned from the same repository.
+func openClone(storeConfig map[string]string, wrappedConfig []byte, configuration storage.Configuration) (storage.Store, error) {
+	cloneStore, err := storage.Create(storeConfig, wrappedConfig)
+	if err == nil {
+		return cloneStore, nil
+	}
+
+	cloneStore, serializedConfig, openErr := storage.Open(storeConfig)
+	if openErr != nil {
+		return nil, fmt.Errorf("could not create repository: %w", err)
+	}
+
+	cloneConfiguration, err := storage.NewConfigurationFromWrappedBytes(serializedConfig)
 	if err != nil {
-		return 1, fmt.Errorf("could not get packfiles list from repository: %w", err)
+		cloneStore.Close()
+		return nil, fmt.Errorf("could not read configuration of existing repository: %w", err)
+	}
+	if cloneConfiguration.RepositoryID != configuration.RepositoryID {
+		cloneStore.Close()
+		return nil, fmt.Errorf("existing repository %s is not a clone of this repository", storeConfig["location"])
 	}
 
-	wg = sync.WaitGroup{}
-	for _, _indexMAC := range indexesMACs {
-		wg.Add(1)
-		go func(indexMAC objects.MAC) {
-			defer wg.Done()
+	return cloneStore, nil
+}
 
-			data, err := sourceStore.GetState(indexMAC)
+// missing returns the macs not in present along with the number of those
+// that were.
+func missing(macs []objects.MAC, present []objects.MAC) ([]objects.MAC, int) {
+	exists := make(map[objects.MAC]struct{}, len(present))
+	for _, mac := range present {
+		exists[mac] = struct{}{}
+	}
+
+	ret := make([]objects.MAC, 0, len(macs))
+	for _, mac := range macs {
+		if _, ok := exists[mac]; !ok {
+			ret = append(ret, mac)
+		}
+	}
+	return ret, len(macs) - len(ret)
+}
+
+// selectSnapshots collects the blobs the selected snapshots depend on,
+// along with the packfiles holding them.
+func (cmd *Clone) selectSnapshots(repo *repository.Repository) ([]objects.MAC, []state.DeltaEntry, error) {
+	blobs := make(map[snapshot.BlobRef]state.DeltaEntry)
+	packfiles := make(map[objects.MAC]struct{})
+
+	for _, prefix := range cmd.Snapshots {
+		snapshotID, err := utils.LocateSnapshotByPrefix(repo, prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		iter, err := snap.ListBlobs()
+		if err != nil {
+			snap.Close()
+			return nil, nil, err
+		}
+
+		for blob, err := range iter {
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "could not get index from repository: %s\n", err)
-				return
+				snap.Close()
+				return nil, nil, err
+			}
+			if _, exists := blobs[blob]; exists {
+				continue
 			}
 
-			err = cloneStore.PutState(indexMAC, data)
+			delta, exists, err := repo.GetDeltaForBlob(blob.Type, blob.MAC)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "could not put packfile to repository: %s\n", err)
-				return
+				snap.Close()
+				return nil, nil, err
 			}
-		}(_indexMAC)
+			if !exists {
+				snap.Close()
+				return nil, nil, fmt.Errorf("snapshot %x: %s %x not found in repository", snap.Header.GetIndexShortID(), blob.Type, blob.MAC)
+			}
+
+			blobs[blob] = delta
+			packfiles[delta.Location.Packfile] = struct{}{}
+		}
+		snap.Close()
 	}
-	wg.Wait()
 
-	return 0, nil
+	packfileMACs := make([]objects.MAC, 0, len(packfiles))
+	for packfileMAC := range packfiles {
+		packfileMACs = append(packfileMACs, packfileMAC)
+	}
+
+	deltas := make([]state.DeltaEntry, 0, len(blobs))
+	for _, delta := range blobs {
+		deltas = append(deltas, delta)
+	}
+
+	return packfileMACs, deltas, nil
+}
+
+// putSelectedState writes to the clone a single state referencing only the
+// cloned packfiles and the blobs of the selected snapshots, the other blobs
+// of these packfiles are left unreachable.
+func putSelectedState(ctx *appcontext.AppContext, repo *repository.Repository, cloneStore storage.Store, packfileMACs []objects.MAC, deltas []state.DeltaEntry) error {
+	stateID := objects.RandomMAC()
+
+	sc, err := ctx.GetCache().Scan(stateID)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	st := repo.NewStateDelta(sc)
+	for i := range deltas {
+		if err := st.PutDelta(&deltas[i]); err != nil {
+			return err
+		}
+	}
+	for _, packfileMAC := range packfileMACs {
+		if err := st.PutPackfile(stateID, packfileMAC); err != nil {
+			return err
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := st.SerializeToStream(buf); err != nil {
+		return err
+	}
+
+	rd, err := repo.Encode(buf)
+	if err != nil {
+		return err
+	}
+
+	rd, err = storage.Serialize(repo.GetMACHasher(), resources.RT_STATE, versioning.GetCurrentVersion(resources.RT_STATE), rd)
+	if err != nil {
+		return err
+	}
+
+	return cloneStore.PutState(stateID, rd)
 }
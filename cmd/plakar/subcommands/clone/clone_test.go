@@ -2,12 +2,24 @@ package clone
 
 import (
 	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
 	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
@@ -61,3 +73,230 @@ func TestExecuteCmdClone(t *testing.T) {
 	_, err = os.Stat(outputDir)
 	require.NoError(t, err)
 }
+
+func TestExecuteCmdCloneSnapshots(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	// a second snapshot with other content in the same repository
+	tmpBackupDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, "other.txt"), []byte("hello other"), 0644))
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &snapshot.BackupOptions{Name: "other_backup", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	snap2ID := snap2.Header.Identifier
+	snap2.Close()
+
+	sourcePackfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(t.TempDir(), "clone_test")
+	args := []string{"to", outputDir, hex.EncodeToString(snap.Header.Identifier[:])}
+
+	subcommand, err := parse_cmd_clone(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// open the clone with its own cache, it shares the repository ID
+	store, serializedConfig, err := storage.Open(map[string]string{"location": outputDir})
+	require.NoError(t, err)
+	cloneCtx := appcontext.NewAppContext()
+	cloneCtx.SetCache(caching.NewManager(t.TempDir()))
+	cloneCtx.SetLogger(logging.NewLogger(bufOut, bufErr))
+	clone, err := repository.New(cloneCtx, store, serializedConfig)
+	require.NoError(t, err)
+	defer clone.Close()
+
+	var snapshots []objects.MAC
+	for snapshotID := range clone.ListSnapshots() {
+		snapshots = append(snapshots, snapshotID)
+	}
+	require.Equal(t, []objects.MAC{snap.Header.Identifier}, snapshots)
+	require.False(t, clone.BlobExists(resources.RT_SNAPSHOT, snap2ID))
+
+	clonePackfiles, err := clone.GetPackfiles()
+	require.NoError(t, err)
+	require.NotEmpty(t, clonePackfiles)
+	require.Less(t, len(clonePackfiles), len(sourcePackfiles))
+	for packfileMAC := range clone.ListPackfiles() {
+		require.Contains(t, clonePackfiles, packfileMAC)
+	}
+
+	cloned, err := snapshot.Load(clone, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer cloned.Close()
+	ok, err := cloned.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestExecuteCmdCloneFailedTransfer(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+
+	args := []string{"-concurrency", "2", "to", "mock:///clone?behavior=brokenPutPackfile"}
+	subcommand, err := parse_cmd_clone(ctx, args)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), subcommand.(*Clone).Concurrency)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), "could not put packfile")
+	require.Contains(t, bufOut.String(), "clone: 0 packfiles and 1 states transferred")
+	require.Contains(t, bufOut.String(), fmt.Sprintf("%d packfiles and 0 states failed", len(packfiles)))
+}
+
+func TestExecuteCmdCloneTwice(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(t.TempDir(), "clone_test")
+	args := []string{"to", outputDir}
+
+	subcommand, err := parse_cmd_clone(ctx, args)
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), fmt.Sprintf("clone: %d packfiles and %d states transferred", len(packfiles), len(states)))
+
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "clone: 0 packfiles and 0 states transferred (0 B)")
+	require.Contains(t, bufOut.String(), fmt.Sprintf("%d packfiles and %d states already present", len(packfiles), len(states)))
+}
+
+// interruptedStore drops the first transfer of each packfile after limit
+// bytes, and records the offsets the transfers are resumed from.
+type interruptedStore struct {
+	storage.Store
+	limit       int64
+	interrupted map[objects.MAC]bool
+	resumes     []uint64
+}
+
+type interruptedReader struct {
+	rd io.Reader
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (s *interruptedStore) GetPackfile(mac objects.MAC) (io.Reader, error) {
+	rd, err := s.Store.GetPackfile(mac)
+	if err != nil || s.interrupted[mac] {
+		return rd, err
+	}
+	s.interrupted[mac] = true
+	return &interruptedReader{rd: io.LimitReader(rd, s.limit)}, nil
+}
+
+func (s *interruptedStore) GetPackfileFrom(mac objects.MAC, offset uint64) (io.Reader, error) {
+	s.resumes = append(s.resumes, offset)
+	return s.Store.(storage.PackfileRanger).GetPackfileFrom(mac, offset)
+}
+
+func TestFetchPackfileResume(t *testing.T) {
+	snap := generateSnapshot(t, nil, nil)
+	defer snap.Close()
+	repo := snap.Repository()
+
+	defer func(delay time.Duration) { resumeDelay = delay }(resumeDelay)
+	resumeDelay = 0
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.NotEmpty(t, packfiles)
+	packfileMAC := packfiles[0]
+
+	rd, err := repo.Store().GetPackfile(packfileMAC)
+	require.NoError(t, err)
+	expected, err := io.ReadAll(rd)
+	require.NoError(t, err)
+
+	store := &interruptedStore{
+		Store:       repo.Store(),
+		limit:       100,
+		interrupted: make(map[objects.MAC]bool),
+	}
+	prd := newPackfileReader(repo, store, packfileMAC)
+	defer prd.Close()
+	data, err := io.ReadAll(prd)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100}, store.resumes)
+	require.Equal(t, expected, data)
+
+	// a packfile which doesn't match its MAC is rejected
+	corrupted := bytes.Clone(expected)
+	corrupted[len(corrupted)/2] ^= 0xff
+	require.Error(t, verifyPackfile(repo, packfileMAC, bytes.NewReader(corrupted)))
+	require.Error(t, verifyPackfile(repo, packfiles[len(packfiles)-1], bytes.NewReader(expected[:len(expected)-1])))
+
+	// and so is a transfer of another packfile, once read to the end
+	if len(packfiles) > 1 {
+		store := &swappedStore{Store: repo.Store(), mac: packfiles[1]}
+		prd := newPackfileReader(repo, store, packfileMAC)
+		defer prd.Close()
+		_, err = io.ReadAll(prd)
+		require.ErrorContains(t, err, "checksum mismatch")
+	}
+}
+
+// swappedStore serves the packfile mac whichever packfile is asked for.
+type swappedStore struct {
+	storage.Store
+	mac objects.MAC
+}
+
+func (s *swappedStore) GetPackfile(objects.MAC) (io.Reader, error) {
+	return s.Store.GetPackfile(s.mac)
+}
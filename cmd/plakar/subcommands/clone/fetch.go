@@ -0,0 +1,191 @@
+package clone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// maxResumes bounds the consecutive attempts to resume an interrupted
+// packfile transfer which receive nothing, the delay before each attempt
+// doubling from resumeDelay.
+const maxResumes = 3
+
+var resumeDelay = 500 * time.Millisecond
+
+var errFetchAborted = errors.New("packfile transfer aborted")
+
+// packfileReader reads the packfile mac from store, resuming from the last
+// received byte when the transfer is interrupted.  What is read is verified
+// on the fly, and the end of the packfile is only reported if it is the
+// packfile named mac: it must be read to the end to be trusted.
+type packfileReader struct {
+	repo  *repository.Repository
+	store storage.Store
+	mac   objects.MAC
+
+	rd       io.Reader
+	offset   uint64
+	start    uint64 // offset at the last failure
+	failures int
+	delay    time.Duration
+	err      error
+
+	// the verifier reads from the pipe what is received
+	verifier *io.PipeWriter
+	verified chan error
+}
+
+func newPackfileReader(repo *repository.Repository, store storage.Store, mac objects.MAC) *packfileReader {
+	pr, pw := io.Pipe()
+	p := &packfileReader{
+		repo:     repo,
+		store:    store,
+		mac:      mac,
+		delay:    resumeDelay,
+		verifier: pw,
+		verified: make(chan error, 1),
+	}
+
+	go func() {
+		err := verifyPackfile(repo, mac, pr)
+		// don't leave the transfer blocked if the verification stopped early
+		pr.CloseWithError(err)
+		p.verified <- err
+	}()
+	return p
+}
+
+func (p *packfileReader) Read(buf []byte) (int, error) {
+	for p.err == nil {
+		if p.rd == nil {
+			if err := p.open(); err != nil {
+				if !p.resume(err) {
+					return 0, p.err
+				}
+				continue
+			}
+		}
+
+		n, err := p.rd.Read(buf)
+		if n != 0 {
+			if _, werr := p.verifier.Write(buf[:n]); werr != nil {
+				p.fail(werr)
+				return 0, p.err
+			}
+			p.offset += uint64(n)
+		}
+
+		switch {
+		case err == io.EOF:
+			p.closeTransfer()
+			p.verifier.Close()
+			if verr := <-p.verified; verr != nil {
+				p.err = verr
+			} else {
+				p.err = io.EOF
+			}
+		case err != nil:
+			p.closeTransfer()
+			p.resume(err)
+		}
+		if n != 0 || p.err != nil {
+			return n, p.err
+		}
+	}
+	return 0, p.err
+}
+
+// Close aborts the transfer if it is not over.
+func (p *packfileReader) Close() error {
+	p.closeTransfer()
+	if p.err == nil {
+		p.fail(errFetchAborted)
+	}
+	return nil
+}
+
+// open starts a transfer at the current offset.
+func (p *packfileReader) open() error {
+	var rd io.Reader
+	var err error
+	if ranger, ok := p.store.(storage.PackfileRanger); ok && p.offset != 0 {
+		rd, err = ranger.GetPackfileFrom(p.mac, p.offset)
+	} else {
+		rd, err = p.store.GetPackfile(p.mac)
+		if err == nil && p.offset != 0 {
+			// the store can't start at an offset, skip what was received
+			_, err = io.CopyN(io.Discard, rd, int64(p.offset))
+		}
+	}
+	if err != nil {
+		if closer, ok := rd.(io.Closer); ok {
+			closer.Close()
+		}
+		return err
+	}
+	p.rd = rd
+	return nil
+}
+
+func (p *packfileReader) closeTransfer() {
+	if closer, ok := p.rd.(io.Closer); ok {
+		closer.Close()
+	}
+	p.rd = nil
+}
+
+// resume waits before the next attempt after the transfer failed with err.
+// It returns false if the transfer is not to be resumed.
+func (p *packfileReader) resume(err error) bool {
+	if errors.Is(err, repository.ErrPackfileNotFound) {
+		p.fail(err)
+		return false
+	}
+
+	if p.offset != p.start {
+		p.failures = 0
+		p.delay = resumeDelay
+		p.start = p.offset
+	}
+	if p.failures == maxResumes {
+		p.fail(err)
+		return false
+	}
+	p.failures++
+
+	p.repo.Logger().Warn("clone: packfile %x: %s, resuming at byte %d", p.mac, err, p.offset)
+	time.Sleep(p.delay)
+	p.delay *= 2
+	return true
+}
+
+func (p *packfileReader) fail(err error) {
+	p.err = err
+	p.verifier.CloseWithError(err)
+}
+
+// verifyPackfile checks the integrity of the serialized packfile read from
+// rd and that its MAC is mac.
+func verifyPackfile(repo *repository.Repository, mac objects.MAC, rd io.Reader) error {
+	_, rd, err := storage.Deserialize(repo.GetMACHasher(), resources.RT_PACKFILE, rd)
+	if err != nil {
+		return fmt.Errorf("packfile %x: %w", mac, err)
+	}
+
+	hasher := repo.GetMACHasher()
+	if _, err := io.Copy(hasher, rd); err != nil {
+		return fmt.Errorf("packfile %x: %w", mac, err)
+	}
+
+	if objects.MAC(hasher.Sum(nil)) != mac {
+		return fmt.Errorf("packfile %x: checksum mismatch", mac)
+	}
+	return nil
+}
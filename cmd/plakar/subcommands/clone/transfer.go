@@ -0,0 +1,77 @@
+package clone
+
+import (
+	"io"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+type transferStats struct {
+	transferred int
+	failed      int
+	size        int64
+}
+
+// transfers runs copies with a bounded number of them in flight and keeps
+// count of their outcome.
+type transfers struct {
+	concurrency chan struct{}
+	wg          sync.WaitGroup
+
+	mu    sync.Mutex
+	stats transferStats
+}
+
+func newTransfers(concurrency uint64) *transfers {
+	return &transfers{
+		concurrency: make(chan struct{}, concurrency),
+	}
+}
+
+func (t *transfers) run(macs []objects.MAC, transfer func(objects.MAC) (int64, error)) {
+	for _, mac := range macs {
+		t.concurrency <- struct{}{}
+		t.wg.Add(1)
+		go func(mac objects.MAC) {
+			defer func() {
+				<-t.concurrency
+				t.wg.Done()
+			}()
+
+			n, err := transfer(mac)
+
+			t.mu.Lock()
+			t.stats.size += n
+			if err != nil {
+				t.stats.failed++
+			} else {
+				t.stats.transferred++
+			}
+			t.mu.Unlock()
+		}(mac)
+	}
+}
+
+// done waits for the running copies and returns their stats, resetting
+// them for the next batch.
+func (t *transfers) done() transferStats {
+	t.wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats
+	t.stats = transferStats{}
+	return stats
+}
+
+type countingReader struct {
+	rd io.Reader
+	n  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.rd.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -19,9 +19,12 @@ package config
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/config"
 	"github.com/PlakarKorp/plakar/repository"
 )
 
@@ -58,6 +61,14 @@ func (cmd *Config) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 		err = cmd_remote(ctx, cmd.args[1:])
 	case "repository", "repo":
 		err = cmd_repository(ctx, cmd.args[1:])
+	case "passphrase":
+		err = cmd_passphrase(ctx, cmd.args[1:])
+	case "trust":
+		err = cmd_trust(ctx, cmd.args[1:])
+	case "show":
+		err = cmd_show(ctx, cmd.args[1:])
+	case "compare":
+		err = cmd_compare(ctx, cmd.args[1:])
 	default:
 		err = fmt.Errorf("unknown subcommand %s", cmd.args[0])
 	}
@@ -181,3 +192,102 @@ func cmd_repository(ctx *appcontext.AppContext, args []string) error {
 		return fmt.Errorf("usage: plakar config repository [create | default | set | unset | validate]")
 	}
 }
+
+func cmd_passphrase(ctx *appcontext.AppContext, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: plakar config passphrase [check | set | unset]")
+	}
+
+	switch args[0] {
+	case "check":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: plakar config passphrase check")
+		}
+		passphrase := []byte(os.Getenv("PLAKAR_PASSPHRASE"))
+		if len(passphrase) == 0 {
+			tmp, err := utils.GetPassphrase("candidate")
+			if err != nil {
+				return err
+			}
+			passphrase = tmp
+		}
+		policy, _ := ctx.Config.GetPassphrasePolicy()
+		if err := policy.Check(passphrase); err != nil {
+			return err
+		}
+		fmt.Fprintln(ctx.Stdout, "passphrase complies with the policy")
+		return nil
+
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: plakar config passphrase set option value")
+		}
+		option, value := args[1], args[2]
+		policy := ctx.Config.PassphrasePolicy
+		if policy == nil {
+			policy = &config.PassphrasePolicy{}
+		}
+		if err := policy.Set(option, value); err != nil {
+			return err
+		}
+		ctx.Config.PassphrasePolicy = policy
+		return ctx.Config.Save()
+
+	case "unset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: plakar config passphrase unset option")
+		}
+		option := args[1]
+		if ctx.Config.PassphrasePolicy == nil {
+			return fmt.Errorf("no passphrase policy configured")
+		}
+		if err := ctx.Config.PassphrasePolicy.Set(option, "0"); err != nil {
+			return err
+		}
+		if *ctx.Config.PassphrasePolicy == (config.PassphrasePolicy{}) {
+			ctx.Config.PassphrasePolicy = nil
+		}
+		return ctx.Config.Save()
+
+	default:
+		return fmt.Errorf("usage: plakar config passphrase [check | set | unset]")
+	}
+}
+
+func cmd_trust(ctx *appcontext.AppContext, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: plakar config trust [add | list | rm]")
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: plakar config trust add key")
+		}
+		if err := ctx.Config.Trust(args[1]); err != nil {
+			return err
+		}
+		return ctx.Config.Save()
+
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: plakar config trust list")
+		}
+		for _, key := range ctx.Config.TrustedKeys {
+			fmt.Fprintln(ctx.Stdout, key)
+		}
+		return nil
+
+	case "rm":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: plakar config trust rm key")
+		}
+		if err := ctx.Config.Untrust(args[1]); err != nil {
+			return err
+		}
+		return ctx.Config.Save()
+
+	default:
+		return fmt.Errorf("usage: plakar config trust [add | list | rm]")
+	}
+}
@@ -2,13 +2,18 @@ package config
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -218,3 +223,129 @@ remotes: {}
 `
 	require.Equal(t, expectedOutput, output)
 }
+
+func TestCmdPassphrase(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+	// init temporary directories
+	tmpDir, err := os.MkdirTemp("", "plakar-config-test")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	cfg, err := config.LoadOrCreate(configPath)
+	require.NoError(t, err)
+	ctx := appcontext.NewAppContext()
+	ctx.Config = cfg
+	ctx.Stdout = bufOut
+	ctx.Stderr = bufErr
+
+	args := []string{"set", "min-classes", "5"}
+	err = cmd_passphrase(ctx, args)
+	require.EqualError(t, err, "min-classes can't be greater than 4")
+
+	args = []string{"set", "unknown", "5"}
+	err = cmd_passphrase(ctx, args)
+	require.EqualError(t, err, "unknown passphrase policy option \"unknown\"")
+
+	args = []string{"set", "min-length", "16"}
+	err = cmd_passphrase(ctx, args)
+	require.NoError(t, err)
+
+	args = []string{"set", "min-classes", "3"}
+	err = cmd_passphrase(ctx, args)
+	require.NoError(t, err)
+
+	t.Setenv("PLAKAR_PASSPHRASE", "password")
+	err = cmd_passphrase(ctx, []string{"check"})
+	require.ErrorIs(t, err, config.ErrWeakPassphrase)
+	require.Contains(t, err.Error(), "use at least 16 characters")
+
+	t.Setenv("PLAKAR_PASSPHRASE", "correct-Horse-battery-staple")
+	err = cmd_passphrase(ctx, []string{"check"})
+	require.NoError(t, err)
+	require.Equal(t, "passphrase complies with the policy\n", bufOut.String())
+
+	// the policy is persisted
+	cfg, err = config.LoadOrCreate(configPath)
+	require.NoError(t, err)
+	require.Equal(t, &config.PassphrasePolicy{MinLength: 16, MinClasses: 3}, cfg.PassphrasePolicy)
+	ctx.Config = cfg
+
+	err = cmd_passphrase(ctx, []string{"unset", "min-length"})
+	require.NoError(t, err)
+	err = cmd_passphrase(ctx, []string{"unset", "min-classes"})
+	require.NoError(t, err)
+	require.Nil(t, ctx.Config.PassphrasePolicy)
+}
+
+func TestCmdTrust(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	tmpDir, err := os.MkdirTemp("", "plakar-config-test")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	cfg, err := config.LoadOrCreate(configPath)
+	require.NoError(t, err)
+	ctx := appcontext.NewAppContext()
+	ctx.Config = cfg
+	ctx.Stdout = bufOut
+
+	kp, err := keypair.Generate()
+	require.NoError(t, err)
+	key := base64.RawStdEncoding.EncodeToString(kp.PublicKey)
+
+	err = cmd_trust(ctx, []string{"add", "invalid"})
+	require.EqualError(t, err, "invalid public key \"invalid\"")
+
+	err = cmd_trust(ctx, []string{"add", key})
+	require.NoError(t, err)
+	err = cmd_trust(ctx, []string{"add", key})
+	require.ErrorContains(t, err, "already trusted")
+
+	err = cmd_trust(ctx, []string{"list"})
+	require.NoError(t, err)
+	require.Equal(t, key+"\n", bufOut.String())
+
+	// the keys are persisted
+	cfg, err = config.LoadOrCreate(configPath)
+	require.NoError(t, err)
+	keys, err := cfg.GetTrustedKeys()
+	require.NoError(t, err)
+	require.Equal(t, []ed25519.PublicKey{kp.PublicKey}, keys)
+	ctx.Config = cfg
+
+	err = cmd_trust(ctx, []string{"rm", key})
+	require.NoError(t, err)
+	require.Nil(t, ctx.Config.TrustedKeys)
+	err = cmd_trust(ctx, []string{"rm", key})
+	require.ErrorContains(t, err, "is not trusted")
+}
+
+func TestConfigCompare(t *testing.T) {
+	local := storage.NewConfiguration()
+	peer := storage.NewConfiguration()
+	require.Empty(t, compareConfigurations(local, peer))
+
+	sha256, err := hashing.LookupDefaultConfiguration("SHA256")
+	require.NoError(t, err)
+	peer.Hashing = *sha256
+	peer.Compression = nil
+
+	incompatibilities := compareConfigurations(local, peer)
+	require.Equal(t, []incompatibility{
+		{Fatal: true, Field: "hashing", Message: "BLAKE3/256 != SHA256/256"},
+		{Fatal: false, Field: "compression", Message: "LZ4 != disabled"},
+	}, incompatibilities)
+	require.Equal(t, "error: hashing: BLAKE3/256 != SHA256/256", incompatibilities[0].String())
+
+	serialized, err := canonicalConfiguration(peer)
+	require.NoError(t, err)
+	require.Contains(t, string(serialized), `"Version": "`+storage.VERSION+`"`)
+	require.Contains(t, string(serialized), `"Algorithm": "SHA256"`)
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// incompatibility is a difference between two repository configurations,
+// fatal ones prevent sync and clone between both repositories.
+type incompatibility struct {
+	Fatal   bool
+	Field   string
+	Message string
+}
+
+func (i incompatibility) String() string {
+	level := "warning"
+	if i.Fatal {
+		level = "error"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, i.Field, i.Message)
+}
+
+// defaultRepository resolves the repository used when none is given, the
+// same way plakar does without "at".
+func defaultRepository(ctx *appcontext.AppContext) string {
+	if location := os.Getenv("PLAKAR_REPOSITORY"); location != "" {
+		return location
+	}
+	if ctx.Config.DefaultRepository != "" {
+		return "@" + ctx.Config.DefaultRepository
+	}
+	return filepath.Join(ctx.HomeDir, ".plakar")
+}
+
+func loadConfiguration(ctx *appcontext.AppContext, name string) (*storage.Configuration, error) {
+	storeConfig, err := ctx.Config.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	store, serializedConfig, err := storage.Open(storeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the repository at %s: %w", storeConfig["location"], err)
+	}
+	defer store.Close()
+
+	return storage.NewConfigurationFromWrappedBytes(serializedConfig)
+}
+
+func cmd_show(ctx *appcontext.AppContext, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: plakar config show [repository]")
+	}
+
+	name := defaultRepository(ctx)
+	if len(args) == 1 {
+		name = args[0]
+	}
+
+	configuration, err := loadConfiguration(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	serialized, err := canonicalConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "%s\n", serialized)
+	return nil
+}
+
+// canonicalConfiguration renders the configuration as indented JSON with
+// the version spelled out.
+func canonicalConfiguration(configuration *storage.Configuration) ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Version string
+		*storage.Configuration
+	}{
+		Version:       configuration.Version.String(),
+		Configuration: configuration,
+	}, "", "  ")
+}
+
+func cmd_compare(ctx *appcontext.AppContext, args []string) error {
+	var name, peer string
+	switch len(args) {
+	case 1:
+		name, peer = defaultRepository(ctx), args[0]
+	case 2:
+		name, peer = args[0], args[1]
+	default:
+		return fmt.Errorf("usage: plakar config compare [repository] peer")
+	}
+
+	local, err := loadConfiguration(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	remote, err := loadConfiguration(ctx, peer)
+	if err != nil {
+		return fmt.Errorf("peer repository: %w", err)
+	}
+
+	fatal := 0
+	for _, i := range compareConfigurations(local, remote) {
+		fmt.Fprintln(ctx.Stdout, i)
+		if i.Fatal {
+			fatal++
+		}
+	}
+	if fatal != 0 {
+		return fmt.Errorf("%d incompatibilities with %s", fatal, peer)
+	}
+	return nil
+}
+
+// compareConfigurations reports the differences between the configurations
+// of two repositories.  Snapshots can't be transferred between repositories
+// of different versions or hashing, the other differences only affect
+// deduplication and the storage of the transferred data.
+func compareConfigurations(a, b *storage.Configuration) []incompatibility {
+	var ret []incompatibility
+
+	add := func(fatal bool, field string, format string, args ...any) {
+		ret = append(ret, incompatibility{
+			Fatal:   fatal,
+			Field:   field,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if a.Version != b.Version {
+		add(true, "version", "%s != %s", a.Version, b.Version)
+	}
+
+	if a.RepositoryID == b.RepositoryID {
+		add(false, "repository", "both repositories share the identifier %s", a.RepositoryID)
+	}
+
+	if a.Hashing.Algorithm != b.Hashing.Algorithm || a.Hashing.Bits != b.Hashing.Bits {
+		add(true, "hashing", "%s/%d != %s/%d",
+			a.Hashing.Algorithm, a.Hashing.Bits, b.Hashing.Algorithm, b.Hashing.Bits)
+	}
+
+	if a.Chunking != b.Chunking {
+		add(false, "chunking", "%s (%d/%d/%d) != %s (%d/%d/%d), chunks will not deduplicate",
+			a.Chunking.Algorithm, a.Chunking.MinSize, a.Chunking.NormalSize, a.Chunking.MaxSize,
+			b.Chunking.Algorithm, b.Chunking.MinSize, b.Chunking.NormalSize, b.Chunking.MaxSize)
+	}
+
+	if a.Packfile != b.Packfile {
+		add(false, "packfile", "sizes %d/%d/%d != %d/%d/%d",
+			a.Packfile.MinSize, a.Packfile.AvgSize, a.Packfile.MaxSize,
+			b.Packfile.MinSize, b.Packfile.AvgSize, b.Packfile.MaxSize)
+	}
+
+	switch {
+	case a.Compression == nil && b.Compression != nil:
+		add(false, "compression", "disabled != %s", b.Compression.Algorithm)
+	case a.Compression != nil && b.Compression == nil:
+		add(false, "compression", "%s != disabled", a.Compression.Algorithm)
+	case a.Compression != nil && !reflect.DeepEqual(a.Compression, b.Compression):
+		add(false, "compression", "%s (level %d) != %s (level %d)",
+			a.Compression.Algorithm, a.Compression.Level, b.Compression.Algorithm, b.Compression.Level)
+	}
+
+	switch {
+	case a.Encryption == nil && b.Encryption != nil:
+		add(false, "encryption", "disabled != %s, data will be encrypted on transfer", b.Encryption.DataAlgorithm)
+	case a.Encryption != nil && b.Encryption == nil:
+		add(false, "encryption", "%s != disabled, data will be stored unencrypted", a.Encryption.DataAlgorithm)
+	case a.Encryption != nil:
+		if a.Encryption.DataAlgorithm != b.Encryption.DataAlgorithm ||
+			a.Encryption.SubKeyAlgorithm != b.Encryption.SubKeyAlgorithm {
+			add(false, "encryption", "%s/%s != %s/%s",
+				a.Encryption.DataAlgorithm, a.Encryption.SubKeyAlgorithm,
+				b.Encryption.DataAlgorithm, b.Encryption.SubKeyAlgorithm)
+		}
+	}
+
+	return ret
+}
@@ -45,6 +45,7 @@ func parse_cmd_create(ctx *appcontext.AppContext, args []string) (subcommands.Su
 	var opt_hashing string
 	var opt_noencryption bool
 	var opt_nocompression bool
+	var opt_compression string
 	var opt_allowweak bool
 
 	flags := flag.NewFlagSet("create", flag.ExitOnError)
@@ -55,10 +56,12 @@ func parse_cmd_create(ctx *appcontext.AppContext, args []string) (subcommands.Su
 		flags.PrintDefaults()
 	}
 
-	flags.BoolVar(&opt_allowweak, "weak-passphrase", false, "allow weak passphrase to protect the repository")
+	flags.BoolVar(&opt_allowweak, "allow-weak", false, "allow a passphrase that does not comply with the passphrase policy")
+	flags.BoolVar(&opt_allowweak, "weak-passphrase", false, "same as -allow-weak")
 	flags.StringVar(&opt_hashing, "hashing", hashing.DEFAULT_HASHING_ALGORITHM, "hashing algorithm to use for digests")
 	flags.BoolVar(&opt_noencryption, "no-encryption", false, "disable transparent encryption")
-	flags.BoolVar(&opt_nocompression, "no-compression", false, "disable transparent compression")
+	flags.StringVar(&opt_compression, "compression", "lz4", "compression algorithm to use for blobs: lz4, gzip, zstd or none")
+	flags.BoolVar(&opt_nocompression, "no-compression", false, "disable transparent compression, same as -compression none")
 	flags.Parse(args)
 
 	if flags.NArg() != 0 {
@@ -69,11 +72,18 @@ func parse_cmd_create(ctx *appcontext.AppContext, args []string) (subcommands.Su
 		return nil, fmt.Errorf("%s: unknown hashing algorithm", flag.CommandLine.Name())
 	}
 
+	if strings.ToLower(opt_compression) == "none" {
+		opt_nocompression = true
+	} else if _, err := compression.LookupDefaultConfiguration(strings.ToUpper(opt_compression)); err != nil {
+		return nil, fmt.Errorf("%s: unknown compression algorithm", flag.CommandLine.Name())
+	}
+
 	return &Create{
 		AllowWeak:     opt_allowweak,
 		Hashing:       opt_hashing,
 		NoEncryption:  opt_noencryption,
 		NoCompression: opt_nocompression,
+		Compression:   opt_compression,
 	}, nil
 }
 
@@ -82,14 +92,21 @@ type Create struct {
 	Hashing       string
 	NoEncryption  bool
 	NoCompression bool
+	Compression   string
 }
 
 func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
 	storageConfiguration := storage.NewConfiguration()
 	if cmd.NoCompression {
 		storageConfiguration.Compression = nil
-	} else {
+	} else if cmd.Compression == "" {
 		storageConfiguration.Compression = compression.NewDefaultConfiguration()
+	} else {
+		compressionConfiguration, err := compression.LookupDefaultConfiguration(strings.ToUpper(cmd.Compression))
+		if err != nil {
+			return 1, err
+		}
+		storageConfiguration.Compression = compressionConfiguration
 	}
 
 	hashingConfiguration, err := hashing.LookupDefaultConfiguration(strings.ToUpper(cmd.Hashing))
@@ -98,9 +115,13 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 	}
 	storageConfiguration.Hashing = *hashingConfiguration
 
-	minEntropBits := 80.
-	if cmd.AllowWeak {
-		minEntropBits = 0.
+	// the policy always applies to passphrases typed interactively, and
+	// to those read from the environment or a key file only if it was
+	// configured explicitly.
+	policy, configured := ctx.Config.GetPassphrasePolicy()
+	var validate func([]byte) error
+	if !cmd.AllowWeak {
+		validate = policy.Check
 	}
 
 	var hasher hash.Hash
@@ -115,7 +136,7 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 				passphrase = []byte(envPassphrase)
 			} else {
 				for attempt := 0; attempt < 3; attempt++ {
-					tmp, err := utils.GetPassphraseConfirm("repository", minEntropBits)
+					tmp, err := utils.GetPassphraseConfirm("repository", validate)
 					if err != nil {
 						fmt.Fprintf(os.Stderr, "%s\n", err)
 						continue
@@ -132,6 +153,13 @@ func (cmd *Create) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 			return 1, fmt.Errorf("can't encrypt the repository with an empty passphrase")
 		}
 
+		// must happen before deriving the key
+		if configured && validate != nil {
+			if err := validate(passphrase); err != nil {
+				return 1, fmt.Errorf("%w (use -allow-weak to override)", err)
+			}
+		}
+
 		key, err := encryption.DeriveKey(storageConfiguration.Encryption.KDFParams, passphrase)
 		if err != nil {
 			return 1, err
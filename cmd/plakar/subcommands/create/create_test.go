@@ -3,11 +3,17 @@ package create
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/config"
+	"github.com/PlakarKorp/plakar/logging"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
 	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
 	"github.com/creack/pty"
 	"github.com/stretchr/testify/require"
@@ -219,3 +225,127 @@ func TestExecuteCmdCreateDefaultWithEnvPassphrase(t *testing.T) {
 	_, err = os.Stat(fmt.Sprintf("%s/repo/CONFIG", tmpRepoDirRoot))
 	require.NoError(t, err)
 }
+
+func TestExecuteCmdCreatePassphrasePolicy(t *testing.T) {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	ctx := appcontext.NewAppContext()
+	defer ctx.Close()
+
+	cfg, err := config.LoadOrCreate(filepath.Join(tmpRepoDirRoot, "plakar.yml"))
+	require.NoError(t, err)
+	cfg.PassphrasePolicy = &config.PassphrasePolicy{
+		MinLength:  12,
+		MinClasses: 3,
+	}
+	ctx.Config = cfg
+
+	repo, err := repository.Inexistent(ctx, map[string]string{"location": tmpRepoDirRoot+"/repo"})
+	require.NoError(t, err)
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = tmpRepoDirRoot
+
+	subcommand, err := parse_cmd_create(ctx, []string{})
+	require.NoError(t, err)
+
+	// a configured policy also applies to the environment
+	t.Setenv("PLAKAR_PASSPHRASE", "azertyuiopqsdf")
+	status, err := subcommand.Execute(ctx, repo)
+	require.ErrorIs(t, err, config.ErrWeakPassphrase)
+	require.Contains(t, err.Error(), "mix at least 3 of")
+	require.Equal(t, 1, status)
+	_, err = os.Stat(fmt.Sprintf("%s/repo/CONFIG", tmpRepoDirRoot))
+	require.True(t, os.IsNotExist(err))
+
+	t.Setenv("PLAKAR_PASSPHRASE", "aZeRtY123456$#@!@")
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	_, err = os.Stat(fmt.Sprintf("%s/repo/CONFIG", tmpRepoDirRoot))
+	require.NoError(t, err)
+}
+
+func TestExecuteCmdCreatePassphrasePolicyAllowWeak(t *testing.T) {
+	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRepoDirRoot)
+	})
+	ctx := appcontext.NewAppContext()
+	defer ctx.Close()
+
+	cfg, err := config.LoadOrCreate(filepath.Join(tmpRepoDirRoot, "plakar.yml"))
+	require.NoError(t, err)
+	cfg.PassphrasePolicy = &config.PassphrasePolicy{MinLength: 32}
+	ctx.Config = cfg
+
+	repo, err := repository.Inexistent(ctx, map[string]string{"location": tmpRepoDirRoot+"/repo"})
+	require.NoError(t, err)
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = tmpRepoDirRoot
+
+	subcommand, err := parse_cmd_create(ctx, []string{"-allow-weak"})
+	require.NoError(t, err)
+
+	t.Setenv("PLAKAR_PASSPHRASE", "short")
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+}
+
+func TestExecuteCmdCreateCompression(t *testing.T) {
+	for _, algorithm := range []string{"lz4", "gzip", "zstd", "none"} {
+		t.Run(algorithm, func(t *testing.T) {
+			tmpRepoDirRoot := t.TempDir()
+			ctx := appcontext.NewAppContext()
+			defer ctx.Close()
+			ctx.SetCache(caching.NewManager(filepath.Join(tmpRepoDirRoot, "cache")))
+			ctx.SetLogger(logging.NewLogger(os.Stdout, os.Stderr))
+
+			location := filepath.Join(tmpRepoDirRoot, "repo")
+			repo, err := repository.Inexistent(ctx, map[string]string{"location": location})
+			require.NoError(t, err)
+			// override the homedir to avoid having test overwriting existing home configuration
+			ctx.HomeDir = tmpRepoDirRoot
+			args := []string{"--no-encryption", "--compression", algorithm}
+
+			subcommand, err := parse_cmd_create(ctx, args)
+			require.NoError(t, err)
+			require.NotNil(t, subcommand)
+
+			status, err := subcommand.Execute(ctx, repo)
+			require.NoError(t, err)
+			require.Equal(t, 0, status)
+
+			store, serializedConfig, err := storage.Open(map[string]string{"location": location})
+			require.NoError(t, err)
+			repo, err = repository.New(ctx, store, serializedConfig)
+			require.NoError(t, err)
+			defer repo.Close()
+
+			if algorithm == "none" {
+				require.Nil(t, repo.Configuration().Compression)
+			} else {
+				require.NotNil(t, repo.Configuration().Compression)
+				require.Equal(t, strings.ToUpper(algorithm), repo.Configuration().Compression.Algorithm)
+			}
+
+			data := []byte(strings.Repeat("hello compression ", 100))
+			encoded, err := repo.EncodeBuffer(data)
+			require.NoError(t, err)
+			if algorithm != "none" {
+				require.Less(t, len(encoded), len(data))
+			}
+			decoded, err := repo.DecodeBuffer(encoded)
+			require.NoError(t, err)
+			require.Equal(t, data, decoded)
+		})
+	}
+
+	_, err := parse_cmd_create(appcontext.NewAppContext(), []string{"--compression", "brotli"})
+	require.Error(t, err)
+}
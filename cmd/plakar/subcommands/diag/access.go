@@ -0,0 +1,69 @@
+package diag
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+type DiagAccess struct {
+	RepositorySecret []byte
+
+	Args []string
+}
+
+func (cmd *DiagAccess) Name() string {
+	return "diag_access"
+}
+
+func (cmd *DiagAccess) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	types := resources.Types()
+	if len(cmd.Args) != 0 {
+		types = nil
+		for _, arg := range cmd.Args {
+			found := false
+			for _, Type := range resources.Types() {
+				if Type.String() == arg {
+					types = append(types, Type)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return 1, fmt.Errorf("invalid resource type: %s", arg)
+			}
+		}
+	}
+
+	type accessEntry struct {
+		Type  resources.Type
+		MAC   objects.MAC
+		Count uint64
+	}
+
+	entries := []accessEntry{}
+	for _, Type := range types {
+		stats, err := repo.AccessStats(Type)
+		if err != nil {
+			return 1, err
+		}
+		for mac, count := range stats {
+			entries = append(entries, accessEntry{Type: Type, MAC: mac, Count: count})
+		}
+	}
+
+	// most accessed blobs first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Count > entries[j].Count
+	})
+
+	for _, entry := range entries {
+		fmt.Fprintf(ctx.Stdout, "%d %s %x\n", entry.Count, entry.Type, entry.MAC)
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,48 @@
+package diag
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/dustin/go-humanize"
+)
+
+type DiagBlobs struct {
+	RepositorySecret []byte
+
+	SnapshotID string
+}
+
+func (cmd *DiagBlobs) Name() string {
+	return "diag_blobs"
+}
+
+func (cmd *DiagBlobs) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, _, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotID)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	stats, err := snap.BlobStats()
+	if err != nil {
+		return 1, err
+	}
+
+	var totalCount, totalSize uint64
+	for _, Type := range resources.Types() {
+		s, ok := stats[Type]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(ctx.Stdout, "%-12s %8d %10s (%d bytes)\n", Type, s.Count, humanize.Bytes(s.Size), s.Size)
+		totalCount += s.Count
+		totalSize += s.Size
+	}
+	fmt.Fprintf(ctx.Stdout, "%-12s %8d %10s (%d bytes)\n", "total", totalCount, humanize.Bytes(totalSize), totalSize)
+
+	return 0, nil
+}
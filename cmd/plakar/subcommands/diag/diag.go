@@ -39,6 +39,7 @@ func parse_cmd_diag(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s snapshot SNAPSHOT\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s blobs SNAPSHOT\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s errors SNAPSHOT\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s state [STATE]...\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s search snapshot[:path] mime\n", flags.Name())
@@ -48,6 +49,7 @@ func parse_cmd_diag(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 		fmt.Fprintf(flags.Output(), "       %s xattr SNAPSHOT[:PATH]\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s contenttype SNAPSHOT[:PATH]\n", flags.Name())
 		fmt.Fprintf(flags.Output(), "       %s locks\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s access [TYPE]...\n", flags.Name())
 	}
 	flags.Parse(args)
 
@@ -61,6 +63,14 @@ func parse_cmd_diag(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 			RepositorySecret: ctx.GetSecret(),
 			SnapshotID:       flags.Args()[1],
 		}, nil
+	case "blobs":
+		if len(flags.Args()) < 2 {
+			return nil, fmt.Errorf("usage: %s blobs SNAPSHOT", flags.Name())
+		}
+		return &DiagBlobs{
+			RepositorySecret: ctx.GetSecret(),
+			SnapshotID:       flags.Args()[1],
+		}, nil
 	case "errors":
 		if len(flags.Args()) < 2 {
 			return nil, fmt.Errorf("usage: %s errors SNAPSHOT", flags.Name())
@@ -115,6 +125,11 @@ func parse_cmd_diag(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 		return &DiagLocks{
 			RepositorySecret: ctx.GetSecret(),
 		}, nil
+	case "access":
+		return &DiagAccess{
+			RepositorySecret: ctx.GetSecret(),
+			Args:             flags.Args()[1:],
+		}, nil
 	case "search":
 		var path, mime string
 		switch flags.NArg() {
@@ -132,5 +147,5 @@ func parse_cmd_diag(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 			Mime:             mime,
 		}, nil
 	}
-	return nil, fmt.Errorf("Invalid parameter. usage: diag [contenttype|snapshot|object|state|packfile|vfs|xattr|errors|search]")
+	return nil, fmt.Errorf("Invalid parameter. usage: diag [access|blobs|contenttype|snapshot|object|state|packfile|vfs|xattr|errors|search]")
 }
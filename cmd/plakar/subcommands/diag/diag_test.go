@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	ptesting "github.com/PlakarKorp/plakar/testing"
@@ -714,3 +715,92 @@ func TestExecuteCmdDiagSearch(t *testing.T) {
 	output := bufOut.String()
 	require.Contains(t, output, "subdir/dummy.txt")
 }
+
+func TestExecuteCmdDiagAccess(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.AccessStats = true
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	for i := 0; i < 3; i++ {
+		_, err := repo.GetBlob(resources.RT_SNAPSHOT, snap.Header.Identifier)
+		require.NoError(t, err)
+	}
+	_, err := repo.GetBlob(resources.RT_VFS_BTREE, snap.Header.GetSource(0).VFS.Root)
+	require.NoError(t, err)
+
+	// counters survive a flush and are merged with later reads
+	require.NoError(t, repo.FlushAccessStats())
+	_, err = repo.GetBlob(resources.RT_SNAPSHOT, snap.Header.Identifier)
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	args := []string{"access", "snapshot", "vfs btree"}
+
+	subcommand, err := parse_cmd_diag(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	lines := strings.Split(strings.Trim(bufOut.String(), "\n"), "\n")
+	require.Equal(t, []string{
+		fmt.Sprintf("4 snapshot %x", snap.Header.Identifier),
+		fmt.Sprintf("1 vfs btree %x", snap.Header.GetSource(0).VFS.Root),
+	}, lines)
+}
+
+func TestExecuteCmdDiagBlobs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"blobs", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_diag(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// output should look like this
+	// snapshot            1      1.2 kB (1234 bytes)
+	// object              4      1.0 kB (1020 bytes)
+	// chunk               4      296 B (296 bytes)
+	// ...
+	// total              27      6.7 kB (6712 bytes)
+	lines := strings.Split(strings.Trim(bufOut.String(), "\n"), "\n")
+	fields := map[string]string{}
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		require.GreaterOrEqual(t, len(parts), 3)
+		fields[parts[0]] = parts[1]
+	}
+	require.Equal(t, "4", fields["chunk"])
+	require.Equal(t, "4", fields["object"])
+	require.Equal(t, "1", fields["snapshot"])
+	require.Contains(t, fields, "total")
+}
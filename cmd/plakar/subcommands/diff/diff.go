@@ -20,11 +20,14 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"iter"
 	"path"
+	"strings"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
@@ -38,6 +41,8 @@ func init() {
 
 func parse_cmd_diff(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	var opt_highlight bool
+	var opt_stat bool
+	var opt_file string
 	flags := flag.NewFlagSet("diff", flag.ExitOnError)
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT:PATH SNAPSHOT[:PATH]\n", flags.Name())
@@ -46,15 +51,27 @@ func parse_cmd_diff(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 	}
 
 	flags.BoolVar(&opt_highlight, "highlight", false, "highlight output")
+	flags.BoolVar(&opt_stat, "stat", false, "only print a summary of the changes between directories")
+	flags.StringVar(&opt_file, "file", "", "report the chunks of the file at `path` that differ between the snapshots")
 	flags.Parse(args)
 
 	if flags.NArg() != 2 {
 		return nil, fmt.Errorf("needs two snapshot ID and/or snapshot files to diff")
 	}
 
+	if opt_file != "" {
+		for _, arg := range flags.Args() {
+			if _, pathname := utils.ParseSnapshotPath(arg); pathname != "" {
+				return nil, fmt.Errorf("-file expects snapshot IDs without path")
+			}
+		}
+	}
+
 	return &Diff{
 		RepositorySecret: ctx.GetSecret(),
 		Highlight:        opt_highlight,
+		Stat:             opt_stat,
+		File:             opt_file,
 		SnapshotPath1:    flags.Arg(0),
 		SnapshotPath2:    flags.Arg(1),
 	}, nil
@@ -64,6 +81,8 @@ type Diff struct {
 	RepositorySecret []byte
 
 	Highlight     bool
+	Stat          bool
+	File          string
 	SnapshotPath1 string
 	SnapshotPath2 string
 }
@@ -86,8 +105,13 @@ func (cmd *Diff) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 	defer snap2.Close()
 
 	var diff string
-	if pathname1 == "" && pathname2 == "" {
-		diff, err = diff_filesystems(ctx, snap1, snap2)
+	if cmd.File != "" {
+		diff, err = diff_chunks(ctx, snap1, snap2, cmd.File)
+		if err != nil {
+			return 1, fmt.Errorf("diff: could not diff chunks: %w", err)
+		}
+	} else if pathname1 == "" && pathname2 == "" {
+		diff, err = diff_filesystems(ctx, snap1, snap2, cmd.Stat)
 		if err != nil {
 			return 1, fmt.Errorf("diff: could not diff snapshots: %w", err)
 		}
@@ -98,7 +122,7 @@ func (cmd *Diff) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 		if pathname2 == "" {
 			pathname2 = pathname1
 		}
-		diff, err = diff_pathnames(ctx, snap1, pathname1, snap2, pathname2)
+		diff, err = diff_pathnames(ctx, snap1, pathname1, snap2, pathname2, cmd.Stat)
 		if err != nil {
 			return 1, fmt.Errorf("diff: could not diff pathnames: %w", err)
 		}
@@ -115,7 +139,7 @@ func (cmd *Diff) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 	return 0, nil
 }
 
-func diff_filesystems(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot) (string, error) {
+func diff_filesystems(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot, stat bool) (string, error) {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
 		return "", err
@@ -126,18 +150,10 @@ func diff_filesystems(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, snap
 		return "", err
 	}
 
-	var f1, f2 *vfs.Entry
-	if f1, err = vfs1.GetEntry("/"); err != nil {
-		return "", err
-	}
-	if f2, err = vfs2.GetEntry("/"); err != nil {
-		return "", err
-	}
-
-	return diff_directories(ctx, f1, f2)
+	return diff_directories(ctx, vfs1, "/", vfs2, "/", stat)
 }
 
-func diff_pathnames(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string) (string, error) {
+func diff_pathnames(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string, stat bool) (string, error) {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
 		return "", err
@@ -157,7 +173,7 @@ func diff_pathnames(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, pathna
 	}
 
 	if f1.Stat().IsDir() && f2.Stat().IsDir() {
-		return diff_directories(ctx, f1, f2)
+		return diff_directories(ctx, vfs1, path.Clean("/"+pathname1), vfs2, path.Clean("/"+pathname2), stat)
 	}
 
 	if f1.Stat().IsDir() || f2.Stat().IsDir() {
@@ -167,8 +183,198 @@ func diff_pathnames(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, pathna
 	return diff_files(ctx, snap1, f1, snap2, f2)
 }
 
-func diff_directories(ctx *appcontext.AppContext, dirEntry1 *vfs.Entry, dirEntry2 *vfs.Entry) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+// below yields the entries beneath dir, relative to it, in the order of
+// the VFS btree.  A failure to walk the btree is stored in errp.  Since the
+// btree is sorted by depth first, the entries beneath dir at a given depth
+// are contiguous: each depth is scanned from the first of them.
+func below(fsc *vfs.Filesystem, dir string, errp *error) iter.Seq2[string, objects.MAC] {
+	prefix := dir
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	return func(yield func(string, objects.MAC) bool) {
+		tree, _, _ := fsc.BTrees()
+		for level := 0; ; level++ {
+			// pathnames can't hold a NUL, this sorts before every entry
+			// beneath dir at this depth
+			from := prefix + strings.Repeat("\x00/", level)
+			depth := strings.Count(from, "/")
+
+			it, err := tree.ScanFrom(from)
+			if err != nil {
+				*errp = err
+				return
+			}
+			found := false
+			for it.Next() {
+				pathname, mac := it.Current()
+				if !strings.HasPrefix(pathname, prefix) || strings.Count(pathname, "/") != depth {
+					break
+				}
+				if pathname == prefix {
+					// the root directory itself
+					continue
+				}
+				found = true
+				if !yield(pathname[len(prefix):], mac) {
+					return
+				}
+			}
+			if err := it.Err(); err != nil {
+				*errp = err
+				return
+			}
+			if !found {
+				// nothing deeper either
+				return
+			}
+		}
+	}
+}
+
+// diff_directories walks both VFS btrees side by side, their entries being
+// sorted the same way, and reports the paths added, removed and modified,
+// a path being modified if its object differs.
+func diff_directories(ctx *appcontext.AppContext, vfs1 *vfs.Filesystem, dir1 string, vfs2 *vfs.Filesystem, dir2 string, stat bool) (string, error) {
+	var err1, err2 error
+	next1, stop1 := iter.Pull2(below(vfs1, dir1, &err1))
+	defer stop1()
+	next2, stop2 := iter.Pull2(below(vfs2, dir2, &err2))
+	defer stop2()
+
+	var out strings.Builder
+	var added, removed, modified int
+	report := func(status string, pathname string) {
+		if !stat {
+			fmt.Fprintf(&out, "%s\t%s\n", status, pathname)
+		}
+	}
+
+	path1, mac1, ok1 := next1()
+	path2, mac2, ok2 := next2()
+	for ok1 || ok2 {
+		var cmp int
+		switch {
+		case !ok2:
+			cmp = -1
+		case !ok1:
+			cmp = 1
+		default:
+			cmp = vfs.PathCmp(path1, path2)
+		}
+
+		switch {
+		case cmp < 0:
+			removed++
+			report("D", path.Join(dir1, path1))
+			path1, mac1, ok1 = next1()
+
+		case cmp > 0:
+			added++
+			report("A", path.Join(dir2, path2))
+			path2, mac2, ok2 = next2()
+
+		default:
+			if mac1 != mac2 {
+				e1, err := vfs1.ResolveEntry(mac1)
+				if err != nil {
+					return "", err
+				}
+				e2, err := vfs2.ResolveEntry(mac2)
+				if err != nil {
+					return "", err
+				}
+				if e1.Object != e2.Object {
+					modified++
+					report("M", path.Join(dir2, path2))
+				}
+			}
+			path1, mac1, ok1 = next1()
+			path2, mac2, ok2 = next2()
+		}
+	}
+
+	if err1 != nil {
+		return "", err1
+	}
+	if err2 != nil {
+		return "", err2
+	}
+
+	if stat {
+		fmt.Fprintf(&out, "%d added, %d removed, %d modified\n", added, removed, modified)
+	}
+	return out.String(), nil
+}
+
+// diff_chunks reports the byte ranges of a file that differ between two
+// snapshots.  Chunks are matched by MAC, so content shifted by an insertion
+// or a removal isn't reported as changed.  Text files are also compared
+// line by line.
+func diff_chunks(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot, pathname string) (string, error) {
+	vfs1, err := snap1.Filesystem()
+	if err != nil {
+		return "", err
+	}
+
+	vfs2, err := snap2.Filesystem()
+	if err != nil {
+		return "", err
+	}
+
+	var f1, f2 *vfs.Entry
+	if f1, err = vfs1.GetEntry(pathname); err != nil {
+		return "", err
+	}
+	if f2, err = vfs2.GetEntry(pathname); err != nil {
+		return "", err
+	}
+
+	if f1.ResolvedObject == nil || f2.ResolvedObject == nil {
+		return "", fmt.Errorf("%s: not a regular file", pathname)
+	}
+	if f1.Object == f2.Object {
+		return diff_files(ctx, snap1, f1, snap2, f2)
+	}
+
+	chunks := func(object *objects.Object) ([]string, []uint64) {
+		macs := make([]string, len(object.Chunks))
+		offsets := make([]uint64, len(object.Chunks)+1)
+		for i, chunk := range object.Chunks {
+			macs[i] = string(chunk.ContentMAC[:])
+			offsets[i+1] = offsets[i] + uint64(chunk.Length)
+		}
+		return macs, offsets
+	}
+	macs1, offsets1 := chunks(f1.ResolvedObject)
+	macs2, offsets2 := chunks(f2.ResolvedObject)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %x:%s\n", snap1.Header.GetIndexShortID(), pathname)
+	fmt.Fprintf(&out, "+++ %x:%s\n", snap2.Header.GetIndexShortID(), pathname)
+
+	matcher := difflib.NewMatcherWithJunk(macs1, macs2, false, nil)
+	for _, op := range matcher.GetOpCodes() {
+		if op.Tag == 'e' {
+			continue
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@ %d chunks -> %d chunks\n",
+			offsets1[op.I1], offsets1[op.I2]-offsets1[op.I1],
+			offsets2[op.J1], offsets2[op.J2]-offsets2[op.J1],
+			op.I2-op.I1, op.J2-op.J1)
+	}
+
+	if strings.HasPrefix(f1.ResolvedObject.ContentType, "text/") &&
+		strings.HasPrefix(f2.ResolvedObject.ContentType, "text/") {
+		text, err := diff_files(ctx, snap1, f1, snap2, f2)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(text)
+	}
+
+	return out.String(), nil
 }
 
 func diff_files(ctx *appcontext.AppContext, snap1 *snapshot.Snapshot, fileEntry1 *vfs.Entry, snap2 *snapshot.Snapshot, fileEntry2 *vfs.Entry) (string, error) {
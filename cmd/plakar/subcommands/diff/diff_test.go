@@ -5,7 +5,9 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -205,3 +207,212 @@ func TestExecuteCmdDiffFiles(t *testing.T) {
 -hello dummy
 +hello dumpy`)
 }
+
+func TestExecuteCmdDiffDirectories(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// create one snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup1", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	// add, remove and modify a file before second backup
+	err = os.WriteFile(tmpBackupDir+"/another_subdir/new.txt", []byte("hello new"), 0644)
+	require.NoError(t, err)
+	err = os.Remove(tmpBackupDir + "/subdir/foo.txt")
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/subdir/dummy.txt", []byte("hello dumpy"), 0644)
+	require.NoError(t, err)
+
+	// create second snapshot
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap2)
+
+	snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup2", MaxConcurrency: 1})
+
+	err = snap2.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId1 := snap.Header.GetIndexShortID()
+	indexId2 := snap2.Header.GetIndexShortID()
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	args := []string{hex.EncodeToString(indexId1[:]), hex.EncodeToString(indexId2[:])}
+
+	subcommand, err := parse_cmd_diff(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	require.Equal(t, fmt.Sprintf("A\t%[1]s/another_subdir/new.txt\nM\t%[1]s/subdir/dummy.txt\nD\t%[1]s/subdir/foo.txt\n", backupDir), bufOut.String())
+
+	// the same, below the backup directory
+	bufOut.Reset()
+	args = []string{
+		fmt.Sprintf("%s:%s/subdir", hex.EncodeToString(indexId1[:]), backupDir),
+		fmt.Sprintf("%s:%s/subdir", hex.EncodeToString(indexId2[:]), backupDir),
+	}
+	subcommand, err = parse_cmd_diff(ctx, args)
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	require.Equal(t, fmt.Sprintf("M\t%[1]s/subdir/dummy.txt\nD\t%[1]s/subdir/foo.txt\n", backupDir), bufOut.String())
+
+	bufOut.Reset()
+	args = []string{"-stat", hex.EncodeToString(indexId1[:]), hex.EncodeToString(indexId2[:])}
+	subcommand, err = parse_cmd_diff(ctx, args)
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	require.Equal(t, "1 added, 1 removed, 1 modified\n", bufOut.String())
+}
+
+// below only scans the directory it is given, yielding the same entries in
+// the same order as a scan of the whole btree filtered by prefix.
+func TestBelow(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// siblings sorting before and after the separator
+	require.NoError(t, os.MkdirAll(tmpBackupDir+"/subdir/nested/deeper", 0755))
+	require.NoError(t, os.MkdirAll(tmpBackupDir+"/subdir-2/nested", 0755))
+	for _, name := range []string{"subdir/nested/deeper/deep.txt", "subdir/nested/a.txt", "subdir-2/nested/b.txt", "subdirz"} {
+		require.NoError(t, os.WriteFile(tmpBackupDir+"/"+name, []byte(name), 0644))
+	}
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+
+	fsc, err := snap.Filesystem()
+	require.NoError(t, err)
+	tree, _, _ := fsc.BTrees()
+
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	for _, dir := range []string{"/", backupDir, backupDir + "/subdir", backupDir + "/subdir/nested/deeper/deep.txt"} {
+		prefix := strings.TrimSuffix(dir, "/") + "/"
+		expected := []string{}
+		it, err := tree.ScanAll()
+		require.NoError(t, err)
+		for it.Next() {
+			pathname, _ := it.Current()
+			if strings.HasPrefix(pathname, prefix) && pathname != prefix {
+				expected = append(expected, pathname[len(prefix):])
+			}
+		}
+		require.NoError(t, it.Err())
+
+		var err1 error
+		pathnames := []string{}
+		for pathname := range below(fsc, dir, &err1) {
+			pathnames = append(pathnames, pathname)
+		}
+		require.NoError(t, err1)
+		require.Equal(t, expected, pathnames, dir)
+	}
+}
+
+func TestExecuteCmdDiffChunks(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	repo, tmpBackupDir := generateFixtures(t, bufOut, bufErr)
+
+	// a file large enough to be split in several chunks
+	const size = 16 << 20
+	const modified = 8 << 20
+	data := make([]byte, size)
+	_, err := rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(t, err)
+	err = os.WriteFile(tmpBackupDir+"/large.bin", data, 0644)
+	require.NoError(t, err)
+
+	// create one snapshot
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup1", MaxConcurrency: 1})
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	// modify the middle of the file before second backup
+	copy(data[modified:], bytes.Repeat([]byte{0xff}, 4096))
+	err = os.WriteFile(tmpBackupDir+"/large.bin", data, 0644)
+	require.NoError(t, err)
+
+	// create second snapshot
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NotNil(t, snap2)
+
+	snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup2", MaxConcurrency: 1})
+
+	err = snap2.Repository().RebuildState()
+	require.NoError(t, err)
+
+	ctx := repo.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId1 := snap.Header.GetIndexShortID()
+	indexId2 := snap2.Header.GetIndexShortID()
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	args := []string{"-file", backupDir + "/large.bin", hex.EncodeToString(indexId1[:]), hex.EncodeToString(indexId2[:])}
+
+	subcommand, err := parse_cmd_diff(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var hunks []string
+	for _, line := range strings.Split(bufOut.String(), "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			hunks = append(hunks, line)
+		}
+	}
+	require.Len(t, hunks, 1)
+
+	var offset1, length1, offset2, length2, chunks1, chunks2 int
+	_, err = fmt.Sscanf(hunks[0], "@@ -%d,%d +%d,%d @@ %d chunks -> %d chunks",
+		&offset1, &length1, &offset2, &length2, &chunks1, &chunks2)
+	require.NoError(t, err)
+	require.LessOrEqual(t, offset1, modified)
+	require.Greater(t, offset1+length1, modified)
+	require.Equal(t, offset1, offset2)
+	require.Less(t, length1, size/2)
+	require.Positive(t, chunks1)
+	require.Positive(t, chunks2)
+}
@@ -17,10 +17,16 @@
 package digest
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -38,6 +44,8 @@ func init() {
 
 func parse_cmd_digest(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	var opt_hashing string
+	var opt_format string
+	var opt_check string
 
 	flags := flag.NewFlagSet("digest", flag.ExitOnError)
 	flags.Usage = func() {
@@ -47,6 +55,8 @@ func parse_cmd_digest(ctx *appcontext.AppContext, args []string) (subcommands.Su
 	}
 
 	flags.StringVar(&opt_hashing, "hashing", "SHA256", "hashing algorithm to use")
+	flags.StringVar(&opt_format, "format", "bsd", "output format: bsd, gnu, json")
+	flags.StringVar(&opt_check, "check", "", "verify digests against a GNU-format manifest file")
 	flags.Parse(args)
 
 	if flags.NArg() == 0 {
@@ -59,9 +69,22 @@ func parse_cmd_digest(ctx *appcontext.AppContext, args []string) (subcommands.Su
 		return nil, fmt.Errorf("unsupported hashing algorithm: %s", hashingFunction)
 	}
 
+	switch opt_format {
+	case "bsd", "gnu", "json":
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", opt_format)
+	}
+
+	if opt_check != "" && flags.NArg() != 1 {
+		ctx.GetLogger().Error("%s: -check requires exactly one snapshot", flags.Name())
+		return nil, fmt.Errorf("-check requires exactly one snapshot")
+	}
+
 	return &Digest{
 		RepositorySecret: ctx.GetSecret(),
 		HashingFunction:  hashingFunction,
+		Format:           opt_format,
+		Check:            opt_check,
 		Targets:          flags.Args(),
 	}, nil
 }
@@ -70,20 +93,48 @@ type Digest struct {
 	RepositorySecret []byte
 
 	HashingFunction string
+	Format          string
+	Check           string
 	Targets         []string
 }
 
+type digestResult struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+}
+
 func (cmd *Digest) Name() string {
 	return "digest"
 }
 
 func (cmd *Digest) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if cmd.Check != "" {
+		return cmd.executeCheck(ctx, repo)
+	}
+
+	results := []digestResult{}
+	emit := func(pathname string, digest []byte) {
+		switch cmd.Format {
+		case "json":
+			results = append(results, digestResult{
+				Path:      pathname,
+				Algorithm: cmd.HashingFunction,
+				Checksum:  fmt.Sprintf("%x", digest),
+			})
+		case "gnu":
+			fmt.Fprintf(ctx.Stdout, "%x  %s\n", digest, pathname)
+		default:
+			fmt.Fprintf(ctx.Stdout, "%s (%s) = %x\n", cmd.HashingFunction, pathname, digest)
+		}
+	}
+
 	errors := 0
 	for _, snapshotPath := range cmd.Targets {
 
-		snap, pathname, err := utils.OpenSnapshotByPath(repo, snapshotPath)
+		snap, pathnames, err := utils.OpenSnapshotByPattern(repo, snapshotPath)
 		if err != nil {
-			ctx.GetLogger().Error("digest: %s: %s", pathname, err)
+			ctx.GetLogger().Error("digest: %s: %s", snapshotPath, err)
 			errors++
 			continue
 		}
@@ -94,14 +145,22 @@ func (cmd *Digest) Execute(ctx *appcontext.AppContext, repo *repository.Reposito
 			continue
 		}
 
-		cmd.displayDigests(ctx, fs, repo, snap, pathname)
+		for _, pathname := range pathnames {
+			cmd.displayDigests(ctx, fs, repo, snap, pathname, emit)
+		}
 		snap.Close()
 	}
 
+	if cmd.Format == "json" {
+		if err := json.NewEncoder(ctx.Stdout).Encode(results); err != nil {
+			return 1, err
+		}
+	}
+
 	return 0, nil
 }
 
-func (cmd *Digest) displayDigests(ctx *appcontext.AppContext, fs *vfs.Filesystem, repo *repository.Repository, snap *snapshot.Snapshot, pathname string) error {
+func (cmd *Digest) displayDigests(ctx *appcontext.AppContext, fs *vfs.Filesystem, repo *repository.Repository, snap *snapshot.Snapshot, pathname string, emit func(string, []byte)) error {
 	fsinfo, err := fs.GetEntry(pathname)
 	if err != nil {
 		return err
@@ -112,8 +171,19 @@ func (cmd *Digest) displayDigests(ctx *appcontext.AppContext, fs *vfs.Filesystem
 		if err != nil {
 			return err
 		}
-		for child := range iter {
-			if err := cmd.displayDigests(ctx, fs, repo, snap, path.Join(pathname, child.Stat().Name())); err != nil {
+
+		// sort children so that the output is stable across runs
+		children := []string{}
+		for child, err := range iter {
+			if err != nil {
+				return err
+			}
+			children = append(children, child.Stat().Name())
+		}
+		sort.Strings(children)
+
+		for _, child := range children {
+			if err := cmd.displayDigests(ctx, fs, repo, snap, path.Join(pathname, child), emit); err != nil {
 				return err
 			}
 		}
@@ -123,18 +193,108 @@ func (cmd *Digest) displayDigests(ctx *appcontext.AppContext, fs *vfs.Filesystem
 		return nil
 	}
 
-	rd, err := snap.NewReader(pathname)
+	digest, err := cmd.computeDigest(snap, pathname)
 	if err != nil {
 		return err
 	}
+	emit(pathname, digest)
+	return nil
+}
+
+func (cmd *Digest) computeDigest(snap *snapshot.Snapshot, pathname string) ([]byte, error) {
+	rd, err := snap.NewReader(pathname)
+	if err != nil {
+		return nil, err
+	}
 	defer rd.Close()
 
-	algorithm := cmd.HashingFunction
-	hasher := hashing.GetHasher(algorithm)
+	hasher := hashing.GetHasher(cmd.HashingFunction)
 	if _, err := io.Copy(hasher, rd); err != nil {
-		return err
+		return nil, err
 	}
-	digest := hasher.Sum(nil)
-	fmt.Fprintf(ctx.Stdout, "%s (%s) = %x\n", algorithm, pathname, digest)
-	return nil
+	return hasher.Sum(nil), nil
+}
+
+type manifestEntry struct {
+	pathname string
+	digest   []byte
+}
+
+// parseManifest reads a GNU-format checksum file, as produced by
+// sha256sum(1) or `plakar digest -format gnu`.
+func parseManifest(rd io.Reader) ([]manifestEntry, error) {
+	entries := []manifestEntry{}
+
+	scanner := bufio.NewScanner(rd)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		digest, pathname, found := strings.Cut(line, " ")
+		if !found || pathname == "" {
+			return nil, fmt.Errorf("line %d: improperly formatted checksum line", lineno)
+		}
+		// the second separator character is ' ' for text and '*' for binary mode
+		if pathname[0] == ' ' || pathname[0] == '*' {
+			pathname = pathname[1:]
+		}
+
+		decoded, err := hex.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid digest: %w", lineno, err)
+		}
+		entries = append(entries, manifestEntry{pathname: pathname, digest: decoded})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (cmd *Digest) executeCheck(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	fp, err := os.Open(cmd.Check)
+	if err != nil {
+		return 1, err
+	}
+	entries, err := parseManifest(fp)
+	fp.Close()
+	if err != nil {
+		return 1, fmt.Errorf("digest: %s: %w", cmd.Check, err)
+	}
+
+	snap, root, err := utils.OpenSnapshotByPath(repo, cmd.Targets[0])
+	if err != nil {
+		return 1, fmt.Errorf("digest: %s: %w", cmd.Targets[0], err)
+	}
+	defer snap.Close()
+
+	failures := 0
+	for _, entry := range entries {
+		pathname := entry.pathname
+		if !strings.HasPrefix(pathname, "/") {
+			pathname = path.Join(root, pathname)
+		}
+
+		digest, err := cmd.computeDigest(snap, pathname)
+		if err != nil {
+			fmt.Fprintf(ctx.Stdout, "%s: FAILED open or read\n", entry.pathname)
+			failures++
+			continue
+		}
+		if !bytes.Equal(digest, entry.digest) {
+			fmt.Fprintf(ctx.Stdout, "%s: FAILED\n", entry.pathname)
+			failures++
+			continue
+		}
+		fmt.Fprintf(ctx.Stdout, "%s: OK\n", entry.pathname)
+	}
+
+	if failures != 0 {
+		return 1, fmt.Errorf("digest: %d of %d computed checksums did NOT match", failures, len(entries))
+	}
+	return 0, nil
 }
@@ -3,8 +3,10 @@ package digest
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 
@@ -108,3 +110,248 @@ func TestExecuteCmdDigestWrongHashing(t *testing.T) {
 	require.Error(t, err, "at least one parameter is required")
 	require.Nil(t, subcommand)
 }
+
+func TestExecuteCmdDigestFormatGNU(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-format", "gnu", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// sha256("hello dummy")
+	expected := "f4da3ebff9dbd21cfb270054dee6948f96de93f68f525e0bf4067ce2f9e2d639"
+
+	output := bufOut.String()
+	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	require.Len(t, lines, 4)
+
+	found := false
+	for _, line := range lines {
+		parts := strings.SplitN(line, "  ", 2)
+		require.Len(t, parts, 2)
+		require.Len(t, parts[0], 64)
+		if strings.HasSuffix(parts[1], "/subdir/dummy.txt") {
+			require.Equal(t, expected, parts[0])
+			found = true
+		}
+	}
+	require.True(t, found)
+}
+
+func TestExecuteCmdDigestFormatJSON(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-format", "json", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var results []struct {
+		Path      string `json:"path"`
+		Algorithm string `json:"algorithm"`
+		Checksum  string `json:"checksum"`
+	}
+	err = json.Unmarshal(bufOut.Bytes(), &results)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	paths := []string{}
+	for _, result := range results {
+		require.Equal(t, "SHA256", result.Algorithm)
+		require.Len(t, result.Checksum, 64)
+		paths = append(paths, result.Path)
+	}
+	require.True(t, sort.StringsAreSorted(paths))
+}
+
+func TestExecuteCmdDigestFormatStable(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-format", "bsd", hex.EncodeToString(indexId[:])}
+
+	outputs := []string{}
+	for i := 0; i < 2; i++ {
+		bufOut.Reset()
+		subcommand, err := parse_cmd_digest(ctx, args)
+		require.NoError(t, err)
+
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+		outputs = append(outputs, bufOut.String())
+	}
+	require.Equal(t, outputs[0], outputs[1])
+	for _, line := range strings.Split(strings.Trim(outputs[0], "\n"), "\n") {
+		require.True(t, strings.HasPrefix(line, "SHA256 ("))
+	}
+}
+
+func TestExecuteCmdDigestWrongFormat(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-format", "xml", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.Error(t, err)
+	require.Nil(t, subcommand)
+}
+
+func TestExecuteCmdDigestCheck(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+
+	// sha256("hello dummy") matches, the foo.txt digest is bogus
+	manifest := fmt.Sprintf("%s  subdir/dummy.txt\n%s  subdir/foo.txt\n",
+		"f4da3ebff9dbd21cfb270054dee6948f96de93f68f525e0bf4067ce2f9e2d639",
+		"0000000000000000000000000000000000000000000000000000000000000000")
+	manifestFile := fmt.Sprintf("%s/manifest.sha256", t.TempDir())
+	err := os.WriteFile(manifestFile, []byte(manifest), 0644)
+	require.NoError(t, err)
+
+	args := []string{"-check", manifestFile, hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+
+	output := bufOut.String()
+	require.Contains(t, output, "subdir/dummy.txt: OK\n")
+	require.Contains(t, output, "subdir/foo.txt: FAILED\n")
+}
+
+func TestExecuteCmdDigestCheckMissing(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+
+	manifest := "f4da3ebff9dbd21cfb270054dee6948f96de93f68f525e0bf4067ce2f9e2d639  subdir/missing.txt\n"
+	manifestFile := fmt.Sprintf("%s/manifest.sha256", t.TempDir())
+	err := os.WriteFile(manifestFile, []byte(manifest), 0644)
+	require.NoError(t, err)
+
+	args := []string{"-check", manifestFile, hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufOut.String(), "subdir/missing.txt: FAILED open or read\n")
+}
+
+func TestExecuteCmdDigestGlob(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-format", "json", hex.EncodeToString(indexId[:]) + ":*/*.txt"}
+
+	subcommand, err := parse_cmd_digest(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var results []struct {
+		Path string `json:"path"`
+	}
+	err = json.Unmarshal(bufOut.Bytes(), &results)
+	require.NoError(t, err)
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	paths := []string{}
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	require.Equal(t, []string{
+		root + "/another_subdir/bar.txt",
+		root + "/subdir/dummy.txt",
+		root + "/subdir/foo.txt",
+	}, paths)
+}
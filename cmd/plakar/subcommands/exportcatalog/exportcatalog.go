@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package exportcatalog
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	subcommands.Register("export-catalog", parse_cmd_export_catalog)
+}
+
+const catalogSchema = `CREATE TABLE files (
+	path TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	mode TEXT NOT NULL,
+	mtime INTEGER NOT NULL,
+	uid INTEGER NOT NULL,
+	gid INTEGER NOT NULL,
+	object_checksum TEXT
+)`
+
+func parse_cmd_export_catalog(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("export-catalog", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s SNAPSHOT[:PATH] FILE\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		ctx.GetLogger().Error("%s: a snapshot and a catalog file are required", flags.Name())
+		return nil, fmt.Errorf("a snapshot and a catalog file are required")
+	}
+
+	output := flags.Arg(1)
+	// the command may be executed by the agent, which has its own cwd
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(ctx.CWD, output)
+	}
+
+	return &ExportCatalog{
+		RepositorySecret: ctx.GetSecret(),
+
+		Snapshot: flags.Arg(0),
+		Output:   output,
+	}, nil
+}
+
+type ExportCatalog struct {
+	RepositorySecret []byte
+
+	Snapshot string
+	Output   string
+}
+
+func (cmd *ExportCatalog) Name() string {
+	return "export-catalog"
+}
+
+func (cmd *ExportCatalog) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	if _, err := os.Stat(cmd.Output); err == nil {
+		return 1, fmt.Errorf("%s: %s: %w", cmd.Name(), cmd.Output, fs.ErrExist)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return 1, fmt.Errorf("%s: %w", cmd.Name(), err)
+	}
+
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.Snapshot)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	fsc, err := snap.Filesystem()
+	if err != nil {
+		return 1, err
+	}
+
+	n, err := writeCatalog(cmd.Output, fsc, pathname)
+	if err != nil {
+		os.Remove(cmd.Output)
+		return 1, fmt.Errorf("%s: %w", cmd.Name(), err)
+	}
+
+	ctx.GetLogger().Info("%s: catalog of %d entries of %x:%s written to %s",
+		cmd.Name(),
+		n,
+		snap.Header.GetIndexShortID(),
+		pathname,
+		cmd.Output)
+	return 0, nil
+}
+
+// writeCatalog creates the SQLite database file and inserts a row for every
+// entry below pathname, returning the number of rows.
+func writeCatalog(file string, fsc *vfs.Filesystem, pathname string) (int, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(catalogSchema); err != nil {
+		return 0, err
+	}
+
+	// a single transaction, committing each row would be very slow
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO files (path, size, mode, mtime, uid, gid, object_checksum) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	n := 0
+	for entry, err := range fsc.Files(pathname) {
+		if err != nil {
+			return 0, err
+		}
+
+		var checksum sql.NullString
+		if entry.HasObject() {
+			checksum.String = hex.EncodeToString(entry.ResolvedObject.ContentMAC[:])
+			checksum.Valid = true
+		}
+
+		fileinfo := entry.Stat()
+		_, err := stmt.Exec(entry.Path(), fileinfo.Size(), fileinfo.Mode().String(),
+			fileinfo.ModTime().Unix(), fileinfo.Uid(), fileinfo.Gid(), checksum)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", entry.Path(), err)
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, db.Close()
+}
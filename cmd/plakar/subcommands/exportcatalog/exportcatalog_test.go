@@ -0,0 +1,108 @@
+package exportcatalog
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockDir("another_subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+		ptesting.NewMockFile("another_subdir/bar.txt", 0644, "hello bar"),
+	})
+}
+
+func TestExecuteCmdExportCatalog(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	catalog := filepath.Join(t.TempDir(), "catalog.db")
+	indexId := snap.Header.GetIndexID()
+	args := []string{hex.EncodeToString(indexId[:]), catalog}
+
+	subcommand, err := parse_cmd_export_catalog(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+	require.Equal(t, "export-catalog", subcommand.(*ExportCatalog).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	db, err := sql.Open("sqlite", catalog)
+	require.NoError(t, err)
+	defer db.Close()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	// the catalog covers the backed up directory
+	root := snap.Header.GetSource(0).Importer.Directory
+	expected := 0
+	for pathname, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if pathname == root || strings.HasPrefix(pathname, root+"/") {
+			expected++
+		}
+	}
+	require.Equal(t, 6, expected)
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files`).Scan(&count))
+	require.Equal(t, expected, count)
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM files WHERE object_checksum IS NOT NULL`).Scan(&count))
+	require.Equal(t, 3, count)
+
+	pathname := ""
+	for p, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if filepath.Base(p) == "dummy.txt" {
+			pathname = p
+		}
+	}
+	entry, err := fs.GetEntry(pathname)
+	require.NoError(t, err)
+
+	var size, mtime int64
+	var mode, checksum string
+	err = db.QueryRow(`SELECT size, mode, mtime, object_checksum FROM files WHERE path = ?`, pathname).Scan(&size, &mode, &mtime, &checksum)
+	require.NoError(t, err)
+	require.Equal(t, int64(len("hello dummy")), size)
+	require.Equal(t, "-rw-r--r--", mode)
+	require.Equal(t, entry.Stat().ModTime().Unix(), mtime)
+	require.Equal(t, hex.EncodeToString(entry.ResolvedObject.ContentMAC[:]), checksum)
+
+	// an existing catalog is not overwritten
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+}
+
+func TestExecuteCmdExportCatalogInvalidArgs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	_, err := parse_cmd_export_catalog(snap.AppContext(), []string{"abc"})
+	require.Error(t, err)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package find
+
+import (
+	"flag"
+	"fmt"
+	"iter"
+	"path"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+const globChars = `*?[\`
+
+func init() {
+	subcommands.Register("find", parse_cmd_find)
+}
+
+func parse_cmd_find(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_snapshot string
+
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] PATTERN\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opt_snapshot, "snapshot", "", "snapshot to search in")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("need a pattern")
+	}
+
+	pattern := flags.Arg(0)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern: %s", pattern)
+	}
+
+	return &Find{
+		RepositorySecret: ctx.GetSecret(),
+
+		Snapshot: opt_snapshot,
+		Pattern:  pattern,
+	}, nil
+}
+
+type Find struct {
+	RepositorySecret []byte
+
+	Snapshot string
+	Pattern  string
+}
+
+func (cmd *Find) Name() string {
+	return "find"
+}
+
+func (cmd *Find) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	var snapshots []objects.MAC
+	if len(cmd.Snapshot) == 0 {
+		locateOptions := utils.NewDefaultLocateOptions()
+		locateOptions.MaxConcurrency = ctx.MaxConcurrency
+		locateOptions.SortOrder = utils.LocateSortOrderAscending
+
+		snapshotIDs, err := utils.LocateSnapshotIDs(repo, locateOptions)
+		if err != nil {
+			return 1, fmt.Errorf("find: could not fetch snapshots list: %w", err)
+		}
+		snapshots = append(snapshots, snapshotIDs...)
+	} else {
+		snapshotIDs := utils.LookupSnapshotByPrefix(repo, cmd.Snapshot)
+		snapshots = append(snapshots, snapshotIDs...)
+	}
+
+	for _, snapshotID := range snapshots {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return 1, fmt.Errorf("find: could not get snapshot: %w", err)
+		}
+
+		fs, err := snap.Filesystem()
+		if err != nil {
+			snap.Close()
+			return 1, fmt.Errorf("find: could not get filesystem: %w", err)
+		}
+
+		for pathname, err := range cmd.find(fs) {
+			if err != nil {
+				snap.Close()
+				return 1, fmt.Errorf("find: could not get pathname: %w", err)
+			}
+			fmt.Fprintf(ctx.Stdout, "%x:%s\n", snap.Header.Identifier[0:4], pathname)
+		}
+		snap.Close()
+	}
+	return 0, nil
+}
+
+// find returns the pathnames of fs matching the pattern.  An absolute
+// pattern is matched against the full pathname and its literal prefix
+// is used to only scan the relevant part of the tree; other patterns
+// are matched against the base name of every pathname.
+func (cmd *Find) find(fs *vfs.Filesystem) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var pathnames iter.Seq2[string, error]
+		var match func(string) bool
+
+		if path.IsAbs(cmd.Pattern) {
+			prefix := cmd.Pattern
+			if idx := strings.IndexAny(cmd.Pattern, globChars); idx != -1 {
+				prefix = cmd.Pattern[:idx]
+				match = func(pathname string) bool {
+					matched, _ := path.Match(cmd.Pattern, pathname)
+					return matched
+				}
+			}
+			pathnames = fs.PathnamesWithPrefix(prefix)
+		} else {
+			pathnames = fs.Pathnames()
+			match = func(pathname string) bool {
+				matched, _ := path.Match(cmd.Pattern, path.Base(pathname))
+				return matched
+			}
+		}
+
+		for pathname, err := range pathnames {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if match != nil && !match(pathname) {
+				continue
+			}
+			if !yield(pathname, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package find
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockDir("another_subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+		ptesting.NewMockFile("another_subdir/bar.txt", 0644, "hello bar"),
+	})
+}
+
+func runFind(t *testing.T, snap *snapshot.Snapshot, bufOut *bytes.Buffer, args []string) []string {
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = snap.Repository().Location()
+
+	subcommand, err := parse_cmd_find(ctx, args)
+	require.NoError(t, err)
+	require.Equal(t, "find", subcommand.(*Find).Name())
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, snap.Repository())
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output := strings.Trim(bufOut.String(), "\n")
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+func TestExecuteCmdFindPrefix(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	shortID := fmt.Sprintf("%x", snap.Header.Identifier[0:4])
+
+	lines := runFind(t, snap, bufOut, []string{backupDir + "/sub"})
+	require.Equal(t, []string{
+		shortID + ":" + backupDir + "/subdir",
+		shortID + ":" + backupDir + "/subdir/dummy.txt",
+		shortID + ":" + backupDir + "/subdir/foo.txt",
+	}, lines)
+
+	lines = runFind(t, snap, bufOut, []string{"-snapshot", shortID, backupDir + "/another_subdir/"})
+	require.Equal(t, []string{shortID + ":" + backupDir + "/another_subdir/bar.txt"}, lines)
+
+	lines = runFind(t, snap, bufOut, []string{"-snapshot", "00000000", backupDir + "/sub"})
+	require.Empty(t, lines)
+}
+
+func TestExecuteCmdFindGlob(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	shortID := fmt.Sprintf("%x", snap.Header.Identifier[0:4])
+
+	lines := runFind(t, snap, bufOut, []string{"*.txt"})
+	require.Equal(t, []string{
+		shortID + ":" + backupDir + "/another_subdir/bar.txt",
+		shortID + ":" + backupDir + "/subdir/dummy.txt",
+		shortID + ":" + backupDir + "/subdir/foo.txt",
+	}, lines)
+
+	lines = runFind(t, snap, bufOut, []string{backupDir + "/*/f*"})
+	require.Equal(t, []string{shortID + ":" + backupDir + "/subdir/foo.txt"}, lines)
+}
+
+func TestParseCmdFind(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	_, err := parse_cmd_find(snap.AppContext(), []string{})
+	require.EqualError(t, err, "need a pattern")
+
+	_, err = parse_cmd_find(snap.AppContext(), []string{"[a-"})
+	require.EqualError(t, err, "invalid pattern: [a-")
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package fsck
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+var ErrPackfileNotFound = errors.New("packfile not found in storage")
+
+func init() {
+	subcommands.Register("fsck", parse_cmd_fsck)
+}
+
+func parse_cmd_fsck(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	return &Fsck{
+		RepositorySecret: ctx.GetSecret(),
+	}, nil
+}
+
+type Fsck struct {
+	RepositorySecret []byte
+}
+
+func (cmd *Fsck) Name() string {
+	return "fsck"
+}
+
+func (cmd *Fsck) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		return 1, err
+	}
+
+	checker := &locationChecker{
+		repo:     repo,
+		stored:   make(map[objects.MAC]struct{}, len(packfiles)),
+		sizes:    make(map[objects.MAC]uint64),
+		failures: make(map[objects.MAC]error),
+	}
+	for _, packfileMAC := range packfiles {
+		checker.stored[packfileMAC] = struct{}{}
+	}
+
+	var checked, dangling uint64
+	for _, Type := range resources.Types() {
+		for de, err := range repo.ListLiveObjectsOfType(Type) {
+			if err != nil {
+				return 1, err
+			}
+
+			checked++
+			if err := checker.check(de.Location); err != nil {
+				ctx.GetLogger().Warn("%s: %s %x: packfile %x: %s", cmd.Name(), de.Type, de.Blob, de.Location.Packfile, err)
+				dangling++
+			}
+		}
+	}
+
+	ctx.GetLogger().Info("%s: %d locations in %d packfiles checked, %d dangling", cmd.Name(), checked, len(packfiles), dangling)
+
+	if dangling != 0 {
+		return 1, fmt.Errorf("fsck failed: %d dangling locations", dangling)
+	}
+	return 0, nil
+}
+
+// locationChecker reads the footer of each packfile at most once to learn
+// the size of the area holding its blobs, which ends where the index
+// starts.
+type locationChecker struct {
+	repo     *repository.Repository
+	stored   map[objects.MAC]struct{}
+	sizes    map[objects.MAC]uint64
+	failures map[objects.MAC]error
+}
+
+func (lc *locationChecker) check(loc state.Location) error {
+	if _, exists := lc.stored[loc.Packfile]; !exists {
+		return ErrPackfileNotFound
+	}
+	if err, failed := lc.failures[loc.Packfile]; failed {
+		return err
+	}
+
+	size, loaded := lc.sizes[loc.Packfile]
+	if !loaded {
+		footer, err := lc.repo.GetPackfileFooter(loc.Packfile)
+		if err != nil {
+			lc.failures[loc.Packfile] = fmt.Errorf("failed to load packfile footer: %w", err)
+			return lc.failures[loc.Packfile]
+		}
+		size = footer.IndexOffset
+		lc.sizes[loc.Packfile] = size
+	}
+
+	if loc.Offset+uint64(loc.Length) > size {
+		return fmt.Errorf("location %d+%d out of bounds, packfile holds %d bytes of blobs", loc.Offset, loc.Length, size)
+	}
+	return nil
+}
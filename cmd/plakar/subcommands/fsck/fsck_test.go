@@ -0,0 +1,132 @@
+package fsck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+	})
+}
+
+func chunkOf(t *testing.T, snap *snapshot.Snapshot, name string) objects.MAC {
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	entry, err := fs.GetEntry(snap.Header.GetSource(0).Importer.Directory + "/subdir/" + name)
+	require.NoError(t, err)
+	require.Len(t, entry.ResolvedObject.Chunks, 1)
+	return entry.ResolvedObject.Chunks[0].ContentMAC
+}
+
+func TestExecuteCmdFsck(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	subcommand, err := parse_cmd_fsck(ctx, []string{})
+	require.NoError(t, err)
+	require.Equal(t, "fsck", subcommand.(*Fsck).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "info: fsck: ")
+	require.Contains(t, bufOut.String(), "0 dangling")
+	require.Empty(t, bufErr.String())
+
+	_, err = parse_cmd_fsck(ctx, []string{"extra"})
+	require.Error(t, err)
+}
+
+func TestExecuteCmdFsckDeletedPackfile(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.HomeDir = repo.Location()
+
+	chunk := chunkOf(t, snap, "dummy.txt")
+	packfileMAC, exists, err := repo.GetPackfileForBlob(resources.RT_CHUNK, chunk)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, repo.Store().DeletePackfile(packfileMAC))
+
+	// every blob of the deleted packfile is reported
+	affected := 0
+	for _, err := range repo.ListPackfileBlobs(packfileMAC) {
+		require.NoError(t, err)
+		affected++
+	}
+	require.NotZero(t, affected)
+
+	bufOut.Reset()
+	status, err := (&Fsck{}).Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), fmt.Sprintf("fsck: %s %x: packfile %x: %s", resources.RT_CHUNK, chunk, packfileMAC, ErrPackfileNotFound))
+	require.Equal(t, affected, bytes.Count(bufErr.Bytes(), []byte(ErrPackfileNotFound.Error())))
+	require.Contains(t, bufOut.String(), fmt.Sprintf("%d dangling", affected))
+}
+
+func TestExecuteCmdFsckOutOfBounds(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.HomeDir = repo.Location()
+
+	chunk := chunkOf(t, snap, "dummy.txt")
+	location, exists, err := repo.GetLocationForBlob(resources.RT_CHUNK, chunk)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	truncated := objects.MAC{0xde, 0xad, 0xbe, 0xef}
+	location.Offset += 1 << 20
+	require.NoError(t, repo.PutStateDelta(&state.DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     truncated,
+		Location: location,
+	}))
+
+	bufOut.Reset()
+	status, err := (&Fsck{}).Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), fmt.Sprintf("fsck: %s %x: packfile %x: location %d+%d out of bounds", resources.RT_CHUNK, truncated, location.Packfile, location.Offset, location.Length))
+	require.NotContains(t, bufErr.String(), fmt.Sprintf("%x", chunk))
+	require.Contains(t, bufOut.String(), "1 dangling")
+}
@@ -30,18 +30,43 @@ func init() {
 }
 
 func parse_cmd_info(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
-	if len(args) == 0 {
-		return &InfoRepository{
-			RepositorySecret: ctx.GetSecret(),
-		}, nil
-	}
+	var opt_output string
+	var opt_usage bool
 
 	flags := flag.NewFlagSet("info", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s [SNAPSHOT]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] [SNAPSHOT]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] -usage\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
 	}
+	flags.StringVar(&opt_output, "output", "text", "output format: text, json")
+	flags.BoolVar(&opt_usage, "usage", false, "display the storage used by each snapshot")
 	flags.Parse(args)
 
+	switch opt_output {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", opt_output)
+	}
+
+	if opt_usage {
+		if flags.NArg() != 0 {
+			return nil, fmt.Errorf("-usage takes no parameter")
+		}
+		return &InfoUsage{
+			RepositorySecret: ctx.GetSecret(),
+			Output:           opt_output,
+		}, nil
+	}
+
+	if flags.NArg() == 0 {
+		return &InfoRepository{
+			RepositorySecret: ctx.GetSecret(),
+			Output:           opt_output,
+		}, nil
+	}
+
 	if len(flags.Args()) > 1 {
 		return nil, fmt.Errorf("invalid parameter. usage: info [snapshot]")
 	}
@@ -54,11 +79,13 @@ func parse_cmd_info(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 		return &InfoVFS{
 			RepositorySecret: ctx.GetSecret(),
 			SnapshotPath:     flags.Arg(0),
+			Output:           opt_output,
 		}, nil
 	}
 
 	return &InfoSnapshot{
 		RepositorySecret: ctx.GetSecret(),
 		SnapshotID:       flags.Args()[0],
+		Output:           opt_output,
 	}, nil
 }
@@ -3,13 +3,20 @@ package info
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/dustin/go-humanize"
 	"github.com/stretchr/testify/require"
 )
 
@@ -202,6 +209,7 @@ func TestExecuteCmdInfoSnapshotPath(t *testing.T) {
 	// ParentPath: /tmp/tmp_to_backup1755905950/subdir
 	// Name: dummy.txt
 	// Type: regular
+	// ContentType: text/plain; charset=utf-8
 	// Size: 11 B (11 bytes)
 	// Permissions: -rw-r--r--
 	// ModTime: 2025-03-06 07:51:06.716971661 +0000 UTC
@@ -221,4 +229,195 @@ func TestExecuteCmdInfoSnapshotPath(t *testing.T) {
 	output := bufOut.String()
 	require.Contains(t, output, "[FileEntry]")
 	require.Contains(t, output, "Name: dummy.txt")
+	require.Contains(t, output, "ContentType: text/plain; charset=utf-8")
+}
+
+func TestExecuteCmdInfoJSON(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+	indexId := snap.Header.GetIndexID()
+	summary := snap.Header.GetSource(0).Summary
+
+	subcommand, err := parse_cmd_info(ctx, []string{"-output", "json"})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var repository repositoryResult
+	require.NoError(t, json.Unmarshal(bufOut.Bytes(), &repository))
+	require.Equal(t, repositoryResult{
+		Version:      repo.Configuration().Version.String(),
+		Timestamp:    repo.Configuration().Timestamp.UTC(),
+		RepositoryID: repo.Configuration().RepositoryID.String(),
+		Snapshots:    1,
+		Size:         summary.Directory.Size + summary.Below.Size,
+	}, repository)
+
+	subcommand, err = parse_cmd_info(ctx, []string{"-output", "json", hex.EncodeToString(indexId[:])})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var snapshot snapshotResult
+	require.NoError(t, json.Unmarshal(bufOut.Bytes(), &snapshot))
+	require.Equal(t, snapshotResult{
+		ID:          hex.EncodeToString(indexId[:]),
+		Timestamp:   snap.Header.Timestamp.UTC(),
+		Duration:    snap.Header.Duration.Seconds(),
+		Name:        "test_backup",
+		Environment: snap.Header.Environment,
+		Perimeter:   snap.Header.Perimeter,
+		Category:    snap.Header.Category,
+		Tags:        []string{},
+		Hostname:    snap.Header.GetContext("Hostname"),
+		Username:    snap.Header.GetContext("Username"),
+		Importer:    "fs",
+		Origin:      snap.Header.GetSource(0).Importer.Origin,
+		Directory:   snap.Header.GetSource(0).Importer.Directory,
+		Size:        summary.Directory.Size + summary.Below.Size,
+		Files:       4,
+		Directories: summary.Directory.Directories + summary.Below.Directories,
+	}, snapshot)
+
+	subcommand, err = parse_cmd_info(ctx, []string{"-output", "json", fmt.Sprintf("%s:subdir", hex.EncodeToString(indexId[:]))})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var entry entryResult
+	require.NoError(t, json.Unmarshal(bufOut.Bytes(), &entry))
+	require.Equal(t, fmt.Sprintf("%s/subdir", snap.Header.GetSource(0).Importer.Directory), entry.Path)
+	require.Equal(t, []childResult{
+		{Name: "dummy.txt", Mode: "-rw-r--r--", Size: int64(len("hello dummy"))},
+		{Name: "foo.txt", Mode: "-rw-r--r--", Size: int64(len("hello foo"))},
+		{Name: "to_exclude", Mode: "-rw-r--r--", Size: int64(len("*/subdir/to_exclude\n"))},
+	}, entry.Children)
+
+	_, err = parse_cmd_info(ctx, []string{"-output", "yaml"})
+	require.EqualError(t, err, "unsupported output format: yaml")
+}
+
+// blobSizes returns the stored size of each blob the snapshot depends on.
+func blobSizes(t *testing.T, repo *repository.Repository, snapshotID objects.MAC) map[snapshot.BlobRef]uint64 {
+	snap, err := snapshot.Load(repo, snapshotID)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	blobs, err := snap.ListBlobs()
+	require.NoError(t, err)
+
+	sizes := make(map[snapshot.BlobRef]uint64)
+	for blob, err := range blobs {
+		require.NoError(t, err)
+		loc, exists, err := repo.GetLocationForBlob(blob.Type, blob.MAC)
+		require.NoError(t, err)
+		require.True(t, exists)
+		sizes[blob] = uint64(loc.Length)
+	}
+	return sizes
+}
+
+func TestExecuteCmdInfoUsage(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	_, err := parse_cmd_info(ctx, []string{"-usage", "abcd"})
+	require.Error(t, err)
+
+	// a lone snapshot owns all of its blobs
+	results, err := storageUsage(repo)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	total := uint64(0)
+	for _, size := range blobSizes(t, repo, snap.Header.Identifier) {
+		total += size
+	}
+	require.Equal(t, total, results[0].Exclusive)
+	require.Zero(t, results[0].Shared)
+
+	// a second backup with an additional file shares the content of the
+	// first one, the new file being its own
+	directory := snap.Header.GetSource(0).Importer.Directory
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "subdir", "unique.txt"), []byte("hello unique"), 0644))
+
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": directory})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup2", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	snap2.Close()
+
+	sizes := map[objects.MAC]map[snapshot.BlobRef]uint64{
+		snap.Header.Identifier:  blobSizes(t, repo, snap.Header.Identifier),
+		snap2.Header.Identifier: blobSizes(t, repo, snap2.Header.Identifier),
+	}
+	shared := uint64(0)
+	sharedChunks := 0
+	for blob, size := range sizes[snap.Header.Identifier] {
+		if _, exists := sizes[snap2.Header.Identifier][blob]; exists {
+			shared += size
+			if blob.Type == resources.RT_CHUNK {
+				sharedChunks++
+			}
+		}
+	}
+	require.Equal(t, 4, sharedChunks)
+
+	subcommand, err := parse_cmd_info(ctx, []string{"-usage", "-output", "json"})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	results = nil
+	require.NoError(t, json.Unmarshal(bufOut.Bytes(), &results))
+	require.Len(t, results, 2)
+	for _, result := range results {
+		snapshotID, err := hex.DecodeString(result.ID)
+		require.NoError(t, err)
+		total := uint64(0)
+		for _, size := range sizes[objects.MAC(snapshotID)] {
+			total += size
+		}
+		require.Equal(t, shared, result.Shared, result.Name)
+		require.Equal(t, total-shared, result.Exclusive, result.Name)
+		require.NotZero(t, result.Exclusive, result.Name)
+	}
+
+	subcommand, err = parse_cmd_info(ctx, []string{"-usage"})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), fmt.Sprintf("%s: exclusive", results[0].ID[:8]))
+	require.Contains(t, bufOut.String(), fmt.Sprintf("shared %s (%d bytes)", humanize.Bytes(shared), shared))
 }
@@ -1,7 +1,9 @@
 package info
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
@@ -13,6 +15,16 @@ import (
 type InfoRepository struct {
 	RepositoryLocation string
 	RepositorySecret   []byte
+
+	Output string
+}
+
+type repositoryResult struct {
+	Version      string    `json:"version"`
+	Timestamp    time.Time `json:"timestamp"`
+	RepositoryID string    `json:"repository_id"`
+	Snapshots    int       `json:"snapshots"`
+	Size         uint64    `json:"size"`
 }
 
 func (cmd *InfoRepository) Name() string {
@@ -20,6 +32,24 @@ func (cmd *InfoRepository) Name() string {
 }
 
 func (cmd *InfoRepository) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snapshots, totalSize, err := cmd.snapshotsSize(repo)
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.Output == "json" {
+		err := json.NewEncoder(ctx.Stdout).Encode(repositoryResult{
+			Version:      repo.Configuration().Version.String(),
+			Timestamp:    repo.Configuration().Timestamp.UTC(),
+			RepositoryID: repo.Configuration().RepositoryID.String(),
+			Snapshots:    snapshots,
+			Size:         totalSize,
+		})
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
 
 	fmt.Fprintln(ctx.Stdout, "Version:", repo.Configuration().Version)
 	fmt.Fprintln(ctx.Stdout, "Timestamp:", repo.Configuration().Timestamp)
@@ -80,22 +110,28 @@ func (cmd *InfoRepository) Execute(ctx *appcontext.AppContext, repo *repository.
 		}
 	}
 
+	fmt.Fprintln(ctx.Stdout, "Snapshots:", snapshots)
+	fmt.Fprintf(ctx.Stdout, "Size: %s (%d bytes)\n", humanize.Bytes(totalSize), totalSize)
+
+	return 0, nil
+}
+
+// snapshotsSize returns the number of snapshots in the repository and
+// their total size.
+func (cmd *InfoRepository) snapshotsSize(repo *repository.Repository) (int, uint64, error) {
 	snapshotIDs, err := utils.LocateSnapshotIDs(repo, nil)
 	if err != nil {
-		return 1, err
+		return 0, 0, err
 	}
 
-	fmt.Fprintln(ctx.Stdout, "Snapshots:", len(snapshotIDs))
 	totalSize := uint64(0)
 	for _, snapshotID := range snapshotIDs {
 		snap, err := snapshot.Load(repo, snapshotID)
 		if err != nil {
-			return 1, err
+			return 0, 0, err
 		}
 		totalSize += snap.Header.GetSource(0).Summary.Directory.Size + snap.Header.GetSource(0).Summary.Below.Size
 		snap.Close()
 	}
-	fmt.Fprintf(ctx.Stdout, "Size: %s (%d bytes)\n", humanize.Bytes(totalSize), totalSize)
-
-	return 0, nil
+	return len(snapshotIDs), totalSize, nil
 }
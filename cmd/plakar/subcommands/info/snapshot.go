@@ -3,6 +3,7 @@ package info
 import (
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -18,6 +19,27 @@ type InfoSnapshot struct {
 	RepositorySecret []byte
 
 	SnapshotID string
+	Output     string
+}
+
+type snapshotResult struct {
+	ID          string    `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Duration    float64   `json:"duration"`
+	Name        string    `json:"name"`
+	Environment string    `json:"environment"`
+	Perimeter   string    `json:"perimeter"`
+	Category    string    `json:"category"`
+	Tags        []string  `json:"tags"`
+	Hostname    string    `json:"hostname"`
+	Username    string    `json:"username"`
+	Importer    string    `json:"importer"`
+	Origin      string    `json:"origin"`
+	Directory   string    `json:"directory"`
+	Size        uint64    `json:"size"`
+	Files       uint64    `json:"files"`
+	Directories uint64    `json:"directories"`
+	Errors      uint64    `json:"errors"`
 }
 
 func (cmd *InfoSnapshot) Name() string {
@@ -34,6 +56,37 @@ func (cmd *InfoSnapshot) Execute(ctx *appcontext.AppContext, repo *repository.Re
 	header := snap.Header
 
 	indexID := header.GetIndexID()
+	if cmd.Output == "json" {
+		summary := header.GetSource(0).Summary
+		tags := header.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		err := json.NewEncoder(ctx.Stdout).Encode(snapshotResult{
+			ID:          hex.EncodeToString(indexID[:]),
+			Timestamp:   header.Timestamp.UTC(),
+			Duration:    header.Duration.Seconds(),
+			Name:        header.Name,
+			Environment: header.Environment,
+			Perimeter:   header.Perimeter,
+			Category:    header.Category,
+			Tags:        tags,
+			Hostname:    header.GetContext("Hostname"),
+			Username:    header.GetContext("Username"),
+			Importer:    header.GetSource(0).Importer.Type,
+			Origin:      header.GetSource(0).Importer.Origin,
+			Directory:   header.GetSource(0).Importer.Directory,
+			Size:        summary.Directory.Size + summary.Below.Size,
+			Files:       summary.Directory.Files + summary.Below.Files,
+			Directories: summary.Directory.Directories + summary.Below.Directories,
+			Errors:      summary.Directory.Errors + summary.Below.Errors,
+		})
+		if err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
 	fmt.Fprintf(ctx.Stdout, "Version: %s\n", repo.Configuration().Version)
 	fmt.Fprintf(ctx.Stdout, "SnapshotID: %s\n", hex.EncodeToString(indexID[:]))
 	fmt.Fprintf(ctx.Stdout, "Timestamp: %s\n", header.Timestamp)
@@ -0,0 +1,148 @@
+package info
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+type InfoUsage struct {
+	RepositorySecret []byte
+
+	Output string
+}
+
+type usageResult struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Exclusive uint64 `json:"exclusive"`
+	Shared    uint64 `json:"shared"`
+}
+
+func (cmd *InfoUsage) Name() string {
+	return "info_usage"
+}
+
+func (cmd *InfoUsage) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	results, err := storageUsage(repo)
+	if err != nil {
+		return 1, err
+	}
+
+	if cmd.Output == "json" {
+		if err := json.NewEncoder(ctx.Stdout).Encode(results); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	for _, result := range results {
+		fmt.Fprintf(ctx.Stdout, "%s: exclusive %s (%d bytes), shared %s (%d bytes)\n",
+			result.ID[:8],
+			humanize.Bytes(result.Exclusive), result.Exclusive,
+			humanize.Bytes(result.Shared), result.Shared)
+	}
+	return 0, nil
+}
+
+// blobUsage is what storageUsage knows of a blob: its stored size, the
+// first and last snapshots found referencing it, and whether several do.
+type blobUsage struct {
+	size   uint64
+	first  int
+	last   int
+	shared bool
+}
+
+// storageUsage splits, for each live snapshot, the stored size of the blobs
+// it depends on between the blobs no other snapshot references, which
+// deleting the snapshot would reclaim, and those shared with others.  The
+// blobs are aggregated as the snapshots are read, only one entry per
+// distinct blob being kept.
+func storageUsage(repo *repository.Repository) ([]usageResult, error) {
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]usageResult, 0, len(snapshotIDs))
+	totals := make([]uint64, 0, len(snapshotIDs))
+	usage := make(map[snapshot.BlobRef]*blobUsage)
+	for i, snapshotID := range snapshotIDs {
+		total := uint64(0)
+		name, err := walkSnapshotBlobs(repo, snapshotID, func(blob snapshot.BlobRef) error {
+			entry, exists := usage[blob]
+			if !exists {
+				loc, exists, err := repo.GetLocationForBlob(blob.Type, blob.MAC)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return fmt.Errorf("blob %x of type %s not found", blob.MAC, blob.Type)
+				}
+				entry = &blobUsage{size: uint64(loc.Length), first: i, last: -1}
+				usage[blob] = entry
+			}
+			if entry.last == i {
+				// already counted for this snapshot
+				return nil
+			}
+			if entry.first != i {
+				entry.shared = true
+			}
+			entry.last = i
+			total += entry.size
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+		results = append(results, usageResult{
+			ID:   hex.EncodeToString(snapshotID[:]),
+			Name: name,
+		})
+	}
+
+	for _, entry := range usage {
+		if !entry.shared {
+			results[entry.first].Exclusive += entry.size
+		}
+	}
+	for i := range results {
+		results[i].Shared = totals[i] - results[i].Exclusive
+	}
+	return results, nil
+}
+
+// walkSnapshotBlobs calls fn on each blob the snapshot depends on, blobs
+// possibly being reported more than once, and returns the snapshot name.
+func walkSnapshotBlobs(repo *repository.Repository, snapshotID objects.MAC, fn func(snapshot.BlobRef) error) (string, error) {
+	snap, err := snapshot.Load(repo, snapshotID)
+	if err != nil {
+		return "", err
+	}
+	defer snap.Close()
+
+	iter, err := snap.ListBlobs()
+	if err != nil {
+		return "", err
+	}
+
+	for blob, err := range iter {
+		if err != nil {
+			return "", err
+		}
+		if err := fn(blob); err != nil {
+			return "", err
+		}
+	}
+	return snap.Header.Name, nil
+}
@@ -1,6 +1,7 @@
 package info
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"time"
@@ -15,6 +16,26 @@ type InfoVFS struct {
 	RepositorySecret []byte
 
 	SnapshotPath string
+	Output       string
+}
+
+type entryResult struct {
+	Path        string        `json:"path"`
+	Mode        string        `json:"mode"`
+	Size        int64         `json:"size"`
+	ModTime     time.Time     `json:"mod_time"`
+	Uid         uint64        `json:"uid"`
+	Gid         uint64        `json:"gid"`
+	Username    string        `json:"username"`
+	Groupname   string        `json:"groupname"`
+	ContentType string        `json:"content_type,omitempty"`
+	Children    []childResult `json:"children,omitempty"`
+}
+
+type childResult struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+	Size int64  `json:"size"`
 }
 
 func (cmd *InfoVFS) Name() string {
@@ -39,6 +60,41 @@ func (cmd *InfoVFS) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 		return 1, err
 	}
 
+	if cmd.Output == "json" {
+		result := entryResult{
+			Path:        entry.Path(),
+			Mode:        entry.Stat().Mode().String(),
+			Size:        entry.Stat().Size(),
+			ModTime:     entry.Stat().ModTime().UTC(),
+			Uid:         entry.Stat().Uid(),
+			Gid:         entry.Stat().Gid(),
+			Username:    entry.Stat().Username(),
+			Groupname:   entry.Stat().Groupname(),
+			ContentType: entry.ContentType(),
+		}
+		if entry.Stat().Mode().IsDir() {
+			iter, err := entry.Getdents(fs)
+			if err != nil {
+				return 1, err
+			}
+			result.Children = []childResult{}
+			for child, err := range iter {
+				if err != nil {
+					return 1, err
+				}
+				result.Children = append(result.Children, childResult{
+					Name: child.Stat().Name(),
+					Mode: child.Stat().Mode().String(),
+					Size: child.Stat().Size(),
+				})
+			}
+		}
+		if err := json.NewEncoder(ctx.Stdout).Encode(result); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
 	if entry.Stat().Mode().IsDir() {
 		fmt.Fprintf(ctx.Stdout, "[DirEntry]\n")
 	} else {
@@ -49,6 +105,9 @@ func (cmd *InfoVFS) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 	fmt.Fprintf(ctx.Stdout, "ParentPath: %s\n", entry.ParentPath)
 	fmt.Fprintf(ctx.Stdout, "Name: %s\n", entry.Stat().Name())
 	fmt.Fprintf(ctx.Stdout, "Type: %s\n", entry.Stat().Type())
+	if entry.ResolvedObject != nil {
+		fmt.Fprintf(ctx.Stdout, "ContentType: %s\n", entry.ContentType())
+	}
 	fmt.Fprintf(ctx.Stdout, "Size: %s (%d bytes)\n", humanize.Bytes(uint64(entry.Stat().Size())), entry.Stat().Size())
 	fmt.Fprintf(ctx.Stdout, "Permissions: %s\n", entry.Stat().Mode())
 	fmt.Fprintf(ctx.Stdout, "ModTime: %s\n", entry.Stat().ModTime())
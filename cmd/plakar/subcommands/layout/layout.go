@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package layout
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+func init() {
+	subcommands.Register("layout", parse_cmd_layout)
+}
+
+func parse_cmd_layout(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("layout", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s SNAPSHOT:PATH\n", flags.Name())
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("usage: %s SNAPSHOT:PATH", flags.Name())
+	}
+
+	return &Layout{
+		RepositorySecret: ctx.GetSecret(),
+		Path:             flags.Arg(0),
+	}, nil
+}
+
+type Layout struct {
+	RepositorySecret []byte
+
+	Path string
+}
+
+func (cmd *Layout) Name() string {
+	return "layout"
+}
+
+func (cmd *Layout) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.Path)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, err
+	}
+
+	entry, err := fs.GetEntry(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", pathname, err)
+	}
+	if !entry.Stat().Mode().IsRegular() || entry.ResolvedObject == nil {
+		return 1, fmt.Errorf("%s: not a regular file", pathname)
+	}
+
+	// the chunks are listed in file order, each switch to another
+	// packfile than the previous chunk's is a seek when reading the file.
+	packfiles := make(map[objects.MAC]struct{})
+	var previous objects.MAC
+	switches := 0
+	for i, chunk := range entry.ResolvedObject.Chunks {
+		loc, exists, err := repo.GetLocationForBlob(resources.RT_CHUNK, chunk.ContentMAC)
+		if err != nil {
+			return 1, err
+		}
+		if !exists {
+			return 1, fmt.Errorf("%s: chunk %x not found in any packfile", pathname, chunk.ContentMAC)
+		}
+
+		fmt.Fprintf(ctx.Stdout, "%d %x %d %x %d %d\n", i, chunk.ContentMAC, chunk.Length,
+			loc.Packfile, loc.Offset, loc.Length)
+
+		packfiles[loc.Packfile] = struct{}{}
+		if i != 0 && loc.Packfile != previous {
+			switches++
+		}
+		previous = loc.Packfile
+	}
+
+	ctx.GetLogger().Info("%s: %s: %d chunks in %d packfiles, %d packfile switches",
+		cmd.Name(), pathname, len(entry.ResolvedObject.Chunks), len(packfiles), switches)
+	return 0, nil
+}
@@ -0,0 +1,74 @@
+package layout
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/resources"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCmdLayout(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	// random content large enough to be split in several chunks
+	content := make([]byte, 8<<20)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/big.bin", 0644, string(content)),
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	require.NoError(t, repo.RebuildState())
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	var pathname string
+	for p, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if strings.HasSuffix(p, "/big.bin") {
+			pathname = p
+		}
+	}
+	require.NotEmpty(t, pathname)
+	entry, err := fs.GetEntry(pathname)
+	require.NoError(t, err)
+	chunks := entry.ResolvedObject.Chunks
+	require.Greater(t, len(chunks), 1)
+
+	subcommand, err := parse_cmd_layout(ctx, []string{fmt.Sprintf("%x:%s", snap.Header.Identifier, pathname)})
+	require.NoError(t, err)
+	require.Equal(t, "layout", subcommand.(*Layout).Name())
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	lines := strings.Split(strings.TrimSuffix(bufOut.String(), "\n"), "\n")
+	require.GreaterOrEqual(t, len(lines), len(chunks))
+	for i, chunk := range chunks {
+		loc, exists, err := repo.GetLocationForBlob(resources.RT_CHUNK, chunk.ContentMAC)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Equal(t, fmt.Sprintf("%d %x %d %x %d %d", i, chunk.ContentMAC, chunk.Length,
+			loc.Packfile, loc.Offset, loc.Length), lines[i])
+	}
+	require.Contains(t, bufOut.String(), fmt.Sprintf("%d chunks in ", len(chunks)))
+
+	subcommand, err = parse_cmd_layout(ctx, []string{fmt.Sprintf("%x:/nonexistent", snap.Header.Identifier)})
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+}
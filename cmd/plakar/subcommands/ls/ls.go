@@ -18,6 +18,7 @@ package ls
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -50,6 +51,7 @@ func parse_cmd_ls(ctx *appcontext.AppContext, args []string) (subcommands.Subcom
 	var opt_latest bool
 	var opt_uuid bool
 	var opt_recursive bool
+	var opt_output string
 
 	flags := flag.NewFlagSet("ls", flag.ExitOnError)
 	flags.Usage = func() {
@@ -69,12 +71,20 @@ func parse_cmd_ls(ctx *appcontext.AppContext, args []string) (subcommands.Subcom
 	flags.BoolVar(&opt_latest, "latest", false, "use latest snapshot")
 	flags.BoolVar(&opt_uuid, "uuid", false, "display uuid instead of short ID")
 	flags.BoolVar(&opt_recursive, "recursive", false, "recursive listing")
+	flags.BoolVar(&opt_recursive, "R", false, "recursive listing, same as -recursive")
+	flags.StringVar(&opt_output, "output", "text", "output format: text, json")
 	flags.Parse(args)
 
 	if flags.NArg() > 1 {
 		return nil, fmt.Errorf("too many arguments")
 	}
 
+	switch opt_output {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", opt_output)
+	}
+
 	var err error
 
 	var beforeDate time.Time
@@ -109,6 +119,7 @@ func parse_cmd_ls(ctx *appcontext.AppContext, args []string) (subcommands.Subcom
 
 		Recursive:   opt_recursive,
 		DisplayUUID: opt_uuid,
+		Output:      opt_output,
 		Path:        flags.Arg(0),
 	}, nil
 }
@@ -129,9 +140,28 @@ type Ls struct {
 
 	Recursive   bool
 	DisplayUUID bool
+	Output      string
 	Path        string
 }
 
+type snapshotResult struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Hostname  string    `json:"hostname"`
+	Directory string    `json:"directory"`
+	Size      uint64    `json:"size"`
+	Files     uint64    `json:"files"`
+}
+
+type entryResult struct {
+	Path      string    `json:"path"`
+	Mode      string    `json:"mode"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Username  string    `json:"username"`
+	Groupname string    `json:"groupname"`
+}
+
 func (cmd *Ls) Name() string {
 	return "ls"
 }
@@ -171,13 +201,25 @@ func (cmd *Ls) list_snapshots(ctx *appcontext.AppContext, repo *repository.Repos
 		return fmt.Errorf("ls: could not fetch snapshots list: %w", err)
 	}
 
+	results := []snapshotResult{}
 	for _, snapshotID := range snapshotIDs {
 		snap, err := snapshot.Load(repo, snapshotID)
 		if err != nil {
 			return fmt.Errorf("ls: could not fetch snapshot: %w", err)
 		}
 
-		if !cmd.DisplayUUID {
+		if cmd.Output == "json" {
+			indexID := snap.Header.GetIndexID()
+			summary := snap.Header.GetSource(0).Summary
+			results = append(results, snapshotResult{
+				ID:        hex.EncodeToString(indexID[:]),
+				Timestamp: snap.Header.Timestamp.UTC(),
+				Hostname:  snap.Header.GetContext("Hostname"),
+				Directory: snap.Header.GetSource(0).Importer.Directory,
+				Size:      summary.Directory.Size + summary.Below.Size,
+				Files:     summary.Directory.Files + summary.Below.Files,
+			})
+		} else if !cmd.DisplayUUID {
 			fmt.Fprintf(ctx.Stdout, "%s %10s%10s%10s %s\n",
 				snap.Header.Timestamp.UTC().Format(time.RFC3339),
 				hex.EncodeToString(snap.Header.GetIndexShortID()),
@@ -196,6 +238,10 @@ func (cmd *Ls) list_snapshots(ctx *appcontext.AppContext, repo *repository.Repos
 
 		snap.Close()
 	}
+
+	if cmd.Output == "json" {
+		return json.NewEncoder(ctx.Stdout).Encode(results)
+	}
 	return nil
 }
 
@@ -211,8 +257,9 @@ func (cmd *Ls) list_snapshot(ctx *appcontext.AppContext, repo *repository.Reposi
 		return err
 	}
 
+	results := []entryResult{}
 	resolved := false
-	return pvfs.WalkDir(pathname, func(path string, d *vfs.Entry, err error) error {
+	err = pvfs.WalkDir(pathname, func(path string, d *vfs.Entry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -253,17 +300,36 @@ func (cmd *Ls) list_snapshot(ctx *appcontext.AppContext, repo *repository.Reposi
 			entryname = d.Name()
 		}
 
-		fmt.Fprintf(ctx.Stdout, "%s %s % 8s % 8s % 8s %s\n",
-			sb.ModTime().UTC().Format(time.RFC3339),
-			sb.Mode(),
-			username,
-			groupname,
-			humanize.Bytes(uint64(sb.Size())),
-			entryname)
+		if cmd.Output == "json" {
+			results = append(results, entryResult{
+				Path:      path,
+				Mode:      sb.Mode().String(),
+				Size:      sb.Size(),
+				ModTime:   sb.ModTime().UTC(),
+				Username:  username,
+				Groupname: groupname,
+			})
+		} else {
+			fmt.Fprintf(ctx.Stdout, "%s %s % 8s % 8s % 8s %s\n",
+				sb.ModTime().UTC().Format(time.RFC3339),
+				sb.Mode(),
+				username,
+				groupname,
+				humanize.Bytes(uint64(sb.Size())),
+				entryname)
+		}
 
 		if !recursive && pathname != path && sb.IsDir() {
 			return fs.SkipDir
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "json" {
+		return json.NewEncoder(ctx.Stdout).Encode(results)
+	}
+	return nil
 }
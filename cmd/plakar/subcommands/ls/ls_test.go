@@ -3,6 +3,7 @@ package ls
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -150,3 +151,105 @@ func TestExecuteCmdLsFilterUuid(t *testing.T) {
 	require.Equal(t, hex.EncodeToString(indexId[:]), fields[1])
 	require.Equal(t, snap.Header.GetSource(0).Importer.Directory, fields[len(fields)-1])
 }
+
+func TestExecuteCmdLsJSON(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	var buf bytes.Buffer
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.Stdout = &buf
+	repo := snap.Repository()
+
+	subcommand, err := parse_cmd_ls(ctx, []string{"-output", "json"})
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var snapshots []snapshotResult
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &snapshots))
+
+	indexID := snap.Header.GetIndexID()
+	summary := snap.Header.GetSource(0).Summary
+	require.Equal(t, []snapshotResult{{
+		ID:        hex.EncodeToString(indexID[:]),
+		Timestamp: snap.Header.Timestamp.UTC(),
+		Hostname:  snap.Header.GetContext("Hostname"),
+		Directory: snap.Header.GetSource(0).Importer.Directory,
+		Size:      summary.Directory.Size + summary.Below.Size,
+		Files:     1,
+	}}, snapshots)
+
+	buf.Reset()
+	subcommand, err = parse_cmd_ls(ctx, []string{"-output", "json", "-recursive", hex.EncodeToString(snap.Header.GetIndexShortID())})
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	var entries []entryResult
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+	require.Len(t, entries, 2)
+	require.Equal(t, fmt.Sprintf("%s/subdir", snap.Header.GetSource(0).Importer.Directory), entries[0].Path)
+	require.True(t, strings.HasPrefix(entries[0].Mode, "d"))
+	require.Equal(t, fmt.Sprintf("%s/subdir/dummy.txt", snap.Header.GetSource(0).Importer.Directory), entries[1].Path)
+	require.Equal(t, "-rw-r--r--", entries[1].Mode)
+	require.Equal(t, int64(len("hello dummy")), entries[1].Size)
+
+	_, err = parse_cmd_ls(ctx, []string{"-output", "yaml"})
+	require.EqualError(t, err, "unsupported output format: yaml")
+}
+
+func TestExecuteCmdLsDirectory(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	var buf bytes.Buffer
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.Stdout = &buf
+	repo := snap.Repository()
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	snapshotID := hex.EncodeToString(snap.Header.GetIndexShortID())
+
+	ls := func(args ...string) [][]string {
+		buf.Reset()
+		subcommand, err := parse_cmd_ls(ctx, args)
+		require.NoError(t, err)
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+
+		lines := [][]string{}
+		for _, line := range strings.Split(strings.Trim(buf.String(), "\n"), "\n") {
+			lines = append(lines, strings.Fields(line))
+		}
+		return lines
+	}
+
+	// the root only lists its immediate children
+	lines := ls(snapshotID)
+	require.Len(t, lines, 1)
+	require.True(t, strings.HasPrefix(lines[0][1], "d"))
+	require.Equal(t, "subdir", lines[0][len(lines[0])-1])
+
+	lines = ls(snapshotID + ":" + root + "/subdir")
+	require.Len(t, lines, 1)
+	require.Equal(t, []string{"-rw-r--r--"}, lines[0][1:2])
+	require.Equal(t, []string{"11", "B", "dummy.txt"}, lines[0][len(lines[0])-3:])
+
+	// a file is listed by itself
+	lines = ls(snapshotID + ":" + root + "/subdir/dummy.txt")
+	require.Len(t, lines, 1)
+	require.Equal(t, "dummy.txt", lines[0][len(lines[0])-1])
+
+	lines = ls("-R", snapshotID)
+	require.Len(t, lines, 2)
+	require.Equal(t, root+"/subdir", lines[0][len(lines[0])-1])
+	require.Equal(t, root+"/subdir/dummy.txt", lines[1][len(lines[1])-1])
+}
@@ -383,6 +383,7 @@ func (cmd *Maintenance) Lock() (chan bool, error) {
 				cmd.repository.DeleteLock(cmd.maintenanceID)
 				return nil, err
 			}
+			continue
 		}
 
 		// There is a lock in place, we need to abort.
@@ -391,7 +392,7 @@ func (cmd *Maintenance) Lock() (chan bool, error) {
 			return nil, err
 		}
 
-		return nil, fmt.Errorf("Can't take exclusive lock, repository is already locked")
+		return nil, fmt.Errorf("Can't take exclusive lock: %w by %s", repository.ErrLocked, lock)
 	}
 
 	// The following bit is a "ping" mechanism, Lock() is a bit badly named at this point,
@@ -21,8 +21,12 @@ package mount
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/plakarfs"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/anacrolix/fuse"
@@ -30,19 +34,63 @@ import (
 )
 
 func (cmd *Mount) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
-	c, err := fuse.Mount(
-		cmd.Mountpoint,
+	var filesystem fs.FS
+	if cmd.SnapshotID == "" {
+		filesystem = plakarfs.NewFS(repo, cmd.Mountpoint)
+	} else {
+		snap, _, err := utils.OpenSnapshotByPath(repo, cmd.SnapshotID)
+		if err != nil {
+			return 1, err
+		}
+		defer snap.Close()
+
+		filesystem, err = plakarfs.NewSnapshotFS(repo, snap)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	options := []fuse.MountOption{
 		fuse.FSName("plakar"),
 		fuse.Subtype("plakarfs"),
 		fuse.LocalVolume(),
-	)
+		fuse.ReadOnly(),
+	}
+	if cmd.AllowOther {
+		options = append(options, fuse.AllowOther())
+	}
+
+	c, err := fuse.Mount(cmd.Mountpoint, options...)
 	if err != nil {
 		return 1, fmt.Errorf("mount: %v", err)
 	}
 	defer c.Close()
-	ctx.GetLogger().Info("mounted repository %s at %s", repo.Location(), cmd.Mountpoint)
+	if cmd.SnapshotID == "" {
+		ctx.GetLogger().Info("mounted repository %s at %s", repo.Location(), cmd.Mountpoint)
+	} else {
+		ctx.GetLogger().Info("mounted snapshot %s at %s", cmd.SnapshotID, cmd.Mountpoint)
+	}
+
+	// unmounting makes Serve return, leaving the mountpoint clean
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
 
-	err = fs.Serve(c, plakarfs.NewFS(repo, cmd.Mountpoint))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-sigc:
+		case <-ctx.GetContext().Done():
+		case <-done:
+			return
+		}
+		if err := fuse.Unmount(cmd.Mountpoint); err != nil {
+			ctx.GetLogger().Warn("failed to unmount %s: %s", cmd.Mountpoint, err)
+		}
+	}()
+
+	err = fs.Serve(c, filesystem)
 	if err != nil {
 		return 1, err
 	}
@@ -51,5 +99,4 @@ func (cmd *Mount) Execute(ctx *appcontext.AppContext, repo *repository.Repositor
 		return 1, err
 	}
 	return 0, nil
-
 }
@@ -29,26 +29,42 @@ func init() {
 }
 
 func parse_cmd_mount(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_allowOther bool
+
 	flags := flag.NewFlagSet("mount", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] [SNAPSHOT] PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
 	}
+	flags.BoolVar(&opt_allowOther, "allow-other", false, "allow other users to access the mounted filesystem")
 	flags.Parse(args)
 
-	if flags.NArg() != 1 {
+	var snapshotID, mountpoint string
+	switch flags.NArg() {
+	case 1:
+		mountpoint = flags.Arg(0)
+	case 2:
+		snapshotID, mountpoint = flags.Arg(0), flags.Arg(1)
+	default:
 		ctx.GetLogger().Error("need mountpoint")
 		return nil, fmt.Errorf("need mountpoint")
 	}
+
 	return &Mount{
 		RepositorySecret: ctx.GetSecret(),
-		Mountpoint:       flags.Arg(0),
+		SnapshotID:       snapshotID,
+		Mountpoint:       mountpoint,
+		AllowOther:       opt_allowOther,
 	}, nil
 }
 
 type Mount struct {
 	RepositorySecret []byte
 
+	SnapshotID string
 	Mountpoint string
+	AllowOther bool
 }
 
 func (cmd *Mount) Name() string {
@@ -0,0 +1,83 @@
+//go:build linux
+
+package mount
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCmdMountSnapshot(t *testing.T) {
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is not available")
+	}
+
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	mountpoint := t.TempDir()
+	args := []string{hex.EncodeToString(snap.Header.Identifier[:]), mountpoint}
+	subcommand, err := parse_cmd_mount(ctx, args)
+	require.NoError(t, err)
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx.SetContext(subCtx)
+
+	type result struct {
+		status int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		status, err := subcommand.Execute(ctx, repo)
+		done <- result{status, err}
+	}()
+
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+	dummy := filepath.Join(mountpoint, backupDir, "subdir", "dummy.txt")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(dummy)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	info, err := os.Stat(dummy)
+	require.NoError(t, err)
+	require.True(t, info.Mode().IsRegular())
+	require.Equal(t, int64(len("hello dummy")), info.Size())
+
+	content, err := os.ReadFile(dummy)
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(content))
+
+	// canceling the context unmounts the snapshot
+	cancel()
+	select {
+	case r := <-done:
+		require.NoError(t, r.err)
+		require.Equal(t, 0, r.status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mount did not return after cancel")
+	}
+	require.Contains(t, bufOut.String(), "mounted snapshot")
+
+	_, err = os.Stat(dummy)
+	require.True(t, os.IsNotExist(err))
+}
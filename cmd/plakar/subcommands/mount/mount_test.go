@@ -96,3 +96,25 @@ func TestExecuteCmdMountDefault(t *testing.T) {
 	// Close the goroutine by canceling the context
 	cancel()
 }
+
+func TestParseCmdMount(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+	ctx := snap.AppContext()
+
+	subcommand, err := parse_cmd_mount(ctx, []string{"/mnt"})
+	require.NoError(t, err)
+	require.Equal(t, &Mount{Mountpoint: "/mnt"}, subcommand)
+
+	subcommand, err = parse_cmd_mount(ctx, []string{"-allow-other", "abcd", "/mnt"})
+	require.NoError(t, err)
+	require.Equal(t, &Mount{SnapshotID: "abcd", Mountpoint: "/mnt", AllowOther: true}, subcommand)
+
+	_, err = parse_cmd_mount(ctx, []string{})
+	require.EqualError(t, err, "need mountpoint")
+	_, err = parse_cmd_mount(ctx, []string{"abcd", "/mnt", "extra"})
+	require.EqualError(t, err, "need mountpoint")
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package packfile
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+func init() {
+	subcommands.Register("packfile", parse_cmd_packfile)
+}
+
+func parse_cmd_packfile(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("packfile", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s PACKFILE\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s refs PACKFILE\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	switch flags.Arg(0) {
+	case "refs":
+		if flags.NArg() != 2 {
+			return nil, fmt.Errorf("usage: %s refs PACKFILE", flags.Name())
+		}
+		packfile, err := parsePackfileMAC(flags.Arg(1))
+		if err != nil {
+			return nil, err
+		}
+		return &PackfileRefs{
+			RepositorySecret: ctx.GetSecret(),
+			Packfile:         packfile,
+		}, nil
+	}
+
+	if flags.NArg() == 1 {
+		packfile, err := parsePackfileMAC(flags.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		return &PackfileShow{
+			RepositorySecret: ctx.GetSecret(),
+			Packfile:         packfile,
+		}, nil
+	}
+	return nil, fmt.Errorf("Invalid parameter. usage: packfile [refs] PACKFILE")
+}
+
+func parsePackfileMAC(arg string) (objects.MAC, error) {
+	if len(arg) != 64 {
+		return objects.MAC{}, fmt.Errorf("invalid packfile hash: %s", arg)
+	}
+
+	b, err := hex.DecodeString(arg)
+	if err != nil {
+		return objects.MAC{}, fmt.Errorf("invalid packfile hash: %s", arg)
+	}
+
+	var mac objects.MAC
+	copy(mac[:], b)
+	return mac, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package packfile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+type PackfileRefs struct {
+	RepositorySecret []byte
+
+	Packfile objects.MAC
+}
+
+func (cmd *PackfileRefs) Name() string {
+	return "packfile_refs"
+}
+
+func (cmd *PackfileRefs) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	blobs := make(map[snapshot.BlobRef]int)
+	order := []snapshot.BlobRef{}
+	for de, err := range repo.ListPackfileBlobs(cmd.Packfile) {
+		if err != nil {
+			return 1, err
+		}
+		blob := snapshot.BlobRef{Type: de.Type, MAC: de.Blob}
+		if _, exists := blobs[blob]; !exists {
+			blobs[blob] = 0
+			order = append(order, blob)
+		}
+	}
+
+	// a blob only matters if it is reachable from a snapshot, so walk them
+	// all and count, for each blob of the packfile, who depends on it.
+	snapshots := make(map[objects.MAC]int)
+	if len(blobs) != 0 {
+		for snapshotID := range repo.ListSnapshots() {
+			snap, err := snapshot.Load(repo, snapshotID)
+			if err != nil {
+				return 1, err
+			}
+
+			iter, err := snap.ListBlobs()
+			if err != nil {
+				snap.Close()
+				return 1, err
+			}
+
+			seen := make(map[snapshot.BlobRef]struct{})
+			for blob, err := range iter {
+				if err != nil {
+					snap.Close()
+					return 1, err
+				}
+				if _, exists := blobs[blob]; !exists {
+					continue
+				}
+				if _, exists := seen[blob]; exists {
+					continue
+				}
+				seen[blob] = struct{}{}
+				blobs[blob]++
+			}
+			snap.Close()
+
+			if len(seen) != 0 {
+				snapshots[snapshotID] = len(seen)
+			}
+		}
+	}
+
+	for _, blob := range order {
+		fmt.Fprintf(ctx.Stdout, "blob %x %s %d\n", blob.MAC, blob.Type, blobs[blob])
+	}
+
+	snapshotIDs := make([]objects.MAC, 0, len(snapshots))
+	for snapshotID := range snapshots {
+		snapshotIDs = append(snapshotIDs, snapshotID)
+	}
+	sort.Slice(snapshotIDs, func(i, j int) bool {
+		return bytes.Compare(snapshotIDs[i][:], snapshotIDs[j][:]) < 0
+	})
+	for _, snapshotID := range snapshotIDs {
+		fmt.Fprintf(ctx.Stdout, "snapshot %x %d\n", snapshotID, snapshots[snapshotID])
+	}
+
+	if len(snapshotIDs) == 0 {
+		ctx.GetLogger().Info("%s: packfile %x is not referenced by any snapshot", cmd.Name(), cmd.Packfile)
+	}
+	return 0, nil
+}
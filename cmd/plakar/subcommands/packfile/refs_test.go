@@ -0,0 +1,62 @@
+package packfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCmdPackfileRefs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+	require.NoError(t, repo.RebuildState())
+
+	iter, err := snap.ListPackfiles()
+	require.NoError(t, err)
+	var packfile objects.MAC
+	for mac, err := range iter {
+		require.NoError(t, err)
+		packfile = mac
+		break
+	}
+
+	subcommand, err := parse_cmd_packfile(ctx, []string{"refs", hex.EncodeToString(packfile[:])})
+	require.NoError(t, err)
+	require.Equal(t, "packfile_refs", subcommand.(*PackfileRefs).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output := bufOut.String()
+	require.Contains(t, output, "blob ")
+	require.Contains(t, output, fmt.Sprintf("snapshot %x ", snap.Header.Identifier))
+
+	// a packfile that made it to the store but not to the state
+	orphan := objects.RandomMAC()
+	require.NoError(t, repo.PutPackfile(orphan, bytes.NewReader([]byte("orphan"))))
+
+	bufOut.Reset()
+	subcommand, err = parse_cmd_packfile(ctx, []string{"refs", hex.EncodeToString(orphan[:])})
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.NotContains(t, bufOut.String(), "blob ")
+	require.NotContains(t, bufOut.String(), "snapshot ")
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package packfile
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+type PackfileShow struct {
+	RepositorySecret []byte
+
+	Packfile objects.MAC
+}
+
+func (cmd *PackfileShow) Name() string {
+	return "packfile_show"
+}
+
+func (cmd *PackfileShow) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	p, err := repo.GetPackfile(cmd.Packfile)
+	if err != nil {
+		return 1, fmt.Errorf("failed to fetch packfile %x: %w", cmd.Packfile, err)
+	}
+
+	compression := "none"
+	if c := repo.Configuration().Compression; c != nil {
+		compression = c.Algorithm
+	}
+	encryption := "none"
+	if e := repo.Configuration().Encryption; e != nil {
+		encryption = e.DataAlgorithm
+	}
+
+	fmt.Fprintf(ctx.Stdout, "packfile %x\n", cmd.Packfile)
+	fmt.Fprintf(ctx.Stdout, "version %s\n", p.Footer.Version)
+	fmt.Fprintf(ctx.Stdout, "timestamp %s\n", time.Unix(0, p.Footer.Timestamp).UTC().Format(time.RFC3339))
+	fmt.Fprintf(ctx.Stdout, "size %d\n", p.Size())
+	fmt.Fprintf(ctx.Stdout, "compression %s\n", compression)
+	fmt.Fprintf(ctx.Stdout, "encryption %s\n", encryption)
+	fmt.Fprintf(ctx.Stdout, "blobs %d\n", len(p.Index))
+
+	for _, blob := range p.Index {
+		// blobs are encrypted with the repository unless flagged otherwise
+		blobEncryption := encryption
+		if blob.Flags&packfile.FLAG_CLEARTEXT != 0 {
+			blobEncryption = "none"
+		}
+		fmt.Fprintf(ctx.Stdout, "blob %s %x %d %d %s\n", blob.Type, blob.MAC, blob.Offset, blob.Length, blobEncryption)
+	}
+	return 0, nil
+}
@@ -0,0 +1,105 @@
+package packfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+// putPackfile stores a packfile made of the given blobs the way the
+// snapshot packer does and returns its MAC.
+func putPackfile(t *testing.T, repo *repository.Repository, p *packfile.PackFile) objects.MAC {
+	data, err := p.SerializeData()
+	require.NoError(t, err)
+	index, err := p.SerializeIndex()
+	require.NoError(t, err)
+	footer, err := p.SerializeFooter()
+	require.NoError(t, err)
+
+	index, err = repo.EncodeBuffer(index)
+	require.NoError(t, err)
+	footer, err = repo.EncodeBuffer(footer)
+	require.NoError(t, err)
+
+	serialized := append(data, index...)
+	serialized = append(serialized, footer...)
+	serialized = binary.LittleEndian.AppendUint32(serialized, uint32(len(footer)))
+
+	mac := repo.ComputeMAC(serialized)
+	require.NoError(t, repo.PutPackfile(mac, bytes.NewReader(serialized)))
+	return mac
+}
+
+func TestExecuteCmdPackfileShow(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	repo := snap.Repository()
+
+	blobs := []struct {
+		typ   resources.Type
+		data  []byte
+		flags uint32
+	}{
+		{resources.RT_CHUNK, []byte("first chunk"), 0},
+		{resources.RT_OBJECT, []byte("an object"), 0},
+		{resources.RT_CHUNK, []byte("a cleartext chunk, a bit longer"), packfile.FLAG_CLEARTEXT},
+	}
+
+	p := packfile.New(repo.GetMACHasher())
+	var macs []objects.MAC
+	for _, blob := range blobs {
+		mac := repo.ComputeMAC(blob.data)
+		p.AddBlob(blob.typ, versioning.GetCurrentVersion(blob.typ), mac, blob.data, blob.flags)
+		macs = append(macs, mac)
+	}
+	packfileMAC := putPackfile(t, repo, p)
+
+	subcommand, err := parse_cmd_packfile(ctx, []string{hex.EncodeToString(packfileMAC[:])})
+	require.NoError(t, err)
+	require.Equal(t, "packfile_show", subcommand.(*PackfileShow).Name())
+
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	compression := "none"
+	if c := repo.Configuration().Compression; c != nil {
+		compression = c.Algorithm
+	}
+	encryption := "none"
+	if e := repo.Configuration().Encryption; e != nil {
+		encryption = e.DataAlgorithm
+	}
+
+	output := bufOut.String()
+	require.Contains(t, output, fmt.Sprintf("packfile %x\n", packfileMAC))
+	require.Contains(t, output, "size 51\n")
+	require.Contains(t, output, fmt.Sprintf("compression %s\n", compression))
+	require.Contains(t, output, fmt.Sprintf("encryption %s\n", encryption))
+	require.Contains(t, output, "blobs 3\n")
+	require.Contains(t, output, fmt.Sprintf("blob chunk %x 0 11 %s\n", macs[0], encryption))
+	require.Contains(t, output, fmt.Sprintf("blob object %x 11 9 %s\n", macs[1], encryption))
+	require.Contains(t, output, fmt.Sprintf("blob chunk %x 20 31 none\n", macs[2]))
+
+	_, err = parse_cmd_packfile(ctx, []string{"abcd"})
+	require.EqualError(t, err, "invalid packfile hash: abcd")
+}
@@ -0,0 +1,126 @@
+package prune
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/header"
+)
+
+// retentionPolicy tells how many snapshots to keep in each group: the
+// Last most recent ones, and the most recent one of each of the Daily
+// most recent days, Weekly weeks, Monthly months and Yearly years that
+// have snapshots.  A snapshot retained by several rules counts for each.
+type retentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+func (p retentionPolicy) empty() bool {
+	return p.Last == 0 && p.Daily == 0 && p.Weekly == 0 && p.Monthly == 0 && p.Yearly == 0
+}
+
+// decision is the fate of a snapshot, it's kept if at least one rule
+// retained it.
+type decision struct {
+	Header  *header.Header
+	Group   string
+	Reasons []string
+}
+
+func (d decision) Keep() bool {
+	return len(d.Reasons) != 0
+}
+
+// group identifies the snapshots of a same host and directory, the policy
+// applies to each of them separately.
+func group(hdr *header.Header) string {
+	directory := ""
+	if len(hdr.Sources) != 0 {
+		directory = hdr.GetSource(0).Importer.Directory
+	}
+	return hdr.GetContext("Hostname") + ":" + directory
+}
+
+type rule struct {
+	name   string
+	count  int
+	period func(time.Time) string
+}
+
+// apply decides which snapshots the policy retains.  Decisions are
+// returned by group, from the most recent snapshot to the oldest.
+func (p retentionPolicy) apply(headers []*header.Header) []decision {
+	groups := make(map[string][]*header.Header)
+	for _, hdr := range headers {
+		key := group(hdr)
+		groups[key] = append(groups[key], hdr)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// the last rule has no period, each snapshot counts
+	rules := []rule{
+		{"last", p.Last, nil},
+		{"daily", p.Daily, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{"weekly", p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{"monthly", p.Monthly, func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+		{"yearly", p.Yearly, func(t time.Time) string {
+			return t.Format("2006")
+		}},
+	}
+
+	var ret []decision
+	for _, key := range keys {
+		snapshots := groups[key]
+		sort.SliceStable(snapshots, func(i, j int) bool {
+			if !snapshots[i].Timestamp.Equal(snapshots[j].Timestamp) {
+				return snapshots[i].Timestamp.After(snapshots[j].Timestamp)
+			}
+			return string(snapshots[i].Identifier[:]) < string(snapshots[j].Identifier[:])
+		})
+
+		decisions := make([]decision, len(snapshots))
+		for i, hdr := range snapshots {
+			decisions[i] = decision{Header: hdr, Group: key}
+		}
+
+		for _, r := range rules {
+			remaining := r.count
+			previous := ""
+			for i := range decisions {
+				if remaining == 0 {
+					break
+				}
+				if r.period != nil {
+					period := r.period(decisions[i].Header.Timestamp)
+					if period == previous {
+						continue
+					}
+					previous = period
+				}
+				decisions[i].Reasons = append(decisions[i].Reasons, r.name)
+				remaining--
+			}
+		}
+
+		ret = append(ret, decisions...)
+	}
+
+	return ret
+}
@@ -0,0 +1,147 @@
+package prune
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	"github.com/stretchr/testify/require"
+)
+
+func syntheticHeader(hostname, directory, timestamp string) *header.Header {
+	hdr := header.NewHeader("default", objects.RandomMAC())
+	hdr.Timestamp, _ = time.Parse(time.RFC3339, timestamp)
+	hdr.SetContext("Hostname", hostname)
+	hdr.GetSource(0).Importer.Directory = directory
+	return hdr
+}
+
+func survivors(decisions []decision) []string {
+	ret := []string{}
+	for _, d := range decisions {
+		if d.Keep() {
+			ret = append(ret, d.Header.Timestamp.Format(time.RFC3339))
+		}
+	}
+	return ret
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	var headers []*header.Header
+	for _, ts := range []string{
+		"2026-10-14T18:00:00Z",
+		"2026-10-14T06:00:00Z",
+		"2026-10-13T18:00:00Z",
+		"2026-10-12T18:00:00Z",
+		"2026-10-05T18:00:00Z",
+		"2026-09-28T18:00:00Z",
+		"2026-09-01T18:00:00Z",
+		"2026-08-15T18:00:00Z",
+		"2025-12-31T18:00:00Z",
+		"2025-06-01T18:00:00Z",
+	} {
+		headers = append(headers, syntheticHeader("host", "/data", ts))
+	}
+
+	tests := []struct {
+		name     string
+		policy   retentionPolicy
+		expected []string
+	}{
+		{
+			name:   "last",
+			policy: retentionPolicy{Last: 3},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2026-10-14T06:00:00Z",
+				"2026-10-13T18:00:00Z",
+			},
+		},
+		{
+			name:   "daily",
+			policy: retentionPolicy{Daily: 3},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2026-10-13T18:00:00Z",
+				"2026-10-12T18:00:00Z",
+			},
+		},
+		{
+			name:   "weekly",
+			policy: retentionPolicy{Weekly: 3},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2026-10-05T18:00:00Z",
+				"2026-09-28T18:00:00Z",
+			},
+		},
+		{
+			name:   "monthly",
+			policy: retentionPolicy{Monthly: 3},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2026-09-28T18:00:00Z",
+				"2026-08-15T18:00:00Z",
+			},
+		},
+		{
+			name:   "yearly",
+			policy: retentionPolicy{Yearly: 5},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2025-12-31T18:00:00Z",
+			},
+		},
+		{
+			name:   "combined",
+			policy: retentionPolicy{Last: 1, Daily: 2, Monthly: 2, Yearly: 2},
+			expected: []string{
+				"2026-10-14T18:00:00Z",
+				"2026-10-13T18:00:00Z",
+				"2026-09-28T18:00:00Z",
+				"2025-12-31T18:00:00Z",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, survivors(tt.policy.apply(headers)))
+		})
+	}
+}
+
+func TestRetentionPolicyReasons(t *testing.T) {
+	headers := []*header.Header{
+		syntheticHeader("host", "/data", "2026-10-14T18:00:00Z"),
+		syntheticHeader("host", "/data", "2026-10-13T18:00:00Z"),
+	}
+
+	decisions := retentionPolicy{Last: 1, Daily: 2, Weekly: 1}.apply(headers)
+	require.Len(t, decisions, 2)
+	require.Equal(t, []string{"last", "daily", "weekly"}, decisions[0].Reasons)
+	require.Equal(t, []string{"daily"}, decisions[1].Reasons)
+}
+
+func TestRetentionPolicyGroups(t *testing.T) {
+	headers := []*header.Header{
+		syntheticHeader("host1", "/data", "2026-10-14T18:00:00Z"),
+		syntheticHeader("host1", "/data", "2026-10-13T18:00:00Z"),
+		syntheticHeader("host1", "/etc", "2026-10-12T18:00:00Z"),
+		syntheticHeader("host2", "/data", "2026-10-11T18:00:00Z"),
+		syntheticHeader("host2", "/data", "2026-10-10T18:00:00Z"),
+	}
+
+	decisions := retentionPolicy{Last: 1}.apply(headers)
+	require.Len(t, decisions, 5)
+	require.Equal(t, []string{
+		"2026-10-14T18:00:00Z",
+		"2026-10-12T18:00:00Z",
+		"2026-10-11T18:00:00Z",
+	}, survivors(decisions))
+
+	for _, d := range decisions {
+		require.Equal(t, group(d.Header), d.Group)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package prune
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+)
+
+func init() {
+	subcommands.Register("prune", parse_cmd_prune)
+}
+
+func parse_cmd_prune(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var policy retentionPolicy
+	var opt_dryrun bool
+
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.IntVar(&policy.Last, "keep-last", 0, "keep the last N snapshots")
+	flags.IntVar(&policy.Daily, "keep-daily", 0, "keep the last snapshot of the last N days")
+	flags.IntVar(&policy.Weekly, "keep-weekly", 0, "keep the last snapshot of the last N weeks")
+	flags.IntVar(&policy.Monthly, "keep-monthly", 0, "keep the last snapshot of the last N months")
+	flags.IntVar(&policy.Yearly, "keep-yearly", 0, "keep the last snapshot of the last N years")
+	flags.BoolVar(&opt_dryrun, "dry-run", true, "only report the snapshots that would be removed")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	if policy.Last < 0 || policy.Daily < 0 || policy.Weekly < 0 || policy.Monthly < 0 || policy.Yearly < 0 {
+		return nil, fmt.Errorf("invalid negative retention")
+	}
+	if policy.empty() {
+		return nil, fmt.Errorf("no retention specified, not going to remove everything")
+	}
+
+	return &Prune{
+		RepositorySecret: ctx.GetSecret(),
+
+		KeepLast:    policy.Last,
+		KeepDaily:   policy.Daily,
+		KeepWeekly:  policy.Weekly,
+		KeepMonthly: policy.Monthly,
+		KeepYearly:  policy.Yearly,
+		DryRun:      opt_dryrun,
+	}, nil
+}
+
+type Prune struct {
+	RepositorySecret []byte
+
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	KeepYearly  int
+	DryRun      bool
+}
+
+func (cmd *Prune) Name() string {
+	return "prune"
+}
+
+func (cmd *Prune) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	policy := retentionPolicy{
+		Last:    cmd.KeepLast,
+		Daily:   cmd.KeepDaily,
+		Weekly:  cmd.KeepWeekly,
+		Monthly: cmd.KeepMonthly,
+		Yearly:  cmd.KeepYearly,
+	}
+
+	var headers []*header.Header
+	for snapshotID := range repo.ListSnapshots() {
+		hdr, _, err := snapshot.GetSnapshot(repo, snapshotID)
+		if err != nil {
+			return 1, fmt.Errorf("failed to load snapshot %x: %w", snapshotID[:4], err)
+		}
+		headers = append(headers, hdr)
+	}
+
+	kept, removed, errors := 0, 0, 0
+	for _, d := range policy.apply(headers) {
+		snapshotID := d.Header.Identifier
+		timestamp := d.Header.Timestamp.UTC().Format("2006-01-02T15:04:05Z")
+
+		if d.Keep() {
+			kept++
+			ctx.GetLogger().Info("%s: keep %x %s %s (%s)", cmd.Name(),
+				snapshotID[:4], timestamp, d.Group, strings.Join(d.Reasons, ", "))
+			continue
+		}
+
+		if cmd.DryRun {
+			removed++
+			ctx.GetLogger().Info("%s: would remove %x %s %s", cmd.Name(), snapshotID[:4], timestamp, d.Group)
+			continue
+		}
+
+		if err := repo.DeleteSnapshot(snapshotID); err != nil {
+			ctx.GetLogger().Error("%s: failed to remove %x: %s", cmd.Name(), snapshotID[:4], err)
+			errors++
+			continue
+		}
+		removed++
+		ctx.GetLogger().Info("%s: removed %x %s %s", cmd.Name(), snapshotID[:4], timestamp, d.Group)
+	}
+
+	if cmd.DryRun {
+		ctx.GetLogger().Info("%s: %d snapshots kept, %d would be removed (dry run)", cmd.Name(), kept, removed)
+	} else {
+		ctx.GetLogger().Info("%s: %d snapshots kept, %d removed", cmd.Name(), kept, removed)
+	}
+
+	if errors != 0 {
+		return 1, fmt.Errorf("failed to remove %d snapshots", errors)
+	}
+	return 0, nil
+}
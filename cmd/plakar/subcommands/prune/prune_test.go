@@ -0,0 +1,145 @@
+package prune
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+}
+
+func TestParseCmdPrune(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+	ctx := snap.AppContext()
+
+	_, err := parse_cmd_prune(ctx, []string{})
+	require.EqualError(t, err, "no retention specified, not going to remove everything")
+
+	_, err = parse_cmd_prune(ctx, []string{"-keep-daily", "-1"})
+	require.EqualError(t, err, "invalid negative retention")
+
+	subcommand, err := parse_cmd_prune(ctx, []string{"-keep-last", "2", "-keep-weekly", "4"})
+	require.NoError(t, err)
+	require.Equal(t, "prune", subcommand.(*Prune).Name())
+	require.True(t, subcommand.(*Prune).DryRun)
+	require.Equal(t, 2, subcommand.(*Prune).KeepLast)
+	require.Equal(t, 4, subcommand.(*Prune).KeepWeekly)
+}
+
+func TestExecuteCmdPrune(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	// a more recent snapshot of the same directory
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": snap.Header.GetSource(0).Importer.Directory})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	snap2ID := snap2.Header.Identifier
+	snap2.Close()
+
+	snapID := snap.Header.Identifier
+
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+
+	bufOut.Reset()
+	subcommand, err := parse_cmd_prune(ctx, []string{"-keep-last", "1"})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output := bufOut.String()
+	require.Contains(t, output, fmt.Sprintf("info: prune: keep %x", snap2ID[:4]))
+	require.Contains(t, output, fmt.Sprintf("info: prune: would remove %x", snapID[:4]))
+	require.Contains(t, output, "info: prune: 1 snapshots kept, 1 would be removed (dry run)")
+	// a dry run writes no state
+	statesAfter, err := repo.GetStates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, states, statesAfter)
+
+	bufOut.Reset()
+	subcommand, err = parse_cmd_prune(ctx, []string{"-keep-last", "1", "-dry-run=false"})
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	output = bufOut.String()
+	require.Contains(t, output, fmt.Sprintf("info: prune: removed %x", snapID[:4]))
+	require.Contains(t, output, "info: prune: 1 snapshots kept, 1 removed")
+
+	// the removal is only seen once the states are loaded again
+	store, serializedConfig, err := storage.Open(map[string]string{"location": repo.Location()})
+	require.NoError(t, err)
+	reopened, err := repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.Equal(t, []objects.MAC{snap2ID}, slices.Collect(reopened.ListSnapshots()))
+}
+
+func TestExecuteCmdPruneAppendOnly(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": snap.Header.GetSource(0).Importer.Directory})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	snap2.Close()
+
+	repo.SetMode(repository.ModeAppendOnly)
+
+	subcommand, err := parse_cmd_prune(ctx, []string{"-keep-last", "1", "-dry-run=false"})
+	require.NoError(t, err)
+	status, err := subcommand.Execute(ctx, repo)
+	require.EqualError(t, err, "failed to remove 1 snapshots")
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), repository.ErrAppendOnly.Error())
+}
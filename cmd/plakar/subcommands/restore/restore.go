@@ -19,6 +19,8 @@ package restore
 import (
 	"flag"
 	"fmt"
+	"io"
+	"path"
 	"strings"
 	"time"
 
@@ -28,12 +30,26 @@ import (
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/PlakarKorp/plakar/snapshot/exporter/null"
+	"github.com/dustin/go-humanize"
+	"github.com/gobwas/glob"
 )
 
 func init() {
 	subcommands.Register("restore", parse_cmd_restore)
 }
 
+type patternFlags []string
+
+func (p *patternFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
 func parse_cmd_restore(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
 	var opt_name string
 	var opt_category string
@@ -46,6 +62,16 @@ func parse_cmd_restore(ctx *appcontext.AppContext, args []string) (subcommands.S
 	var opt_concurrency uint64
 	var opt_quiet bool
 	var opt_silent bool
+	var opt_prefetch bool
+	var opt_overwrite string
+	var opt_stdout bool
+	var opt_stripPrefix string
+	var opt_verifyInline bool
+	var opt_preserveOwner bool
+	var opt_overlay bool
+	var opt_force bool
+	var opt_include patternFlags
+	var opt_exclude patternFlags
 
 	flags := flag.NewFlagSet("restore", flag.ExitOnError)
 	flags.Usage = func() {
@@ -65,8 +91,23 @@ func parse_cmd_restore(ctx *appcontext.AppContext, args []string) (subcommands.S
 	flags.StringVar(&pullPath, "to", "", "base directory where pull will restore")
 	flags.BoolVar(&opt_quiet, "quiet", false, "do not print progress")
 	flags.BoolVar(&opt_silent, "silent", false, "do not print ANY progress")
+	flags.BoolVar(&opt_prefetch, "prefetch", false, "read ahead blobs using the recorded access history")
+	flags.StringVar(&opt_overwrite, "overwrite", "always", "policy for existing files: always, never or if-newer")
+	flags.BoolVar(&opt_force, "force", false, "store every file, even those already at the destination with the same content")
+	flags.BoolVar(&opt_overlay, "overlay", false, "restore several snapshots in order, later ones overwriting the files of earlier ones")
+	flags.BoolVar(&opt_verifyInline, "verify-inline", false, "verify the checksum of files as they are restored")
+	flags.BoolVar(&opt_preserveOwner, "preserve-owner", false, "restore the ownership of files even when not running as root")
+	flags.Var(&opt_include, "include", "glob pattern of the paths to restore, can be specified multiple times")
+	flags.Var(&opt_exclude, "exclude", "glob pattern of the paths not to restore, can be specified multiple times")
+	flags.BoolVar(&opt_stdout, "stdout", false, "write the content of a single file to standard output")
+	flags.StringVar(&opt_stripPrefix, "strip-prefix", "", "leading path removed from the restored entries instead of the snapshot root")
 	flags.Parse(args)
 
+	overwrite, err := exporter.ParseOverwritePolicy(opt_overwrite)
+	if err != nil {
+		return nil, err
+	}
+
 	if flags.NArg() != 0 {
 		if opt_name != "" || opt_category != "" || opt_environment != "" || opt_perimeter != "" || opt_job != "" || opt_tag != "" {
 			ctx.GetLogger().Warn("snapshot specified, filters will be ignored")
@@ -75,6 +116,34 @@ func parse_cmd_restore(ctx *appcontext.AppContext, args []string) (subcommands.S
 		return nil, fmt.Errorf("multiple restore paths specified, please specify only one")
 	}
 
+	for _, item := range opt_include {
+		if _, err := glob.Compile(item); err != nil {
+			return nil, fmt.Errorf("failed to compile include pattern: %s", item)
+		}
+	}
+	for _, item := range opt_exclude {
+		if _, err := glob.Compile(item); err != nil {
+			return nil, fmt.Errorf("failed to compile exclude pattern: %s", item)
+		}
+	}
+
+	if opt_stdout && pullPath != "" {
+		return nil, fmt.Errorf("-stdout and -to are mutually exclusive")
+	}
+
+	if opt_stdout && opt_stripPrefix != "" {
+		return nil, fmt.Errorf("-stdout and -strip-prefix are mutually exclusive")
+	}
+
+	if opt_overlay && opt_stdout {
+		return nil, fmt.Errorf("-stdout and -overlay are mutually exclusive")
+	}
+
+	// later snapshots must win over earlier ones
+	if opt_overlay && overwrite != exporter.OverwriteAlways {
+		return nil, fmt.Errorf("-overlay requires the always overwrite policy")
+	}
+
 	if pullPath == "" {
 		pullPath = fmt.Sprintf("%s/plakar-%s", ctx.CWD, time.Now().Format(time.RFC3339))
 	}
@@ -89,11 +158,21 @@ func parse_cmd_restore(ctx *appcontext.AppContext, args []string) (subcommands.S
 		OptJob:         opt_job,
 		OptTag:         opt_tag,
 
-		Target:      pullPath,
-		Concurrency: opt_concurrency,
-		Quiet:       opt_quiet,
-		Silent:      opt_silent,
-		Snapshots:   flags.Args(),
+		Target:        pullPath,
+		Strip:         opt_stripPrefix,
+		Concurrency:   opt_concurrency,
+		Quiet:         opt_quiet,
+		Silent:        opt_silent,
+		Prefetch:      opt_prefetch,
+		Overwrite:     overwrite,
+		Stdout:        opt_stdout,
+		VerifyInline:  opt_verifyInline,
+		PreserveOwner: opt_preserveOwner,
+		Overlay:       opt_overlay,
+		Force:         opt_force,
+		Includes:      opt_include,
+		Excludes:      opt_exclude,
+		Snapshots:     flags.Args(),
 	}, nil
 }
 
@@ -107,12 +186,21 @@ type Restore struct {
 	OptJob         string
 	OptTag         string
 
-	Target      string
-	Strip       string
-	Concurrency uint64
-	Quiet       bool
-	Silent      bool
-	Snapshots   []string
+	Target        string
+	Strip         string
+	Concurrency   uint64
+	Quiet         bool
+	Silent        bool
+	Prefetch      bool
+	Overwrite     exporter.OverwritePolicy
+	Stdout        bool
+	VerifyInline  bool
+	PreserveOwner bool
+	Overlay       bool
+	Force         bool
+	Includes      []string
+	Excludes      []string
+	Snapshots     []string
 }
 
 func (cmd *Restore) Name() string {
@@ -120,9 +208,6 @@ func (cmd *Restore) Name() string {
 }
 
 func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
-	if !cmd.Silent {
-		go eventsProcessorStdio(ctx, cmd.Quiet)
-	}
 	var snapshots []string
 	if len(cmd.Snapshots) == 0 {
 		locateOptions := utils.NewDefaultLocateOptions()
@@ -173,8 +258,12 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 
 	if len(snapshots) == 0 {
 		return 1, fmt.Errorf("no snapshots found")
-	} else if len(snapshots) > 1 {
-		return 1, fmt.Errorf("multiple snapshots found, please specify one")
+	} else if len(snapshots) > 1 && !cmd.Overlay {
+		return 1, fmt.Errorf("multiple snapshots found, please specify one or use -overlay")
+	}
+
+	if cmd.Stdout {
+		return cmd.writeStdout(ctx, repo, snapshots[0])
 	}
 
 	exporterConfig := map[string]string{
@@ -188,9 +277,15 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 		if _, ok := remote["location"]; !ok {
 			return 1, fmt.Errorf("could not resolve exporter location: %s", cmd.Target)
 		} else {
-			exporterConfig = remote
+			exporterConfig = make(map[string]string, len(remote))
+			for key, value := range remote {
+				exporterConfig[key] = value
+			}
 		}
 	}
+	if cmd.PreserveOwner {
+		exporterConfig["preserve_owner"] = "true"
+	}
 
 	var exporterInstance exporter.Exporter
 	var err error
@@ -200,28 +295,131 @@ func (cmd *Restore) Execute(ctx *appcontext.AppContext, repo *repository.Reposit
 	}
 	defer exporterInstance.Close()
 
+	includes := []glob.Glob{}
+	for _, item := range cmd.Includes {
+		g, err := snapshot.CompileRestorePattern(item)
+		if err != nil {
+			return 1, fmt.Errorf("failed to compile include pattern: %s", item)
+		}
+		includes = append(includes, g)
+	}
+
+	excludes := []glob.Glob{}
+	for _, item := range cmd.Excludes {
+		g, err := snapshot.CompileRestorePattern(item)
+		if err != nil {
+			return 1, fmt.Errorf("failed to compile exclude pattern: %s", item)
+		}
+		excludes = append(excludes, g)
+	}
+
 	opts := &snapshot.RestoreOptions{
 		MaxConcurrency: cmd.Concurrency,
+		Prefetch:       cmd.Prefetch,
+		Overwrite:      cmd.Overwrite,
+		Force:          cmd.Force,
+		VerifyInline:   cmd.VerifyInline,
+		Includes:       includes,
+		Excludes:       excludes,
+	}
+	if !cmd.Quiet && !cmd.Silent {
+		opts.Progress = progressStdio(ctx)
+	}
+	if !cmd.Silent {
+		events, done := eventsProcessorStdio(ctx, cmd.Quiet)
+		defer func() {
+			close(events)
+			<-done
+		}()
+		opts.Events = events
 	}
 
+	// with -overlay, the snapshots are restored in the order they were
+	// given so that the files of the last one end up at the destination.
 	for _, snapPath := range snapshots {
-		snap, pathname, err := utils.OpenSnapshotByPath(repo, snapPath)
+		snap, pathnames, err := utils.OpenSnapshotByPattern(repo, snapPath)
 		if err != nil {
 			return 1, err
 		}
 		opts.Strip = snap.Header.GetSource(0).Importer.Directory
+		if cmd.Strip != "" {
+			opts.Strip = cmd.Strip
+			if !path.IsAbs(opts.Strip) {
+				opts.Strip = path.Join(snap.Header.GetSource(0).Importer.Directory, opts.Strip)
+			}
+			opts.Strip = path.Clean(opts.Strip)
+		}
 
-		err = snap.Restore(exporterInstance, exporterInstance.Root(), pathname, opts)
-
-		if err != nil {
-			return 1, err
+		for _, pathname := range pathnames {
+			if !isBelow(pathname, opts.Strip) {
+				snap.Close()
+				return 1, fmt.Errorf("%s: not below the stripped prefix %s", pathname, opts.Strip)
+			}
+			err = snap.Restore(exporterInstance, exporterInstance.Root(), pathname, opts)
+			if err != nil {
+				snap.Close()
+				return 1, err
+			}
+			ctx.GetLogger().Info("%s: restoration of %x:%s at %s completed successfully",
+				cmd.Name(),
+				snap.Header.GetIndexShortID(),
+				pathname,
+				cmd.Target)
 		}
-		ctx.GetLogger().Info("%s: restoration of %x:%s at %s completed successfully",
-			cmd.Name(),
-			snap.Header.GetIndexShortID(),
-			pathname,
-			cmd.Target)
 		snap.Close()
 	}
+
+	if verifier, ok := exporterInstance.(*null.NullExporter); ok {
+		ctx.GetLogger().Info("%s: verified %d files, %s",
+			cmd.Name(),
+			verifier.Files(),
+			humanize.Bytes(verifier.Size()))
+	}
+	return 0, nil
+}
+
+// isBelow reports whether pathname is prefix or lies within it, comparing
+// whole path components so that /home/al is not below /home/a.
+func isBelow(pathname, prefix string) bool {
+	if prefix == "/" || pathname == prefix {
+		return true
+	}
+	return strings.HasPrefix(pathname, prefix+"/")
+}
+
+// writeStdout streams the content of the file at snapPath to the standard
+// output, refusing anything but a single regular file.
+func (cmd *Restore) writeStdout(ctx *appcontext.AppContext, repo *repository.Repository, snapPath string) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, snapPath)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		return 1, err
+	}
+
+	entry, err := fs.GetEntry(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", pathname, err)
+	}
+	if entry.IsDir() {
+		return 1, fmt.Errorf("%s: is a directory, -stdout restores a single file", pathname)
+	}
+	if !entry.Type().IsRegular() {
+		return 1, fmt.Errorf("%s: not a regular file", pathname)
+	}
+
+	rd, err := snap.NewReader(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("%s: %w", pathname, err)
+	}
+	defer rd.Close()
+
+	if _, err := io.Copy(ctx.Stdout, rd); err != nil {
+		return 1, fmt.Errorf("%s: %w", pathname, err)
+	}
 	return 0, nil
 }
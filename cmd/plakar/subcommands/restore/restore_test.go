@@ -5,11 +5,15 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
@@ -29,6 +33,19 @@ func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer)
 	})
 }
 
+var progressLine = regexp.MustCompile(`info: restore: [0-9.]+% `)
+
+// withoutProgress drops the progress lines, whose number depends on timing.
+func withoutProgress(lines []string) []string {
+	ret := []string{}
+	for _, line := range lines {
+		if !progressLine.MatchString(line) {
+			ret = append(ret, line)
+		}
+	}
+	return ret
+}
+
 func TestExecuteCmdRestoreDefault(t *testing.T) {
 	bufOut := bytes.NewBuffer(nil)
 	bufErr := bytes.NewBuffer(nil)
@@ -72,7 +89,7 @@ func TestExecuteCmdRestoreDefault(t *testing.T) {
 	// 2025-02-25T21:35:42Z info: restore: restoration of 31b0d219:/ at /tmp/tmp_to_restore3971085618/plakar-2025-02-25T21:35:42Z completed successfully
 
 	output := bufOut.String()
-	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	lines := withoutProgress(strings.Split(strings.Trim(output, "\n"), "\n"))
 	require.Equal(t, 8, len(lines))
 	// last line should have the summary
 	lastline := lines[len(lines)-1]
@@ -122,9 +139,217 @@ func TestExecuteCmdRestoreSpecificSnapshot(t *testing.T) {
 	// 2025-02-25T21:35:42Z info: restore: restoration of 31b0d219:/ at /tmp/tmp_to_restore3971085618/plakar-2025-02-25T21:35:42Z completed successfully
 
 	output := bufOut.String()
-	lines := strings.Split(strings.Trim(output, "\n"), "\n")
+	lines := withoutProgress(strings.Split(strings.Trim(output, "\n"), "\n"))
 	require.Equal(t, 8, len(lines))
 	// last line should have the summary
 	lastline := lines[len(lines)-1]
 	require.Contains(t, lastline, "info: restore: restoration of")
 }
+
+func TestExecuteCmdRestoreOverlay(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	first := generateSnapshot(t, bufOut, bufErr)
+	defer first.Close()
+
+	ctx := first.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := first.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	// back up the same directory again after changing a file and adding
+	// another one
+	backupDir := first.Header.GetSource(0).Importer.Directory
+	err := os.WriteFile(filepath.Join(backupDir, "subdir", "dummy.txt"), []byte("hello overlay"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(backupDir, "subdir", "new.txt"), []byte("hello new"), 0644)
+	require.NoError(t, err)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": backupDir})
+	require.NoError(t, err)
+	defer imp.Close()
+	second, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NoError(t, second.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	second.Close()
+	require.NoError(t, repo.RebuildState())
+
+	restore := func(snapshots ...*snapshot.Snapshot) string {
+		target := t.TempDir()
+		args := []string{"-overlay", "-to", target}
+		for _, snap := range snapshots {
+			indexId := snap.Header.GetIndexID()
+			args = append(args, hex.EncodeToString(indexId[:]))
+		}
+		subcommand, err := parse_cmd_restore(ctx, args)
+		require.NoError(t, err)
+		status, err := subcommand.Execute(ctx, repo)
+		require.NoError(t, err)
+		require.Equal(t, 0, status)
+		return target
+	}
+	content := func(pathname string) string {
+		data, err := os.ReadFile(pathname)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	target := restore(first, second)
+	require.Equal(t, "hello overlay", content(filepath.Join(target, "subdir", "dummy.txt")))
+	require.Equal(t, "hello new", content(filepath.Join(target, "subdir", "new.txt")))
+	require.Equal(t, "hello foo", content(filepath.Join(target, "subdir", "foo.txt")))
+
+	// the order of the snapshots decides which content wins
+	target = restore(second, first)
+	require.Equal(t, "hello dummy", content(filepath.Join(target, "subdir", "dummy.txt")))
+	require.Equal(t, "hello new", content(filepath.Join(target, "subdir", "new.txt")))
+
+	// several snapshots are refused without -overlay
+	indexId := first.Header.GetIndexID()
+	secondId := second.Header.GetIndexID()
+	subcommand, err := parse_cmd_restore(ctx, []string{"-to", t.TempDir(), hex.EncodeToString(indexId[:]), hex.EncodeToString(secondId[:])})
+	require.NoError(t, err)
+	_, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+
+	_, err = parse_cmd_restore(ctx, []string{"-overlay", "-overwrite", "never", hex.EncodeToString(indexId[:])})
+	require.Error(t, err)
+}
+
+func TestExecuteCmdRestoreStdout(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	indexId := snap.Header.GetIndexID()
+
+	bufOut.Reset()
+	args := []string{"-stdout", fmt.Sprintf("%x:subdir/dummy.txt", indexId[:])}
+	subcommand, err := parse_cmd_restore(ctx, args)
+	require.NoError(t, err)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Equal(t, "hello dummy", bufOut.String())
+
+	args = []string{"-stdout", fmt.Sprintf("%x:subdir", indexId[:])}
+	subcommand, err = parse_cmd_restore(ctx, args)
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.ErrorContains(t, err, "is a directory")
+	require.Equal(t, 1, status)
+
+	args = []string{"-stdout", "-to", t.TempDir(), fmt.Sprintf("%x:subdir/dummy.txt", indexId[:])}
+	_, err = parse_cmd_restore(ctx, args)
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestExecuteCmdRestoreStripPrefix(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	tmpToRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpToRestoreDir)
+	})
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	indexId := snap.Header.GetIndexID()
+	snapPath := fmt.Sprintf("%s:%s/subdir", hex.EncodeToString(indexId[:]), root)
+
+	// a relative prefix is resolved against the snapshot root
+	args := []string{"-quiet", "-to", tmpToRestoreDir, "-strip-prefix", "subdir", snapPath}
+	subcommand, err := parse_cmd_restore(ctx, args)
+	require.NoError(t, err)
+	require.Equal(t, "subdir", subcommand.(*Restore).Strip)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	entries, err := os.ReadDir(tmpToRestoreDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"dummy.txt", "foo.txt", "to_exclude"}, names)
+
+	content, err := os.ReadFile(tmpToRestoreDir + "/dummy.txt")
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(content))
+
+	// an absolute prefix keeps the path below it
+	nestedDir := tmpToRestoreDir + "/nested"
+	args = []string{"-quiet", "-to", nestedDir, "-strip-prefix", root, snapPath}
+	subcommand, err = parse_cmd_restore(ctx, args)
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	content, err = os.ReadFile(nestedDir + "/subdir/foo.txt")
+	require.NoError(t, err)
+	require.Equal(t, "hello foo", string(content))
+
+	// the restored path must be below the prefix
+	args = []string{"-quiet", "-to", tmpToRestoreDir, "-strip-prefix", "another_subdir", snapPath}
+	subcommand, err = parse_cmd_restore(ctx, args)
+	require.NoError(t, err)
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, err.Error(), "not below the stripped prefix")
+
+	_, err = parse_cmd_restore(ctx, []string{"-stdout", "-strip-prefix", "subdir", snapPath})
+	require.Error(t, err)
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	mtime := time.Date(2024, 3, 14, 15, 9, 26, 535897932, time.UTC)
+
+	script := ptesting.NewMockFile("bin/run.sh", 0755, "#!/bin/sh\necho hello\n")
+	script.ModTime = mtime
+	secret := ptesting.NewMockFile("etc/secret", 0600, "hunter2")
+	secret.ModTime = mtime.Add(-24 * time.Hour)
+	tagged := ptesting.NewMockFile("etc/tagged.txt", 0640, "hello tagged")
+	tagged.Xattrs = map[string][]byte{
+		"user.origin":  []byte("plakar"),
+		"user.comment": []byte("round trip"),
+	}
+	private := ptesting.NewMockDir("private")
+	private.Mode = 0700
+
+	ptesting.AssertRoundTrip(t, []ptesting.MockFile{
+		ptesting.NewMockDir("bin"),
+		ptesting.NewMockDir("etc"),
+		private,
+		script,
+		secret,
+		tagged,
+		ptesting.NewMockFile("private/empty", 0644, ""),
+		ptesting.NewMockSymlink("bin/run", "run.sh"),
+		ptesting.NewMockSymlink("dangling", "does/not/exist"),
+	})
+}
@@ -1,9 +1,12 @@
 package restore
 
 import (
+	"time"
+
 	"github.com/PlakarKorp/plakar/appcontext"
-	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
 )
 
 var (
@@ -11,29 +14,49 @@ var (
 	crossMark = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).SetString("✘")
 )
 
-func eventsProcessorStdio(ctx *appcontext.AppContext, quiet bool) chan struct{} {
+// eventsProcessorStdio logs the outcome of each restored entry, the
+// returned channel is to be set as RestoreOptions.Events and closed once
+// done, done is then closed when everything was logged.
+func eventsProcessorStdio(ctx *appcontext.AppContext, quiet bool) (chan<- snapshot.RestoreEvent, <-chan struct{}) {
+	ch := make(chan snapshot.RestoreEvent)
 	done := make(chan struct{})
 	go func() {
-		for event := range ctx.Events().Listen() {
-			switch event := event.(type) {
-			case events.PathError:
-				ctx.GetLogger().Warn("%x: KO %s %s: %s", event.SnapshotID[:4], crossMark, event.Pathname, event.Message)
-
-			case events.FileError:
-				ctx.GetLogger().Warn("%x: KO %s %s: %s", event.SnapshotID[:4], crossMark, event.Pathname, event.Message)
-
-			case events.DirectoryOK:
+		defer close(done)
+		for event := range ch {
+			switch event.Kind {
+			case snapshot.RestoreError:
+				ctx.GetLogger().Warn("%x: KO %s %s: %s", event.SnapshotID[:4], crossMark, event.Path, event.Err)
+			case snapshot.RestoreDirectoryOK, snapshot.RestoreFileOK:
 				if !quiet {
-					ctx.GetLogger().Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Pathname)
+					ctx.GetLogger().Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Path)
 				}
-			case events.FileOK:
-				if !quiet {
-					ctx.GetLogger().Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Pathname)
-				}
-			default:
 			}
 		}
-		done <- struct{}{}
 	}()
-	return done
+	return ch, done
+}
+
+// progressStdio returns a RestoreOptions.Progress callback logging the
+// percentage restored and the throughput, at most once per second.
+func progressStdio(ctx *appcontext.AppContext) func(done, total int64) {
+	start := time.Now()
+	var last time.Time
+	return func(done, total int64) {
+		now := time.Now()
+		if done != total && now.Sub(last) < time.Second {
+			return
+		}
+		last = now
+
+		percent := 100.0
+		if total != 0 {
+			percent = float64(done) * 100 / float64(total)
+		}
+		var rate uint64
+		if elapsed := now.Sub(start).Seconds(); elapsed > 0 {
+			rate = uint64(float64(done) / elapsed)
+		}
+		ctx.GetLogger().Info("restore: %.1f%% (%s/%s) %s/s", percent,
+			humanize.Bytes(uint64(done)), humanize.Bytes(uint64(total)), humanize.Bytes(rate))
+	}
 }
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package restoreimage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("restore-image", parse_cmd_restore_image)
+}
+
+// filesystems whose mkfs can populate the image from a directory, which
+// avoids the need for a loopback mount and thus for root privileges.
+var supportedFilesystems = []string{"ext2", "ext3", "ext4"}
+
+func parse_cmd_restore_image(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_out string
+	var opt_fs string
+	var opt_size string
+	var opt_concurrency uint64
+
+	flags := flag.NewFlagSet("restore-image", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] -out FILE -size SIZE SNAPSHOT[:PATH]\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
+	flags.StringVar(&opt_out, "out", "", "image file to create")
+	flags.StringVar(&opt_fs, "fs", "ext4", "filesystem type: "+strings.Join(supportedFilesystems, ", "))
+	flags.StringVar(&opt_size, "size", "", "size of the image, e.g. 10G")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		ctx.GetLogger().Error("%s: exactly one snapshot is required", flags.Name())
+		return nil, fmt.Errorf("exactly one snapshot is required")
+	}
+
+	if opt_out == "" {
+		return nil, fmt.Errorf("an output image must be specified with -out")
+	}
+	// the command may be executed by the agent, which has its own cwd
+	if !filepath.IsAbs(opt_out) {
+		opt_out = filepath.Join(ctx.CWD, opt_out)
+	}
+
+	supported := false
+	for _, fs := range supportedFilesystems {
+		if fs == opt_fs {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported filesystem: %s", opt_fs)
+	}
+
+	if opt_size == "" {
+		return nil, fmt.Errorf("an image size must be specified with -size")
+	}
+	size, err := humanize.ParseBytes(opt_size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image size: %s", opt_size)
+	}
+
+	return &RestoreImage{
+		RepositorySecret: ctx.GetSecret(),
+
+		Output:      opt_out,
+		Filesystem:  opt_fs,
+		Size:        size,
+		Concurrency: opt_concurrency,
+		Snapshot:    flags.Arg(0),
+	}, nil
+}
+
+type RestoreImage struct {
+	RepositorySecret []byte
+
+	Output      string
+	Filesystem  string
+	Size        uint64
+	Concurrency uint64
+	Snapshot    string
+}
+
+func (cmd *RestoreImage) Name() string {
+	return "restore-image"
+}
+
+func (cmd *RestoreImage) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	mkfs, err := exec.LookPath("mkfs." + cmd.Filesystem)
+	if err != nil {
+		return 1, fmt.Errorf("%s: mkfs.%s is required to build the image: %w", cmd.Name(), cmd.Filesystem, err)
+	}
+
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.Snapshot)
+	if err != nil {
+		return 1, err
+	}
+	defer snap.Close()
+
+	// the tree is staged in a temporary directory that mkfs then copies
+	// into the image.
+	stagingDir, err := os.MkdirTemp("", "plakar-restore-image-")
+	if err != nil {
+		return 1, err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": stagingDir})
+	if err != nil {
+		return 1, err
+	}
+	defer exporterInstance.Close()
+
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: cmd.Concurrency,
+		Strip:          pathname,
+	}
+	if err := snap.Restore(exporterInstance, exporterInstance.Root(), pathname, opts); err != nil {
+		return 1, err
+	}
+
+	fp, err := os.OpenFile(cmd.Output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return 1, err
+	}
+	if err := fp.Truncate(int64(cmd.Size)); err != nil {
+		fp.Close()
+		os.Remove(cmd.Output)
+		return 1, err
+	}
+	if err := fp.Close(); err != nil {
+		os.Remove(cmd.Output)
+		return 1, err
+	}
+
+	mkfsCmd := exec.CommandContext(ctx.GetContext(), mkfs, "-q", "-F", "-d", stagingDir, cmd.Output)
+	if output, err := mkfsCmd.CombinedOutput(); err != nil {
+		os.Remove(cmd.Output)
+		return 1, fmt.Errorf("%s: mkfs.%s failed: %w: %s", cmd.Name(), cmd.Filesystem, err, strings.TrimSpace(string(output)))
+	}
+
+	ctx.GetLogger().Info("%s: image of %x:%s written to %s",
+		cmd.Name(),
+		snap.Header.GetIndexShortID(),
+		pathname,
+		cmd.Output)
+	return 0, nil
+}
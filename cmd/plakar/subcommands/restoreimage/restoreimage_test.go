@@ -0,0 +1,97 @@
+package restoreimage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockDir("another_subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+		ptesting.NewMockFile("another_subdir/bar.txt", 0644, "hello bar"),
+	})
+}
+
+func TestExecuteCmdRestoreImageExt4(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not available")
+	}
+	debugfs, err := exec.LookPath("debugfs")
+	if err != nil {
+		t.Skip("debugfs not available")
+	}
+
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	repo := snap.Repository()
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	image := filepath.Join(t.TempDir(), "disk.img")
+	indexId := snap.Header.GetIndexID()
+	args := []string{"-out", image, "-size", "4M", hex.EncodeToString(indexId[:])}
+
+	subcommand, err := parse_cmd_restore_image(ctx, args)
+	require.NoError(t, err)
+	require.NotNil(t, subcommand)
+	require.Equal(t, "restore-image", subcommand.(*RestoreImage).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	info, err := os.Stat(image)
+	require.NoError(t, err)
+	require.Equal(t, int64(4*1000*1000), info.Size())
+
+	output, err := exec.Command(debugfs, "-R", "cat /subdir/dummy.txt", image).Output()
+	require.NoError(t, err)
+	require.Equal(t, "hello dummy", string(output))
+}
+
+func TestExecuteCmdRestoreImageInvalidArgs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	ctx := snap.AppContext()
+	indexId := snap.Header.GetIndexID()
+	snapshotID := hex.EncodeToString(indexId[:])
+
+	_, err := parse_cmd_restore_image(ctx, []string{"-size", "4M", snapshotID})
+	require.Error(t, err)
+
+	_, err = parse_cmd_restore_image(ctx, []string{"-out", "disk.img", snapshotID})
+	require.Error(t, err)
+
+	_, err = parse_cmd_restore_image(ctx, []string{"-out", "disk.img", "-size", "4M", "-fs", "zfs", snapshotID})
+	require.Error(t, err)
+
+	_, err = parse_cmd_restore_image(ctx, []string{"-out", "disk.img", "-size", "lots", snapshotID})
+	require.Error(t, err)
+}
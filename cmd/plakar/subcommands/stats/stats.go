@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package stats
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("stats", parse_cmd_stats)
+}
+
+func parse_cmd_stats(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return nil, fmt.Errorf("too many arguments")
+	}
+
+	return &Stats{
+		RepositorySecret: ctx.GetSecret(),
+	}, nil
+}
+
+type Stats struct {
+	RepositorySecret []byte
+}
+
+func (cmd *Stats) Name() string {
+	return "stats"
+}
+
+// chunkStats describes how the chunks stored in a repository are shared by
+// its snapshots.
+type chunkStats struct {
+	Snapshots uint64
+
+	// Chunks and StoredSize count the chunks recorded in the state, and
+	// the size they occupy in packfiles.
+	Chunks     uint64
+	StoredSize uint64
+
+	// References and LogicalSize count the chunks of every file of every
+	// snapshot, as if nothing was deduplicated.
+	References  uint64
+	LogicalSize uint64
+
+	// UniqueSize is the size of the chunks referenced by at least one
+	// snapshot, counted once.
+	UniqueSize uint64
+
+	// Unreferenced chunks are not used by any snapshot, Missing ones are
+	// referenced but not in the state.
+	Unreferenced     uint64
+	UnreferencedSize uint64
+	Missing          uint64
+}
+
+// Ratio returns the deduplication ratio, the size of the data in the
+// snapshots over the size of the distinct chunks holding it.
+func (s *chunkStats) Ratio() float64 {
+	if s.UniqueSize == 0 {
+		return 0
+	}
+	return float64(s.LogicalSize) / float64(s.UniqueSize)
+}
+
+func computeStats(repo *repository.Repository) (*chunkStats, error) {
+	stats := &chunkStats{}
+
+	// a chunk may be recorded in several packfiles, only one is read
+	stored := make(map[objects.MAC]uint32)
+	for de, err := range repo.ListObjectsOfType(resources.RT_CHUNK) {
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := stored[de.Blob]; !exists {
+			stored[de.Blob] = de.Location.Length
+			stats.Chunks++
+			stats.StoredSize += uint64(de.Location.Length)
+		}
+	}
+
+	referenced := make(map[objects.MAC]struct{})
+	for snapshotID := range repo.ListSnapshots() {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load snapshot %x: %w", snapshotID[:4], err)
+		}
+
+		fs, err := snap.Filesystem()
+		if err != nil {
+			snap.Close()
+			return nil, err
+		}
+
+		for entry, err := range fs.Files("/") {
+			if err != nil {
+				snap.Close()
+				return nil, err
+			}
+			if !entry.HasObject() {
+				continue
+			}
+			for _, chunk := range entry.ResolvedObject.Chunks {
+				stats.References++
+				stats.LogicalSize += uint64(chunk.Length)
+
+				if _, exists := referenced[chunk.ContentMAC]; exists {
+					continue
+				}
+				referenced[chunk.ContentMAC] = struct{}{}
+				stats.UniqueSize += uint64(chunk.Length)
+				if _, exists := stored[chunk.ContentMAC]; !exists {
+					stats.Missing++
+				}
+			}
+		}
+		snap.Close()
+		stats.Snapshots++
+	}
+
+	for mac, length := range stored {
+		if _, exists := referenced[mac]; !exists {
+			stats.Unreferenced++
+			stats.UnreferencedSize += uint64(length)
+		}
+	}
+
+	return stats, nil
+}
+
+func (cmd *Stats) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	stats, err := computeStats(repo)
+	if err != nil {
+		return 1, err
+	}
+
+	size := func(n uint64) string {
+		return fmt.Sprintf("%s (%d bytes)", humanize.Bytes(n), n)
+	}
+
+	fmt.Fprintf(ctx.Stdout, "%-14s %d\n", "snapshots", stats.Snapshots)
+	fmt.Fprintf(ctx.Stdout, "%-14s %d\n", "chunks", stats.Chunks)
+	fmt.Fprintf(ctx.Stdout, "%-14s %d\n", "references", stats.References)
+	fmt.Fprintf(ctx.Stdout, "%-14s %s\n", "logical size", size(stats.LogicalSize))
+	fmt.Fprintf(ctx.Stdout, "%-14s %s\n", "unique size", size(stats.UniqueSize))
+	fmt.Fprintf(ctx.Stdout, "%-14s %s\n", "stored size", size(stats.StoredSize))
+	fmt.Fprintf(ctx.Stdout, "%-14s %.2f\n", "dedup ratio", stats.Ratio())
+	if stats.Unreferenced != 0 {
+		fmt.Fprintf(ctx.Stdout, "%-14s %d chunks, %s\n", "unreferenced", stats.Unreferenced, size(stats.UnreferencedSize))
+	}
+	if stats.Missing != 0 {
+		fmt.Fprintf(ctx.Stdout, "%-14s %d chunks\n", "missing", stats.Missing)
+		return 1, fmt.Errorf("%d chunks referenced by snapshots are missing", stats.Missing)
+	}
+
+	return 0, nil
+}
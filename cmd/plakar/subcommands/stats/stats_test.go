@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+	})
+}
+
+func TestParseCmdStats(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	subcommand, err := parse_cmd_stats(snap.AppContext(), []string{})
+	require.NoError(t, err)
+	require.Equal(t, "stats", subcommand.(*Stats).Name())
+
+	_, err = parse_cmd_stats(snap.AppContext(), []string{"foo"})
+	require.EqualError(t, err, "too many arguments")
+}
+
+func TestExecuteCmdStats(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	stats, err := computeStats(repo)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.Snapshots)
+	require.Equal(t, uint64(2), stats.References)
+	require.Equal(t, uint64(len("hello dummy")+len("hello foo")), stats.LogicalSize)
+	require.Equal(t, stats.LogicalSize, stats.UniqueSize)
+	require.Equal(t, 1.0, stats.Ratio())
+
+	// a second backup of the same files shares all of their chunks
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	imp, err := fs.NewFSImporter(map[string]string{"location": snap.Header.GetSource(0).Importer.Directory})
+	require.NoError(t, err)
+	require.NoError(t, snap2.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	snap2.Close()
+
+	stats, err = computeStats(repo)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), stats.Snapshots)
+	require.Equal(t, uint64(2), stats.Chunks)
+	require.Equal(t, uint64(4), stats.References)
+	require.Equal(t, 2*stats.UniqueSize, stats.LogicalSize)
+	require.Equal(t, 2.0, stats.Ratio())
+	require.Zero(t, stats.Unreferenced)
+	require.Zero(t, stats.Missing)
+
+	subcommand, err := parse_cmd_stats(ctx, []string{})
+	require.NoError(t, err)
+	bufOut.Reset()
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "snapshots      2\n")
+	require.Contains(t, bufOut.String(), "logical size   40 B (40 bytes)\n")
+	require.Contains(t, bufOut.String(), "unique size    20 B (20 bytes)\n")
+	require.Contains(t, bufOut.String(), "dedup ratio    2.00\n")
+}
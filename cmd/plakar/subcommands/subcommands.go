@@ -1,6 +1,7 @@
 package subcommands
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"sort"
 
@@ -44,44 +45,74 @@ type RPC interface {
 	Name() string
 }
 
+// RPCContext carries the global options of the client that change how a
+// command runs, for the agent to run it as the client would have.
+type RPCContext struct {
+	AccessStats      bool
+	OTelEndpoint     string
+	StrictSignatures bool
+	TrustedKeys      []ed25519.PublicKey
+}
+
+func NewRPCContext(ctx *appcontext.AppContext) RPCContext {
+	return RPCContext{
+		AccessStats:      ctx.AccessStats,
+		OTelEndpoint:     ctx.OTelEndpoint,
+		StrictSignatures: ctx.StrictSignatures,
+		TrustedKeys:      ctx.TrustedKeys,
+	}
+}
+
+// Apply sets the options on the context the command runs with, the
+// tracer for OTelEndpoint is left to the caller.
+func (rc RPCContext) Apply(ctx *appcontext.AppContext) {
+	ctx.AccessStats = rc.AccessStats
+	ctx.OTelEndpoint = rc.OTelEndpoint
+	ctx.StrictSignatures = rc.StrictSignatures
+	ctx.TrustedKeys = rc.TrustedKeys
+}
+
 type encodedRPC struct {
 	Name        string
 	Subcommand  RPC
 	StoreConfig map[string]string
+	Context     RPCContext
 }
 
 // Encode marshals the RPC into the msgpack encoder. It prefixes the RPC with
 // the Name() of the RPC. This is used to identify the RPC on decoding.
-func EncodeRPC(encoder *msgpack.Encoder, cmd RPC, storeConfig map[string]string) error {
+func EncodeRPC(encoder *msgpack.Encoder, cmd RPC, storeConfig map[string]string, rpcContext RPCContext) error {
 	return encoder.Encode(encodedRPC{
 		Name:        cmd.Name(),
 		Subcommand:  cmd,
 		StoreConfig: storeConfig,
+		Context:     rpcContext,
 	})
 }
 
 // Decode extracts the request encoded by Encode(). It returns the name of the
-// RPC and the raw bytes of the request. The raw bytes can be used by the caller
-// to unmarshal the bytes with the correct struct.
-func DecodeRPC(decoder *msgpack.Decoder) (string, map[string]string, []byte, error) {
+// RPC, the store configuration, the raw bytes of the request and the client
+// context. The raw bytes can be used by the caller to unmarshal the bytes with
+// the correct struct.
+func DecodeRPC(decoder *msgpack.Decoder) (string, map[string]string, []byte, RPCContext, error) {
 	var request map[string]interface{}
 	if err := decoder.Decode(&request); err != nil {
-		return "", nil, nil, fmt.Errorf("failed to decode client request: %w", err)
+		return "", nil, nil, RPCContext{}, fmt.Errorf("failed to decode client request: %w", err)
 	}
 
 	rawRequest, err := msgpack.Marshal(request)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("failed to marshal client request: %s", err)
+		return "", nil, nil, RPCContext{}, fmt.Errorf("failed to marshal client request: %s", err)
 	}
 
 	name, ok := request["Name"].(string)
 	if !ok {
-		return "", nil, nil, fmt.Errorf("request does not contain a Name string field")
+		return "", nil, nil, RPCContext{}, fmt.Errorf("request does not contain a Name string field")
 	}
 
 	storeConfig, ok := request["StoreConfig"].(map[string]interface{})
 	if !ok {
-		return "", nil, nil, fmt.Errorf("request does not contain a StoreConfig field")
+		return "", nil, nil, RPCContext{}, fmt.Errorf("request does not contain a StoreConfig field")
 	}
 
 	okStoreConfig := make(map[string]string)
@@ -89,9 +120,16 @@ func DecodeRPC(decoder *msgpack.Decoder) (string, map[string]string, []byte, err
 		if str, ok := v.(string); ok {
 			okStoreConfig[k] = str
 		} else {
-			return "", nil, nil, fmt.Errorf("StoreConfig field %s is not a string", k)
+			return "", nil, nil, RPCContext{}, fmt.Errorf("StoreConfig field %s is not a string", k)
 		}
 	}
 
-	return name, okStoreConfig, rawRequest, nil
+	var rpcContext struct {
+		Context RPCContext
+	}
+	if err := msgpack.Unmarshal(rawRequest, &rpcContext); err != nil {
+		return "", nil, nil, RPCContext{}, fmt.Errorf("failed to decode client context: %w", err)
+	}
+
+	return name, okStoreConfig, rawRequest, rpcContext.Context, nil
 }
@@ -2,6 +2,7 @@ package subcommands
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -99,16 +100,23 @@ func TestEncodeDecodeRPC(t *testing.T) {
 
 	bufIn := bytes.NewBuffer(nil)
 	encoder := msgpack.NewEncoder(bufIn)
-	err := EncodeRPC(encoder, rpc, map[string]string{"location": "s3://bucket", "access_key": "deadbeef"})
+	rpcContextIn := RPCContext{
+		AccessStats:      true,
+		OTelEndpoint:     "http://localhost:4318",
+		StrictSignatures: true,
+		TrustedKeys:      []ed25519.PublicKey{bytes.Repeat([]byte{0x42}, ed25519.PublicKeySize)},
+	}
+	err := EncodeRPC(encoder, rpc, map[string]string{"location": "s3://bucket", "access_key": "deadbeef"}, rpcContextIn)
 	require.NoError(t, err)
 
 	decoder := msgpack.NewDecoder(bufIn)
-	name, storeConfig, rawRequest, err := DecodeRPC(decoder)
+	name, storeConfig, rawRequest, rpcContextOut, err := DecodeRPC(decoder)
 	require.NoError(t, err)
 	require.Equal(t, "test", name)
 	require.Equal(t, storeConfig["location"], "s3://bucket")
 	require.Equal(t, storeConfig["access_key"], "deadbeef")
 	require.NotEmpty(t, rawRequest)
+	require.Equal(t, rpcContextIn, rpcContextOut)
 
 	var subcmdOut MockedSubcommand
 	err = msgpack.Unmarshal(rawRequest, &subcmdOut)
@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+// transferState copies the state a snapshot was committed with from src to
+// dst, without copying any blob, when dst already has everything the
+// snapshot depends on: the packfiles that state refers to, and the blobs
+// located by older states.  This happens when the packfiles were cloned or
+// copied by other means.  It returns false if the blobs have to be copied,
+// which is also the case when srcStates, the states of src, doesn't have
+// the state of the snapshot because maintenance merged it into another.
+func transferState(src, dst *repository.Repository, snapshotID objects.MAC, srcStates map[objects.MAC]struct{}) (bool, error) {
+	if _, exists := srcStates[snapshotID]; !exists {
+		return false, nil
+	}
+
+	version, rd, err := src.GetState(snapshotID)
+	if err != nil {
+		return false, err
+	}
+	serialized, err := io.ReadAll(rd)
+	if err != nil {
+		return false, err
+	}
+
+	scanCache, err := src.AppContext().GetCache().Scan(objects.RandomMAC())
+	if err != nil {
+		return false, err
+	}
+	defer scanCache.Close()
+
+	snapshotState, err := state.FromStream(version, bytes.NewReader(serialized), scanCache)
+	if err != nil {
+		return false, err
+	}
+
+	dstPackfiles, err := dst.GetPackfiles()
+	if err != nil {
+		return false, err
+	}
+	present := make(map[objects.MAC]struct{}, len(dstPackfiles))
+	for _, packfileMAC := range dstPackfiles {
+		present[packfileMAC] = struct{}{}
+	}
+	for packfileMAC := range snapshotState.ListPackfiles() {
+		if _, exists := present[packfileMAC]; !exists {
+			return false, nil
+		}
+	}
+
+	snap, err := snapshot.Load(src, snapshotID)
+	if err != nil {
+		return false, err
+	}
+	defer snap.Close()
+
+	blobs, err := snap.ListBlobs()
+	if err != nil {
+		return false, err
+	}
+	for blob, err := range blobs {
+		if err != nil {
+			return false, err
+		}
+		if !snapshotState.BlobExists(blob.Type, blob.MAC) && !dst.BlobExists(blob.Type, blob.MAC) {
+			return false, nil
+		}
+	}
+
+	if err := dst.PutState(snapshotID, bytes.NewReader(serialized)); err != nil {
+		return false, err
+	}
+
+	// the blobs of the state are known to dst right away, so that the
+	// snapshots depending on them can be transferred the same way
+	return true, dst.MergeState(version, snapshotID, bytes.NewReader(serialized))
+}
+
+// listStates returns the set of the states of repo.
+func listStates(repo *repository.Repository) (map[objects.MAC]struct{}, error) {
+	states, err := repo.GetStates()
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[objects.MAC]struct{}, len(states))
+	for _, stateID := range states {
+		set[stateID] = struct{}{}
+	}
+	return set, nil
+}
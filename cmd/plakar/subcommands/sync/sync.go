@@ -29,6 +29,8 @@ import (
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/PlakarKorp/plakar/tracing"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
@@ -36,14 +38,29 @@ func init() {
 }
 
 func parse_cmd_sync(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_concurrency uint64
+	var opt_ratelimit string
+
 	flags := flag.NewFlagSet("sync", flag.ExitOnError)
 	flags.Usage = func() {
-		fmt.Fprintf(flags.Output(), "Usage: %s [SNAPSHOT] to REPOSITORY\n", flags.Name())
-		fmt.Fprintf(flags.Output(), "       %s [SNAPSHOT] from REPOSITORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] [SNAPSHOT] to REPOSITORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "       %s [OPTIONS] [SNAPSHOT] from REPOSITORY\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
 		flags.PrintDefaults()
 	}
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of parallel tasks")
+	flags.StringVar(&opt_ratelimit, "rate-limit", "", "maximum number of bytes per second written to the destination")
 	flags.Parse(args)
 
+	var rateLimit uint64
+	if opt_ratelimit != "" {
+		var err error
+		rateLimit, err = humanize.ParseBytes(opt_ratelimit)
+		if err != nil || rateLimit == 0 {
+			return nil, fmt.Errorf("invalid rate limit: %s", opt_ratelimit)
+		}
+	}
+
 	syncSnapshotID := ""
 	direction := ""
 	peerRepositoryPath := ""
@@ -126,6 +143,8 @@ func parse_cmd_sync(ctx *appcontext.AppContext, args []string) (subcommands.Subc
 		PeerRepositorySecret:   peerSecret,
 		Direction:              direction,
 		SnapshotPrefix:         syncSnapshotID,
+		Concurrency:            opt_concurrency,
+		RateLimit:              rateLimit,
 	}, nil
 }
 
@@ -138,6 +157,8 @@ type Sync struct {
 	Direction string
 
 	SnapshotPrefix string
+	Concurrency    uint64
+	RateLimit      uint64
 }
 
 func (cmd *Sync) Name() string {
@@ -178,6 +199,19 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 		return 1, fmt.Errorf("could not synchronize %s: invalid direction, must be to, from or with", peerStore.Location())
 	}
 
+	// both repositories are written to when synchronizing with a peer
+	dstRepository.LimitWrites(cmd.RateLimit)
+	if cmd.Direction == "with" {
+		srcRepository.LimitWrites(cmd.RateLimit)
+	}
+
+	span := ctx.GetTracer().Start("sync")
+	span.SetString("direction", cmd.Direction)
+	span.SetString("source", srcRepository.Location())
+	span.SetString("destination", dstRepository.Location())
+	defer span.End()
+
+	diffSpan := span.Start("diff")
 	srcSnapshots, err := srcRepository.GetSnapshots()
 	if err != nil {
 		return 1, fmt.Errorf("could not get list of snapshots from source repository %s: %s", srcRepository.Location(), err)
@@ -213,9 +247,18 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 			srcSyncList = append(srcSyncList, snapshotID)
 		}
 	}
+	diffSpan.SetInt("snapshots.source", int64(len(srcSnapshots)))
+	diffSpan.SetInt("snapshots.destination", int64(len(dstSnapshots)))
+	diffSpan.SetInt("snapshots.missing", int64(len(srcSyncList)))
+	diffSpan.End()
+
+	srcStates, err := listStates(srcRepository)
+	if err != nil {
+		return 1, fmt.Errorf("could not list states in source repository %s: %s", srcRepository.Location(), err)
+	}
 
 	for _, snapshotID := range srcSyncList {
-		err := synchronize(srcRepository, dstRepository, snapshotID)
+		err := synchronize(srcRepository, dstRepository, snapshotID, srcStates, cmd.Concurrency, span)
 		if err != nil {
 			ctx.GetLogger().Error("failed to synchronize snapshot %x from source repository %s: %s",
 				snapshotID[:4], srcRepository.Location(), err)
@@ -235,8 +278,13 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 			}
 		}
 
+		dstStates, err := listStates(dstRepository)
+		if err != nil {
+			return 1, fmt.Errorf("could not list states in peer repository %s: %s", dstRepository.Location(), err)
+		}
+
 		for _, snapshotID := range dstSyncList {
-			err := synchronize(dstRepository, srcRepository, snapshotID)
+			err := synchronize(dstRepository, srcRepository, snapshotID, dstStates, cmd.Concurrency, span)
 			if err != nil {
 				ctx.GetLogger().Error("failed to synchronize snapshot %x from peer repository %s: %s",
 					snapshotID[:4], dstRepository.Location(), err)
@@ -264,7 +312,22 @@ func (cmd *Sync) Execute(ctx *appcontext.AppContext, repo *repository.Repository
 	return 0, nil
 }
 
-func synchronize(srcRepository, dstRepository *repository.Repository, snapshotID objects.MAC) error {
+func synchronize(srcRepository, dstRepository *repository.Repository, snapshotID objects.MAC, srcStates map[objects.MAC]struct{}, concurrency uint64, parent *tracing.Span) (err error) {
+	span := parent.Start("snapshot")
+	span.SetString("snapshot.id", fmt.Sprintf("%x", snapshotID))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	if transferred, err := transferState(srcRepository, dstRepository, snapshotID, srcStates); err != nil {
+		return err
+	} else if transferred {
+		span.SetString("snapshot.transfer", "state")
+		return nil
+	}
+	span.SetString("snapshot.transfer", "blobs")
+
 	srcSnapshot, err := snapshot.Load(srcRepository, snapshotID)
 	if err != nil {
 		return err
@@ -280,7 +343,11 @@ func synchronize(srcRepository, dstRepository *repository.Repository, snapshotID
 	// overwrite the header, we want to keep the original snapshot info
 	dstSnapshot.Header = srcSnapshot.Header
 
-	if err := srcSnapshot.Synchronize(dstSnapshot); err != nil {
+	opts := &snapshot.SynchronizeOptions{
+		MaxConcurrency: concurrency,
+		Span:           span,
+	}
+	if err := srcSnapshot.Synchronize(dstSnapshot, opts); err != nil {
 		return err
 	}
 
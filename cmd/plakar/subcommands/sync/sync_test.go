@@ -0,0 +1,272 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/server/httpd"
+	"github.com/PlakarKorp/plakar/snapshot"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	_ "github.com/PlakarKorp/plakar/storage/backends/http"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+	})
+}
+
+func backup(t *testing.T, repo *repository.Repository, name string, content string) objects.MAC {
+	tmpBackupDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, name+".txt"), []byte(content), 0644))
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: name, MaxConcurrency: 1}))
+	require.NoError(t, repo.RebuildState())
+	return snap.Header.Identifier
+}
+
+// copyRepository creates a copy of repo, with the same configuration and
+// its packfiles and states, and opens it with its own cache.
+func copyRepository(t *testing.T, repo *repository.Repository, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *repository.Repository {
+	srcStore, wrappedConfig, err := storage.Open(map[string]string{"location": repo.Location()})
+	require.NoError(t, err)
+	defer srcStore.Close()
+
+	location := filepath.Join(t.TempDir(), "copy")
+	dstStore, err := storage.Create(map[string]string{"location": location}, wrappedConfig)
+	require.NoError(t, err)
+
+	packfiles, err := srcStore.GetPackfiles()
+	require.NoError(t, err)
+	for _, packfileMAC := range packfiles {
+		copyPackfile(t, srcStore, dstStore, packfileMAC)
+	}
+
+	states, err := srcStore.GetStates()
+	require.NoError(t, err)
+	for _, stateMAC := range states {
+		rd, err := srcStore.GetState(stateMAC)
+		require.NoError(t, err)
+		require.NoError(t, dstStore.PutState(stateMAC, rd))
+	}
+	dstStore.Close()
+
+	return openRepository(t, map[string]string{"location": location}, bufOut, bufErr)
+}
+
+// openRepository opens the repository at storeConfig with its own cache.
+func openRepository(t *testing.T, storeConfig map[string]string, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *repository.Repository {
+	store, serializedConfig, err := storage.Open(storeConfig)
+	require.NoError(t, err)
+	ctx := appcontext.NewAppContext()
+	ctx.SetCache(caching.NewManager(t.TempDir()))
+	ctx.SetLogger(logging.NewLogger(bufOut, bufErr))
+	repo, err := repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func copyPackfile(t *testing.T, src, dst storage.Store, packfileMAC objects.MAC) {
+	rd, err := src.GetPackfile(packfileMAC)
+	require.NoError(t, err)
+	require.NoError(t, dst.PutPackfile(packfileMAC, rd))
+}
+
+func readState(t *testing.T, repo *repository.Repository, stateID objects.MAC) []byte {
+	_, rd, err := repo.GetState(stateID)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	return data
+}
+
+// statesOf returns the set of the states of repo.
+func statesOf(t *testing.T, repo *repository.Repository) map[objects.MAC]struct{} {
+	states, err := listStates(repo)
+	require.NoError(t, err)
+	return states
+}
+
+func TestSynchronizeTransferState(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	src := snap.Repository()
+	src.AppContext().MaxConcurrency = 1
+	dst := copyRepository(t, src, bufOut, bufErr)
+
+	// the packfiles of the new snapshot reach the destination by other
+	// means, only its state is missing
+	snapshotID := backup(t, src, "copied", "hello copied")
+
+	present, err := dst.GetPackfiles()
+	require.NoError(t, err)
+	srcPackfiles, err := src.GetPackfiles()
+	require.NoError(t, err)
+	for _, packfileMAC := range srcPackfiles {
+		if !slices.Contains(present, packfileMAC) {
+			copyPackfile(t, src.Store(), dst.Store(), packfileMAC)
+		}
+	}
+	dstPackfiles, err := dst.GetPackfiles()
+	require.NoError(t, err)
+
+	require.NoError(t, synchronize(src, dst, snapshotID, statesOf(t, src), 1, nil))
+
+	after, err := dst.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, dstPackfiles, after)
+	require.Equal(t, readState(t, src, snapshotID), readState(t, dst, snapshotID))
+
+	synced, err := snapshot.Load(dst, snapshotID)
+	require.NoError(t, err)
+	defer synced.Close()
+	ok, err := synced.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// The states transferred are known to the destination right away, so that
+// a snapshot depending on the blobs of another one synchronized in the same
+// run is transferred the same way.
+func TestSynchronizeTransferStateChain(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	src := snap.Repository()
+	src.AppContext().MaxConcurrency = 1
+	dst := copyRepository(t, src, bufOut, bufErr)
+
+	// the second snapshot has the content of the first
+	firstID := backup(t, src, "first", "hello chain")
+	secondID := backup(t, src, "second", "hello chain")
+
+	present, err := dst.GetPackfiles()
+	require.NoError(t, err)
+	srcPackfiles, err := src.GetPackfiles()
+	require.NoError(t, err)
+	for _, packfileMAC := range srcPackfiles {
+		if !slices.Contains(present, packfileMAC) {
+			copyPackfile(t, src.Store(), dst.Store(), packfileMAC)
+		}
+	}
+	dstPackfiles, err := dst.GetPackfiles()
+	require.NoError(t, err)
+
+	srcStates := statesOf(t, src)
+	for _, snapshotID := range []objects.MAC{firstID, secondID} {
+		require.NoError(t, synchronize(src, dst, snapshotID, srcStates, 1, nil))
+		require.Equal(t, readState(t, src, snapshotID), readState(t, dst, snapshotID))
+	}
+
+	after, err := dst.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, dstPackfiles, after)
+
+	synced, err := snapshot.Load(dst, secondID)
+	require.NoError(t, err)
+	defer synced.Close()
+	ok, err := synced.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestSynchronizeCopyBlobs(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	src := snap.Repository()
+	src.AppContext().MaxConcurrency = 1
+	dst := copyRepository(t, src, bufOut, bufErr)
+
+	// nothing of the new snapshot is in the destination
+	snapshotID := backup(t, src, "missing", "hello missing")
+
+	dstPackfiles, err := dst.GetPackfiles()
+	require.NoError(t, err)
+
+	require.NoError(t, synchronize(src, dst, snapshotID, statesOf(t, src), 1, nil))
+
+	after, err := dst.GetPackfiles()
+	require.NoError(t, err)
+	require.Greater(t, len(after), len(dstPackfiles))
+
+	synced, err := snapshot.Load(dst, snapshotID)
+	require.NoError(t, err)
+	defer synced.Close()
+	ok, err := synced.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// The peer doesn't need to be reachable on the local filesystem, any store
+// works, such as a repository served by plakar server.
+func TestSynchronizeToServer(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	src := snap.Repository()
+	src.AppContext().MaxConcurrency = 1
+
+	srcStore, wrappedConfig, err := storage.Open(map[string]string{"location": src.Location()})
+	require.NoError(t, err)
+	srcStore.Close()
+	location := filepath.Join(t.TempDir(), "served")
+	servedStore, err := storage.Create(map[string]string{"location": location}, wrappedConfig)
+	require.NoError(t, err)
+	servedStore.Close()
+
+	served := openRepository(t, map[string]string{"location": location}, bufOut, bufErr)
+	server := httptest.NewServer(httpd.Handler(served, false))
+	defer server.Close()
+
+	peer := openRepository(t, map[string]string{"location": server.URL}, bufOut, bufErr)
+	require.NoError(t, synchronize(src, peer, snap.Header.Identifier, statesOf(t, src), 1, nil))
+
+	served = openRepository(t, map[string]string{"location": location}, bufOut, bufErr)
+	synced, err := snapshot.Load(served, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer synced.Close()
+	ok, err := synced.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tag
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/google/uuid"
+)
+
+func init() {
+	subcommands.Register("tag", parse_cmd_tag)
+}
+
+func parse_cmd_tag(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s add|rm SNAPSHOT TAG...\n", flags.Name())
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 3 {
+		flags.Usage()
+		return nil, fmt.Errorf("not enough arguments")
+	}
+
+	action := flags.Arg(0)
+	if action != "add" && action != "rm" {
+		return nil, fmt.Errorf("unknown action %s", action)
+	}
+
+	for _, tag := range flags.Args()[2:] {
+		if tag == "" {
+			return nil, fmt.Errorf("invalid empty tag")
+		}
+	}
+
+	return &Tag{
+		RepositorySecret: ctx.GetSecret(),
+		Action:           action,
+		Snapshot:         flags.Arg(1),
+		Tags:             flags.Args()[2:],
+	}, nil
+}
+
+type Tag struct {
+	RepositorySecret []byte
+
+	Action   string
+	Snapshot string
+	Tags     []string
+}
+
+func (cmd *Tag) Name() string {
+	return "tag"
+}
+
+func (cmd *Tag) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snapshotID, err := utils.LocateSnapshotByPrefix(repo, cmd.Snapshot)
+	if err != nil {
+		return 1, err
+	}
+
+	newID, err := retag(ctx, repo, snapshotID, cmd.Action, cmd.Tags)
+	if err != nil {
+		return 1, err
+	}
+
+	if newID == snapshotID {
+		ctx.GetLogger().Info("%s: %x unchanged", cmd.Name(), snapshotID[:4])
+	} else {
+		ctx.GetLogger().Info("%s: %x is now %x", cmd.Name(), snapshotID[:4], newID[:4])
+	}
+	return 0, nil
+}
+
+// retag rewrites the header of a snapshot with its tags updated.  Headers
+// are immutable blobs, so the updated header is committed as a new snapshot
+// sharing the content of the original one, which is then removed.
+func retag(ctx *appcontext.AppContext, repo *repository.Repository, snapshotID objects.MAC, action string, tags []string) (objects.MAC, error) {
+	// the original snapshot is removed once retagged, fail before leaving
+	// a copy behind.
+	if err := repo.CheckDelete(); err != nil {
+		return snapshotID, err
+	}
+
+	src, err := snapshot.Load(repo, snapshotID)
+	if err != nil {
+		return snapshotID, err
+	}
+	defer src.Close()
+
+	// the new header is signed with our key, refuse to vouch for the
+	// snapshot of someone else.
+	identity := src.Header.Identity.Identifier
+	if identity != uuid.Nil && identity != ctx.Identity {
+		return snapshotID, fmt.Errorf("snapshot %x is signed by identity %s", snapshotID[:4], identity)
+	}
+
+	newTags := slices.Clone(src.Header.Tags)
+	for _, tag := range tags {
+		switch action {
+		case "add":
+			if !slices.Contains(newTags, tag) {
+				newTags = append(newTags, tag)
+			}
+		case "rm":
+			newTags = slices.DeleteFunc(newTags, func(t string) bool { return t == tag })
+		}
+	}
+	if slices.Equal(newTags, src.Header.Tags) {
+		return snapshotID, nil
+	}
+
+	dst, err := snapshot.New(repo)
+	if err != nil {
+		return snapshotID, err
+	}
+	defer dst.Close()
+
+	hdr := *src.Header
+	hdr.Identifier = dst.Header.Identifier
+	hdr.Tags = newTags
+	dst.Header = &hdr
+
+	if err := dst.Commit(nil); err != nil {
+		return snapshotID, err
+	}
+
+	if err := repo.DeleteSnapshot(snapshotID); err != nil {
+		return dst.Header.Identifier, fmt.Errorf("failed to remove %x: %w", snapshotID[:4], err)
+	}
+	return dst.Header.Identifier, nil
+}
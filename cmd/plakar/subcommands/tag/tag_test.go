@@ -0,0 +1,116 @@
+package tag
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+}
+
+func locateByTag(t *testing.T, repo *repository.Repository, tag string) []objects.MAC {
+	locateOptions := utils.NewDefaultLocateOptions()
+	locateOptions.MaxConcurrency = 1
+	locateOptions.Tag = tag
+
+	snapshotIDs, err := utils.LocateSnapshotIDs(repo, locateOptions)
+	require.NoError(t, err)
+	return snapshotIDs
+}
+
+// reopen returns a new handle on the repository, removals are only seen
+// once the states are loaded again.
+func reopen(t *testing.T, ctx *appcontext.AppContext, repo *repository.Repository) *repository.Repository {
+	store, serializedConfig, err := storage.Open(map[string]string{"location": repo.Location()})
+	require.NoError(t, err)
+	repo, err = repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func runTag(t *testing.T, ctx *appcontext.AppContext, repo *repository.Repository, args ...string) {
+	subcommand, err := parse_cmd_tag(ctx, args)
+	require.NoError(t, err)
+	require.Equal(t, "tag", subcommand.(*Tag).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+}
+
+func TestExecuteCmdTag(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	require.Empty(t, locateByTag(t, repo, "daily"))
+
+	runTag(t, ctx, repo, "add", fmt.Sprintf("%x", snap.Header.GetIndexShortID()), "daily", "prod")
+
+	repo = reopen(t, ctx, repo)
+	tagged := locateByTag(t, repo, "daily")
+	require.Len(t, tagged, 1)
+	require.NotEqual(t, snap.Header.Identifier, tagged[0])
+	require.Equal(t, tagged, locateByTag(t, repo, "prod"))
+
+	// the original snapshot is gone, the tagged one has the same content
+	require.Equal(t, tagged, slices.Collect(repo.ListSnapshots()))
+	retagged, err := snapshot.Load(repo, tagged[0])
+	require.NoError(t, err)
+	defer retagged.Close()
+	require.Equal(t, []string{"daily", "prod"}, retagged.Header.Tags)
+	require.Equal(t, snap.Header.GetSource(0).VFS, retagged.Header.GetSource(0).VFS)
+	require.Equal(t, snap.Header.Timestamp.UTC(), retagged.Header.Timestamp.UTC())
+
+	fs, err := retagged.Filesystem()
+	require.NoError(t, err)
+	_, err = fs.GetEntry(snap.Header.GetSource(0).Importer.Directory + "/subdir/dummy.txt")
+	require.NoError(t, err)
+
+	runTag(t, ctx, repo, "rm", fmt.Sprintf("%x", tagged[0][:4]), "daily")
+
+	repo = reopen(t, ctx, repo)
+	require.Empty(t, locateByTag(t, repo, "daily"))
+	remaining := locateByTag(t, repo, "prod")
+	require.Len(t, remaining, 1)
+	require.NotEqual(t, tagged[0], remaining[0])
+}
+
+func TestParseCmdTagErrors(t *testing.T) {
+	ctx := appcontext.NewAppContext()
+
+	_, err := parse_cmd_tag(ctx, []string{"add", "abcd"})
+	require.Error(t, err)
+
+	_, err = parse_cmd_tag(ctx, []string{"set", "abcd", "daily"})
+	require.EqualError(t, err, "unknown action set")
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package verify
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("verify", parse_cmd_verify)
+}
+
+func parse_cmd_verify(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_concurrency uint64
+
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] [SNAPSHOT]...\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.MaxConcurrency), "maximum number of blobs verified in parallel")
+	flags.Parse(args)
+
+	if opt_concurrency == 0 {
+		return nil, fmt.Errorf("invalid concurrency: 0")
+	}
+
+	return &Verify{
+		RepositorySecret: ctx.GetSecret(),
+		Concurrency:      opt_concurrency,
+		Snapshots:        flags.Args(),
+	}, nil
+}
+
+type Verify struct {
+	RepositorySecret []byte
+
+	Concurrency uint64
+	Snapshots   []string
+}
+
+type verifyJob struct {
+	snapshot string
+	blob     snapshot.BlobRef
+}
+
+func (cmd *Verify) Name() string {
+	return "verify"
+}
+
+func (cmd *Verify) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	var snapshotIDs []objects.MAC
+	if len(cmd.Snapshots) == 0 {
+		locateOptions := utils.NewDefaultLocateOptions()
+		locateOptions.MaxConcurrency = ctx.MaxConcurrency
+
+		var err error
+		snapshotIDs, err = utils.LocateSnapshotIDs(repo, locateOptions)
+		if err != nil {
+			return 1, err
+		}
+	} else {
+		for _, prefix := range cmd.Snapshots {
+			snapshotID, err := utils.LocateSnapshotByPrefix(repo, prefix)
+			if err != nil {
+				return 1, err
+			}
+			snapshotIDs = append(snapshotIDs, snapshotID)
+		}
+	}
+
+	var corrupted atomic.Uint64
+	var wg sync.WaitGroup
+
+	// blobs are fetched and hashed by the workers, in no particular order
+	jobs := make(chan verifyJob, cmd.Concurrency)
+	for i := uint64(0); i < cmd.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := snapshot.VerifyBlob(repo, job.blob); err != nil {
+					ctx.GetLogger().Warn("%s: %s: %s %x: %s", cmd.Name(), job.snapshot, job.blob.Type, job.blob.MAC, err)
+					corrupted.Add(1)
+				}
+			}
+		}()
+	}
+
+	// blobs are shared between snapshots, each one is only verified once
+	verified := make(map[snapshot.BlobRef]struct{})
+	err := cmd.listBlobs(repo, snapshotIDs, func(snapshotID string, blob snapshot.BlobRef, err error) {
+		if err != nil {
+			ctx.GetLogger().Warn("%s: %s: %s", cmd.Name(), snapshotID, err)
+			corrupted.Add(1)
+			return
+		}
+		if _, exists := verified[blob]; exists {
+			return
+		}
+		verified[blob] = struct{}{}
+		jobs <- verifyJob{snapshot: snapshotID, blob: blob}
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return 1, err
+	}
+
+	ctx.GetLogger().Info("%s: %d blobs of %d snapshots verified, %d corrupted", cmd.Name(), len(verified), len(snapshotIDs), corrupted.Load())
+
+	if corrupted.Load() != 0 {
+		return 1, fmt.Errorf("verify failed: %d corrupted blobs", corrupted.Load())
+	}
+	return 0, nil
+}
+
+// listBlobs calls fn with each blob the snapshots depend on, along with the
+// short identifier of the snapshot being walked.
+func (cmd *Verify) listBlobs(repo *repository.Repository, snapshotIDs []objects.MAC, fn func(string, snapshot.BlobRef, error)) error {
+	for _, snapshotID := range snapshotIDs {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			return err
+		}
+
+		blobs, err := snap.ListBlobs()
+		if err != nil {
+			snap.Close()
+			return err
+		}
+
+		shortID := fmt.Sprintf("%x", snap.Header.GetIndexShortID())
+		for blob, err := range blobs {
+			fn(shortID, blob, err)
+		}
+		snap.Close()
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	os.Setenv("TZ", "UTC")
+}
+
+func generateSnapshot(t *testing.T, bufOut *bytes.Buffer, bufErr *bytes.Buffer) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/corrupted.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/intact.txt", 0644, "world"),
+	})
+}
+
+// corruptChunk makes the chunk of corrupted.txt resolve to the content of
+// intact.txt, the blob decodes fine but doesn't match its MAC.
+func corruptChunk(t *testing.T, snap *snapshot.Snapshot) objects.MAC {
+	repo := snap.Repository()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	root := snap.Header.GetSource(0).Importer.Directory
+	chunkOf := func(name string) objects.MAC {
+		entry, err := fs.GetEntry(root + "/subdir/" + name)
+		require.NoError(t, err)
+		require.Len(t, entry.ResolvedObject.Chunks, 1)
+		return entry.ResolvedObject.Chunks[0].ContentMAC
+	}
+
+	corrupted, intact := chunkOf("corrupted.txt"), chunkOf("intact.txt")
+	packfileMAC, exists, err := repo.GetPackfileForBlob(resources.RT_CHUNK, corrupted)
+	require.NoError(t, err)
+	require.True(t, exists)
+	location, exists, err := repo.GetLocationForBlob(resources.RT_CHUNK, intact)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, repo.RemoveBlob(resources.RT_CHUNK, corrupted, packfileMAC))
+	require.NoError(t, repo.PutStateDelta(&state.DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     corrupted,
+		Location: location,
+	}))
+
+	return corrupted
+}
+
+func TestExecuteCmdVerify(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	subcommand, err := parse_cmd_verify(ctx, []string{})
+	require.NoError(t, err)
+	require.Equal(t, "verify", subcommand.(*Verify).Name())
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, bufOut.String(), "info: verify: ")
+	require.Contains(t, bufOut.String(), "blobs of 1 snapshots verified, 0 corrupted")
+
+	corrupted := corruptChunk(t, snap)
+
+	bufOut.Reset()
+	subcommand, err = parse_cmd_verify(ctx, []string{fmt.Sprintf("%x", snap.Header.GetIndexShortID())})
+	require.NoError(t, err)
+
+	status, err = subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), fmt.Sprintf("verify: %x: %s %x: %s", snap.Header.GetIndexShortID(), resources.RT_CHUNK, corrupted, snapshot.ErrBlobMACMismatch))
+	require.Contains(t, bufOut.String(), "blobs of 1 snapshots verified, 1 corrupted")
+}
+
+func TestExecuteCmdVerifyConcurrent(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := generateSnapshot(t, bufOut, bufErr)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	// override the homedir to avoid having test overwriting existing home configuration
+	ctx.HomeDir = repo.Location()
+
+	corrupted := corruptChunk(t, snap)
+
+	subcommand, err := parse_cmd_verify(ctx, []string{"-concurrency", "8"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), subcommand.(*Verify).Concurrency)
+
+	status, err := subcommand.Execute(ctx, repo)
+	require.Error(t, err)
+	require.Equal(t, 1, status)
+	require.Contains(t, bufErr.String(), fmt.Sprintf("%s %x: %s", resources.RT_CHUNK, corrupted, snapshot.ErrBlobMACMismatch))
+	require.Contains(t, bufOut.String(), "blobs of 1 snapshots verified, 1 corrupted")
+}
+
+func BenchmarkVerify(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	files := []ptesting.MockFile{ptesting.NewMockDir("data")}
+	for i := 0; i < 64; i++ {
+		content := make([]byte, 256<<10)
+		rng.Read(content)
+		files = append(files, ptesting.NewMockFile(fmt.Sprintf("data/%d.bin", i), 0644, string(content)))
+	}
+
+	snap := ptesting.GenerateSnapshot(b, bytes.NewBuffer(nil), bytes.NewBuffer(nil), nil, files)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+
+	for _, concurrency := range []uint64{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			cmd := &Verify{Concurrency: concurrency}
+			for i := 0; i < b.N; i++ {
+				if _, err := cmd.Execute(ctx, repo); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package xattr
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+func init() {
+	subcommands.Register("xattr", parse_cmd_xattr)
+}
+
+func parse_cmd_xattr(ctx *appcontext.AppContext, args []string) (subcommands.Subcommand, error) {
+	var opt_get string
+
+	flags := flag.NewFlagSet("xattr", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [OPTIONS] SNAPSHOT:PATH\n", flags.Name())
+		fmt.Fprintf(flags.Output(), "\nOPTIONS:\n")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&opt_get, "get", "", "write the value of the named attribute to stdout")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		ctx.GetLogger().Error("%s: exactly one parameter is required", flags.Name())
+		return nil, fmt.Errorf("exactly one parameter is required")
+	}
+
+	return &Xattr{
+		RepositorySecret: ctx.GetSecret(),
+		Get:              opt_get,
+		Path:             flags.Arg(0),
+	}, nil
+}
+
+type Xattr struct {
+	RepositorySecret []byte
+
+	Get  string
+	Path string
+}
+
+func (cmd *Xattr) Name() string {
+	return "xattr"
+}
+
+func attributeType(typ objects.Attribute) string {
+	switch typ {
+	case objects.AttributeExtended:
+		return "xattr"
+	case objects.AttributeADS:
+		return "ads"
+	default:
+		return "unknown"
+	}
+}
+
+func (cmd *Xattr) Execute(ctx *appcontext.AppContext, repo *repository.Repository) (int, error) {
+	snap, pathname, err := utils.OpenSnapshotByPath(repo, cmd.Path)
+	if err != nil {
+		return 1, fmt.Errorf("xattr: %s: %w", cmd.Path, err)
+	}
+	defer snap.Close()
+
+	fsc, err := snap.Filesystem()
+	if err != nil {
+		return 1, fmt.Errorf("xattr: %s: %w", cmd.Path, err)
+	}
+
+	entry, err := fsc.GetEntry(pathname)
+	if err != nil {
+		return 1, fmt.Errorf("xattr: %s: no such file", pathname)
+	}
+
+	if cmd.Get != "" {
+		xattr, err := entry.LookupXattr(fsc, cmd.Get)
+		if errors.Is(err, fs.ErrNotExist) {
+			return 1, fmt.Errorf("xattr: %s: no attribute %s", pathname, cmd.Get)
+		} else if err != nil {
+			return 1, fmt.Errorf("xattr: %s: %s: %w", pathname, cmd.Get, err)
+		}
+
+		rd := vfs.NewObjectReader(repo, xattr.ResolvedObject, xattr.Size)
+		if _, err := io.Copy(ctx.Stdout, rd); err != nil {
+			return 1, fmt.Errorf("xattr: %s: %s: %w", pathname, cmd.Get, err)
+		}
+		return 0, nil
+	}
+
+	for _, name := range entry.ExtendedAttributes {
+		xattr, err := entry.LookupXattr(fsc, name)
+		if err != nil {
+			return 1, fmt.Errorf("xattr: %s: %s: %w", pathname, name, err)
+		}
+		fmt.Fprintf(ctx.Stdout, "%-5s %8d %s\n", attributeType(xattr.Type), xattr.Size, name)
+	}
+	return 0, nil
+}
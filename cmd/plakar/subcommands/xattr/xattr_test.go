@@ -0,0 +1,63 @@
+package xattr
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCmdXattr(t *testing.T) {
+	file := ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy")
+	file.Xattrs = map[string][]byte{
+		"user.origin":  []byte("plakar"),
+		"user.comment": []byte("a longer comment"),
+	}
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		file,
+	})
+	defer snap.Close()
+
+	var buf bytes.Buffer
+	ctx := snap.AppContext()
+	ctx.MaxConcurrency = 1
+	ctx.Stdout = &buf
+	repo := snap.Repository()
+
+	target := hex.EncodeToString(snap.Header.GetIndexShortID()) + ":" +
+		snap.Header.GetSource(0).Importer.Directory + "/subdir/dummy.txt"
+
+	xattr := func(args ...string) (string, error) {
+		buf.Reset()
+		subcommand, err := parse_cmd_xattr(ctx, args)
+		require.NoError(t, err)
+		require.Equal(t, "xattr", subcommand.(*Xattr).Name())
+		_, err = subcommand.Execute(ctx, repo)
+		return buf.String(), err
+	}
+
+	output, err := xattr(target)
+	require.NoError(t, err)
+	lines := [][]string{}
+	for _, line := range strings.Split(strings.Trim(output, "\n"), "\n") {
+		lines = append(lines, strings.Fields(line))
+	}
+	require.ElementsMatch(t, [][]string{
+		{"xattr", "16", "user.comment"},
+		{"xattr", "6", "user.origin"},
+	}, lines)
+
+	output, err = xattr("-get", "user.origin", target)
+	require.NoError(t, err)
+	require.Equal(t, "plakar", output)
+
+	_, err = xattr("-get", "user.missing", target)
+	require.ErrorContains(t, err, "no attribute user.missing")
+
+	_, err = parse_cmd_xattr(ctx, []string{})
+	require.Error(t, err)
+}
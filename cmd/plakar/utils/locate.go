@@ -28,6 +28,7 @@ import (
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
 
 type locateSortOrder int
@@ -251,3 +252,85 @@ func OpenSnapshotByPath(repo *repository.Repository, snapshotPath string) (*snap
 	}
 	return snap, path.Clean(snapRoot), err
 }
+
+// OpenSnapshotByPattern is like OpenSnapshotByPath but the path may be a
+// glob pattern, as understood by path.Match, expanded through the VFS of
+// the snapshot.  The matching pathnames are returned in sorted order, a path
+// without any pattern is returned as is.
+func OpenSnapshotByPattern(repo *repository.Repository, snapshotPath string) (*snapshot.Snapshot, []string, error) {
+	snap, pattern, err := OpenSnapshotByPath(repo, snapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !hasGlobMeta(pattern) {
+		return snap, []string{pattern}, nil
+	}
+
+	// a literal pathname such as file[1].txt is not expanded
+	fs, err := snap.Filesystem()
+	if err != nil {
+		snap.Close()
+		return nil, nil, err
+	}
+
+	pathnames, err := globVFS(fs, pattern)
+	if err != nil {
+		snap.Close()
+		return nil, nil, err
+	}
+	if len(pathnames) == 0 {
+		snap.Close()
+		return nil, nil, fmt.Errorf("%s: no matching file", pattern)
+	}
+	return snap, pathnames, nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// globVFS expands pattern one component at a time, so that only the
+// directories leading to the matches are listed.  A pathname that exists
+// is its own match, even if it contains glob metacharacters.
+func globVFS(fs *vfs.Filesystem, pattern string) ([]string, error) {
+	if _, err := fs.GetEntry(pattern); err == nil {
+		return []string{pattern}, nil
+	}
+	if !hasGlobMeta(pattern) {
+		return nil, nil
+	}
+
+	dir, file := path.Split(pattern)
+	if _, err := path.Match(file, ""); err != nil {
+		return nil, err
+	}
+
+	dirs, err := globVFS(fs, path.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []string{}
+	for _, dir := range dirs {
+		entry, err := fs.GetEntry(dir)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		children, err := entry.Getdents(fs)
+		if err != nil {
+			return nil, err
+		}
+		for child, err := range children {
+			if err != nil {
+				return nil, err
+			}
+			if matched, _ := path.Match(file, child.Name()); matched {
+				matches = append(matches, path.Join(dir, child.Name()))
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
@@ -29,7 +29,6 @@ import (
 	"syscall"
 	"time"
 
-	passwordvalidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/mod/semver"
 	"golang.org/x/term"
 	"golang.org/x/tools/blog/atom"
@@ -159,7 +158,9 @@ func GetPassphrase(prefix string) ([]byte, error) {
 	return passphrase, nil
 }
 
-func GetPassphraseConfirm(prefix string, minEntropyBits float64) ([]byte, error) {
+// GetPassphraseConfirm prompts for a passphrase twice, validate is called
+// on the first one when not nil.
+func GetPassphraseConfirm(prefix string, validate func([]byte) error) ([]byte, error) {
 	fmt.Fprintf(os.Stderr, "%s passphrase: ", prefix)
 	passphrase1, err := term.ReadPassword(int(syscall.Stdin))
 	fmt.Fprintf(os.Stderr, "\n")
@@ -167,10 +168,10 @@ func GetPassphraseConfirm(prefix string, minEntropyBits float64) ([]byte, error)
 		return nil, err
 	}
 
-	// keepass considers < 80 bits as weak
-	err = passwordvalidator.Validate(string(passphrase1), minEntropyBits)
-	if err != nil {
-		return nil, fmt.Errorf("passphrase is too weak: %s", err)
+	if validate != nil {
+		if err := validate(passphrase1); err != nil {
+			return nil, err
+		}
 	}
 
 	fmt.Fprintf(os.Stderr, "%s passphrase (confirm): ", prefix)
@@ -4,7 +4,9 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"sync"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
 )
 
@@ -48,8 +50,17 @@ func LookupDefaultConfiguration(algorithm string) (*Configuration, error) {
 			BlockSize:  -1,
 			EnableCRC:  false,
 		}, nil
+	case "ZSTD":
+		return &Configuration{
+			Algorithm:  "ZSTD",
+			Level:      int(zstd.SpeedDefault),
+			WindowSize: -1,
+			ChunkSize:  -1,
+			BlockSize:  -1,
+			EnableCRC:  false,
+		}, nil
 	default:
-		return nil, fmt.Errorf("unknown hashing algorithm: %s", algorithm)
+		return nil, fmt.Errorf("unknown compression algorithm: %s", algorithm)
 	}
 }
 
@@ -57,6 +68,7 @@ func DeflateStream(name string, r io.Reader) (io.Reader, error) {
 	m := map[string]func(io.Reader) (io.Reader, error){
 		"GZIP": DeflateGzipStream,
 		"LZ4":  DeflateLZ4Stream,
+		"ZSTD": DeflateZstdStream,
 	}
 	if fn, exists := m[name]; exists {
 		return fn(r)
@@ -64,10 +76,37 @@ func DeflateStream(name string, r io.Reader) (io.Reader, error) {
 	return nil, fmt.Errorf("unsupported compression method %q", name)
 }
 
+// DeflateStreamLevel is DeflateStream at the given level, -1 selecting the
+// default one.  The level of LZ4 is ignored, it always runs in fast mode.
+func DeflateStreamLevel(name string, level int, r io.Reader) (io.Reader, error) {
+	switch name {
+	case "GZIP":
+		return deflateGzipStream(level, r)
+	case "ZSTD":
+		zlevel := zstd.SpeedDefault
+		if level != -1 {
+			zlevel = zstd.EncoderLevel(level)
+			if zlevel < zstd.SpeedFastest || zlevel > zstd.SpeedBestCompression {
+				return nil, fmt.Errorf("invalid zstd compression level %d", level)
+			}
+		}
+		return deflateZstdStream(zlevel, r)
+	default:
+		return DeflateStream(name, r)
+	}
+}
+
 func DeflateGzipStream(r io.Reader) (io.Reader, error) {
+	return deflateGzipStream(gzip.DefaultCompression, r)
+}
+
+func deflateGzipStream(level int, r io.Reader) (io.Reader, error) {
 	pr, pw := io.Pipe()
+	gw, err := gzip.NewWriterLevel(pw, level)
+	if err != nil {
+		return nil, err
+	}
 	go func() {
-		gw := gzip.NewWriter(pw)
 		defer pw.Close()
 		defer gw.Close()
 
@@ -93,10 +132,48 @@ func DeflateLZ4Stream(r io.Reader) (io.Reader, error) {
 	return pr, nil
 }
 
+// zstd encoders and decoders are costly to create, so they are reused
+// across streams.  They work on the goroutine of the stream rather than
+// starting their own.
+var (
+	zstdEncoders [zstd.SpeedBestCompression + 1]sync.Pool
+	zstdDecoders sync.Pool
+)
+
+func DeflateZstdStream(r io.Reader) (io.Reader, error) {
+	return deflateZstdStream(zstd.SpeedDefault, r)
+}
+
+func deflateZstdStream(level zstd.EncoderLevel, r io.Reader) (io.Reader, error) {
+	zw, ok := zstdEncoders[level].Get().(*zstd.Encoder)
+	if !ok {
+		var err error
+		zw, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	zw.Reset(pw)
+	go func() {
+		_, err := io.Copy(zw, r)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+
+		zw.Reset(nil)
+		zstdEncoders[level].Put(zw)
+	}()
+	return pr, nil
+}
+
 func InflateStream(name string, r io.Reader) (io.Reader, error) {
 	m := map[string]func(io.Reader) (io.Reader, error){
 		"GZIP": InflateGzipStream,
 		"LZ4":  InflateLZ4Stream,
+		"ZSTD": InflateZstdStream,
 	}
 	if fn, exists := m[name]; exists {
 		return fn(r)
@@ -135,3 +212,28 @@ func InflateLZ4Stream(r io.Reader) (io.Reader, error) {
 	}()
 	return pr, nil
 }
+
+func InflateZstdStream(r io.Reader) (io.Reader, error) {
+	zr, ok := zstdDecoders.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		zr, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := zr.Reset(r); err != nil {
+		zstdDecoders.Put(zr)
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := io.Copy(pw, zr)
+		pw.CloseWithError(err)
+
+		zr.Reset(nil)
+		zstdDecoders.Put(zr)
+	}()
+	return pr, nil
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
 )
 
@@ -45,6 +46,8 @@ func TestCompression(t *testing.T) {
 		{"GZIP", []byte{}}, // Test empty buffer for gzip
 		{"LZ4", []byte("Hello, world!")},
 		{"LZ4", []byte{}}, // Test empty buffer for lz4
+		{"ZSTD", []byte("Hello, world!")},
+		{"ZSTD", []byte{}}, // Test empty buffer for zstd
 	}
 
 	for _, tt := range tests {
@@ -54,6 +57,55 @@ func TestCompression(t *testing.T) {
 	}
 }
 
+func TestCompressionLevel(t *testing.T) {
+	data := bytes.Repeat([]byte("Hello, world! "), 10000)
+
+	for _, level := range []int{-1, int(zstd.SpeedFastest), int(zstd.SpeedBestCompression)} {
+		// run the streams concurrently, so that the pooled encoders and
+		// decoders are shared between them
+		errs := make(chan error, 8)
+		for range 8 {
+			go func() {
+				compressed, err := DeflateStreamLevel("ZSTD", level, bytes.NewReader(data))
+				if err != nil {
+					errs <- err
+					return
+				}
+				buf, err := io.ReadAll(compressed)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				decompressed, err := InflateStream("ZSTD", bytes.NewReader(buf))
+				if err != nil {
+					errs <- err
+					return
+				}
+				buf, err = io.ReadAll(decompressed)
+				if err == nil && !bytes.Equal(buf, data) {
+					err = errors.New("decompressed data does not match")
+				}
+				errs <- err
+			}()
+		}
+		for range 8 {
+			if err := <-errs; err != nil {
+				t.Fatalf("ZSTD level %d: %v", level, err)
+			}
+		}
+	}
+
+	if _, err := DeflateStreamLevel("ZSTD", 42, bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for invalid zstd level, got nil")
+	}
+
+	testCompressionDecompression(t, "GZIP", data)
+	if _, err := DeflateStreamLevel("GZIP", 42, bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for invalid gzip level, got nil")
+	}
+}
+
 func TestDefaultAlgorithm(t *testing.T) {
 	expected := "LZ4"
 	result := NewDefaultConfiguration().Algorithm
@@ -171,6 +223,19 @@ func TestLookupNewDefaultConfigurationGZIP(t *testing.T) {
 	}
 }
 
+func TestLookupNewDefaultConfigurationZSTD(t *testing.T) {
+	config, err := LookupDefaultConfiguration("ZSTD")
+	if err != nil {
+		t.Errorf("LookupNewDefaultConfiguration(ZSTD) returned an error: %v", err)
+	}
+	if config.Algorithm != "ZSTD" {
+		t.Errorf("LookupNewDefaultConfiguration(ZSTD) returned incorrect algorithm: %s", config.Algorithm)
+	}
+	if config.Level != int(zstd.SpeedDefault) {
+		t.Errorf("LookupNewDefaultConfiguration(ZSTD) returned incorrect level: %d", config.Level)
+	}
+}
+
 func TestLookupNewDefaultConfigurationUnknown(t *testing.T) {
 	_, err := LookupDefaultConfiguration("unknown")
 	if err == nil {
@@ -15,6 +15,8 @@ type Config struct {
 	DefaultRepository string                      `yaml:"default-repo"`
 	Repositories      map[string]RepositoryConfig `yaml:"repositories"`
 	Remotes           map[string]RemoteConfig     `yaml:"remotes"`
+	PassphrasePolicy  *PassphrasePolicy           `yaml:"passphrase-policy,omitempty"`
+	TrustedKeys       []string                    `yaml:"trusted-keys,omitempty"`
 }
 
 type RepositoryConfig map[string]string
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	passwordvalidator "github.com/wagslane/go-password-validator"
+)
+
+var ErrWeakPassphrase = errors.New("passphrase is too weak")
+
+// PassphrasePolicy describes the minimal quality expected from the
+// passphrases protecting new repositories.  Zero values disable a check.
+type PassphrasePolicy struct {
+	MinLength  int     `yaml:"min-length,omitempty"`
+	MinClasses int     `yaml:"min-classes,omitempty"`
+	MinEntropy float64 `yaml:"min-entropy,omitempty"`
+}
+
+// DefaultPassphrasePolicy is used when none is configured, keepass
+// considers < 80 bits as weak.
+func DefaultPassphrasePolicy() *PassphrasePolicy {
+	return &PassphrasePolicy{
+		MinEntropy: 80,
+	}
+}
+
+// characterClasses returns how many of lowercase letters, uppercase
+// letters, digits and symbols appear in passphrase.
+func characterClasses(passphrase string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range passphrase {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// Check returns an error wrapping ErrWeakPassphrase and explaining how to
+// improve passphrase if it doesn't comply with the policy.
+func (p *PassphrasePolicy) Check(passphrase []byte) error {
+	s := string(passphrase)
+	guidance := []string{}
+
+	if p.MinLength > 0 && len([]rune(s)) < p.MinLength {
+		guidance = append(guidance, fmt.Sprintf("use at least %d characters", p.MinLength))
+	}
+	if p.MinClasses > 0 && characterClasses(s) < p.MinClasses {
+		guidance = append(guidance, fmt.Sprintf("mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses))
+	}
+	if p.MinEntropy > 0 {
+		if err := passwordvalidator.Validate(s, p.MinEntropy); err != nil {
+			guidance = append(guidance, err.Error())
+		}
+	}
+
+	if len(guidance) != 0 {
+		return fmt.Errorf("%w: %s", ErrWeakPassphrase, strings.Join(guidance, "; "))
+	}
+	return nil
+}
+
+func (p *PassphrasePolicy) Set(option string, value string) error {
+	switch option {
+	case "min-length", "min-classes":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s value: %q", option, value)
+		}
+		if option == "min-length" {
+			p.MinLength = n
+		} else if n > 4 {
+			return fmt.Errorf("min-classes can't be greater than 4")
+		} else {
+			p.MinClasses = n
+		}
+	case "min-entropy":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid %s value: %q", option, value)
+		}
+		p.MinEntropy = f
+	default:
+		return fmt.Errorf("unknown passphrase policy option %q", option)
+	}
+	return nil
+}
+
+// GetPassphrasePolicy returns the configured policy, if any, and the
+// default one otherwise.
+func (c *Config) GetPassphrasePolicy() (*PassphrasePolicy, bool) {
+	if c == nil || c.PassphrasePolicy == nil {
+		return DefaultPassphrasePolicy(), false
+	}
+	return c.PassphrasePolicy, true
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"slices"
+)
+
+// parsePublicKey decodes a public key in the form displayed by plakar
+// info, unpadded base64.
+func parsePublicKey(key string) (ed25519.PublicKey, error) {
+	data, err := base64.RawStdEncoding.DecodeString(key)
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key %q", key)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// Trust adds key to the public keys whose snapshot signatures are
+// trusted.
+func (c *Config) Trust(key string) error {
+	if _, err := parsePublicKey(key); err != nil {
+		return err
+	}
+	if slices.Contains(c.TrustedKeys, key) {
+		return fmt.Errorf("public key %q is already trusted", key)
+	}
+	c.TrustedKeys = append(c.TrustedKeys, key)
+	return nil
+}
+
+// Untrust removes key from the trusted public keys.
+func (c *Config) Untrust(key string) error {
+	idx := slices.Index(c.TrustedKeys, key)
+	if idx == -1 {
+		return fmt.Errorf("public key %q is not trusted", key)
+	}
+	c.TrustedKeys = slices.Delete(c.TrustedKeys, idx, idx+1)
+	if len(c.TrustedKeys) == 0 {
+		c.TrustedKeys = nil
+	}
+	return nil
+}
+
+// GetTrustedKeys returns the decoded trusted public keys.
+func (c *Config) GetTrustedKeys() ([]ed25519.PublicKey, error) {
+	if c == nil {
+		return nil, nil
+	}
+	keys := make([]ed25519.PublicKey, 0, len(c.TrustedKeys))
+	for _, key := range c.TrustedKeys {
+		publicKey, err := parsePublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, publicKey)
+	}
+	return keys, nil
+}
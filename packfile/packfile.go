@@ -30,6 +30,9 @@ type Blob struct {
 
 const BLOB_RECORD_SIZE = 56
 
+// FLAG_CLEARTEXT marks a blob which is compressed but not encrypted.
+const FLAG_CLEARTEXT uint32 = 1 << 0
+
 type PackFile struct {
 	hasher hash.Hash
 	Blobs  []byte
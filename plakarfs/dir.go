@@ -26,14 +26,33 @@ type Dir struct {
 	vfs      *vfs.Filesystem
 }
 
+// isRepositoryRoot tells if d is the root of a mounted repository, whose
+// entries are its snapshots.  The root of a mounted snapshot already has
+// its snapshot.
+func (d *Dir) isRepositoryRoot() bool {
+	return d.parent == nil && d.snap == nil
+}
+
+// isSnapshotRoot tells if d is the root directory of a snapshot, either
+// the root of a mounted snapshot or an entry of a mounted repository.
+func (d *Dir) isSnapshotRoot() bool {
+	if d.parent == nil {
+		return d.snap != nil
+	}
+	return d.parent.isRepositoryRoot()
+}
+
 func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
-	if d.name == "/" {
+	if d.isRepositoryRoot() {
 		d.fullpath = d.name
 		a.Inode = 1
 		a.Mode = os.ModeDir | 0o700
 		a.Uid = uint32(os.Geteuid())
 		a.Gid = uint32(os.Getgid())
-	} else if d.parent.name == "/" {
+		return nil
+	}
+
+	if d.isSnapshotRoot() && d.snap == nil {
 		snapshotID, err := hex.DecodeString(d.name)
 		if err != nil {
 			return err
@@ -54,8 +73,15 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 		d.repo = d.parent.repo
 		d.vfs = snapfs
 		d.fullpath = "/"
+	}
 
-		a.Inode = rand.Uint64()
+	if d.isSnapshotRoot() {
+		snap := d.snap
+		if d.parent == nil {
+			a.Inode = 1
+		} else {
+			a.Inode = rand.Uint64()
+		}
 		a.Mode = os.ModeDir | 0o700
 		a.Uid = uint32(os.Geteuid())
 		a.Gid = uint32(os.Getgid())
@@ -93,9 +119,9 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) error {
 }
 
 func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
-	if d.name == "/" {
+	if d.isRepositoryRoot() {
 		return &Dir{parent: d, name: name, repo: d.repo}, nil
-	} else if d.parent.name == "/" {
+	} else if d.parent != nil && d.parent.isRepositoryRoot() {
 		return &Dir{parent: d, name: name}, nil
 	} else {
 		cleanpath := filepath.Clean(d.fullpath + "/" + name)
@@ -112,7 +138,7 @@ func (d *Dir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 }
 
 func (d *Dir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
-	if d.name == "/" {
+	if d.isRepositoryRoot() {
 
 		d.repo.RebuildState()
 
@@ -2,11 +2,15 @@ package plakarfs
 
 import (
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/anacrolix/fuse/fs"
 )
 
 type FS struct {
 	repo *repository.Repository
+	snap *snapshot.Snapshot
+	vfs  *vfs.Filesystem
 }
 
 func NewFS(repo *repository.Repository, mountpoint string) *FS {
@@ -16,6 +20,23 @@ func NewFS(repo *repository.Repository, mountpoint string) *FS {
 	return fs
 }
 
+// NewSnapshotFS returns a filesystem exposing the content of a single
+// snapshot at its root.
+func NewSnapshotFS(repo *repository.Repository, snap *snapshot.Snapshot) (*FS, error) {
+	snapfs, err := snap.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+	return &FS{
+		repo: repo,
+		snap: snap,
+		vfs:  snapfs,
+	}, nil
+}
+
 func (f *FS) Root() (fs.Node, error) {
+	if f.snap != nil {
+		return &Dir{name: "/", fullpath: "/", repo: f.repo, snap: f.snap, vfs: f.vfs}, nil
+	}
 	return &Dir{name: "/", repo: f.repo}, nil
 }
@@ -0,0 +1,104 @@
+package repository_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"path"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetBlobReader(t *testing.T) {
+	content := make([]byte, 4<<20)
+	rand.New(rand.NewSource(42)).Read(content)
+
+	files := []ptesting.MockFile{
+		ptesting.NewMockFile("large.bin", 0644, string(content)),
+	}
+	opts := &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}
+
+	for name, encrypted := range map[string]bool{"cleartext": false, "encrypted": true} {
+		t.Run(name, func(t *testing.T) {
+			var snap *snapshot.Snapshot
+			if encrypted {
+				snap = ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), files, opts)
+			} else {
+				snap = ptesting.GenerateSnapshot(t, nil, nil, nil, files)
+			}
+			defer snap.Close()
+			repo := snap.Repository()
+
+			fs, err := snap.Filesystem()
+			require.NoError(t, err)
+			entry, err := fs.GetEntry(path.Join(snap.Header.GetSource(0).Importer.Directory, "large.bin"))
+			require.NoError(t, err)
+			require.NotNil(t, entry.ResolvedObject)
+			require.Greater(t, len(entry.ResolvedObject.Chunks), 1)
+
+			streamed := &bytes.Buffer{}
+			for _, chunk := range entry.ResolvedObject.Chunks {
+				blob, err := repo.GetBlob(resources.RT_CHUNK, chunk.ContentMAC)
+				require.NoError(t, err)
+				buffered, err := io.ReadAll(blob)
+				require.NoError(t, err)
+
+				rd, err := repo.GetBlobReader(resources.RT_CHUNK, chunk.ContentMAC)
+				require.NoError(t, err)
+				data, err := io.ReadAll(rd)
+				require.NoError(t, err)
+				require.NoError(t, rd.Close())
+
+				require.Equal(t, buffered, data)
+				streamed.Write(data)
+			}
+			require.Equal(t, content, streamed.Bytes())
+
+			// a chunk abandoned before its end must not block
+			rd, err := repo.GetBlobReader(resources.RT_CHUNK, entry.ResolvedObject.Chunks[0].ContentMAC)
+			require.NoError(t, err)
+			_, err = rd.Read(make([]byte, 16))
+			require.NoError(t, err)
+			require.NoError(t, rd.Close())
+		})
+	}
+}
+
+func TestGetPackfileFooter(t *testing.T) {
+	files := []ptesting.MockFile{
+		ptesting.NewMockFile("file.txt", 0644, "hello footer"),
+	}
+	opts := &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}
+
+	for name, encrypted := range map[string]bool{"cleartext": false, "encrypted": true} {
+		t.Run(name, func(t *testing.T) {
+			var snap *snapshot.Snapshot
+			if encrypted {
+				snap = ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), files, opts)
+			} else {
+				snap = ptesting.GenerateSnapshot(t, nil, nil, nil, files)
+			}
+			defer snap.Close()
+			repo := snap.Repository()
+			_, ok := repo.Store().(storage.PackfileSizer)
+			require.True(t, ok)
+
+			packfiles, err := repo.GetPackfiles()
+			require.NoError(t, err)
+			require.NotEmpty(t, packfiles)
+			for _, packfileMAC := range packfiles {
+				p, err := repo.GetPackfile(packfileMAC)
+				require.NoError(t, err)
+
+				footer, err := repo.GetPackfileFooter(packfileMAC)
+				require.NoError(t, err)
+				require.Equal(t, p.Footer, footer)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/PlakarKorp/plakar/resources"
@@ -13,6 +16,8 @@ const LOCK_REFRESH_RATE = 5 * time.Minute
 const LOCK_TTL = 2 * LOCK_REFRESH_RATE
 const LOCK_VERSION = "1.0.0"
 
+var ErrLocked = errors.New("repository is already locked")
+
 func init() {
 	versioning.Register(resources.RT_LOCK, versioning.FromString(LOCK_VERSION))
 }
@@ -22,6 +27,7 @@ type Lock struct {
 	Timestamp time.Time          `msgpack:"timestamp"`
 	Hostname  string             `msgpack:"hostname"`
 	Exclusive bool               `msgpack:"exclusive"`
+	Pid       int                `msgpack:"pid,omitempty"`
 }
 
 func newLock(hostname string, exclusive bool) *Lock {
@@ -29,6 +35,7 @@ func newLock(hostname string, exclusive bool) *Lock {
 		Timestamp: time.Now(),
 		Hostname:  hostname,
 		Exclusive: exclusive,
+		Pid:       os.Getpid(),
 	}
 }
 
@@ -56,3 +63,15 @@ func (lock *Lock) SerializeToStream(w io.Writer) error {
 func (lock *Lock) IsStale() bool {
 	return time.Since(lock.Timestamp) >= LOCK_TTL
 }
+
+// String identifies the holder of the lock.
+func (lock *Lock) String() string {
+	holder := "backup"
+	if lock.Exclusive {
+		holder = "maintenance"
+	}
+	if lock.Pid != 0 {
+		return fmt.Sprintf("%s on %s (pid %d) since %s", holder, lock.Hostname, lock.Pid, lock.Timestamp.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s on %s since %s", holder, lock.Hostname, lock.Timestamp.UTC().Format(time.RFC3339))
+}
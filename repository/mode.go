@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrReadOnly   = errors.New("repository is read-only")
+	ErrAppendOnly = errors.New("repository is append-only")
+)
+
+// Mode restricts the operations allowed on a repository.  It is enforced
+// by the repository itself so that no command can bypass it, but it is
+// read from the configuration of the client: this is a guard against
+// mistakes, not a protection from a client that wants to modify the
+// store.
+type Mode int
+
+const (
+	// ModeReadWrite allows every operation.
+	ModeReadWrite Mode = iota
+	// ModeAppendOnly allows adding data but refuses to remove snapshots,
+	// states, packfiles or blobs.
+	ModeAppendOnly
+	// ModeReadOnly refuses every write.
+	ModeReadOnly
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeReadWrite:
+		return "read-write"
+	case ModeAppendOnly:
+		return "append-only"
+	case ModeReadOnly:
+		return "read-only"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// ModeFromConfig returns the mode requested by the "append_only" and
+// "read_only" options of a repository configuration.
+func ModeFromConfig(storeConfig map[string]string) (Mode, error) {
+	mode := ModeReadWrite
+	for _, option := range []struct {
+		name string
+		mode Mode
+	}{
+		{"append_only", ModeAppendOnly},
+		{"read_only", ModeReadOnly},
+	} {
+		value, ok := storeConfig[option.name]
+		if !ok {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return ModeReadWrite, fmt.Errorf("invalid value for %s: %q", option.name, value)
+		}
+		if enabled {
+			mode = max(mode, option.mode)
+		}
+	}
+	return mode, nil
+}
+
+func (r *Repository) SetMode(mode Mode) {
+	r.mode = mode
+}
+
+func (r *Repository) Mode() Mode {
+	return r.mode
+}
+
+// CheckWrite fails if the repository doesn't allow adding data, commands
+// can use it to fail before doing any work.
+func (r *Repository) CheckWrite() error {
+	if r.mode == ModeReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// CheckDelete fails if the repository doesn't allow removing data.
+func (r *Repository) CheckDelete() error {
+	switch r.mode {
+	case ModeReadOnly:
+		return ErrReadOnly
+	case ModeAppendOnly:
+		return ErrAppendOnly
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package repository_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSnapshot(t *testing.T) *snapshot.Snapshot {
+	return ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+	})
+}
+
+func TestModeFromConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config map[string]string
+		mode   repository.Mode
+	}{
+		{map[string]string{}, repository.ModeReadWrite},
+		{map[string]string{"append_only": "false"}, repository.ModeReadWrite},
+		{map[string]string{"append_only": "true"}, repository.ModeAppendOnly},
+		{map[string]string{"read_only": "1"}, repository.ModeReadOnly},
+		{map[string]string{"append_only": "true", "read_only": "true"}, repository.ModeReadOnly},
+	} {
+		mode, err := repository.ModeFromConfig(tt.config)
+		require.NoError(t, err)
+		require.Equal(t, tt.mode, mode, "%v", tt.config)
+	}
+
+	_, err := repository.ModeFromConfig(map[string]string{"append_only": "maybe"})
+	require.EqualError(t, err, `invalid value for append_only: "maybe"`)
+}
+
+func TestAppendOnly(t *testing.T) {
+	snap := generateSnapshot(t)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	repo.SetMode(repository.ModeAppendOnly)
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.NotEmpty(t, packfiles)
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+	require.NotEmpty(t, states)
+
+	require.ErrorIs(t, repo.DeleteSnapshot(snap.Header.Identifier), repository.ErrAppendOnly)
+	require.ErrorIs(t, repo.DeleteState(states[0]), repository.ErrAppendOnly)
+	require.ErrorIs(t, repo.DeletePackfile(packfiles[0]), repository.ErrAppendOnly)
+	require.ErrorIs(t, repo.RemovePackfile(packfiles[0]), repository.ErrAppendOnly)
+	require.ErrorIs(t, repo.RemoveDeletedPackfile(packfiles[0]), repository.ErrAppendOnly)
+	require.ErrorIs(t, repo.RemoveBlob(resources.RT_SNAPSHOT, snap.Header.Identifier, packfiles[0]), repository.ErrAppendOnly)
+
+	// nothing was removed
+	packfilesAfter, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.ElementsMatch(t, packfiles, packfilesAfter)
+	statesAfter, err := repo.GetStates()
+	require.NoError(t, err)
+	require.ElementsMatch(t, states, statesAfter)
+	require.True(t, repo.BlobExists(resources.RT_SNAPSHOT, snap.Header.Identifier))
+
+	// writes still succeed
+	stateID := objects.RandomMAC()
+	require.NoError(t, repo.PutState(stateID, bytes.NewReader([]byte("state"))))
+	lockID := objects.RandomMAC()
+	require.NoError(t, repo.PutLock(lockID, bytes.NewReader([]byte("lock"))))
+	require.NoError(t, repo.DeleteLock(lockID))
+
+	snap2, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap2.Close()
+	require.NoError(t, snap2.Commit(nil))
+}
+
+func TestReadOnly(t *testing.T) {
+	snap := generateSnapshot(t)
+	defer snap.Close()
+
+	repo := snap.Repository()
+	repo.SetMode(repository.ModeReadOnly)
+
+	packfiles, err := repo.GetPackfiles()
+	require.NoError(t, err)
+	require.NotEmpty(t, packfiles)
+
+	require.ErrorIs(t, repo.DeleteSnapshot(snap.Header.Identifier), repository.ErrReadOnly)
+	require.ErrorIs(t, repo.DeletePackfile(packfiles[0]), repository.ErrReadOnly)
+	require.ErrorIs(t, repo.PutState(objects.RandomMAC(), bytes.NewReader([]byte("state"))), repository.ErrReadOnly)
+	require.ErrorIs(t, repo.PutPackfile(objects.RandomMAC(), bytes.NewReader([]byte("packfile"))), repository.ErrReadOnly)
+	require.ErrorIs(t, repo.PutLock(objects.RandomMAC(), bytes.NewReader([]byte("lock"))), repository.ErrReadOnly)
+
+	// reads still succeed
+	_, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+}
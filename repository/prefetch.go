@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// prefetchAhead is how many blobs are considered for prefetching from a
+// blob that was just read, walking its successors breadth first.
+const prefetchAhead = 16
+
+// prefetchFetches bounds the blobs being prefetched at once, so that the
+// reads ahead leave most of the bandwidth of the store to the blobs being
+// waited for.
+const prefetchFetches = 4
+
+// prefetchQueue bounds the blobs read whose successors are yet to be
+// scheduled, the older ones being dropped when the scheduler lags behind.
+const prefetchQueue = 64
+
+// DefaultPrefetchMemory bounds the size of the blobs held by the
+// prefetcher, whether they are buffered or still being fetched.
+const DefaultPrefetchMemory = 64 << 20
+
+// prefetcher reads ahead the blobs that followed the blob being read in
+// the co-access history recorded with access statistics.  Without history
+// it never schedules anything and GetBlob behaves as usual.  Successors
+// are looked up in the background, not to delay the reads.
+type prefetcher struct {
+	repo      *Repository
+	maxMemory uint64
+
+	keys    chan accessKey
+	fetches chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	used    uint64
+	entries map[accessKey]*prefetchEntry
+	order   []accessKey
+
+	waits atomic.Uint64
+	hits  atomic.Uint64
+}
+
+type prefetchEntry struct {
+	size uint64
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// PrefetchStats reports how the reads went while prefetching was enabled:
+// Waits is the number of blobs that had to be fetched from the store when
+// requested, Hits the number of blobs that were prefetched.
+type PrefetchStats struct {
+	Waits uint64
+	Hits  uint64
+}
+
+// EnablePrefetch makes GetBlob read ahead the blobs recorded as usually
+// read next, holding at most maxMemory bytes.  It returns false, and has
+// no effect, if prefetching is already enabled.
+func (r *Repository) EnablePrefetch(maxMemory uint64) bool {
+	if maxMemory == 0 {
+		maxMemory = DefaultPrefetchMemory
+	}
+	p := &prefetcher{
+		repo:      r,
+		maxMemory: maxMemory,
+		keys:      make(chan accessKey, prefetchQueue),
+		fetches:   make(chan struct{}, prefetchFetches),
+		done:      make(chan struct{}),
+		entries:   make(map[accessKey]*prefetchEntry),
+	}
+	if !r.prefetcher.CompareAndSwap(nil, p) {
+		return false
+	}
+	go p.run()
+	return true
+}
+
+// DisablePrefetch stops prefetching, releases the buffered blobs and
+// returns the statistics gathered since EnablePrefetch.
+func (r *Repository) DisablePrefetch() PrefetchStats {
+	p := r.prefetcher.Swap(nil)
+	if p == nil {
+		return PrefetchStats{}
+	}
+	close(p.done)
+
+	p.mu.Lock()
+	p.entries = make(map[accessKey]*prefetchEntry)
+	p.order = nil
+	p.used = 0
+	p.mu.Unlock()
+
+	return PrefetchStats{
+		Waits: p.waits.Load(),
+		Hits:  p.hits.Load(),
+	}
+}
+
+// take returns the prefetched content of the blob, waiting for it if the
+// fetch is in flight.
+func (p *prefetcher) take(key accessKey) ([]byte, bool) {
+	p.mu.Lock()
+	e, exists := p.entries[key]
+	p.mu.Unlock()
+	if !exists {
+		return nil, false
+	}
+
+	<-e.done
+
+	p.mu.Lock()
+	if p.entries[key] == e {
+		p.release(key)
+	}
+	p.mu.Unlock()
+
+	if e.err != nil {
+		return nil, false
+	}
+	p.hits.Add(1)
+	return e.data, true
+}
+
+// release drops an entry, must be called with p.mu held.
+func (p *prefetcher) release(key accessKey) {
+	e := p.entries[key]
+	delete(p.entries, key)
+	p.used -= e.size
+	for i, k := range p.order {
+		if k == key {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// evict drops the oldest completed entries until size fits in the
+// budget, must be called with p.mu held.
+func (p *prefetcher) evict(size uint64) bool {
+	for i := 0; p.used+size > p.maxMemory && i < len(p.order); {
+		key := p.order[i]
+		select {
+		case <-p.entries[key].done:
+			p.release(key)
+		default:
+			i++
+		}
+	}
+	return p.used+size <= p.maxMemory
+}
+
+// next returns the blobs read right after key, the ones of the current
+// run first.
+func (p *prefetcher) next(key accessKey) []accessKey {
+	r := p.repo
+
+	r.accessMtx.Lock()
+	successors := slices.Clone(r.accessNext[key])
+	r.accessMtx.Unlock()
+
+	cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID)
+	if err != nil {
+		return successors
+	}
+	for Type, mac := range cache.GetAccessNext(key.Type, key.MAC) {
+		successor := accessKey{Type: Type, MAC: mac}
+		if !slices.Contains(successors, successor) {
+			successors = append(successors, successor)
+		}
+	}
+	return successors
+}
+
+// notify queues the successors of key for scheduling, unless the
+// scheduler is too far behind.
+func (p *prefetcher) notify(key accessKey) {
+	select {
+	case p.keys <- key:
+	default:
+	}
+}
+
+// run schedules the blobs queued by notify until the prefetcher is
+// disabled.
+func (p *prefetcher) run() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case key := <-p.keys:
+			p.schedule(key)
+		}
+	}
+}
+
+// schedule starts fetching the blobs that followed key in the history,
+// the closest first, as long as fewer than prefetchFetches are already
+// being fetched.
+func (p *prefetcher) schedule(key accessKey) {
+	queue := []accessKey{key}
+	visited := map[accessKey]struct{}{key: {}}
+	for i := 0; i < len(queue) && i <= prefetchAhead; i++ {
+		key := queue[i]
+		for _, successor := range p.next(key) {
+			if _, exists := visited[successor]; !exists {
+				visited[successor] = struct{}{}
+				queue = append(queue, successor)
+			}
+		}
+
+		// the first one is the blob that was just read
+		if i == 0 {
+			continue
+		}
+
+		delta, exists, err := p.repo.state.GetDeltaForBlob(key.Type, key.MAC)
+		if err != nil || !exists {
+			continue
+		}
+
+		p.mu.Lock()
+		if _, exists := p.entries[key]; exists {
+			p.mu.Unlock()
+			continue
+		}
+		if !p.evict(uint64(delta.Location.Length)) {
+			p.mu.Unlock()
+			return
+		}
+		select {
+		case p.fetches <- struct{}{}:
+		default:
+			p.mu.Unlock()
+			return
+		}
+		e := &prefetchEntry{
+			size: uint64(delta.Location.Length),
+			done: make(chan struct{}),
+		}
+		p.entries[key] = e
+		p.order = append(p.order, key)
+		p.used += e.size
+		p.mu.Unlock()
+
+		go func() {
+			defer func() { <-p.fetches }()
+			defer close(e.done)
+			rd, err := p.repo.GetPackfileBlob(delta.Blob, delta.Location, delta.Flags)
+			if err != nil {
+				e.err = err
+				return
+			}
+			e.data, e.err = io.ReadAll(rd)
+		}()
+	}
+}
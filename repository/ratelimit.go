@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket shared by all the writers of a repository,
+// so that their aggregate rate respects the limit.  The bucket holds a
+// tenth of a second worth of bytes, and goes in debt when a writer takes
+// more than available: later writers wait for the debt to be paid.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec uint64) *rateLimiter {
+	burst := max(float64(bytesPerSec)/10, 1)
+	return &rateLimiter{
+		rate:   float64(bytesPerSec),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes can be written.
+func (l *rateLimiter) wait(n int) {
+	for n > 0 {
+		chunk := min(float64(n), l.burst)
+
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		l.tokens -= chunk
+		var delay time.Duration
+		if l.tokens < 0 {
+			delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		time.Sleep(delay)
+		n -= int(chunk)
+	}
+}
+
+type rateLimitedReader struct {
+	rd      io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
+
+// LimitWrites caps the rate at which packfiles and states are written to
+// the store, 0 removes the limit.  It must be called before writing.
+func (r *Repository) LimitWrites(bytesPerSec uint64) {
+	if bytesPerSec == 0 {
+		r.writeLimiter = nil
+	} else {
+		r.writeLimiter = newRateLimiter(bytesPerSec)
+	}
+}
+
+func (r *Repository) limitWrite(rd io.Reader) io.Reader {
+	if r.writeLimiter == nil {
+		return rd
+	}
+	return &rateLimitedReader{rd: rd, limiter: r.writeLimiter}
+}
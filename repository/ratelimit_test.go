@@ -0,0 +1,52 @@
+package repository_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitWrites(t *testing.T) {
+	snap := generateSnapshot(t)
+	defer snap.Close()
+	repo := snap.Repository()
+
+	const rate = 512 << 10
+	const workers = 4
+	const size = 64 << 10
+
+	repo.LimitWrites(rate)
+	defer repo.LimitWrites(0)
+
+	// the limit applies to the aggregate of the writers, minus the tenth
+	// of a second that can be written at once.
+	payload := bytes.Repeat([]byte("x"), size)
+	expected := time.Duration(workers*size-rate/10) * time.Second / rate
+
+	t0 := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, repo.PutPackfile(objects.RandomMAC(), bytes.NewReader(payload)))
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(t0)
+
+	require.GreaterOrEqual(t, elapsed, expected*9/10)
+	require.Less(t, elapsed, expected*2)
+
+	// without a limit the same writes are immediate
+	repo.LimitWrites(0)
+	t0 = time.Now()
+	for i := 0; i < workers; i++ {
+		require.NoError(t, repo.PutPackfile(objects.RandomMAC(), bytes.NewReader(payload)))
+	}
+	require.Less(t, time.Since(t0), expected/2)
+}
@@ -11,7 +11,10 @@ import (
 	"iter"
 	"math/big"
 	"math/bits"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	chunkers "github.com/PlakarKorp/go-cdc-chunkers"
@@ -36,14 +39,29 @@ var (
 	ErrPackfileNotFound = errors.New("packfile not found")
 	ErrBlobNotFound     = errors.New("blob not found")
 	ErrNotReadable      = errors.New("repository is not readable")
+	ErrBlobCorrupted    = errors.New("blob does not match its MAC")
 )
 
 type Repository struct {
 	store         storage.Store
 	state         *state.LocalState
 	configuration storage.Configuration
+	mode          Mode
+	writeLimiter  *rateLimiter
 
 	appContext *appcontext.AppContext
+
+	accessMtx    sync.Mutex
+	accessCounts map[accessKey]uint64
+	accessLast   *accessKey
+	accessNext   map[accessKey][]accessKey
+
+	prefetcher atomic.Pointer[prefetcher]
+}
+
+type accessKey struct {
+	Type resources.Type
+	MAC  objects.MAC
 }
 
 func Inexistent(ctx *appcontext.AppContext, storeConfig map[string]string) (*Repository, error) {
@@ -239,17 +257,25 @@ func (r *Repository) Close() error {
 	defer func() {
 		r.Logger().Trace("repository", "Close(): %s", time.Since(t0))
 	}()
-	return nil
+	return r.FlushAccessStats()
 }
 
 func (r *Repository) Decode(input io.Reader) (io.Reader, error) {
+	return r.decode(input, 0, objects.MAC{})
+}
+
+// decode reverses the encoding of the blob mac stored with the given
+// packfile flags.  A blob stored with packfile.FLAG_CLEARTEXT isn't
+// authenticated by its encryption, the returned reader then fails at the
+// end of the blob if its content doesn't match mac.
+func (r *Repository) decode(input io.Reader, flags uint32, mac objects.MAC) (io.Reader, error) {
 	t0 := time.Now()
 	defer func() {
 		r.Logger().Trace("repository", "Decode: %s", time.Since(t0))
 	}()
 
 	stream := input
-	if r.AppContext().GetSecret() != nil {
+	if r.AppContext().GetSecret() != nil && flags&packfile.FLAG_CLEARTEXT == 0 {
 		tmp, err := encryption.DecryptStream(r.configuration.Encryption, r.AppContext().GetSecret(), stream)
 		if err != nil {
 			return nil, err
@@ -265,10 +291,41 @@ func (r *Repository) Decode(input io.Reader) (io.Reader, error) {
 		stream = tmp
 	}
 
+	if flags&packfile.FLAG_CLEARTEXT != 0 {
+		stream = &macReader{rd: stream, hasher: r.GetMACHasher(), expected: mac}
+	}
+
 	return stream, nil
 }
 
+// macReader reads rd and fails at its end with ErrBlobCorrupted if what
+// was read doesn't hash to expected.
+type macReader struct {
+	rd       io.Reader
+	hasher   hash.Hash
+	expected objects.MAC
+}
+
+func (mr *macReader) Read(p []byte) (int, error) {
+	n, err := mr.rd.Read(p)
+	mr.hasher.Write(p[:n])
+	if err == io.EOF && objects.MAC(mr.hasher.Sum(nil)) != mr.expected {
+		err = ErrBlobCorrupted
+	}
+	return n, err
+}
+
 func (r *Repository) Encode(input io.Reader) (io.Reader, error) {
+	return r.encode(input, 0)
+}
+
+// EncodeCleartext compresses input without encrypting it, the resulting
+// blob must be stored with packfile.FLAG_CLEARTEXT.
+func (r *Repository) EncodeCleartext(input io.Reader) (io.Reader, error) {
+	return r.encode(input, packfile.FLAG_CLEARTEXT)
+}
+
+func (r *Repository) encode(input io.Reader, flags uint32) (io.Reader, error) {
 	t0 := time.Now()
 	defer func() {
 		r.Logger().Trace("repository", "Encode: %s", time.Since(t0))
@@ -276,14 +333,14 @@ func (r *Repository) Encode(input io.Reader) (io.Reader, error) {
 
 	stream := input
 	if r.configuration.Compression != nil {
-		tmp, err := compression.DeflateStream(r.configuration.Compression.Algorithm, stream)
+		tmp, err := compression.DeflateStreamLevel(r.configuration.Compression.Algorithm, r.configuration.Compression.Level, stream)
 		if err != nil {
 			return nil, err
 		}
 		stream = tmp
 	}
 
-	if r.AppContext().GetSecret() != nil {
+	if r.AppContext().GetSecret() != nil && flags&packfile.FLAG_CLEARTEXT == 0 {
 		tmp, err := encryption.EncryptStream(r.configuration.Encryption, r.AppContext().GetSecret(), stream)
 		if err != nil {
 			return nil, err
@@ -391,6 +448,10 @@ func (r *Repository) DeleteSnapshot(snapshotID objects.MAC) error {
 		r.Logger().Trace("repository", "DeleteSnapshot(%x): %s", snapshotID, time.Since(t0))
 	}()
 
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	identifier := objects.RandomMAC()
 	sc, err := r.AppContext().GetCache().Scan(identifier)
 	if err != nil {
@@ -455,6 +516,10 @@ func (r *Repository) PutState(mac objects.MAC, rd io.Reader) error {
 		r.Logger().Trace("repository", "PutState(%x, ...): %s", mac, time.Since(t0))
 	}()
 
+	if err := r.CheckWrite(); err != nil {
+		return err
+	}
+
 	rd, err := r.Encode(rd)
 	if err != nil {
 		return err
@@ -465,7 +530,7 @@ func (r *Repository) PutState(mac objects.MAC, rd io.Reader) error {
 		return err
 	}
 
-	return r.store.PutState(mac, rd)
+	return r.store.PutState(mac, r.limitWrite(rd))
 }
 
 func (r *Repository) DeleteState(mac objects.MAC) error {
@@ -474,6 +539,10 @@ func (r *Repository) DeleteState(mac objects.MAC) error {
 		r.Logger().Trace("repository", "DeleteState(%x, ...): %s", mac, time.Since(t0))
 	}()
 
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	return r.store.DeleteState(mac)
 }
 
@@ -552,6 +621,76 @@ func (r *Repository) GetPackfile(mac objects.MAC) (*packfile.PackFile, error) {
 	return p, nil
 }
 
+// GetPackfileFooter returns the footer of the packfile mac.  When the store
+// can tell the size of the packfile, only its header and footer are read.
+func (r *Repository) GetPackfileFooter(mac objects.MAC) (packfile.PackFileFooter, error) {
+	sizer, ok := r.store.(storage.PackfileSizer)
+	if !ok {
+		p, err := r.GetPackfile(mac)
+		if err != nil {
+			return packfile.PackFileFooter{}, err
+		}
+		return p.Footer, nil
+	}
+
+	size, err := sizer.GetPackfileSize(mac)
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+	if size < uint64(storage.STORAGE_HEADER_SIZE+storage.STORAGE_FOOTER_SIZE+4) {
+		return packfile.PackFileFooter{}, fmt.Errorf("packfile: truncated")
+	}
+	// the encoded footer is followed by its length, then by the MAC of
+	// the serialized packfile
+	end := size - uint64(storage.STORAGE_FOOTER_SIZE) - 4
+
+	header, err := r.readStoreRange(mac, 0, storage.STORAGE_HEADER_SIZE)
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+	packfileVersion, _, err := storage.Deserialize(r.GetMACHasher(), resources.RT_PACKFILE, bytes.NewReader(header))
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+
+	lenbuf, err := r.readStoreRange(mac, end, 4)
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+	footerBufLength := binary.LittleEndian.Uint32(lenbuf)
+	if uint64(footerBufLength) > end-uint64(storage.STORAGE_HEADER_SIZE) {
+		return packfile.PackFileFooter{}, fmt.Errorf("packfile: invalid footer length")
+	}
+
+	footerbuf, err := r.readStoreRange(mac, end-uint64(footerBufLength), footerBufLength)
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+	footerbuf, err = r.DecodeBuffer(footerbuf)
+	if err != nil {
+		return packfile.PackFileFooter{}, err
+	}
+	return packfile.NewFooterFromBytes(packfileVersion, footerbuf)
+}
+
+// readStoreRange reads length bytes at offset of the packfile mac, as it is
+// stored.
+func (r *Repository) readStoreRange(mac objects.MAC, offset uint64, length uint32) ([]byte, error) {
+	rd, err := r.store.GetPackfileBlob(mac, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := rd.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(rd, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
 func padmeLength(L uint32) (uint32, error) {
 	// Determine the bit-length of L.
 	bitLen := 32 - bits.LeadingZeros32(L)
@@ -583,12 +722,10 @@ func randomShift(n uint32) (uint64, error) {
 	return uint64(r.Int64()), nil
 }
 
-func (r *Repository) GetPackfileBlob(loc state.Location) (io.ReadSeeker, error) {
-	t0 := time.Now()
-	defer func() {
-		r.Logger().Trace("repository", "GetPackfileBlob(%x, %d, %d): %s", loc.Packfile, loc.Offset, loc.Length, time.Since(t0))
-	}()
-
+// readPackfileBlob returns a reader for the encoded blob at loc.  The
+// range requested from the store is padded by a random amount on both
+// sides, so that the requests don't reveal the exact blob boundaries.
+func (r *Repository) readPackfileBlob(loc state.Location) (io.Reader, error) {
 	offset := loc.Offset
 	length := loc.Length
 
@@ -613,19 +750,45 @@ func (r *Repository) GetPackfileBlob(loc state.Location) (io.ReadSeeker, error)
 
 	// discard the first offsetDelta bytes
 	_, err = io.ReadFull(rd, make([]byte, offsetDelta))
+	if err != nil {
+		if c, ok := rd.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+
+	// and the last lengthDelta bytes
+	return &blobReader{
+		Reader: io.LimitReader(rd, int64(length)),
+		source: rd,
+	}, nil
+}
+
+// GetPackfileBlob reads and decodes the blob mac at loc, flags are the ones
+// recorded for the blob in the packfile index.
+func (r *Repository) GetPackfileBlob(mac objects.MAC, loc state.Location, flags uint32) (io.ReadSeeker, error) {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "GetPackfileBlob(%x, %d, %d): %s", loc.Packfile, loc.Offset, loc.Length, time.Since(t0))
+	}()
+
+	rd, err := r.readPackfileBlob(loc)
 	if err != nil {
 		return nil, err
 	}
+	defer rd.(io.Closer).Close()
 
 	data, err := io.ReadAll(rd)
 	if err != nil {
 		return nil, err
 	}
 
-	// discard the last lengthDelta bytes
-	data = data[:length]
+	rd, err = r.decode(bytes.NewReader(data), flags, mac)
+	if err != nil {
+		return nil, err
+	}
 
-	decoded, err := r.DecodeBuffer(data)
+	decoded, err := io.ReadAll(rd)
 	if err != nil {
 		return nil, err
 	}
@@ -633,17 +796,80 @@ func (r *Repository) GetPackfileBlob(loc state.Location) (io.ReadSeeker, error)
 	return bytes.NewReader(decoded), nil
 }
 
+// GetPackfileBlobReader is the streaming version of GetPackfileBlob: the
+// blob is read from the store and decoded as the returned reader is
+// consumed, instead of being held in memory.
+func (r *Repository) GetPackfileBlobReader(mac objects.MAC, loc state.Location, flags uint32) (io.ReadCloser, error) {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "GetPackfileBlobReader(%x, %d, %d): %s", loc.Packfile, loc.Offset, loc.Length, time.Since(t0))
+	}()
+
+	rd, err := r.readPackfileBlob(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// decryption expects every read to return a whole encrypted chunk
+	decoded, err := r.decode(&fullReader{rd}, flags, mac)
+	if err != nil {
+		rd.(io.Closer).Close()
+		return nil, err
+	}
+
+	return &blobReader{
+		Reader: decoded,
+		source: rd,
+	}, nil
+}
+
+// fullReader fills the whole buffer on every read unless the end of the
+// stream is reached.
+type fullReader struct {
+	io.Reader
+}
+
+func (fr *fullReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(fr.Reader, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// blobReader reads a blob out of source.
+type blobReader struct {
+	io.Reader
+	source io.Reader
+}
+
+// Close consumes what is left of the blob, which terminates the goroutines
+// decoding it, and releases the source.
+func (br *blobReader) Close() error {
+	_, err := io.Copy(io.Discard, br.Reader)
+	if c, ok := br.source.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
 func (r *Repository) PutPackfile(mac objects.MAC, rd io.Reader) error {
 	t0 := time.Now()
 	defer func() {
 		r.Logger().Trace("repository", "PutPackfile(%x, ...): %s", mac, time.Since(t0))
 	}()
 
+	if err := r.CheckWrite(); err != nil {
+		return err
+	}
+
 	rd, err := storage.Serialize(r.GetMACHasher(), resources.RT_PACKFILE, versioning.GetCurrentVersion(resources.RT_PACKFILE), rd)
 	if err != nil {
 		return err
 	}
-	return r.store.PutPackfile(mac, rd)
+	return r.store.PutPackfile(mac, r.limitWrite(rd))
 }
 
 // Deletes a packfile from the store. Warning this is a true delete and is unrecoverable.
@@ -653,6 +879,10 @@ func (r *Repository) DeletePackfile(mac objects.MAC) error {
 		r.Logger().Trace("repository", "DeletePackfile(%x): %s", mac, time.Since(t0))
 	}()
 
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	return r.store.DeletePackfile(mac)
 }
 
@@ -662,6 +892,11 @@ func (r *Repository) RemovePackfile(packfileMAC objects.MAC) error {
 	defer func() {
 		r.Logger().Trace("repository", "RemovePackfile(%x): %s", packfileMAC, time.Since(t0))
 	}()
+
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	return r.state.DelPackfile(packfileMAC)
 }
 
@@ -721,18 +956,37 @@ func (r *Repository) RemoveDeletedPackfile(packfileMAC objects.MAC) error {
 		r.Logger().Trace("repository", "RemoveDeletedPackfile(%x): %s", packfileMAC, time.Since(t0))
 	}()
 
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	return r.state.DelDeletedResource(resources.RT_PACKFILE, packfileMAC)
 }
 
 func (r *Repository) GetPackfileForBlob(Type resources.Type, mac objects.MAC) (objects.MAC, bool, error) {
+	loc, exists, err := r.GetLocationForBlob(Type, mac)
+
+	return loc.Packfile, exists, err
+}
+
+// GetLocationForBlob returns the packfile holding the blob and where it
+// lies in that packfile.
+func (r *Repository) GetLocationForBlob(Type resources.Type, mac objects.MAC) (state.Location, bool, error) {
 	t0 := time.Now()
 	defer func() {
-		r.Logger().Trace("repository", "GetPackfileForBlob(%x): %s", mac, time.Since(t0))
+		r.Logger().Trace("repository", "GetLocationForBlob(%x): %s", mac, time.Since(t0))
 	}()
 
-	packfile, exists, err := r.state.GetSubpartForBlob(Type, mac)
+	return r.state.GetSubpartForBlob(Type, mac)
+}
+
+func (r *Repository) GetDeltaForBlob(Type resources.Type, mac objects.MAC) (state.DeltaEntry, bool, error) {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "GetDeltaForBlob(%x): %s", mac, time.Since(t0))
+	}()
 
-	return packfile.Packfile, exists, err
+	return r.state.GetDeltaForBlob(Type, mac)
 }
 
 func (r *Repository) GetBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeker, error) {
@@ -741,7 +995,17 @@ func (r *Repository) GetBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeke
 		r.Logger().Trace("repository", "GetBlob(%s, %x): %s", Type, mac, time.Since(t0))
 	}()
 
-	loc, exists, err := r.state.GetSubpartForBlob(Type, mac)
+	if p := r.prefetcher.Load(); p != nil {
+		key := accessKey{Type: Type, MAC: mac}
+		defer p.notify(key)
+		if data, ok := p.take(key); ok {
+			r.recordAccess(Type, mac)
+			return bytes.NewReader(data), nil
+		}
+		p.waits.Add(1)
+	}
+
+	delta, exists, err := r.state.GetDeltaForBlob(Type, mac)
 	if err != nil {
 		return nil, err
 	}
@@ -750,14 +1014,139 @@ func (r *Repository) GetBlob(Type resources.Type, mac objects.MAC) (io.ReadSeeke
 		return nil, ErrPackfileNotFound
 	}
 
-	rd, err := r.GetPackfileBlob(loc)
+	rd, err := r.GetPackfileBlob(mac, delta.Location, delta.Flags)
 	if err != nil {
 		return nil, err
 	}
 
+	r.recordAccess(Type, mac)
 	return rd, nil
 }
 
+// GetBlobReader is the streaming version of GetBlob, the blob is decoded
+// as it is read so that large blobs are not held in memory.  The reader
+// must be closed.
+func (r *Repository) GetBlobReader(Type resources.Type, mac objects.MAC) (io.ReadCloser, error) {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "GetBlobReader(%s, %x): %s", Type, mac, time.Since(t0))
+	}()
+
+	if p := r.prefetcher.Load(); p != nil {
+		key := accessKey{Type: Type, MAC: mac}
+		defer p.notify(key)
+		if data, ok := p.take(key); ok {
+			r.recordAccess(Type, mac)
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		p.waits.Add(1)
+	}
+
+	delta, exists, err := r.state.GetDeltaForBlob(Type, mac)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrPackfileNotFound
+	}
+
+	rd, err := r.GetPackfileBlobReader(mac, delta.Location, delta.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordAccess(Type, mac)
+	return rd, nil
+}
+
+// recordAccess counts a read of the blob when access statistics are
+// enabled.  Counters are kept in memory and only merged into the cache
+// by FlushAccessStats, so that reads do not turn into cache writes.
+func (r *Repository) recordAccess(Type resources.Type, mac objects.MAC) {
+	if !r.appContext.AccessStats {
+		return
+	}
+
+	r.accessMtx.Lock()
+	defer r.accessMtx.Unlock()
+	if r.accessCounts == nil {
+		r.accessCounts = make(map[accessKey]uint64)
+	}
+	key := accessKey{Type: Type, MAC: mac}
+	r.accessCounts[key]++
+
+	// remember what was read next, this is the co-access history the
+	// prefetcher follows on later runs.
+	if r.accessLast != nil && *r.accessLast != key {
+		if r.accessNext == nil {
+			r.accessNext = make(map[accessKey][]accessKey)
+		}
+		r.accessNext[*r.accessLast] = addSuccessor(r.accessNext[*r.accessLast], key)
+	}
+	r.accessLast = &key
+}
+
+// addSuccessor puts key first in successors, keeping at most
+// caching.AccessNextMax of them.
+func addSuccessor(successors []accessKey, key accessKey) []accessKey {
+	if idx := slices.Index(successors, key); idx != -1 {
+		successors = slices.Delete(successors, idx, idx+1)
+	}
+	successors = slices.Insert(successors, 0, key)
+	if len(successors) > caching.AccessNextMax {
+		successors = successors[:caching.AccessNextMax]
+	}
+	return successors
+}
+
+func (r *Repository) FlushAccessStats() error {
+	r.accessMtx.Lock()
+	counts := r.accessCounts
+	r.accessCounts = nil
+	next := r.accessNext
+	r.accessNext = nil
+	r.accessMtx.Unlock()
+
+	if len(counts) == 0 && len(next) == 0 {
+		return nil
+	}
+
+	cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID)
+	if err != nil {
+		return err
+	}
+
+	for key, count := range counts {
+		if err := cache.AddAccessCount(key.Type, key.MAC, count); err != nil {
+			return err
+		}
+	}
+	for key, successors := range next {
+		// oldest first, so that the most recent end up first
+		for _, successor := range slices.Backward(successors) {
+			if err := cache.AddAccessNext(key.Type, key.MAC, successor.Type, successor.MAC); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AccessStats returns the recorded number of reads for every blob of the
+// given type.
+func (r *Repository) AccessStats(Type resources.Type) (iter.Seq2[objects.MAC, uint64], error) {
+	if err := r.FlushAccessStats(); err != nil {
+		return nil, err
+	}
+
+	cache, err := r.AppContext().GetCache().Repository(r.Configuration().RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetAccessCountsByType(Type), nil
+}
+
 func (r *Repository) BlobExists(Type resources.Type, mac objects.MAC) bool {
 	t0 := time.Now()
 	defer func() {
@@ -772,6 +1161,11 @@ func (r *Repository) RemoveBlob(Type resources.Type, mac, packfileMAC objects.MA
 	defer func() {
 		r.Logger().Trace("repository", "DeleteBlob(%s, %x, %x): %s", Type, mac, packfileMAC, time.Since(t0))
 	}()
+
+	if err := r.CheckDelete(); err != nil {
+		return err
+	}
+
 	return r.state.DelDelta(Type, mac, packfileMAC)
 }
 
@@ -800,6 +1194,16 @@ func (r *Repository) PutStateState(stateId objects.MAC) error {
 	return r.state.PutState(stateId)
 }
 
+// MergeState adds to the local aggregated state the state stateID, read
+// from rd, without going through all the states as RebuildState does.
+func (r *Repository) MergeState(version versioning.Version, stateID objects.MAC, rd io.Reader) error {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "MergeState(%x): %s", stateID, time.Since(t0))
+	}()
+	return r.state.MergeState(version, stateID, rd)
+}
+
 func (r *Repository) ListOrphanBlobs() iter.Seq2[state.DeltaEntry, error] {
 	t0 := time.Now()
 	defer func() {
@@ -808,6 +1212,37 @@ func (r *Repository) ListOrphanBlobs() iter.Seq2[state.DeltaEntry, error] {
 	return r.state.ListOrphanDeltas()
 }
 
+// ListObjectsOfType yields the state entries of the blobs of the given type
+// stored in the repository, a blob stored in several packfiles has one
+// entry for each.
+func (r *Repository) ListObjectsOfType(Type resources.Type) iter.Seq2[state.DeltaEntry, error] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListObjectsOfType(%s): %s", Type, time.Since(t0))
+	}()
+	return r.state.ListObjectsOfType(Type)
+}
+
+// ListLiveObjectsOfType is like ListObjectsOfType but skips the blobs of
+// the packfiles and snapshots that were deleted.  Blobs of a deleted snapshot
+// that live snapshots don't reference are still yielded until a maintenance
+// tombstones their packfile, see snapshot.ListLiveObjectsOfType.
+func (r *Repository) ListLiveObjectsOfType(Type resources.Type) iter.Seq2[state.DeltaEntry, error] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListLiveObjectsOfType(%s): %s", Type, time.Since(t0))
+	}()
+	return r.state.ListLiveObjectsOfType(Type)
+}
+
+func (r *Repository) ListPackfileBlobs(packfile objects.MAC) iter.Seq2[state.DeltaEntry, error] {
+	t0 := time.Now()
+	defer func() {
+		r.Logger().Trace("repository", "ListPackfileBlobs(%x): %s", packfile, time.Since(t0))
+	}()
+	return r.state.ListPackfileDeltas(packfile)
+}
+
 func (r *Repository) ListSnapshots() iter.Seq[objects.MAC] {
 	t0 := time.Now()
 	defer func() {
@@ -887,6 +1322,10 @@ func (r *Repository) PutLock(lockID objects.MAC, rd io.Reader) error {
 		r.Logger().Trace("repository", "PutLock(%x, ...): %s", lockID, time.Since(t0))
 	}()
 
+	if err := r.CheckWrite(); err != nil {
+		return err
+	}
+
 	rd, err := r.Encode(rd)
 	if err != nil {
 		return err
@@ -906,5 +1345,9 @@ func (r *Repository) DeleteLock(lockID objects.MAC) error {
 		r.Logger().Trace("repository", "DeleteLock(%x, ...): %s", lockID, time.Since(t0))
 	}()
 
+	if err := r.CheckWrite(); err != nil {
+		return err
+	}
+
 	return r.store.DeleteLock(lockID)
 }
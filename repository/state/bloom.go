@@ -0,0 +1,72 @@
+package state
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+const (
+	// bloomBitsPerEntry and bloomHashes keep the false positive rate
+	// around 1% while the filter holds at most its capacity.
+	bloomBitsPerEntry = 10
+	bloomHashes       = 7
+
+	// bloomMinCapacity avoids rebuilding the filter over and over while
+	// a small state grows.
+	bloomMinCapacity = 1 << 16
+)
+
+// bloomFilter tells whether a blob may be in the state, a negative answer
+// being definitive.  It can be queried and updated concurrently.
+type bloomFilter struct {
+	bits     []atomic.Uint64
+	capacity uint64
+	count    atomic.Uint64
+}
+
+func newBloomFilter(capacity uint64) *bloomFilter {
+	capacity = max(capacity, bloomMinCapacity)
+	return &bloomFilter{
+		bits:     make([]atomic.Uint64, (capacity*bloomBitsPerEntry+63)/64),
+		capacity: capacity,
+	}
+}
+
+// positions derives the bits of a blob by double hashing, the MACs being
+// uniformly distributed there is no need to hash them any further.
+func (bf *bloomFilter) positions(Type resources.Type, mac objects.MAC) (uint64, uint64) {
+	h1 := binary.LittleEndian.Uint64(mac[0:8]) ^ uint64(Type)*0x9e3779b97f4a7c15
+	h2 := binary.LittleEndian.Uint64(mac[8:16]) | 1
+	return h1, h2
+}
+
+func (bf *bloomFilter) add(Type resources.Type, mac objects.MAC) {
+	nbits := uint64(len(bf.bits)) * 64
+	h1, h2 := bf.positions(Type, mac)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % nbits
+		bf.bits[bit/64].Or(1 << (bit % 64))
+	}
+	bf.count.Add(1)
+}
+
+func (bf *bloomFilter) mayContain(Type resources.Type, mac objects.MAC) bool {
+	nbits := uint64(len(bf.bits)) * 64
+	h1, h2 := bf.positions(Type, mac)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % nbits
+		if bf.bits[bit/64].Load()&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// overloaded reports whether the filter holds more entries than it was
+// sized for, past which its false positive rate degrades quickly.
+func (bf *bloomFilter) overloaded() bool {
+	return bf.count.Load() > bf.capacity
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"sync"
 	"time"
 
 	"github.com/PlakarKorp/plakar/caching"
@@ -118,6 +119,22 @@ type LocalState struct {
 	//    we need it to avoid concurrent insert of the same entry by two
 	//    different backup processes.
 	cache caching.StateCache
+
+	// filter answers most of the BlobExists negatives without reading the
+	// cache.  It is built from the cache on the first lookup and updated
+	// on every delta written through this state, which must therefore be
+	// the only writer of the deltas of its cache.  While it is rebuilt,
+	// the blobs written are also recorded in pending to be replayed into
+	// the new filter, which may not find them in the cache.
+	filterMtx  sync.Mutex
+	filter     *bloomFilter
+	rebuilding bool
+	pending    []blobKey
+}
+
+type blobKey struct {
+	Type resources.Type
+	MAC  objects.MAC
 }
 
 func NewLocalState(cache caching.StateCache) *LocalState {
@@ -313,6 +330,9 @@ func (ls *LocalState) SerializeToStream(w io.Writer) error {
 }
 
 func DeltaEntryFromBytes(buf []byte) (de DeltaEntry, err error) {
+	if len(buf) < DeltaEntrySerializedSize {
+		return de, fmt.Errorf("short read while deserializing delta entry")
+	}
 	bbuf := bytes.NewBuffer(buf)
 
 	typ, err := bbuf.ReadByte()
@@ -346,6 +366,20 @@ func DeltaEntryFromBytes(buf []byte) (de DeltaEntry, err error) {
 	return
 }
 
+// DecodeDeltaKey decodes a delta record with DeltaEntryFromBytes and
+// returns what it is keyed by in the cache, it is the decoder used to
+// verify the cache.
+func DecodeDeltaKey(buf []byte) (resources.Type, objects.MAC, objects.MAC, error) {
+	if len(buf) != DeltaEntrySerializedSize {
+		return 0, objects.MAC{}, objects.MAC{}, fmt.Errorf("invalid delta entry size %d", len(buf))
+	}
+	de, err := DeltaEntryFromBytes(buf)
+	if err != nil {
+		return 0, objects.MAC{}, objects.MAC{}, err
+	}
+	return de.Type, de.Blob, de.Location.Packfile, nil
+}
+
 func (de *DeltaEntry) _toBytes(buf []byte) {
 	pos := 0
 	buf[pos] = byte(de.Type)
@@ -369,6 +403,9 @@ func (de *DeltaEntry) ToBytes() (ret []byte) {
 }
 
 func PackfileEntryFromBytes(buf []byte) (pe PackfileEntry, err error) {
+	if len(buf) < PackfileEntrySerializedSize {
+		return pe, fmt.Errorf("Short read while deserializing packfile entry")
+	}
 	bbuf := bytes.NewBuffer(buf)
 
 	n, err := bbuf.Read(pe.Packfile[:])
@@ -407,6 +444,9 @@ func (pe *PackfileEntry) ToBytes() (ret []byte) {
 }
 
 func DeletedEntryFromBytes(buf []byte) (de DeletedEntry, err error) {
+	if len(buf) < DeletedEntrySerializedSize {
+		return de, fmt.Errorf("Short read while deserializing deleted entry")
+	}
 	bbuf := bytes.NewBuffer(buf)
 
 	typ, err := bbuf.ReadByte()
@@ -458,9 +498,15 @@ func ConfigurationEntryFromBytes(buf []byte) (ce ConfigurationEntry, err error)
 	if err != nil {
 		return ce, fmt.Errorf("Short read while deserializing keyLen ConfigurationEntry")
 	}
+	if bbuf.Len() < int(keyLen)+2 {
+		return ce, fmt.Errorf("Short read while deserializing key ConfigurationEntry")
+	}
 	ce.Key = string(bbuf.Next(int(keyLen)))
 
 	valueLen := binary.LittleEndian.Uint16(bbuf.Next(2))
+	if bbuf.Len() < int(valueLen)+8 {
+		return ce, fmt.Errorf("Short read while deserializing value ConfigurationEntry")
+	}
 	ce.Value = bbuf.Next(int(valueLen))
 
 	timestamp := binary.LittleEndian.Uint64(bbuf.Next(8))
@@ -486,6 +532,10 @@ func (ce *ConfigurationEntry) ToBytes() []byte {
 	return buf
 }
 
+// deltaBatchSize is the number of delta entries written to the cache at
+// once when loading a state.
+const deltaBatchSize = 10000
+
 func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 	readUint64 := func() (uint64, error) {
 		buf := make([]byte, 8)
@@ -508,6 +558,18 @@ func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 	de_buf := make([]byte, DeltaEntrySerializedSize)
 	deleted_buf := make([]byte, DeletedEntrySerializedSize)
 	pe_buf := make([]byte, PackfileEntrySerializedSize)
+	batch := ls.cache.NewDeltaBatch()
+	batched := []blobKey{}
+	flush := func() error {
+		if err := batch.Flush(); err != nil {
+			return err
+		}
+		for _, blob := range batched {
+			ls.addToFilter(blob.Type, blob.MAC)
+		}
+		batched = batched[:0]
+		return nil
+	}
 	for {
 		n, err := r.Read(et_buf)
 		if err != nil || n != len(et_buf) {
@@ -516,6 +578,9 @@ func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 
 		entryType := EntryType(et_buf[0])
 		if entryType == ET_METADATA {
+			if err := flush(); err != nil {
+				return fmt.Errorf("failed to write delta entries %w", err)
+			}
 			break
 		}
 
@@ -542,7 +607,13 @@ func (ls *LocalState) deserializeFromStream(r io.Reader) error {
 				return fmt.Errorf("failed to deserialize delta entry %w", err)
 			}
 
-			ls.cache.PutDelta(delta.Type, delta.Blob, delta.Location.Packfile, de_buf)
+			batch.PutDelta(delta.Type, delta.Blob, delta.Location.Packfile, de_buf)
+			batched = append(batched, blobKey{delta.Type, delta.Blob})
+			if batch.Len() >= deltaBatchSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("failed to write delta entries %w", err)
+				}
+			}
 		case ET_DELETED:
 			if length != DeletedEntrySerializedSize {
 				return fmt.Errorf("failed to read deleted entry wrong length got(%d)/expected(%d)", length, DeletedEntrySerializedSize)
@@ -628,14 +699,100 @@ func (ls *LocalState) DelState(stateID objects.MAC) error {
 }
 
 func (ls *LocalState) PutDelta(de *DeltaEntry) error {
-	return ls.cache.PutDelta(de.Type, de.Blob, de.Location.Packfile, de.ToBytes())
+	// the filter is updated once the delta can be found in the cache, so
+	// that a rebuild either finds it there or gets it replayed
+	if err := ls.cache.PutDelta(de.Type, de.Blob, de.Location.Packfile, de.ToBytes()); err != nil {
+		return err
+	}
+	ls.addToFilter(de.Type, de.Blob)
+	return nil
 }
 
 func (ls *LocalState) DelDelta(Type resources.Type, blobMAC, packfileMAC objects.MAC) error {
 	return ls.cache.DelDelta(Type, blobMAC, packfileMAC)
 }
 
+// CountByType returns the number of delta entries of type Type without
+// iterating them.  A blob stored in several packfiles is counted once per
+// packfile, and entries whose packfile is no longer part of the state are
+// counted until they are removed.
+func (ls *LocalState) CountByType(Type resources.Type) (uint64, error) {
+	return ls.cache.CountDeltas(Type)
+}
+
+// blobFilter returns the filter of the blobs of the state, (re)building it
+// from the cache when there is none yet or it outgrew its capacity.  The
+// cache is scanned without holding filterMtx, lookups meanwhile using the
+// previous filter, which is still accurate if overloaded.  It returns nil
+// if there is no filter to use, in which case every lookup goes to the
+// cache.
+func (ls *LocalState) blobFilter() *bloomFilter {
+	ls.filterMtx.Lock()
+	if ls.rebuilding || (ls.filter != nil && !ls.filter.overloaded()) {
+		defer ls.filterMtx.Unlock()
+		return ls.filter
+	}
+	ls.rebuilding = true
+	ls.filterMtx.Unlock()
+
+	filter := ls.buildFilter()
+
+	ls.filterMtx.Lock()
+	defer ls.filterMtx.Unlock()
+	if filter != nil {
+		for _, blob := range ls.pending {
+			filter.add(blob.Type, blob.MAC)
+		}
+		ls.filter = filter
+	}
+	ls.rebuilding = false
+	ls.pending = nil
+	return ls.filter
+}
+
+// buildFilter returns a filter of the blobs found in the cache, or nil if
+// it could not be read.
+func (ls *LocalState) buildFilter() *bloomFilter {
+	count := uint64(0)
+	for _, Type := range resources.Types() {
+		n, err := ls.cache.CountDeltas(Type)
+		if err != nil {
+			return nil
+		}
+		count += n
+	}
+
+	// leave room for the blobs added until the next rebuild
+	filter := newBloomFilter(2 * count)
+	for _, buf := range ls.cache.GetDeltas() {
+		de, err := DeltaEntryFromBytes(buf)
+		if err != nil {
+			return nil
+		}
+		filter.add(de.Type, de.Blob)
+	}
+	return filter
+}
+
+// addToFilter records a blob written to the cache, it is a no-op until the
+// filter is built.
+func (ls *LocalState) addToFilter(Type resources.Type, blobMAC objects.MAC) {
+	ls.filterMtx.Lock()
+	defer ls.filterMtx.Unlock()
+
+	if ls.filter != nil {
+		ls.filter.add(Type, blobMAC)
+	}
+	if ls.rebuilding {
+		ls.pending = append(ls.pending, blobKey{Type, blobMAC})
+	}
+}
+
 func (ls *LocalState) BlobExists(Type resources.Type, blobMAC objects.MAC) bool {
+	if filter := ls.blobFilter(); filter != nil && !filter.mayContain(Type, blobMAC) {
+		return false
+	}
+
 	for _, buf := range ls.cache.GetDelta(Type, blobMAC) {
 		de, err := DeltaEntryFromBytes(buf)
 
@@ -658,31 +815,31 @@ func (ls *LocalState) BlobExists(Type resources.Type, blobMAC objects.MAC) bool
 }
 
 func (ls *LocalState) GetSubpartForBlob(Type resources.Type, blobMAC objects.MAC) (Location, bool, error) {
-	var delta *DeltaEntry
+	delta, exists, err := ls.GetDeltaForBlob(Type, blobMAC)
+	return delta.Location, exists, err
+}
+
+// GetDeltaForBlob returns the entry locating the blob in a packfile that
+// is still live, along with the flags the blob was stored with.
+func (ls *LocalState) GetDeltaForBlob(Type resources.Type, blobMAC objects.MAC) (DeltaEntry, bool, error) {
 	for _, buf := range ls.cache.GetDelta(Type, blobMAC) {
 		de, err := DeltaEntryFromBytes(buf)
 
 		if err != nil {
-			return Location{}, false, err
+			return DeltaEntry{}, false, err
 		}
 
 		ok, err := ls.cache.HasPackfile(de.Location.Packfile)
 		if err != nil {
-			return Location{}, false, err
+			return DeltaEntry{}, false, err
 		}
 
 		deleted, _ := ls.HasDeletedResource(resources.RT_PACKFILE, de.Location.Packfile)
 		if ok && !deleted {
-			delta = &de
-			break
+			return de, true, nil
 		}
 	}
-
-	if delta == nil {
-		return Location{}, false, nil
-	} else {
-		return delta.Location, true, nil
-	}
+	return DeltaEntry{}, false, nil
 }
 
 func (ls *LocalState) PutPackfile(stateId, packfile objects.MAC) error {
@@ -712,7 +869,10 @@ func (ls *LocalState) ListPackfiles() iter.Seq[objects.MAC] {
 func (ls *LocalState) ListSnapshots() iter.Seq[objects.MAC] {
 	return func(yield func(objects.MAC) bool) {
 		for _, buf := range ls.cache.GetDeltasByType(resources.RT_SNAPSHOT) {
-			de, _ := DeltaEntryFromBytes(buf)
+			de, err := DeltaEntryFromBytes(buf)
+			if err != nil {
+				continue
+			}
 
 			ok, err := ls.cache.HasPackfile(de.Location.Packfile)
 			if err != nil || !ok {
@@ -758,6 +918,50 @@ func (ls *LocalState) ListObjectsOfType(Type resources.Type) iter.Seq2[DeltaEntr
 	}
 }
 
+// ListLiveObjectsOfType is like ListObjectsOfType but also skips the
+// entries located in a packfile that was tombstoned by a maintenance, along
+// with the headers and signatures of the deleted snapshots.
+func (ls *LocalState) ListLiveObjectsOfType(Type resources.Type) iter.Seq2[DeltaEntry, error] {
+	return func(yield func(DeltaEntry, error) bool) {
+		for de, err := range ls.ListObjectsOfType(Type) {
+			if err != nil {
+				if !yield(DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+
+			deleted, err := ls.HasDeletedResource(resources.RT_PACKFILE, de.Location.Packfile)
+			if err != nil {
+				if !yield(DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+			if deleted {
+				continue
+			}
+
+			if Type == resources.RT_SNAPSHOT || Type == resources.RT_SIGNATURE {
+				deleted, err := ls.HasDeletedResource(resources.RT_SNAPSHOT, de.Blob)
+				if err != nil {
+					if !yield(DeltaEntry{}, err) {
+						return
+					}
+					continue
+				}
+				if deleted {
+					continue
+				}
+			}
+
+			if !yield(de, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (ls *LocalState) ListOrphanDeltas() iter.Seq2[DeltaEntry, error] {
 	return func(yield func(DeltaEntry, error) bool) {
 		for _, buf := range ls.cache.GetDeltas() {
@@ -785,6 +989,30 @@ func (ls *LocalState) ListOrphanDeltas() iter.Seq2[DeltaEntry, error] {
 	}
 }
 
+// ListPackfileDeltas yields the delta entries locating a blob in packfile,
+// whether or not the packfile is still part of the state.
+func (ls *LocalState) ListPackfileDeltas(packfile objects.MAC) iter.Seq2[DeltaEntry, error] {
+	return func(yield func(DeltaEntry, error) bool) {
+		for _, buf := range ls.cache.GetDeltas() {
+			de, err := DeltaEntryFromBytes(buf)
+			if err != nil {
+				if !yield(DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+
+			if de.Location.Packfile != packfile {
+				continue
+			}
+
+			if !yield(de, nil) {
+				return
+			}
+		}
+	}
+}
+
 func (ls *LocalState) DeleteResource(rtype resources.Type, resource objects.MAC) error {
 	de := DeletedEntry{
 		Type: rtype,
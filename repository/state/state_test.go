@@ -0,0 +1,451 @@
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	managers := map[string]func(t *testing.T) *caching.Manager{
+		"leveldb": func(t *testing.T) *caching.Manager { return caching.NewManager(t.TempDir()) },
+		"memory":  func(t *testing.T) *caching.Manager { return caching.NewMemoryManager() },
+	}
+
+	for name, newManager := range managers {
+		t.Run(name, func(t *testing.T) {
+			manager := newManager(t)
+			defer manager.Close()
+
+			src, err := manager.Scan(objects.MAC{0xaa})
+			require.NoError(t, err)
+			defer src.Close()
+
+			st := NewLocalState(src)
+			stateID := objects.MAC{0xbb}
+			packfile := objects.MAC{0xcc}
+			deltas := []DeltaEntry{
+				{Type: resources.RT_CHUNK, Blob: objects.MAC{1}, Location: Location{Packfile: packfile, Offset: 0, Length: 10}},
+				{Type: resources.RT_CHUNK, Blob: objects.MAC{2}, Location: Location{Packfile: packfile, Offset: 10, Length: 20}},
+				{Type: resources.RT_OBJECT, Blob: objects.MAC{3}, Location: Location{Packfile: packfile, Offset: 30, Length: 5}},
+			}
+			for i := range deltas {
+				deltas[i].Version = versioning.GetCurrentVersion(deltas[i].Type)
+				require.NoError(t, st.PutDelta(&deltas[i]))
+			}
+			require.NoError(t, st.PutPackfile(stateID, packfile))
+			require.NoError(t, st.DeleteResource(resources.RT_SNAPSHOT, objects.MAC{4}))
+			require.NoError(t, st.SetConfiguration("key", []byte("value")))
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, st.SerializeToStream(buf))
+
+			dst, err := manager.Repository(uuid.New())
+			require.NoError(t, err)
+			loaded, err := FromStream(versioning.GetCurrentVersion(resources.RT_STATE), buf, dst)
+			require.NoError(t, err)
+
+			require.Equal(t, st.Metadata.Serial, loaded.Metadata.Serial)
+			require.Equal(t, st.Metadata.Timestamp.UnixNano(), loaded.Metadata.Timestamp.UnixNano())
+
+			for _, de := range deltas {
+				got, exists, err := loaded.GetDeltaForBlob(de.Type, de.Blob)
+				require.NoError(t, err)
+				require.True(t, exists)
+				require.Equal(t, de, got)
+			}
+			_, exists, err := loaded.GetDeltaForBlob(resources.RT_OBJECT, objects.MAC{1})
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			var packfiles []objects.MAC
+			for mac := range loaded.ListPackfiles() {
+				packfiles = append(packfiles, mac)
+			}
+			require.Equal(t, []objects.MAC{packfile}, packfiles)
+
+			deleted, err := loaded.HasDeletedResource(resources.RT_SNAPSHOT, objects.MAC{4})
+			require.NoError(t, err)
+			require.True(t, deleted)
+
+			value, err := dst.GetConfiguration("key")
+			require.NoError(t, err)
+			ce, err := ConfigurationEntryFromBytes(value)
+			require.NoError(t, err)
+			require.Equal(t, []byte("value"), ce.Value)
+		})
+	}
+}
+
+var errShortWrite = errors.New("short write")
+
+// failingWriter accepts at most n bytes and then fails every write.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		written := w.n
+		w.n = 0
+		return written, errShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestSerializeToStreamWriteError(t *testing.T) {
+	manager := caching.NewMemoryManager()
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	st := NewLocalState(cache)
+	de := DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     objects.MAC{1},
+		Location: Location{Packfile: objects.MAC{0xcc}, Length: 10},
+	}
+	require.NoError(t, st.PutDelta(&de))
+	require.NoError(t, st.PutPackfile(objects.MAC{0xbb}, objects.MAC{0xcc}))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, st.SerializeToStream(buf))
+	size := buf.Len()
+
+	err = st.SerializeToStream(&failingWriter{n: 0})
+	require.ErrorIs(t, err, errShortWrite)
+	require.EqualError(t, err, "failed to write delta entry type: short write")
+
+	// type and length are written, the entry itself fails
+	err = st.SerializeToStream(&failingWriter{n: 1 + 4})
+	require.ErrorIs(t, err, errShortWrite)
+	require.EqualError(t, err, "failed to write delta entry: short write")
+
+	for n := 0; n < size; n++ {
+		err := st.SerializeToStream(&failingWriter{n: n})
+		require.ErrorIs(t, err, errShortWrite, "writer failing after %d bytes", n)
+	}
+	require.NoError(t, st.SerializeToStream(&failingWriter{n: size}))
+}
+
+func TestVerifyCache(t *testing.T) {
+	manager := caching.NewManager(t.TempDir())
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	st := NewLocalState(cache)
+	packfile := objects.MAC{0xcc}
+	for i := byte(1); i <= 3; i++ {
+		de := DeltaEntry{
+			Type:     resources.RT_CHUNK,
+			Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+			Blob:     objects.MAC{i},
+			Location: Location{Packfile: packfile, Length: 10},
+		}
+		require.NoError(t, st.PutDelta(&de))
+	}
+
+	problems, err := cache.Verify(DecodeDeltaKey)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// a truncated value and a value recorded under the wrong blob
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, objects.MAC{4}, packfile, []byte{0x01}))
+	misplaced := DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     objects.MAC{6},
+		Location: Location{Packfile: packfile, Length: 10},
+	}
+	require.NoError(t, cache.PutDelta(resources.RT_CHUNK, objects.MAC{5}, packfile, misplaced.ToBytes()))
+
+	problems, err = cache.Verify(DecodeDeltaKey)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	require.Contains(t, problems[0].Error(), "failed to decode entry")
+	require.Contains(t, problems[1].Error(), fmt.Sprintf("entry has blob %x", objects.MAC{6}))
+}
+
+func TestCountByType(t *testing.T) {
+	manager := caching.NewMemoryManager()
+	defer manager.Close()
+
+	src, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	st := NewLocalState(src)
+	packfile := objects.MAC{0xcc}
+	types := []resources.Type{
+		resources.RT_CHUNK, resources.RT_CHUNK, resources.RT_CHUNK,
+		resources.RT_OBJECT, resources.RT_OBJECT,
+		resources.RT_VFS_ENTRY,
+	}
+	for i, Type := range types {
+		de := DeltaEntry{
+			Type:     Type,
+			Version:  versioning.FromString("1.0.0"),
+			Blob:     objects.MAC{byte(i)},
+			Location: Location{Packfile: packfile, Length: 10},
+		}
+		require.NoError(t, st.PutDelta(&de))
+		// putting the same entry again doesn't count it twice
+		require.NoError(t, st.PutDelta(&de))
+	}
+	require.NoError(t, st.PutPackfile(objects.MAC{0xbb}, packfile))
+
+	// the same chunk in another packfile is another entry
+	de := DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     objects.MAC{0},
+		Location: Location{Packfile: objects.MAC{0xdd}, Length: 10},
+	}
+	require.NoError(t, st.PutDelta(&de))
+
+	expected := map[resources.Type]uint64{
+		resources.RT_CHUNK:     4,
+		resources.RT_OBJECT:    2,
+		resources.RT_VFS_ENTRY: 1,
+		resources.RT_SNAPSHOT:  0,
+	}
+	for Type, count := range expected {
+		n, err := st.CountByType(Type)
+		require.NoError(t, err)
+		require.Equal(t, count, n, Type)
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, st.SerializeToStream(buf))
+
+	dst, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	loaded, err := FromStream(versioning.GetCurrentVersion(resources.RT_STATE), buf, dst)
+	require.NoError(t, err)
+	for Type, count := range expected {
+		n, err := loaded.CountByType(Type)
+		require.NoError(t, err)
+		require.Equal(t, count, n, Type)
+	}
+
+	// removing an entry, twice, only decrements once
+	require.NoError(t, loaded.DelDelta(resources.RT_CHUNK, objects.MAC{0}, objects.MAC{0xdd}))
+	require.NoError(t, loaded.DelDelta(resources.RT_CHUNK, objects.MAC{0}, objects.MAC{0xdd}))
+	n, err := loaded.CountByType(resources.RT_CHUNK)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), n)
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	de := DeltaEntry{Type: resources.RT_CHUNK, Blob: objects.MAC{1}, Location: Location{Packfile: objects.MAC{2}, Length: 10}}
+	pe := PackfileEntry{Packfile: objects.MAC{2}, StateID: objects.MAC{3}}
+	deleted := DeletedEntry{Type: resources.RT_SNAPSHOT, Blob: objects.MAC{4}}
+	ce := ConfigurationEntry{Key: "key", Value: []byte("value")}
+
+	decoders := map[string]struct {
+		buf    []byte
+		decode func([]byte) error
+	}{
+		"delta":         {de.ToBytes(), func(buf []byte) error { _, err := DeltaEntryFromBytes(buf); return err }},
+		"packfile":      {pe.ToBytes(), func(buf []byte) error { _, err := PackfileEntryFromBytes(buf); return err }},
+		"deleted":       {deleted.ToBytes(), func(buf []byte) error { _, err := DeletedEntryFromBytes(buf); return err }},
+		"configuration": {ce.ToBytes(), func(buf []byte) error { _, err := ConfigurationEntryFromBytes(buf); return err }},
+	}
+	for name, decoder := range decoders {
+		require.NoError(t, decoder.decode(decoder.buf), name)
+		for i := range decoder.buf {
+			require.NotPanics(t, func() {
+				require.Error(t, decoder.decode(decoder.buf[:i]), "%s truncated at %d", name, i)
+			})
+		}
+	}
+}
+
+func TestFromStreamCorruptConfiguration(t *testing.T) {
+	manager := caching.NewMemoryManager()
+	defer manager.Close()
+
+	src, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+
+	st := NewLocalState(src)
+	require.NoError(t, st.SetConfiguration("key", []byte("value")))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, st.SerializeToStream(buf))
+
+	// claim a value longer than the entry holds
+	data := buf.Bytes()
+	pos := bytes.Index(data, []byte("key")) + len("key")
+	data[pos], data[pos+1] = 0xff, 0xff
+
+	dst, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	require.NotPanics(t, func() {
+		_, err = FromStream(versioning.GetCurrentVersion(resources.RT_STATE), bytes.NewReader(data), dst)
+	})
+	require.ErrorContains(t, err, "failed to deserialize configuration entry")
+}
+
+// countingCache counts the lookups of deltas that reach the cache.
+type countingCache struct {
+	caching.StateCache
+	reads atomic.Int64
+}
+
+func (c *countingCache) GetDelta(blobType resources.Type, blobCsum objects.MAC) iter.Seq2[objects.MAC, []byte] {
+	c.reads.Add(1)
+	return c.StateCache.GetDelta(blobType, blobCsum)
+}
+
+func blobMAC(i int) objects.MAC {
+	return objects.MAC(sha256.Sum256([]byte(fmt.Sprintf("blob %d", i))))
+}
+
+func putChunks(t testing.TB, st *LocalState, from, to int) {
+	packfile := objects.MAC{0xcc}
+	for i := from; i < to; i++ {
+		de := DeltaEntry{
+			Type:     resources.RT_CHUNK,
+			Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+			Blob:     blobMAC(i),
+			Location: Location{Packfile: packfile, Length: 10},
+		}
+		require.NoError(t, st.PutDelta(&de))
+	}
+	require.NoError(t, st.PutPackfile(objects.MAC{0xbb}, packfile))
+}
+
+func TestBlobExistsFilter(t *testing.T) {
+	manager := caching.NewManager(t.TempDir())
+	defer manager.Close()
+
+	src, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	cache := &countingCache{StateCache: src}
+	st := NewLocalState(cache)
+
+	// blobs put before the filter is built are loaded from the cache,
+	// those put after are added to it.
+	putChunks(t, st, 0, 1000)
+	require.False(t, st.BlobExists(resources.RT_OBJECT, blobMAC(0)))
+	putChunks(t, st, 1000, 2000)
+	for i := 0; i < 2000; i++ {
+		require.True(t, st.BlobExists(resources.RT_CHUNK, blobMAC(i)), i)
+	}
+
+	cache.reads.Store(0)
+	for i := 2000; i < 3000; i++ {
+		require.False(t, st.BlobExists(resources.RT_CHUNK, blobMAC(i)), i)
+	}
+	require.Less(t, cache.reads.Load(), int64(50))
+
+	// a state loaded from a stream has no false negatives either
+	buf := &bytes.Buffer{}
+	require.NoError(t, st.SerializeToStream(buf))
+	dst, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	loaded, err := FromStream(versioning.GetCurrentVersion(resources.RT_STATE), buf, dst)
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		require.True(t, loaded.BlobExists(resources.RT_CHUNK, blobMAC(i)), i)
+	}
+}
+
+func TestBlobExistsFilterRebuild(t *testing.T) {
+	manager := caching.NewMemoryManager()
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	st := NewLocalState(cache)
+
+	require.False(t, st.BlobExists(resources.RT_CHUNK, blobMAC(0)))
+	filter := st.filter
+	putChunks(t, st, 0, bloomMinCapacity+1)
+	require.True(t, st.BlobExists(resources.RT_CHUNK, blobMAC(0)))
+	require.NotSame(t, filter, st.filter)
+	require.Greater(t, st.filter.capacity, uint64(bloomMinCapacity))
+	for i := 0; i < bloomMinCapacity+1; i++ {
+		require.True(t, st.filter.mayContain(resources.RT_CHUNK, blobMAC(i)), i)
+	}
+}
+
+// TestBlobExistsFilterConcurrent writes deltas while lookups rebuild the
+// filter and checks that a blob is found as soon as its delta is written.
+func TestBlobExistsFilterConcurrent(t *testing.T) {
+	manager := caching.NewMemoryManager()
+	defer manager.Close()
+
+	cache, err := manager.Repository(uuid.New())
+	require.NoError(t, err)
+	st := NewLocalState(cache)
+	require.NoError(t, st.PutPackfile(objects.MAC{0xbb}, objects.MAC{0xcc}))
+	require.False(t, st.BlobExists(resources.RT_CHUNK, blobMAC(-1)))
+
+	const writers, count = 4, 2*bloomMinCapacity + 1000
+	var missing atomic.Int64
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < count; i += writers {
+				de := DeltaEntry{
+					Type:     resources.RT_CHUNK,
+					Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+					Blob:     blobMAC(i),
+					Location: Location{Packfile: objects.MAC{0xcc}, Length: 10},
+				}
+				if err := st.PutDelta(&de); err != nil {
+					missing.Add(1)
+				} else if !st.BlobExists(resources.RT_CHUNK, blobMAC(i)) {
+					missing.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, missing.Load())
+	for i := 0; i < count; i++ {
+		require.True(t, st.BlobExists(resources.RT_CHUNK, blobMAC(i)), i)
+	}
+}
+
+// BenchmarkBlobExistsNew probes a state for blobs it doesn't hold, as a
+// backup of mostly new data does, and reports the lookups reaching the
+// cache.
+func BenchmarkBlobExistsNew(b *testing.B) {
+	manager := caching.NewManager(b.TempDir())
+	defer manager.Close()
+
+	src, err := manager.Repository(uuid.New())
+	require.NoError(b, err)
+	cache := &countingCache{StateCache: src}
+	st := NewLocalState(cache)
+	putChunks(b, st, 0, 100000)
+	st.BlobExists(resources.RT_CHUNK, blobMAC(0))
+
+	cache.reads.Store(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		st.BlobExists(resources.RT_CHUNK, blobMAC(100000+i))
+	}
+	b.ReportMetric(float64(cache.reads.Load())/float64(b.N), "reads/op")
+}
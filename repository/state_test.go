@@ -0,0 +1,89 @@
+package repository_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/stretchr/testify/require"
+)
+
+// States go through the same encoding as the blobs of the packfiles: they
+// are compressed, then encrypted when the repository is.
+func TestStateEncryption(t *testing.T) {
+	files := []ptesting.MockFile{
+		ptesting.NewMockFile("dummy.txt", 0644, "hello dummy"),
+	}
+	opts := &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}
+
+	for name, encrypted := range map[string]bool{"cleartext": false, "encrypted": true} {
+		t.Run(name, func(t *testing.T) {
+			var snap *snapshot.Snapshot
+			if encrypted {
+				snap = ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), files, opts)
+			} else {
+				snap = ptesting.GenerateSnapshot(t, nil, nil, nil, files)
+			}
+			defer snap.Close()
+			repo := snap.Repository()
+
+			cache, err := repo.AppContext().GetCache().Scan(objects.RandomMAC())
+			require.NoError(t, err)
+			defer cache.Close()
+
+			st := repo.NewStateDelta(cache)
+			de := state.DeltaEntry{
+				Type:     resources.RT_CHUNK,
+				Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+				Blob:     objects.MAC{0xde, 0xad, 0xbe, 0xef},
+				Location: state.Location{Packfile: objects.MAC{0xcc}, Length: 10},
+			}
+			require.NoError(t, st.PutDelta(&de))
+
+			serialized := &bytes.Buffer{}
+			require.NoError(t, st.SerializeToStream(serialized))
+
+			stateID := objects.RandomMAC()
+			require.NoError(t, repo.PutState(stateID, bytes.NewReader(serialized.Bytes())))
+
+			// without the key, only the compression can be undone
+			rd, err := repo.Store().GetState(stateID)
+			require.NoError(t, err)
+			_, rd, err = storage.Deserialize(repo.GetMACHasher(), resources.RT_STATE, rd)
+			require.NoError(t, err)
+			rd, err = compression.InflateStream(repo.Configuration().Compression.Algorithm, rd)
+			if encrypted {
+				if err == nil {
+					data, _ := io.ReadAll(rd)
+					require.NotEqual(t, serialized.Bytes(), data)
+				}
+			} else {
+				require.NoError(t, err)
+				data, err := io.ReadAll(rd)
+				require.NoError(t, err)
+				require.Equal(t, serialized.Bytes(), data)
+			}
+
+			version, rd, err := repo.GetState(stateID)
+			require.NoError(t, err)
+
+			loadedCache, err := repo.AppContext().GetCache().Scan(objects.RandomMAC())
+			require.NoError(t, err)
+			defer loadedCache.Close()
+			loaded, err := state.FromStream(version, rd, loadedCache)
+			require.NoError(t, err)
+
+			reserialized := &bytes.Buffer{}
+			require.NoError(t, loaded.SerializeToStream(reserialized))
+			require.Equal(t, serialized.Bytes(), reserialized.Bytes())
+		})
+	}
+}
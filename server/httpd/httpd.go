@@ -319,27 +319,34 @@ func deleteLock(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Server(repo *repository.Repository, addr string, noDelete bool) error {
+// Handler returns the handler serving the store of repo over HTTP, the
+// protocol spoken by the http storage backend.
+func Handler(repo *repository.Repository, noDelete bool) http.Handler {
 	lNoDelete = noDelete
 	store = repo.Store()
 
-	http.HandleFunc("GET /", openRepository)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", openRepository)
+
+	mux.HandleFunc("GET /states", getStates)
+	mux.HandleFunc("PUT /state", putState)
+	mux.HandleFunc("GET /state", getState)
+	mux.HandleFunc("DELETE /state", deleteState)
 
-	http.HandleFunc("GET /states", getStates)
-	http.HandleFunc("PUT /state", putState)
-	http.HandleFunc("GET /state", getState)
-	http.HandleFunc("DELETE /state", deleteState)
+	mux.HandleFunc("GET /packfiles", getPackfiles)
+	mux.HandleFunc("PUT /packfile", putPackfile)
+	mux.HandleFunc("GET /packfile", getPackfile)
+	mux.HandleFunc("GET /packfile/blob", GetPackfileBlob)
+	mux.HandleFunc("DELETE /packfile", deletePackfile)
 
-	http.HandleFunc("GET /packfiles", getPackfiles)
-	http.HandleFunc("PUT /packfile", putPackfile)
-	http.HandleFunc("GET /packfile", getPackfile)
-	http.HandleFunc("GET /packfile/blob", GetPackfileBlob)
-	http.HandleFunc("DELETE /packfile", deletePackfile)
+	mux.HandleFunc("GET /locks", getLocks)
+	mux.HandleFunc("PUT /lock", putLock)
+	mux.HandleFunc("GET /lock", getLock)
+	mux.HandleFunc("DELETE /lock", deleteLock)
 
-	http.HandleFunc("GET /locks", getLocks)
-	http.HandleFunc("PUT /lock", putLock)
-	http.HandleFunc("GET /lock", getLock)
-	http.HandleFunc("DELETE /lock", deleteLock)
+	return mux
+}
 
-	return http.ListenAndServe(addr, nil)
+func Server(repo *repository.Repository, addr string, noDelete bool) error {
+	return http.ListenAndServe(addr, Handler(repo, noDelete))
 }
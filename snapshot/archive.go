@@ -20,6 +20,7 @@ const (
 	ArchiveTar     ArchiveFormat = "tar"
 	ArchiveTarball               = "tarball"
 	ArchiveZip                   = "zip"
+	ArchiveConcat                = "concat"
 )
 
 var (
@@ -28,6 +29,10 @@ var (
 )
 
 func (snap *Snapshot) Archive(w io.Writer, format ArchiveFormat, paths []string, rebase bool) error {
+	if format == ArchiveConcat {
+		return snap.ArchiveConcat(w, paths, rebase)
+	}
+
 	fsc, err := snap.Filesystem()
 	if err != nil {
 		return err
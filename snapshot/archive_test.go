@@ -2,11 +2,13 @@ package snapshot_test
 
 import (
 	"bytes"
+	"io"
 	"strings"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,3 +40,59 @@ func TestArchive(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestArchiveConcat(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/a.txt", 0644, "first file"),
+		ptesting.NewMockFile("subdir/b.txt", 0644, "the middle file"),
+		ptesting.NewMockFile("subdir/c.txt", 0644, "last"),
+	})
+	defer snap.Close()
+
+	var root string
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	for pathname, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if strings.HasSuffix(pathname, "/subdir") {
+			root = pathname
+		}
+	}
+	require.NotEmpty(t, root)
+
+	bufOut := bytes.NewBuffer(nil)
+	err = snap.Archive(bufOut, snapshot.ArchiveConcat, []string{root}, true)
+	require.NoError(t, err)
+
+	// the output must be deterministic
+	bufOut2 := bytes.NewBuffer(nil)
+	err = snap.Archive(bufOut2, snapshot.ArchiveConcat, []string{root}, true)
+	require.NoError(t, err)
+	require.Equal(t, bufOut.Bytes(), bufOut2.Bytes())
+
+	rd, err := snapshot.NewConcatReader(bytes.NewReader(bufOut.Bytes()))
+	require.NoError(t, err)
+
+	entries := rd.Entries()
+	require.Len(t, entries, 3)
+	require.Equal(t, "a.txt", entries[0].Path)
+	require.Equal(t, "b.txt", entries[1].Path)
+	require.Equal(t, "c.txt", entries[2].Path)
+
+	fp, err := rd.Open("b.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(fp)
+	require.NoError(t, err)
+	require.Equal(t, "the middle file", string(content))
+
+	_, err = rd.Open("missing.txt")
+	require.Error(t, err)
+}
+
+func TestConcatReaderHugeCount(t *testing.T) {
+	// a stream announcing 4 billion entries without holding them
+	stream := []byte("PLKCAT01\xff\xff\xff\xff")
+	_, err := snapshot.NewConcatReader(bytes.NewReader(stream))
+	require.ErrorIs(t, err, io.EOF)
+}
@@ -18,7 +18,9 @@ import (
 	"github.com/PlakarKorp/plakar/caching"
 	"github.com/PlakarKorp/plakar/classifier"
 	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/iterator"
 	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
 	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/header"
@@ -50,8 +52,58 @@ type BackupOptions struct {
 	Name           string
 	Tags           []string
 	Excludes       []glob.Glob
+
+	// ExcludeList holds gitignore-style patterns matched against the
+	// pathnames relative to the root of the importer.
+	ExcludeList *ExcludeList
+
+	// Cleartext lists the patterns of the files whose chunks are stored
+	// compressed but not encrypted, so that anyone with access to the
+	// repository storage can read their content.  It is meant for public
+	// data that isn't worth the cost of encryption.
+	Cleartext []glob.Glob
+
+	// Resume makes the backup checkpoint its progress: the state of the
+	// packfiles written so far is pushed to the repository every
+	// checkpointInterval and when the backup is interrupted, so that
+	// running it again skips the files that were already stored.
+	Resume bool
+
+	// Deterministic packs the blobs in a canonical order, so that backing
+	// up the same content on the same day into repositories sharing the
+	// same configuration, with a MaxConcurrency of 1, produces the same
+	// packfiles, except for the one holding the snapshot header.  With
+	// more workers, the order in which files are processed still changes
+	// which blobs end up in which packfile.  Packfiles are dated from the
+	// start of the day, which maintenance must be given a grace period of
+	// more than a day to cope with.  Packfiles of encrypted repositories
+	// still differ as the encryption is randomized.
+	Deterministic bool
+
+	// ForceLock breaks the locks of the other writers instead of failing
+	// when the repository is already locked.
+	ForceLock bool
+
+	// SkipIfUnchanged doesn't commit the snapshot when the entries at and
+	// below the importer root, their extended attributes and the errors
+	// are the same as in the latest snapshot of the source, Backup
+	// returning ErrUnchanged instead.  The parents of the root are not
+	// compared.  The data written by the backup is then left for
+	// maintenance to reclaim.
+	SkipIfUnchanged bool
 }
 
+// checkpointInterval is how often a resumable backup pushes its state.
+const checkpointInterval = 5 * time.Minute
+
+// flushPackfiles and flushBytes bound the packfiles a backup writes before
+// pushing their state, so that a crash doesn't lose more than that: the
+// next run finds the blobs they hold and doesn't store them again.
+const (
+	flushPackfiles = 64
+	flushBytes     = 1 << 30
+)
+
 func (bc *BackupContext) recordEntry(entry *vfs.Entry) error {
 	path := entry.Path()
 
@@ -86,11 +138,13 @@ func (bc *BackupContext) recordXattr(record *importer.ScanRecord, objectMAC obje
 	return bc.xattridx.Insert(xattr.ToPath(), serialized)
 }
 
-func (snapshot *Snapshot) skipExcludedPathname(options *BackupOptions, record *importer.ScanResult) bool {
+func (snapshot *Snapshot) skipExcludedPathname(options *BackupOptions, root string, record *importer.ScanResult) bool {
 	var pathname string
+	var isDir bool
 	switch {
 	case record.Record != nil:
 		pathname = record.Record.Pathname
+		isDir = record.Record.FileInfo.IsDir()
 	case record.Error != nil:
 		pathname = record.Error.Pathname
 	}
@@ -99,6 +153,14 @@ func (snapshot *Snapshot) skipExcludedPathname(options *BackupOptions, record *i
 		return false
 	}
 
+	if options.ExcludeList != nil {
+		prefix := strings.TrimSuffix(root, "/") + "/"
+		if strings.HasPrefix(pathname, prefix) &&
+			options.ExcludeList.Match(strings.TrimPrefix(pathname, prefix), isDir) {
+			return true
+		}
+	}
+
 	doExclude := false
 	for _, exclude := range options.Excludes {
 		if exclude.Match(pathname) {
@@ -110,8 +172,11 @@ func (snapshot *Snapshot) skipExcludedPathname(options *BackupOptions, record *i
 }
 
 func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptions) (chan *importer.ScanRecord, error) {
+	span := snap.span.Start("scan")
 	scanner, err := backupCtx.imp.Scan()
 	if err != nil {
+		span.SetError(err)
+		span.End()
 		return nil, err
 	}
 
@@ -134,7 +199,7 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 			if backupCtx.aborted.Load() {
 				break
 			}
-			if snap.skipExcludedPathname(options, _record) {
+			if snap.skipExcludedPathname(options, backupCtx.imp.Root(), _record) {
 				continue
 			}
 
@@ -200,6 +265,11 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *BackupOptio
 		doneEvent.NumDirectories = nDirectories
 		doneEvent.Size = size
 		snap.Event(doneEvent)
+
+		span.SetInt("files", int64(nFiles))
+		span.SetInt("directories", int64(nDirectories))
+		span.SetInt("bytes", int64(size))
+		span.End()
 	}()
 
 	return filesChannel, nil
@@ -234,66 +304,212 @@ func (snap *Snapshot) flushDeltaState(bc *BackupContext) {
 			close(bc.flushEnded)
 			return
 		case <-bc.flushTick.C:
-			// Take the write lock to be able to swap the pointers
-			snap.deltaMtx.Lock()
-			oldState := snap.deltaState
-			oldCache := snap.deltaCache
-			oldStateId := bc.stateId
+			snap.pushDeltaState(bc)
+		case <-snap.flushRequest:
+			snap.pushDeltaState(bc)
+		}
+	}
+}
 
-			// Now make a new state backed by a new cache.
-			identifier := objects.RandomMAC()
+// pushDeltaState swaps the state of the backup for a new one and pushes
+// the former to the repository while the backup goes on.
+func (snap *Snapshot) pushDeltaState(bc *BackupContext) {
+	// Take the write lock to be able to swap the pointers
+	snap.deltaMtx.Lock()
+	oldState := snap.deltaState
+	oldCache := snap.deltaCache
+	oldStateId := bc.stateId
 
-			deltaCache, err := snap.repository.AppContext().GetCache().Scan(identifier)
-			if err != nil {
-				// XXX: ERROR HANDLING
-				snap.deltaMtx.Unlock()
-				snap.Logger().Warn("Failed to open deltaCache %s\n", err)
-				break
-			}
+	// Now make a new state backed by a new cache.
+	identifier := objects.RandomMAC()
 
-			bc.stateId = identifier
-			snap.deltaCache = deltaCache
-			snap.deltaState = snap.repository.NewStateDelta(deltaCache)
-			snap.deltaMtx.Unlock()
+	deltaCache, err := snap.repository.AppContext().GetCache().Scan(identifier)
+	if err != nil {
+		// XXX: ERROR HANDLING
+		snap.deltaMtx.Unlock()
+		snap.Logger().Warn("Failed to open deltaCache %s\n", err)
+		return
+	}
 
-			// Now that the backup is free to progress we can serialize and push
-			// the resulting statefile to the repo.
-			stateDeltaStream := buildSerializedDeltaState(oldState)
-			err = snap.repository.PutState(oldStateId, stateDeltaStream)
-			if err != nil {
-				// XXX: ERROR HANDLING
-				snap.Logger().Warn("Failed to push the state to the repository %s", err)
-			}
+	bc.stateId = identifier
+	snap.deltaCache = deltaCache
+	snap.deltaState = snap.repository.NewStateDelta(deltaCache)
+	snap.unflushedPackfiles.Store(0)
+	snap.unflushedBytes.Store(0)
+	snap.deltaMtx.Unlock()
+
+	// Now that the backup is free to progress we can serialize and push
+	// the resulting statefile to the repo.
+	stateDeltaStream := buildSerializedDeltaState(oldState)
+	err = snap.repository.PutState(oldStateId, stateDeltaStream)
+	if err != nil {
+		// XXX: ERROR HANDLING
+		snap.Logger().Warn("Failed to push the state to the repository %s", err)
+	}
 
-			// We inserted deltas during the process in our aggregated state, we
-			// also need to publish the state so that rebuild doesn't pickit up on
-			// next run.
-			err = snap.repository.PutStateState(bc.stateId)
-			if err != nil {
-				snap.Logger().Warn("Failed to push the state to the local state %s", err)
-			}
+	// We inserted deltas during the process in our aggregated state, we
+	// also need to publish the state so that rebuild doesn't pickit up on
+	// next run.
+	err = snap.repository.PutStateState(bc.stateId)
+	if err != nil {
+		snap.Logger().Warn("Failed to push the state to the local state %s", err)
+	}
 
-			// The first cache is always the scanCache, only in this function we
-			// allocate a new and different one, so when we first hit this function
-			// do not close the deltaCache, as it'll be closed at the end of the
-			// backup because it's used by other parts of the code.
-			if oldCache != snap.scanCache {
-				oldCache.Close()
-			}
+	// The first cache is always the scanCache, only in this function we
+	// allocate a new and different one, so when we first hit this function
+	// do not close the deltaCache, as it'll be closed at the end of the
+	// backup because it's used by other parts of the code.
+	if oldCache != snap.scanCache {
+		oldCache.Close()
+	}
+}
+
+// checkpoint stops an interrupted backup: the files being processed are
+// completed, their packfiles written and the resulting state pushed to the
+// repository, so that a later run finds their objects and chunks.
+func (snap *Snapshot) checkpoint(bc *BackupContext, filesChannel chan *importer.ScanRecord, wg *sync.WaitGroup) {
+	bc.aborted.Store(true)
+	go func() {
+		// unblock the importer until it notices the abort
+		for range filesChannel {
+		}
+	}()
+
+	wg.Wait()
+	snap.endFlush(bc)
+}
+
+// endFlush waits for the packfiles being written and pushes the last state
+// of a backup which isn't committed.
+func (snap *Snapshot) endFlush(bc *BackupContext) {
+	bc.flushTick.Stop()
+	snap.packerManager.Wait()
+
+	bc.flushEnd <- true
+	close(bc.flushEnd)
+	<-bc.flushEnded
+}
+
+// latestOfSource returns the header of the most recent snapshot of the same
+// source as snap, or nil if there is none.  Every header is looked up, but
+// those already fetched are read from the cache.
+func (snap *Snapshot) latestOfSource() (*header.Header, error) {
+	source := snap.Header.GetSource(0).Importer
+
+	var latest *header.Header
+	for snapshotID := range snap.repository.ListSnapshots() {
+		if snapshotID == snap.Header.Identifier {
+			continue
 		}
+		hdr, _, err := GetSnapshot(snap.repository, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if hdr.GetSource(0).Importer != source {
+			continue
+		}
+		if latest == nil || hdr.Timestamp.After(latest.Timestamp) {
+			latest = hdr
+		}
+	}
+	return latest, nil
+}
+
+// subtreeMAC returns a MAC of the pathnames and entries at and below root
+// in a VFS index, which unlike the MAC of the index doesn't depend on the
+// parents of root.
+func subtreeMAC[V any](snap *Snapshot, it iterator.Iterator[string, V], root string, entryMAC func(V) objects.MAC) (objects.MAC, error) {
+	root = path.Clean(root)
+	prefix := strings.TrimSuffix(root, "/") + "/"
+
+	hasher := snap.repository.GetMACHasher()
+	for it.Next() {
+		pathname, value := it.Current()
+		if pathname != root && !strings.HasPrefix(pathname, prefix) {
+			continue
+		}
+		mac := entryMAC(value)
+		hasher.Write([]byte(pathname))
+		hasher.Write([]byte{0})
+		hasher.Write(mac[:])
+	}
+	if err := it.Err(); err != nil {
+		return objects.MAC{}, err
+	}
+	return objects.MAC(hasher.Sum(nil)), nil
+}
+
+// unchangedSince reports whether the content of snap at and below the
+// importer root is the same as in the snapshot of header latest.
+func (snap *Snapshot) unchangedSince(latest *header.Header, fileidx *btree.BTree[string, int, []byte]) (bool, error) {
+	previous, current := latest.GetSource(0).VFS, snap.Header.GetSource(0).VFS
+	if previous.Xattrs != current.Xattrs || previous.Errors != current.Errors {
+		return false, nil
+	}
+	if previous.Root == current.Root {
+		return true, nil
+	}
+
+	root := snap.Header.GetSource(0).Importer.Directory
+
+	fsc, err := vfs.NewFilesystem(snap.repository, previous.Root, previous.Xattrs, previous.Errors)
+	if err != nil {
+		return false, err
+	}
+	tree, _, _ := fsc.BTrees()
+	it, err := tree.ScanAll()
+	if err != nil {
+		return false, err
+	}
+	previousMAC, err := subtreeMAC(snap, it, root, func(mac objects.MAC) objects.MAC {
+		return mac
+	})
+	if err != nil {
+		return false, err
+	}
+
+	fileit, err := fileidx.ScanAll()
+	if err != nil {
+		return false, err
+	}
+	currentMAC, err := subtreeMAC(snap, fileit, root, func(serialized []byte) objects.MAC {
+		return snap.repository.ComputeMAC(serialized)
+	})
+	if err != nil {
+		return false, err
 	}
+	return previousMAC == currentMAC, nil
 }
 
-func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) error {
+func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) (err error) {
 	snap.Event(events.StartEvent())
 	defer snap.Event(events.DoneEvent())
 
-	done, err := snap.Lock()
+	snap.span = snap.AppContext().GetTracer().Start("backup")
+	snap.span.SetString("snapshot.id", fmt.Sprintf("%x", snap.Header.Identifier))
+	snap.span.SetString("importer.type", imp.Type())
+	snap.span.SetString("importer.origin", imp.Origin())
+	snap.span.SetString("importer.root", imp.Root())
+	defer func() {
+		snap.span.SetError(err)
+		snap.span.End()
+	}()
+
+	done, err := snap.Lock(options.ForceLock)
 	if err != nil {
 		return err
 	}
 	defer snap.Unlock(done)
 
+	if options.Deterministic {
+		// no blob was queued yet, swap for a manager packing with a
+		// single worker.
+		snap.packerManager.Wait()
+		snap.packerManager = NewPackerManager(snap)
+		snap.packerManager.deterministic = true
+		go snap.packerManager.Run()
+	}
+
 	vfsCache, err := snap.AppContext().GetCache().VFS(snap.repository.Configuration().RepositoryID, imp.Type(), imp.Origin())
 	if err != nil {
 		return err
@@ -321,16 +537,22 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		maxConcurrency = uint64(snap.AppContext().MaxConcurrency)
 	}
 
+	flushInterval := 1 * time.Hour
+	if options.Resume {
+		flushInterval = checkpointInterval
+	}
+
 	backupCtx := &BackupContext{
 		imp:            imp,
 		maxConcurrency: maxConcurrency,
 		scanCache:      snap.scanCache,
-		flushTick:      time.NewTicker(1 * time.Hour),
+		flushTick:      time.NewTicker(flushInterval),
 		flushEnd:       make(chan bool),
 		flushEnded:     make(chan bool),
 		stateId:        snap.Header.Identifier,
 	}
 
+	snap.flushRequest = make(chan struct{}, 1)
 	go snap.flushDeltaState(backupCtx)
 
 	errstore := caching.DBStore[string, []byte]{
@@ -372,10 +594,16 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	concurrencyChan := make(chan struct{}, maxConcurrency)
 
 	/* scanner */
+	chunkSpan := snap.span.Start("chunk")
+	var chunkedFiles, chunkedBytes atomic.Int64
 	scannerWg := sync.WaitGroup{}
 	for _record := range filesChannel {
 		select {
 		case <-snap.AppContext().GetContext().Done():
+			if options.Resume {
+				snap.checkpoint(backupCtx, filesChannel, &scannerWg)
+			}
+			chunkSpan.End()
 			return snap.AppContext().GetContext().Err()
 		default:
 		}
@@ -390,6 +618,10 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 
 			snap.Event(events.FileEvent(snap.Header.Identifier, record.Pathname))
 
+			// shadows the error of Backup, which returns while the
+			// workers of an interrupted backup are still running
+			var err error
+
 			var fileEntry *vfs.Entry
 			var object *objects.Object
 			var objectMAC objects.MAC
@@ -439,11 +671,13 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 			// Chunkify the file if it is a regular file and we don't have a cached object
 			if record.FileInfo.Mode().IsRegular() {
 				if object == nil || !snap.BlobExists(resources.RT_OBJECT, objectMAC) {
-					object, err = snap.chunkify(imp, cf, record)
+					object, err = snap.chunkify(imp, cf, record, isCleartextPathname(options, record))
 					if err != nil {
 						backupCtx.recordError(record.Pathname, err)
 						return
 					}
+					chunkedFiles.Add(1)
+					chunkedBytes.Add(int64(object.Size()))
 					objectSerialized, err = object.Serialize()
 					if err != nil {
 						backupCtx.recordError(record.Pathname, err)
@@ -551,6 +785,12 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		}(_record)
 	}
 	scannerWg.Wait()
+	chunkSpan.SetInt("files", chunkedFiles.Load())
+	chunkSpan.SetInt("bytes", chunkedBytes.Load())
+	chunkSpan.End()
+
+	indexSpan := snap.span.Start("index")
+	defer indexSpan.End()
 
 	errcsum, err := persistMACIndex(snap, backupCtx.erridx,
 		resources.RT_ERROR_BTREE, resources.RT_ERROR_NODE, resources.RT_ERROR_ENTRY)
@@ -570,7 +810,9 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	var rootSummary *vfs.Summary
 
 	diriter := backupCtx.scanCache.EnumerateKeysWithPrefix("__directory__:", true)
+	directories := int64(0)
 	for dirPath, bytes := range diriter {
+		directories++
 		select {
 		case <-snap.AppContext().GetContext().Done():
 			return snap.AppContext().GetContext().Err()
@@ -704,6 +946,8 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		}
 	}
 
+	indexSpan.SetInt("directories", directories)
+
 	// hits, miss, cachesize := fileidx.Stats()
 	// log.Printf("before persist: fileidx: hits/miss/size: %d/%d/%d", hits, miss, cachesize)
 
@@ -737,6 +981,8 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 	// hits, miss, cachesize = ctidx.Stats()
 	// log.Printf("after persist: ctidx: hits/miss/size: %d/%d/%d", hits, miss, cachesize)
 
+	indexSpan.End()
+
 	if backupCtx.aborted.Load() {
 		return backupCtx.abortedReason
 	}
@@ -756,6 +1002,23 @@ func (snap *Snapshot) Backup(imp importer.Importer, options *BackupOptions) erro
 		},
 	}
 
+	if options.SkipIfUnchanged {
+		latest, err := snap.latestOfSource()
+		if err != nil {
+			return err
+		}
+		if latest != nil {
+			unchanged, err := snap.unchangedSince(latest, fileidx)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				snap.endFlush(backupCtx)
+				return ErrUnchanged
+			}
+		}
+	}
+
 	return snap.Commit(backupCtx)
 }
 
@@ -782,7 +1045,18 @@ func entropy(data []byte) (float64, [256]float64) {
 	return entropy, freq
 }
 
-func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier, record *importer.ScanRecord) (*objects.Object, error) {
+// isCleartextPathname reports whether the chunks of the record are to be
+// stored unencrypted.
+func isCleartextPathname(options *BackupOptions, record *importer.ScanRecord) bool {
+	for _, pattern := range options.Cleartext {
+		if pattern.Match(record.Pathname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier, record *importer.ScanRecord, cleartext bool) (*objects.Object, error) {
 	var rd io.ReadCloser
 	var err error
 
@@ -844,10 +1118,26 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 		totalEntropy += chunk.Entropy * float64(len(data))
 		totalDataSize += uint64(len(data))
 
-		return snap.PutBlobIfNotExists(resources.RT_CHUNK, chunk.ContentMAC, data)
+		if snap.BlobExists(resources.RT_CHUNK, chunk.ContentMAC) {
+			return nil
+		}
+		if cleartext {
+			return snap.putBlob(resources.RT_CHUNK, chunk.ContentMAC, data, packfile.FLAG_CLEARTEXT)
+		}
+		return snap.PutBlob(resources.RT_CHUNK, chunk.ContentMAC, data)
 	}
 
-	if record.FileInfo.Size() == 0 {
+	if record.IsXattr {
+		// xattr records carry no size, their value is small enough to be
+		// read at once
+		buf, err := io.ReadAll(rd)
+		if err != nil {
+			return nil, err
+		}
+		if err := processChunk(buf); err != nil {
+			return nil, err
+		}
+	} else if record.FileInfo.Size() == 0 {
 		// Produce an empty chunk for empty file
 		if err := processChunk([]byte{}); err != nil {
 			return nil, err
@@ -895,7 +1185,12 @@ func (snap *Snapshot) chunkify(imp importer.Importer, cf *classifier.Classifier,
 	return object, nil
 }
 
-func (snap *Snapshot) PutPackfile(packer *Packer) error {
+func (snap *Snapshot) PutPackfile(packer *Packer) (err error) {
+	span := snap.span.Start("pack")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
 
 	repo := snap.repository
 
@@ -931,6 +1226,9 @@ func (snap *Snapshot) PutPackfile(packer *Packer) error {
 	serializedPackfile = append(serializedPackfile, encryptedFooterLength...)
 
 	mac := snap.repository.ComputeMAC(serializedPackfile)
+	span.SetString("packfile.mac", fmt.Sprintf("%x", mac))
+	span.SetInt("packfile.blobs", int64(len(packer.Packfile.Index)))
+	span.SetInt("bytes", int64(len(serializedPackfile)))
 
 	repo.Logger().Trace("snapshot", "%x: PutPackfile(%x, ...)", snap.Header.GetIndexShortID(), mac)
 	err = snap.repository.PutPackfile(mac, bytes.NewBuffer(serializedPackfile))
@@ -953,6 +1251,7 @@ func (snap *Snapshot) PutPackfile(packer *Packer) error {
 							Offset:   packer.Packfile.Index[idx].Offset,
 							Length:   packer.Packfile.Index[idx].Length,
 						},
+						Flags: packer.Packfile.Index[idx].Flags,
 					}
 
 					if err := snap.deltaState.PutDelta(delta); err != nil {
@@ -975,10 +1274,28 @@ func (snap *Snapshot) PutPackfile(packer *Packer) error {
 		return err
 	}
 
+	if snap.flushRequest != nil {
+		packfiles := snap.unflushedPackfiles.Add(1)
+		size := snap.unflushedBytes.Add(int64(len(serializedPackfile)))
+		if packfiles >= flushPackfiles || size >= flushBytes {
+			select {
+			case snap.flushRequest <- struct{}{}:
+			default:
+				// a push is already pending
+			}
+		}
+	}
+
 	return nil
 }
 
-func (snap *Snapshot) Commit(bc *BackupContext) error {
+func (snap *Snapshot) Commit(bc *BackupContext) (err error) {
+	span := snap.span.Start("commit")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	// First thing is to stop the ticker, as we don't want any concurrent flushes to run.
 	// Maybe this could be stopped earlier.
 
@@ -988,17 +1305,13 @@ func (snap *Snapshot) Commit(bc *BackupContext) error {
 		bc.flushTick.Stop()
 	}
 
-	serializedHdr, err := snap.Header.Serialize()
-	if err != nil {
+	if err := snap.sign(); err != nil {
 		return err
 	}
 
-	if kp := snap.AppContext().Keypair; kp != nil {
-		serializedHdrMAC := snap.repository.ComputeMAC(serializedHdr)
-		signature := kp.Sign(serializedHdrMAC[:])
-		if err := snap.PutBlob(resources.RT_SIGNATURE, snap.Header.Identifier, signature); err != nil {
-			return err
-		}
+	serializedHdr, err := snap.Header.Serialize()
+	if err != nil {
+		return err
 	}
 
 	if err := snap.PutBlob(resources.RT_SNAPSHOT, snap.Header.Identifier, serializedHdr); err != nil {
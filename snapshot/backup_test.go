@@ -0,0 +1,557 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/appcontext"
+	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/hashing"
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/gobwas/glob"
+	"github.com/stretchr/testify/require"
+)
+
+// readWithoutKey reads a blob straight from the store, only undoing the
+// compression.
+func readWithoutKey(t *testing.T, repo *repository.Repository, mac objects.MAC) (state.DeltaEntry, []byte, error) {
+	packfileMAC, exists, err := repo.GetPackfileForBlob(resources.RT_CHUNK, mac)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	var delta *state.DeltaEntry
+	for de, err := range repo.ListPackfileBlobs(packfileMAC) {
+		require.NoError(t, err)
+		if de.Type == resources.RT_CHUNK && de.Blob == mac {
+			delta = &de
+			break
+		}
+	}
+	require.NotNil(t, delta)
+
+	rd, err := repo.Store().GetPackfileBlob(packfileMAC, delta.Location.Offset+uint64(storage.STORAGE_HEADER_SIZE), delta.Location.Length)
+	require.NoError(t, err)
+
+	rd, err = compression.InflateStream(repo.Configuration().Compression.Algorithm, rd)
+	if err != nil {
+		return *delta, nil, err
+	}
+	data, err := io.ReadAll(rd)
+	return *delta, data, err
+}
+
+func TestBackupCleartext(t *testing.T) {
+	publicContent := strings.Repeat("public package content ", 10)
+	privateContent := strings.Repeat("private document content ", 10)
+
+	snap := ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), []ptesting.MockFile{
+		ptesting.NewMockDir("public"),
+		ptesting.NewMockDir("private"),
+		ptesting.NewMockFile("public/package.txt", 0644, publicContent),
+		ptesting.NewMockFile("private/document.txt", 0644, privateContent),
+	}, &snapshot.BackupOptions{
+		Name:           "test_backup",
+		MaxConcurrency: 1,
+		Cleartext:      []glob.Glob{glob.MustCompile("*/public/*")},
+	})
+	defer snap.Close()
+	repo := snap.Repository()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		content   string
+		cleartext bool
+	}{
+		"package.txt":  {publicContent, true},
+		"document.txt": {privateContent, false},
+	}
+
+	found := 0
+	for e, err := range fs.Files("/") {
+		require.NoError(t, err)
+		test, ok := tests[e.Name()]
+		if !ok {
+			continue
+		}
+		found++
+
+		// both are readable with the key
+		rd, err := snap.NewReader(e.Path())
+		require.NoError(t, err)
+		data, err := io.ReadAll(rd)
+		rd.Close()
+		require.NoError(t, err)
+		require.Equal(t, test.content, string(data))
+
+		require.Len(t, e.ResolvedObject.Chunks, 1)
+		delta, data, err := readWithoutKey(t, repo, e.ResolvedObject.Chunks[0].ContentMAC)
+		if test.cleartext {
+			require.Equal(t, packfile.FLAG_CLEARTEXT, delta.Flags)
+			require.NoError(t, err)
+			require.Equal(t, test.content, string(data))
+		} else {
+			require.Zero(t, delta.Flags)
+			require.NotEqual(t, test.content, string(data))
+		}
+	}
+	require.Equal(t, len(tests), found)
+}
+
+// Cleartext blobs are not authenticated by their encryption, a blob whose
+// content was altered in the store fails to read on its MAC.
+func TestBackupCleartextCorrupted(t *testing.T) {
+	content := strings.Repeat("public package content ", 10)
+
+	snap := ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), []ptesting.MockFile{
+		ptesting.NewMockFile("package.txt", 0644, content),
+	}, &snapshot.BackupOptions{
+		Name:           "test_backup",
+		MaxConcurrency: 1,
+		Cleartext:      []glob.Glob{glob.MustCompile("*/package.txt")},
+	})
+	defer snap.Close()
+	repo := snap.Repository()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	entry, err := fs.GetEntry(filepath.Join(snap.Header.GetSource(0).Importer.Directory, "package.txt"))
+	require.NoError(t, err)
+	require.Len(t, entry.ResolvedObject.Chunks, 1)
+	mac := entry.ResolvedObject.Chunks[0].ContentMAC
+
+	delta, _, err := readWithoutKey(t, repo, mac)
+	require.NoError(t, err)
+	require.Equal(t, packfile.FLAG_CLEARTEXT, delta.Flags)
+
+	// flip a byte of the content, encoded as a valid blob of the same size
+	// so that only the MAC tells
+	tampered := []byte(content)
+	tampered[len(tampered)-1] ^= 0x01
+	rd, err := repo.EncodeCleartext(bytes.NewReader(tampered))
+	require.NoError(t, err)
+	encoded, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Len(t, encoded, int(delta.Location.Length))
+
+	location := strings.TrimPrefix(repo.Location(), "fs://")
+	buckets := bfs.NewBuckets(filepath.Join(location, "packfiles"))
+	packfilePath := buckets.Path(delta.Location.Packfile)
+	fp, err := os.OpenFile(packfilePath, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = fp.WriteAt(encoded, int64(delta.Location.Offset)+int64(storage.STORAGE_HEADER_SIZE))
+	require.NoError(t, err)
+	require.NoError(t, fp.Close())
+
+	_, err = repo.GetBlob(resources.RT_CHUNK, mac)
+	require.ErrorIs(t, err, repository.ErrBlobCorrupted)
+
+	brd, err := repo.GetBlobReader(resources.RT_CHUNK, mac)
+	require.NoError(t, err)
+	_, err = io.ReadAll(brd)
+	require.ErrorIs(t, err, repository.ErrBlobCorrupted)
+	brd.Close()
+}
+
+func TestBackupContentType(t *testing.T) {
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewGray(image.Rect(0, 0, 1, 1))))
+
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockFile("image.png", 0644, img.String()),
+		ptesting.NewMockFile("image", 0644, img.String()),
+		ptesting.NewMockFile("notes.txt", 0644, "some notes"),
+		ptesting.NewMockFile("notes", 0644, "some notes"),
+		// the extension takes precedence over the content
+		ptesting.NewMockFile("image.txt", 0644, img.String()),
+	})
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"image.png": "image/png",
+		"image":     "image/png",
+		"notes.txt": "text/plain; charset=utf-8",
+		"notes":     "text/plain; charset=utf-8",
+		"image.txt": "text/plain; charset=utf-8",
+	}
+
+	found := 0
+	for e, err := range fs.Files("/") {
+		require.NoError(t, err)
+		contentType, ok := expected[e.Name()]
+		if !ok {
+			continue
+		}
+		found++
+		require.Equal(t, contentType, e.ContentType(), e.Name())
+	}
+	require.Equal(t, len(expected), found)
+}
+
+// interruptingImporter cancels the backup once after files have been
+// opened.
+type interruptingImporter struct {
+	importer.Importer
+	after  int32
+	opened atomic.Int32
+	cancel context.CancelFunc
+}
+
+func (imp *interruptingImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if imp.opened.Add(1) == imp.after {
+		imp.cancel()
+	}
+	return imp.Importer.NewReader(pathname)
+}
+
+func countChunks(t *testing.T, repo *repository.Repository) int {
+	require.NoError(t, repo.RebuildState())
+
+	n := 0
+	for _, err := range repo.ListObjectsOfType(resources.RT_CHUNK) {
+		require.NoError(t, err)
+		n++
+	}
+	return n
+}
+
+func TestBackupResume(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	const nfiles = 100
+	tmpBackupDir := t.TempDir()
+	for i := range nfiles {
+		content := strings.Repeat(fmt.Sprintf("content of file %d\n", i), 10)
+		err := os.WriteFile(filepath.Join(tmpBackupDir, fmt.Sprintf("file%03d.txt", i)), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+
+	chunksBefore := countChunks(t, repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo.AppContext().SetContext(ctx)
+	defer repo.AppContext().SetContext(context.Background())
+
+	fsImporter, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	imp := &interruptingImporter{Importer: fsImporter, after: 80, cancel: cancel}
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "interrupted", MaxConcurrency: 1, Resume: true})
+	require.ErrorIs(t, err, context.Canceled)
+	snap.Close()
+
+	// the progress was pushed to the repository
+	states, err := repo.GetStates()
+	require.NoError(t, err)
+	require.Contains(t, states, snap.Header.Identifier)
+
+	chunksInterrupted := countChunks(t, repo)
+	require.GreaterOrEqual(t, chunksInterrupted-chunksBefore, 80)
+
+	repo.AppContext().SetContext(context.Background())
+	fsImporter, err = fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	imp = &interruptingImporter{Importer: fsImporter}
+
+	snap, err = snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "resumed", MaxConcurrency: 1, Resume: true})
+	require.NoError(t, err)
+
+	// only the files that were not stored before the interruption are read
+	require.LessOrEqual(t, int(imp.opened.Load()), nfiles-80)
+	chunksResumed := countChunks(t, repo)
+	require.LessOrEqual(t, chunksResumed-chunksInterrupted, nfiles-80)
+	require.Equal(t, chunksBefore+nfiles, chunksResumed)
+
+	filesystem, err := snap.Filesystem()
+	require.NoError(t, err)
+	files := 0
+	for e, err := range filesystem.Files("/") {
+		require.NoError(t, err)
+		if e.Type().IsRegular() {
+			files++
+		}
+	}
+	require.Equal(t, nfiles, files)
+}
+
+func TestBackupSkipIfUnchanged(t *testing.T) {
+	parentDir := t.TempDir()
+	tmpBackupDir := filepath.Join(parentDir, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpBackupDir, "subdir"), 0755))
+	for _, file := range []string{"subdir/a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, file), []byte(file), 0644))
+	}
+
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+	repo := newRepositoryFromConfig(t, config)
+
+	backup := func() error {
+		fsImporter, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+		require.NoError(t, err)
+		snap, err := snapshot.New(repo)
+		require.NoError(t, err)
+		defer snap.Close()
+		return snap.Backup(fsImporter, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1, SkipIfUnchanged: true})
+	}
+	snapshots := func() int {
+		require.NoError(t, repo.RebuildState())
+		n := 0
+		for range repo.ListSnapshots() {
+			n++
+		}
+		return n
+	}
+
+	require.NoError(t, backup())
+	require.Equal(t, 1, snapshots())
+
+	require.ErrorIs(t, backup(), snapshot.ErrUnchanged)
+	require.Equal(t, 1, snapshots())
+
+	// changes next to the root don't count
+	require.NoError(t, os.WriteFile(filepath.Join(parentDir, "sibling.txt"), []byte("sibling"), 0644))
+	require.ErrorIs(t, backup(), snapshot.ErrUnchanged)
+	require.Equal(t, 1, snapshots())
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, "b.txt"), []byte("changed"), 0644))
+	require.NoError(t, backup())
+	require.Equal(t, 2, snapshots())
+}
+
+// newRepositoryFromConfig creates a fresh unencrypted repository from an
+// existing configuration, so that repositories created from the same one
+// compute the same MACs.
+func newRepositoryFromConfig(t *testing.T, config *storage.Configuration) *repository.Repository {
+	serialized, err := config.ToBytes()
+	require.NoError(t, err)
+	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
+	require.NoError(t, err)
+	wrappedConfig, err := io.ReadAll(wrappedConfigRd)
+	require.NoError(t, err)
+
+	location := filepath.Join(t.TempDir(), "repo")
+	store, err := bfs.NewStore(map[string]string{"location": "fs://" + location})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(wrappedConfig))
+
+	return openRepository(t, location)
+}
+
+// openRepository opens the repository at location with an empty cache, as
+// a new process would.
+func openRepository(t *testing.T, location string) *repository.Repository {
+	store, serializedConfig, err := storage.Open(map[string]string{"location": location})
+	require.NoError(t, err)
+
+	ctx := appcontext.NewAppContext()
+	ctx.SetCache(caching.NewManager(t.TempDir()))
+	ctx.SetLogger(logging.NewLogger(io.Discard, io.Discard))
+	repo, err := repository.New(ctx, store, serializedConfig)
+	require.NoError(t, err)
+	return repo
+}
+
+// crashingImporter cancels the backup once a state has been pushed to the
+// repository after files have been opened.
+type crashingImporter struct {
+	importer.Importer
+	repo   *repository.Repository
+	after  int32
+	opened atomic.Int32
+	cancel context.CancelFunc
+}
+
+func (imp *crashingImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if imp.opened.Add(1) == imp.after {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if states, err := imp.repo.GetStates(); err == nil && len(states) != 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		imp.cancel()
+	}
+	return imp.Importer.NewReader(pathname)
+}
+
+func TestBackupCrash(t *testing.T) {
+	const nfiles = 100
+	tmpBackupDir := t.TempDir()
+	for i := range nfiles {
+		content := make([]byte, 1024)
+		_, err := rand.Read(content)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(tmpBackupDir, fmt.Sprintf("file%03d", i)), content, 0644)
+		require.NoError(t, err)
+	}
+
+	// one packfile per blob, so that states are pushed along the way
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+	config.Packfile.MaxSize = 1
+	repo := newRepositoryFromConfig(t, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo.AppContext().SetContext(ctx)
+
+	fsImporter, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	imp := &crashingImporter{Importer: fsImporter, repo: repo, after: 80, cancel: cancel}
+
+	// without -resume nothing is pushed when the backup is interrupted,
+	// as if it had crashed
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "crashed", MaxConcurrency: 1})
+	require.ErrorIs(t, err, context.Canceled)
+	snap.Close()
+
+	repo = openRepository(t, repo.Location())
+	chunksCrashed := countChunks(t, repo)
+	require.Greater(t, chunksCrashed, 0)
+	require.Less(t, chunksCrashed, nfiles)
+
+	packfilesCrashed := map[objects.MAC]struct{}{}
+	for mac := range repo.ListPackfiles() {
+		packfilesCrashed[mac] = struct{}{}
+	}
+
+	fsImporter, err = fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	snap, err = snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+	err = snap.Backup(fsImporter, &snapshot.BackupOptions{Name: "resumed", MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.Equal(t, nfiles, countChunks(t, repo))
+
+	// only the chunks missing from the pushed states were stored again
+	stored := 0
+	for mac := range repo.ListPackfiles() {
+		if _, exists := packfilesCrashed[mac]; exists {
+			continue
+		}
+		for delta, err := range repo.ListPackfileBlobs(mac) {
+			require.NoError(t, err)
+			if delta.Type == resources.RT_CHUNK {
+				stored++
+			}
+		}
+	}
+	require.Equal(t, nfiles-chunksCrashed, stored)
+}
+
+// stableParentsImporter resets the metadata of the parents of the root,
+// which change as temporary directories are created next to it.
+type stableParentsImporter struct {
+	importer.Importer
+}
+
+func (imp *stableParentsImporter) Scan() (<-chan *importer.ScanResult, error) {
+	results, err := imp.Importer.Scan()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *importer.ScanResult)
+	go func() {
+		defer close(ch)
+		for result := range results {
+			if record := result.Record; record != nil && !strings.HasPrefix(record.Pathname, imp.Root()) {
+				record.FileInfo = objects.FileInfo{
+					Lname: record.FileInfo.Lname,
+					Lmode: record.FileInfo.Lmode,
+				}
+			}
+			ch <- result
+		}
+	}()
+	return ch, nil
+}
+
+func TestBackupDeterministic(t *testing.T) {
+	tmpBackupDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(tmpBackupDir, "subdir"), 0755))
+	for i := range 20 {
+		content := strings.Repeat(fmt.Sprintf("content of file %d\n", i), 100*(i+1))
+		err := os.WriteFile(filepath.Join(tmpBackupDir, "subdir", fmt.Sprintf("file%02d.txt", i)), []byte(content), 0644)
+		require.NoError(t, err)
+	}
+
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+
+	packfiles := make([][]objects.MAC, 2)
+	for i := range packfiles {
+		repo := newRepositoryFromConfig(t, config)
+
+		fsImporter, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+		require.NoError(t, err)
+		snap, err := snapshot.New(repo)
+		require.NoError(t, err)
+		err = snap.Backup(&stableParentsImporter{fsImporter}, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1, Deterministic: true})
+		require.NoError(t, err)
+		snap.Close()
+		require.NoError(t, repo.RebuildState())
+
+		// the packfile of the header differs, it holds the timestamp
+		headerPackfile, exists, err := repo.GetPackfileForBlob(resources.RT_SNAPSHOT, snap.Header.Identifier)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		macs, err := repo.GetPackfiles()
+		require.NoError(t, err)
+		for _, mac := range macs {
+			if mac != headerPackfile {
+				packfiles[i] = append(packfiles[i], mac)
+			}
+
+		}
+		require.NotEmpty(t, packfiles[i])
+
+		// packfiles keep a date for the grace period of maintenance
+		pf, err := repo.GetPackfile(packfiles[i][0])
+		require.NoError(t, err)
+		date := time.Unix(0, pf.Footer.Timestamp)
+		require.WithinDuration(t, time.Now(), date, 24*time.Hour)
+	}
+	require.ElementsMatch(t, packfiles[0], packfiles[1])
+}
@@ -0,0 +1,146 @@
+package snapshot
+
+import (
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+)
+
+var ErrBlobMACMismatch = errors.New("content does not match the MAC")
+
+type BlobTypeStats struct {
+	Count uint64
+	Size  uint64
+}
+
+// BlobStats returns the number and the stored size of the blobs of each
+// type that were written by this snapshot, as recorded in the state delta
+// it pushed on commit.  Blobs that were already present in the repository
+// and thus deduplicated are not accounted for.
+func (snap *Snapshot) BlobStats() (map[resources.Type]BlobTypeStats, error) {
+	version, rd, err := snap.repository.GetState(snap.Header.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	scanCache, err := snap.AppContext().GetCache().Scan(objects.RandomMAC())
+	if err != nil {
+		return nil, err
+	}
+	defer scanCache.Close()
+
+	st, err := state.FromStream(version, rd, scanCache)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[resources.Type]BlobTypeStats)
+	for _, Type := range resources.Types() {
+		for de, err := range st.ListObjectsOfType(Type) {
+			if err != nil {
+				return nil, err
+			}
+			s := stats[Type]
+			s.Count++
+			s.Size += uint64(de.Location.Length)
+			stats[Type] = s
+		}
+	}
+	return stats, nil
+}
+
+// ListLiveObjectsOfType yields the state entries of the blobs of the given
+// type that are still referenced by a live snapshot.  Deleted snapshots are
+// only tombstoned and their packfiles may be shared with live snapshots, so
+// when deletions are pending the live snapshots are walked to find out
+// which blobs they reference.
+func ListLiveObjectsOfType(repo *repository.Repository, Type resources.Type) iter.Seq2[state.DeltaEntry, error] {
+	return func(yield func(state.DeltaEntry, error) bool) {
+		var referenced map[objects.MAC]struct{}
+		for range repo.ListDeletedSnapShots() {
+			var err error
+			if referenced, err = referencedBlobs(repo, Type); err != nil {
+				yield(state.DeltaEntry{}, err)
+				return
+			}
+			break
+		}
+
+		for de, err := range repo.ListLiveObjectsOfType(Type) {
+			if err != nil {
+				if !yield(state.DeltaEntry{}, err) {
+					return
+				}
+				continue
+			}
+
+			if referenced != nil {
+				if _, ok := referenced[de.Blob]; !ok {
+					continue
+				}
+			}
+
+			if !yield(de, nil) {
+				return
+			}
+		}
+	}
+}
+
+func referencedBlobs(repo *repository.Repository, Type resources.Type) (map[objects.MAC]struct{}, error) {
+	referenced := make(map[objects.MAC]struct{})
+	for snapshotID := range repo.ListSnapshots() {
+		snap, err := Load(repo, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+
+		blobs, err := snap.ListBlobs()
+		if err != nil {
+			snap.Close()
+			return nil, err
+		}
+
+		for blob, err := range blobs {
+			if err != nil {
+				snap.Close()
+				return nil, err
+			}
+			if blob.Type == Type {
+				referenced[blob.MAC] = struct{}{}
+			}
+		}
+		snap.Close()
+	}
+	return referenced, nil
+}
+
+// VerifyBlob fetches a blob and checks that its content hashes to the MAC
+// it is stored under.  Snapshot headers and signatures are stored under the
+// snapshot identifier, only their retrieval can be verified.
+func VerifyBlob(repo *repository.Repository, blob BlobRef) error {
+	rd, err := repo.GetBlob(blob.Type, blob.MAC)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+
+	switch blob.Type {
+	case resources.RT_SNAPSHOT, resources.RT_SIGNATURE:
+		return nil
+	}
+
+	if repo.ComputeMAC(data) != blob.MAC {
+		return ErrBlobMACMismatch
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package snapshot_test
+
+import (
+	"iter"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobStats(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/a.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/b.txt", 0644, "hello"),
+		ptesting.NewMockFile("c.txt", 0644, "world"),
+	})
+	defer snap.Close()
+
+	stats, err := snap.BlobStats()
+	require.NoError(t, err)
+
+	// identical contents are deduplicated
+	require.Equal(t, uint64(2), stats[resources.RT_CHUNK].Count)
+	require.Equal(t, uint64(2), stats[resources.RT_OBJECT].Count)
+	require.Equal(t, uint64(1), stats[resources.RT_SNAPSHOT].Count)
+	require.Equal(t, uint64(1), stats[resources.RT_VFS_BTREE].Count)
+
+	// the sizes must match what was written to the packfiles
+	expected := make(map[resources.Type]snapshot.BlobTypeStats)
+	packfiles, err := snap.Repository().GetPackfiles()
+	require.NoError(t, err)
+	for _, mac := range packfiles {
+		p, err := snap.Repository().GetPackfile(mac)
+		require.NoError(t, err)
+		for _, blob := range p.Index {
+			s := expected[blob.Type]
+			s.Count++
+			s.Size += uint64(blob.Length)
+			expected[blob.Type] = s
+		}
+	}
+	require.Equal(t, expected, stats)
+}
+
+func TestListLiveObjectsOfType(t *testing.T) {
+	config := storage.NewConfiguration()
+	config.Encryption = nil
+	repo := newRepositoryFromConfig(t, config)
+
+	tmpBackupDir := t.TempDir()
+	backup := func(files map[string]string) *snapshot.Snapshot {
+		entries, err := os.ReadDir(tmpBackupDir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.NoError(t, os.Remove(filepath.Join(tmpBackupDir, entry.Name())))
+		}
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(tmpBackupDir, name), []byte(content), 0644))
+		}
+
+		imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+		require.NoError(t, err)
+		snap, err := snapshot.New(repo)
+		require.NoError(t, err)
+		require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+		snap.Close()
+		require.NoError(t, repo.RebuildState())
+		return snap
+	}
+
+	listChunks := func(seq iter.Seq2[state.DeltaEntry, error]) []objects.MAC {
+		macs := []objects.MAC{}
+		for de, err := range seq {
+			require.NoError(t, err)
+			macs = append(macs, de.Blob)
+		}
+		return macs
+	}
+
+	shared := repo.ComputeMAC([]byte("shared content"))
+	unique1 := repo.ComputeMAC([]byte("only in the first snapshot"))
+	unique2 := repo.ComputeMAC([]byte("only in the second snapshot"))
+
+	snap1 := backup(map[string]string{"shared.txt": "shared content", "unique.txt": "only in the first snapshot"})
+	snap2 := backup(map[string]string{"shared.txt": "shared content", "unique.txt": "only in the second snapshot"})
+
+	live := listChunks(snapshot.ListLiveObjectsOfType(repo, resources.RT_CHUNK))
+	require.ElementsMatch(t, []objects.MAC{shared, unique1, unique2}, live)
+
+	require.NoError(t, repo.DeleteSnapshot(snap1.Header.Identifier))
+	require.NoError(t, repo.RebuildState())
+
+	// the shared chunk was written by the deleted snapshot, it must remain
+	require.Contains(t, listChunks(repo.ListObjectsOfType(resources.RT_CHUNK)), unique1)
+	live = listChunks(snapshot.ListLiveObjectsOfType(repo, resources.RT_CHUNK))
+	require.ElementsMatch(t, []objects.MAC{shared, unique2}, live)
+
+	headers := listChunks(repo.ListLiveObjectsOfType(resources.RT_SNAPSHOT))
+	require.Equal(t, []objects.MAC{snap2.Header.Identifier}, headers)
+}
@@ -131,3 +131,33 @@ func (snap *Snapshot) Check(pathname string, opts *CheckOptions) (bool, error) {
 
 	return true, nil
 }
+
+// DanglingRoots returns the name of every top-level reference of the snapshot
+// header that does not resolve to a blob present in the repository.  A
+// snapshot with a dangling VFS root cannot be listed nor restored, even if
+// the files it refers to are still around.
+func (snap *Snapshot) DanglingRoots() []string {
+	dangling := []string{}
+
+	source := snap.Header.GetSource(0)
+	if !snap.repository.BlobExists(resources.RT_VFS_BTREE, source.VFS.Root) {
+		dangling = append(dangling, "vfs root")
+	}
+	if !snap.repository.BlobExists(resources.RT_XATTR_BTREE, source.VFS.Xattrs) {
+		dangling = append(dangling, "vfs xattrs")
+	}
+	if !snap.repository.BlobExists(resources.RT_ERROR_BTREE, source.VFS.Errors) {
+		dangling = append(dangling, "vfs errors")
+	}
+
+	for _, index := range source.Indexes {
+		if index.Type != "btree" {
+			continue
+		}
+		if !snap.repository.BlobExists(resources.RT_BTREE_ROOT, index.Value) {
+			dangling = append(dangling, "index "+index.Name)
+		}
+	}
+
+	return dangling
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	"github.com/stretchr/testify/require"
@@ -34,3 +35,16 @@ func TestCheck(t *testing.T) {
 	require.NoError(t, err)
 	require.True(t, checked)
 }
+
+func TestDanglingRoots(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	require.Empty(t, snap.DanglingRoots())
+
+	snap.Header.GetSource(0).VFS.Root = objects.MAC{}
+	require.Equal(t, []string{"vfs root"}, snap.DanglingRoots())
+}
@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+)
+
+// The concat format is a minimal, deterministic alternative to tar meant for
+// internal pipelines: a leading index of (path, offset, length) records
+// followed by the raw concatenated content of the regular files, in VFS
+// walk order.  Offsets are relative to the start of the content section.
+//
+//	magic   [8]byte "PLKCAT01"
+//	count   uint32
+//	count * { pathLen uint16, path [pathLen]byte, offset uint64, length uint64 }
+//	content
+const concatMagic = "PLKCAT01"
+
+// concatMaxPrealloc bounds the index entries allocated ahead of reading
+// them, the index grows as needed past it.
+const concatMaxPrealloc = 1024
+
+var (
+	ErrInvalidConcat = errors.New("invalid concat stream")
+	ErrConcatShort   = errors.New("short concat content")
+)
+
+type ConcatEntry struct {
+	Path   string
+	Offset uint64
+	Length uint64
+}
+
+type concatFile struct {
+	entrypath string
+	entry     *vfs.Entry
+}
+
+func (snap *Snapshot) ArchiveConcat(w io.Writer, paths []string, rebase bool) error {
+	fsc, err := snap.Filesystem()
+	if err != nil {
+		return err
+	}
+
+	var index []ConcatEntry
+	var files []concatFile
+	offset := uint64(0)
+
+	for _, p := range paths {
+		err := fsc.WalkDir(p, func(entrypath string, e *vfs.Entry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !e.FileInfo.Lmode.IsRegular() {
+				return nil
+			}
+
+			outpath := entrypath
+			if rebase {
+				outpath = strings.TrimPrefix(outpath, p)
+				if outpath == "" {
+					outpath = e.Name()
+				}
+			}
+			outpath = strings.TrimLeft(outpath, "/")
+
+			if len(outpath) > 0xffff {
+				return fmt.Errorf("pathname too long: %s", entrypath)
+			}
+
+			length := uint64(e.Size())
+			index = append(index, ConcatEntry{
+				Path:   outpath,
+				Offset: offset,
+				Length: length,
+			})
+			files = append(files, concatFile{entrypath: entrypath, entry: e})
+			offset += length
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writeConcatIndex(w, index); err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		fp := file.entry.Open(fsc, file.entrypath)
+		n, err := io.Copy(w, fp)
+		fp.Close()
+		if err != nil {
+			return fmt.Errorf("Failed to archive %s: %w", file.entrypath, err)
+		}
+		if uint64(n) != index[i].Length {
+			return fmt.Errorf("Failed to archive %s: %w", file.entrypath, ErrConcatShort)
+		}
+	}
+
+	return nil
+}
+
+func writeConcatIndex(w io.Writer, index []ConcatEntry) error {
+	buf := bytes.Buffer{}
+	buf.WriteString(concatMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(index)))
+	for _, entry := range index {
+		binary.Write(&buf, binary.LittleEndian, uint16(len(entry.Path)))
+		buf.WriteString(entry.Path)
+		binary.Write(&buf, binary.LittleEndian, entry.Offset)
+		binary.Write(&buf, binary.LittleEndian, entry.Length)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ConcatReader gives random access to the files of a concat stream.
+type ConcatReader struct {
+	rd         io.ReaderAt
+	entries    []ConcatEntry
+	byPath     map[string]int
+	dataOffset int64
+}
+
+func NewConcatReader(rd io.ReaderAt) (*ConcatReader, error) {
+	sr := io.NewSectionReader(rd, 0, 1<<63-1)
+
+	magic := make([]byte, len(concatMagic))
+	if _, err := io.ReadFull(sr, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != concatMagic {
+		return nil, ErrInvalidConcat
+	}
+
+	var count uint32
+	if err := binary.Read(sr, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	prealloc := min(count, concatMaxPrealloc)
+	cr := &ConcatReader{
+		rd:      rd,
+		entries: make([]ConcatEntry, 0, prealloc),
+		byPath:  make(map[string]int, prealloc),
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var pathLen uint16
+		if err := binary.Read(sr, binary.LittleEndian, &pathLen); err != nil {
+			return nil, err
+		}
+		pathname := make([]byte, pathLen)
+		if _, err := io.ReadFull(sr, pathname); err != nil {
+			return nil, err
+		}
+
+		entry := ConcatEntry{Path: string(pathname)}
+		if err := binary.Read(sr, binary.LittleEndian, &entry.Offset); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(sr, binary.LittleEndian, &entry.Length); err != nil {
+			return nil, err
+		}
+
+		cr.byPath[entry.Path] = len(cr.entries)
+		cr.entries = append(cr.entries, entry)
+	}
+
+	offset, err := sr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	cr.dataOffset = offset
+
+	return cr, nil
+}
+
+func (cr *ConcatReader) Entries() []ConcatEntry {
+	return cr.entries
+}
+
+// Open returns a reader over the content of pathname, positioned at the
+// start of the file.
+func (cr *ConcatReader) Open(pathname string) (*io.SectionReader, error) {
+	idx, ok := cr.byPath[strings.TrimLeft(pathname, "/")]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	entry := cr.entries[idx]
+	return io.NewSectionReader(cr.rd, cr.dataOffset+int64(entry.Offset), int64(entry.Length)), nil
+}
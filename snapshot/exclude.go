@@ -0,0 +1,138 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ExcludeList is a list of gitignore-style patterns matched against the
+// pathnames relative to the root of the scan:
+//
+//   - blank lines and lines starting with # are ignored,
+//   - a leading ! re-includes what a previous pattern excluded,
+//   - a trailing / only matches directories,
+//   - a pattern without any other / matches the name at any depth,
+//     otherwise it is anchored to the scan root,
+//   - * and ? do not match /, while ** matches any number of directories.
+//
+// As with git, the content of an excluded directory is excluded too and
+// can't be re-included.  The last matching pattern wins.
+type ExcludeList struct {
+	rules []excludeRule
+}
+
+type excludeRule struct {
+	patterns []glob.Glob
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func NewExcludeList() *ExcludeList {
+	return &ExcludeList{}
+}
+
+// Add parses a single pattern line.
+func (el *ExcludeList) Add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	rule := excludeRule{}
+	pattern := line
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		rule.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return fmt.Errorf("invalid exclude pattern: %s", line)
+	}
+
+	for _, variant := range expandDoubleStar(pattern) {
+		g, err := glob.Compile(variant, '/')
+		if err != nil {
+			return fmt.Errorf("failed to compile exclude pattern: %s", line)
+		}
+		rule.patterns = append(rule.patterns, g)
+	}
+
+	el.rules = append(el.rules, rule)
+	return nil
+}
+
+// Load reads patterns from rd, one per line.
+func (el *ExcludeList) Load(rd io.Reader) error {
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		if err := el.Add(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// expandDoubleStar returns the variants of pattern where each **/ matches
+// either some directories or none, which a single glob can't express.
+func expandDoubleStar(pattern string) []string {
+	before, after, found := strings.Cut(pattern, "**/")
+	if !found || (before != "" && !strings.HasSuffix(before, "/")) {
+		return []string{pattern}
+	}
+	variants := []string{}
+	for _, rest := range expandDoubleStar(after) {
+		variants = append(variants, before+"**/"+rest, before+rest)
+	}
+	return variants
+}
+
+func (el *ExcludeList) match(pathname string, isDir bool) bool {
+	excluded := false
+	for _, rule := range el.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := pathname
+		if !rule.anchored {
+			name = path.Base(pathname)
+		}
+		for _, pattern := range rule.patterns {
+			if pattern.Match(name) {
+				excluded = !rule.negate
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// Match reports whether pathname, relative to the scan root and without
+// leading slash, is excluded.
+func (el *ExcludeList) Match(pathname string, isDir bool) bool {
+	if el == nil || len(el.rules) == 0 || pathname == "" {
+		return false
+	}
+
+	components := strings.Split(pathname, "/")
+	for i := 1; i < len(components); i++ {
+		if el.match(strings.Join(components[:i], "/"), true) {
+			return true
+		}
+	}
+	return el.match(pathname, isDir)
+}
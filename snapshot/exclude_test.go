@@ -0,0 +1,84 @@
+package snapshot_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcludeListMatch(t *testing.T) {
+	excludes := snapshot.NewExcludeList()
+	require.NoError(t, excludes.Load(strings.NewReader(`
+# comments and blank lines are ignored
+
+*.log
+!keep.log
+/build
+cache/
+docs/**/*.tmp
+**/node_modules
+`)))
+
+	tests := []struct {
+		pathname string
+		isDir    bool
+		excluded bool
+	}{
+		{"app.log", false, true},
+		{"src/deep/app.log", false, true},
+		{"src/keep.log", false, false},
+		{"build", true, true},
+		{"build/out.o", false, true},
+		{"src/build", true, false},
+		{"cache", true, true},
+		{"src/cache/entry", false, true},
+		{"cache", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/x/y/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"node_modules/pkg/index.js", false, true},
+		{"web/node_modules", true, true},
+		{"src/main.go", false, false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.excluded, excludes.Match(test.pathname, test.isDir), test.pathname)
+	}
+
+	require.Error(t, snapshot.NewExcludeList().Add("["))
+	require.False(t, (*snapshot.ExcludeList)(nil).Match("app.log", false))
+}
+
+func TestBackupExcludeList(t *testing.T) {
+	excludes := snapshot.NewExcludeList()
+	require.NoError(t, excludes.Load(strings.NewReader("*.log\n/subdir/cache/\n")))
+
+	snap := ptesting.GenerateEncryptedSnapshot(t, []byte("passphrase"), []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockDir("subdir/cache"),
+		ptesting.NewMockFile("app.log", 0644, "log"),
+		ptesting.NewMockFile("subdir/app.log", 0644, "log"),
+		ptesting.NewMockFile("subdir/cache/entry", 0644, "cached"),
+		ptesting.NewMockFile("subdir/main.go", 0644, "package main"),
+	}, &snapshot.BackupOptions{
+		Name:           "test_backup",
+		MaxConcurrency: 1,
+		ExcludeList:    excludes,
+	})
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	paths := []string{}
+	for pathname, err := range fs.Pathnames() {
+		require.NoError(t, err)
+		if strings.HasPrefix(pathname, root+"/") {
+			paths = append(paths, strings.TrimPrefix(pathname, root+"/"))
+		}
+	}
+	require.ElementsMatch(t, []string{"subdir", "subdir/main.go"}, paths)
+}
@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,9 +17,65 @@ type Exporter interface {
 	CreateDirectory(pathname string) error
 	StoreFile(pathname string, fp io.Reader) error
 	SetPermissions(pathname string, fileinfo *objects.FileInfo) error
+	CreateSymlink(oldname string, newname string) error
+	CreateHardlink(oldname string, newname string) error
+	SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error
+	Capabilities() ExporterCaps
 	Close() error
 }
 
+// ExporterCaps tells which operations an exporter can perform besides
+// creating directories and storing files, restore doesn't attempt the
+// others.
+type ExporterCaps uint8
+
+const (
+	CapPermissions ExporterCaps = 1 << iota
+	CapSymlinks
+	CapHardlinks
+	CapXattrs
+
+	CapAll = CapPermissions | CapSymlinks | CapHardlinks | CapXattrs
+)
+
+func (c ExporterCaps) Has(caps ExporterCaps) bool {
+	return c&caps == caps
+}
+
+func (c ExporterCaps) String() string {
+	names := []string{}
+	for _, known := range []struct {
+		caps ExporterCaps
+		name string
+	}{
+		{CapPermissions, "permissions"},
+		{CapSymlinks, "symlinks"},
+		{CapHardlinks, "hardlinks"},
+		{CapXattrs, "xattrs"},
+	} {
+		if c.Has(known.caps) {
+			names = append(names, known.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// XattrFlusher is implemented by exporters that buffer the attributes
+// given to SetXattr, restore calls FlushXattrs once all the attributes of
+// an entry were given so that they are applied at once.
+type XattrFlusher interface {
+	FlushXattrs(pathname string) error
+}
+
+// ErrNotSupported is returned by exporters that cannot represent an entry,
+// such as object stores asked to create a link.
+var ErrNotSupported = errors.New("operation not supported by exporter")
+
+// ErrOwnership is returned by SetPermissions when everything but the
+// ownership of the entry was restored, the user not being allowed to
+// change it.
+var ErrOwnership = errors.New("not permitted to restore ownership")
+
 var muBackends sync.Mutex
 var backends map[string]func(config map[string]string) (Exporter, error) = make(map[string]func(config map[string]string) (Exporter, error))
 
@@ -46,44 +103,61 @@ func Backends() []string {
 	return ret
 }
 
-func NewExporter(config map[string]string) (Exporter, error) {
+// parseLocation splits location into the scheme naming its backend and the
+// rest of the location.  The scheme follows the URL syntax, a letter then
+// letters, digits, '+', '-' or '.', and is case-insensitive.  A location
+// without a scheme, or an absolute path, is a path on the local file
+// system.
+func parseLocation(location string) (string, string, error) {
+	if strings.HasPrefix(location, "/") {
+		return "fs", location, nil
+	}
+
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found {
+		return "fs", location, nil
+	}
+
+	if scheme == "" {
+		return "", "", fmt.Errorf("malformed location %q: missing scheme", location)
+	}
+	for i, c := range scheme {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i != 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return "", "", fmt.Errorf("malformed location %q: invalid scheme", location)
+		}
+	}
+	return strings.ToLower(scheme), rest, nil
+}
 
+func NewExporter(config map[string]string) (Exporter, error) {
 	location, ok := config["location"]
 	if !ok {
 		return nil, fmt.Errorf("missing location")
 	}
 
-	muBackends.Lock()
-	defer muBackends.Unlock()
+	scheme, rest, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
 
-	var backendName string
-	if !strings.HasPrefix(location, "/") {
-		if strings.HasPrefix(location, "s3://") {
-			backendName = "s3"
-		} else if strings.HasPrefix(location, "fs://") {
-			backendName = "fs"
-		} else if strings.HasPrefix(location, "ftp://") {
-			backendName = "ftp"
-		} else if strings.HasPrefix(location, "sftp://") {
-			backendName = "sftp"
-		} else {
-			if strings.Contains(location, "://") {
-				return nil, fmt.Errorf("unsupported exporter protocol")
-			} else {
-				backendName = "fs"
-			}
-		}
-	} else {
-		backendName = "fs"
+	muBackends.Lock()
+	backend, exists := backends[scheme]
+	muBackends.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("unsupported exporter protocol: %s", scheme)
 	}
 
-	if backend, exists := backends[backendName]; !exists {
-		return nil, fmt.Errorf("backend '%s' does not exist", backendName)
-	} else {
-		backendInstance, err := backend(config)
-		if err != nil {
-			return nil, err
+	// backends strip their own lowercase scheme from the location
+	if location != rest {
+		normalized := make(map[string]string, len(config))
+		for key, value := range config {
+			normalized[key] = value
 		}
-		return backendInstance, nil
+		normalized["location"] = scheme + "://" + rest
+		config = normalized
 	}
+	return backend(config)
 }
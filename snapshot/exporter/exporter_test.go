@@ -26,6 +26,22 @@ func (m MockedExporter) SetPermissions(pathname string, fileinfo *objects.FileIn
 	return nil
 }
 
+func (m MockedExporter) CreateSymlink(oldname string, newname string) error {
+	return nil
+}
+
+func (m MockedExporter) CreateHardlink(oldname string, newname string) error {
+	return nil
+}
+
+func (m MockedExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	return nil
+}
+
+func (m MockedExporter) Capabilities() ExporterCaps {
+	return CapAll
+}
+
 func (m MockedExporter) Close() error {
 	return nil
 }
@@ -48,36 +64,57 @@ func TestBackends(t *testing.T) {
 }
 
 func TestNewExporter(t *testing.T) {
-	// Setup: Register some backends
-	Register("fs", func(config map[string]string) (Exporter, error) {
-		return MockedExporter{}, nil
-	})
-	Register("s3", func(config map[string]string) (Exporter, error) {
-		return MockedExporter{}, nil
-	})
+	// Setup: Register a backend for each scheme, recording the calls
+	var calledBackend, calledLocation string
+	for _, name := range []string{"fs", "s3", "ftp", "sftp", "null", "tar", "tar+gz"} {
+		Register(name, func(config map[string]string) (Exporter, error) {
+			calledBackend = name
+			calledLocation = config["location"]
+			return MockedExporter{}, nil
+		})
+	}
 
 	tests := []struct {
-		location        string
-		expectedError   string
-		expectedBackend string
+		location         string
+		expectedError    string
+		expectedBackend  string
+		expectedLocation string
 	}{
-		{location: "/", expectedError: "", expectedBackend: "fs"},
-		{location: "fs://some/path", expectedError: "", expectedBackend: "fs"},
-		{location: "s3://bucket/path", expectedError: "", expectedBackend: "s3"},
-		{location: "http://unsupported", expectedError: "unsupported exporter protocol", expectedBackend: ""},
+		{location: "/", expectedBackend: "fs", expectedLocation: "/"},
+		{location: "relative/path", expectedBackend: "fs", expectedLocation: "relative/path"},
+		{location: "/tmp/a://b", expectedBackend: "fs", expectedLocation: "/tmp/a://b"},
+		{location: "fs://some/path", expectedBackend: "fs", expectedLocation: "fs://some/path"},
+		{location: "s3://bucket/path", expectedBackend: "s3", expectedLocation: "s3://bucket/path"},
+		{location: "ftp://host/path", expectedBackend: "ftp", expectedLocation: "ftp://host/path"},
+		{location: "sftp://user@host/path", expectedBackend: "sftp", expectedLocation: "sftp://user@host/path"},
+		{location: "null://", expectedBackend: "null", expectedLocation: "null://"},
+		{location: "tar:///tmp/out.tar", expectedBackend: "tar", expectedLocation: "tar:///tmp/out.tar"},
+		{location: "tar+gz:///tmp/out.tgz", expectedBackend: "tar+gz", expectedLocation: "tar+gz:///tmp/out.tgz"},
+		{location: "S3://bucket/path", expectedBackend: "s3", expectedLocation: "s3://bucket/path"},
+		{location: "http://unsupported", expectedError: "unsupported exporter protocol: http"},
+		{location: "://missing", expectedError: "missing scheme"},
+		{location: "1tar://archive", expectedError: "invalid scheme"},
+		{location: "t ar://archive", expectedError: "invalid scheme"},
 	}
 
 	for _, test := range tests {
 		t.Run(test.location, func(t *testing.T) {
+			calledBackend, calledLocation = "", ""
 			exporter, err := NewExporter(map[string]string{"location": test.location})
 
 			if test.expectedError != "" {
 				require.Error(t, err)
 				require.Contains(t, err.Error(), test.expectedError)
+				require.Empty(t, calledBackend)
 			} else {
 				require.NoError(t, err)
 				require.NotNil(t, exporter)
+				require.Equal(t, test.expectedBackend, calledBackend)
+				require.Equal(t, test.expectedLocation, calledLocation)
 			}
 		})
 	}
+
+	_, err := NewExporter(map[string]string{})
+	require.EqualError(t, err, "missing location")
 }
@@ -17,18 +17,35 @@
 package fs
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/pkg/xattr"
 )
 
 type FSExporter struct {
 	rootDir string
+
+	// preserveOwner restores the ownership of the entries, which is
+	// attempted by default only when running as root.
+	preserveOwner bool
 }
 
+// getuid, chown and lchown are overridden by the tests to simulate
+// privileged and unprivileged restores.
+var (
+	getuid = os.Getuid
+	chown  = os.Chown
+	lchown = os.Lchown
+)
+
 func init() {
 	exporter.Register("fs", NewFSExporter)
 }
@@ -40,8 +57,18 @@ func NewFSExporter(config map[string]string) (exporter.Exporter, error) {
 		location = location[4:]
 	}
 
+	preserveOwner := getuid() == 0
+	if value, ok := config["preserve_owner"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preserve_owner value")
+		}
+		preserveOwner = tmp
+	}
+
 	return &FSExporter{
-		rootDir: location,
+		rootDir:       location,
+		preserveOwner: preserveOwner,
 	}, nil
 }
 
@@ -66,7 +93,35 @@ func (p *FSExporter) StoreFile(pathname string, fp io.Reader) error {
 	if err != nil {
 		return err
 	}
+	return p.store(f, fp)
+}
 
+func (p *FSExporter) StoreFileWithPolicy(pathname string, fp io.Reader, fileinfo *objects.FileInfo, policy exporter.OverwritePolicy) (bool, error) {
+	switch policy {
+	case exporter.OverwriteNever:
+		// O_EXCL so that a file appearing meanwhile is kept as well
+		f, err := os.OpenFile(pathname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, os.ErrExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, p.store(f, fp)
+
+	case exporter.OverwriteIfNewer:
+		existing, err := os.Lstat(pathname)
+		if err == nil && existing.Mode().IsRegular() &&
+			existing.Size() == fileinfo.Size() &&
+			!existing.ModTime().Before(fileinfo.ModTime()) {
+			return false, nil
+		}
+	}
+
+	return true, p.StoreFile(pathname, fp)
+}
+
+func (p *FSExporter) store(f *os.File, fp io.Reader) error {
 	if _, err := io.Copy(f, fp); err != nil {
 		//logging.Warn("copy failure: %s: %s", pathname, err)
 		f.Close()
@@ -81,16 +136,69 @@ func (p *FSExporter) StoreFile(pathname string, fp io.Reader) error {
 	return nil
 }
 
+// SetPermissions restores the ownership of pathname if preserveOwner is
+// set, then its mode and times.  If only the ownership can't be restored,
+// the rest is still applied and ErrOwnership returned.
 func (p *FSExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	// chmod would follow the link, and the mode of a symlink is not
+	// meaningful anyway, only its ownership can be restored.
+	if fileinfo.Mode()&os.ModeSymlink != 0 {
+		if p.preserveOwner {
+			return ownershipError(lchown(pathname, int(fileinfo.Uid()), int(fileinfo.Gid())))
+		}
+		return nil
+	}
+
+	// chown clears the setuid and setgid bits, so it comes before chmod
+	var ownerErr error
+	if p.preserveOwner {
+		ownerErr = ownershipError(chown(pathname, int(fileinfo.Uid()), int(fileinfo.Gid())))
+		if ownerErr != nil && !errors.Is(ownerErr, exporter.ErrOwnership) {
+			return ownerErr
+		}
+	}
 	if err := os.Chmod(pathname, fileinfo.Mode()); err != nil {
 		return err
 	}
-	if os.Getuid() == 0 {
-		if err := os.Chown(pathname, int(fileinfo.Uid()), int(fileinfo.Gid())); err != nil {
-			return err
+	// the access time isn't recorded, use the modification time for both
+	if err := os.Chtimes(pathname, fileinfo.ModTime(), fileinfo.ModTime()); err != nil {
+		return err
+	}
+	return ownerErr
+}
+
+func ownershipError(err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%w: %w", exporter.ErrOwnership, err)
+	}
+	return err
+}
+
+func (p *FSExporter) CreateSymlink(oldname string, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (p *FSExporter) CreateHardlink(oldname string, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (p *FSExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	switch typ {
+	case objects.AttributeExtended:
+		return xattr.LSet(pathname, name, value)
+	case objects.AttributeADS:
+		// alternate data streams are addressed as file:stream on NTFS
+		if runtime.GOOS != "windows" {
+			return exporter.ErrNotSupported
 		}
+		return os.WriteFile(pathname+":"+name, value, 0600)
+	default:
+		return fmt.Errorf("unknown attribute type %d", typ)
 	}
-	return nil
+}
+
+func (p *FSExporter) Capabilities() exporter.ExporterCaps {
+	return exporter.CapAll
 }
 
 func (p *FSExporter) Close() error {
@@ -1,9 +1,14 @@
 package fs
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
@@ -52,3 +57,82 @@ func TestExporter(t *testing.T) {
 	err = exporterInstance.SetPermissions(tmpExportDir+"/dummy.txt", &objects.FileInfo{Lmode: 0644})
 	require.NoError(t, err)
 }
+
+// simulate runs the test as the user uid, with chown failing unless
+// running as root, and records the ownership changes attempted.
+func simulate(t *testing.T, uid int) *[]string {
+	chowns := []string{}
+	fakeChown := func(name string, uid, gid int) error {
+		chowns = append(chowns, fmt.Sprintf("%s %d:%d", filepath.Base(name), uid, gid))
+		if getuid() != 0 {
+			return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+		}
+		return nil
+	}
+
+	origGetuid, origChown, origLchown := getuid, chown, lchown
+	getuid = func() int { return uid }
+	chown, lchown = fakeChown, fakeChown
+	t.Cleanup(func() {
+		getuid, chown, lchown = origGetuid, origChown, origLchown
+	})
+	return &chowns
+}
+
+func TestSetPermissionsOwnership(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fileinfo := objects.NewFileInfo("dummy.txt", 5, 0640, mtime, 0, 0, 1234, 5678, 1)
+	linkinfo := objects.NewFileInfo("link", 0, 0777|os.ModeSymlink, mtime, 0, 0, 1234, 5678, 1)
+
+	restore := func(t *testing.T, config map[string]string) error {
+		dir := t.TempDir()
+		config["location"] = dir
+		exp, err := NewFSExporter(config)
+		require.NoError(t, err)
+
+		pathname := filepath.Join(dir, "dummy.txt")
+		require.NoError(t, os.WriteFile(pathname, []byte("hello"), 0600))
+		require.NoError(t, os.Symlink("dummy.txt", filepath.Join(dir, "link")))
+
+		if err := exp.SetPermissions(filepath.Join(dir, "link"), &linkinfo); !errors.Is(err, exporter.ErrOwnership) {
+			require.NoError(t, err)
+		}
+		err = exp.SetPermissions(pathname, &fileinfo)
+
+		// the mode and times are applied whatever happened to the ownership
+		info, statErr := os.Stat(pathname)
+		require.NoError(t, statErr)
+		require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		require.True(t, mtime.Equal(info.ModTime()))
+		return err
+	}
+
+	t.Run("privileged", func(t *testing.T) {
+		chowns := simulate(t, 0)
+		require.NoError(t, restore(t, map[string]string{}))
+		require.Equal(t, []string{"link 1234:5678", "dummy.txt 1234:5678"}, *chowns)
+	})
+
+	t.Run("privileged not preserving owner", func(t *testing.T) {
+		chowns := simulate(t, 0)
+		require.NoError(t, restore(t, map[string]string{"preserve_owner": "false"}))
+		require.Empty(t, *chowns)
+	})
+
+	t.Run("unprivileged", func(t *testing.T) {
+		chowns := simulate(t, 1000)
+		require.NoError(t, restore(t, map[string]string{}))
+		require.Empty(t, *chowns)
+	})
+
+	t.Run("unprivileged preserving owner", func(t *testing.T) {
+		chowns := simulate(t, 1000)
+		err := restore(t, map[string]string{"preserve_owner": "true"})
+		require.ErrorIs(t, err, exporter.ErrOwnership)
+		require.ErrorIs(t, err, syscall.EPERM)
+		require.Equal(t, []string{"link 1234:5678", "dummy.txt 1234:5678"}, *chowns)
+	})
+
+	_, err := NewFSExporter(map[string]string{"location": t.TempDir(), "preserve_owner": "maybe"})
+	require.EqualError(t, err, "invalid preserve_owner value")
+}
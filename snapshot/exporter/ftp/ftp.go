@@ -31,6 +31,7 @@ type FTPExporter struct {
 	host    string
 	rootDir string
 	client  *goftp.Client
+	retry   *exporter.RetryPolicy
 }
 
 func connectToFTP(host, username, password string) (*goftp.Client, error) {
@@ -67,6 +68,11 @@ func NewFTPExporter(config map[string]string) (exporter.Exporter, error) {
 		password = tmp
 	}
 
+	retry, err := exporter.NewRetryPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := connectToFTP(parsed.Host, username, password)
 	if err != nil {
 		return nil, err
@@ -76,6 +82,7 @@ func NewFTPExporter(config map[string]string) (exporter.Exporter, error) {
 		host:    parsed.Host,
 		rootDir: parsed.Path,
 		client:  client,
+		retry:   retry,
 	}, nil
 }
 
@@ -87,17 +94,21 @@ func (p *FTPExporter) CreateDirectory(pathname string) error {
 	if pathname == "/" {
 		return nil
 	}
-	_, err := p.client.Mkdir(pathname)
-	if err != nil {
-		if strings.Contains(err.Error(), "exists") {
-			return nil
+	return p.retry.Do(func() error {
+		_, err := p.client.Mkdir(pathname)
+		if err != nil {
+			if strings.Contains(err.Error(), "exists") {
+				return nil
+			}
 		}
-	}
-	return err
+		return err
+	})
 }
 
 func (p *FTPExporter) StoreFile(pathname string, fp io.Reader) error {
-	return p.client.Store(pathname, fp)
+	return p.retry.StoreFile(fp, func(rd io.Reader) error {
+		return p.client.Store(pathname, rd)
+	})
 }
 
 func (p *FTPExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
@@ -105,6 +116,24 @@ func (p *FTPExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo
 	return nil
 }
 
+func (p *FTPExporter) CreateSymlink(oldname string, newname string) error {
+	// FTP has no notion of links
+	return exporter.ErrNotSupported
+}
+
+func (p *FTPExporter) CreateHardlink(oldname string, newname string) error {
+	return exporter.ErrNotSupported
+}
+
+func (p *FTPExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	return exporter.ErrNotSupported
+}
+
+func (p *FTPExporter) Capabilities() exporter.ExporterCaps {
+	// FTP only stores files and directories
+	return 0
+}
+
 func (p *FTPExporter) Close() error {
 	if p.client != nil {
 		return p.client.Close()
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package null
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+)
+
+// NullExporter reads every restored file to completion and discards it,
+// which forces all the blobs to be fetched and decoded without writing
+// anything.
+type NullExporter struct {
+	files atomic.Uint64
+	size  atomic.Uint64
+}
+
+func init() {
+	exporter.Register("null", NewNullExporter)
+}
+
+func NewNullExporter(config map[string]string) (exporter.Exporter, error) {
+	return &NullExporter{}, nil
+}
+
+func (p *NullExporter) Root() string {
+	return "/"
+}
+
+func (p *NullExporter) CreateDirectory(pathname string) error {
+	return nil
+}
+
+func (p *NullExporter) StoreFile(pathname string, fp io.Reader) error {
+	n, err := io.Copy(io.Discard, fp)
+	p.size.Add(uint64(n))
+	if err != nil {
+		return err
+	}
+	p.files.Add(1)
+	return nil
+}
+
+func (p *NullExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	return nil
+}
+
+func (p *NullExporter) CreateSymlink(oldname string, newname string) error {
+	return nil
+}
+
+func (p *NullExporter) CreateHardlink(oldname string, newname string) error {
+	return nil
+}
+
+func (p *NullExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	return nil
+}
+
+func (p *NullExporter) Capabilities() exporter.ExporterCaps {
+	return exporter.CapAll
+}
+
+func (p *NullExporter) Close() error {
+	return nil
+}
+
+// Files returns the number of files read to completion.
+func (p *NullExporter) Files() uint64 {
+	return p.files.Load()
+}
+
+// Size returns the number of bytes read, including those of files that
+// failed to read.
+func (p *NullExporter) Size() uint64 {
+	return p.size.Load()
+}
@@ -0,0 +1,41 @@
+package null
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello dummy"),
+		ptesting.NewMockFile("subdir/foo.txt", 0644, "hello foo"),
+		ptesting.NewMockFile("bar.txt", 0644, "hello bar, a longer one"),
+	})
+	defer snap.Close()
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": "null://"})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+	require.Equal(t, "/", exporterInstance.Root())
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), root, &snapshot.RestoreOptions{
+		MaxConcurrency: 2,
+		Strip:          root,
+	})
+	require.NoError(t, err)
+
+	summary := snap.Header.GetSource(0).Summary
+	nullExporter := exporterInstance.(*NullExporter)
+	require.Equal(t, uint64(3), nullExporter.Files())
+	require.Equal(t, summary.Directory.Size+summary.Below.Size, nullExporter.Size())
+}
@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// OverwritePolicy tells what to do with a file already present at the
+// path where a file is restored.
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways replaces existing files.
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteNever keeps existing files.
+	OverwriteNever
+	// OverwriteIfNewer replaces existing files that differ in size or
+	// are older than the file being restored.
+	OverwriteIfNewer
+)
+
+func (p OverwritePolicy) String() string {
+	switch p {
+	case OverwriteAlways:
+		return "always"
+	case OverwriteNever:
+		return "never"
+	case OverwriteIfNewer:
+		return "if-newer"
+	default:
+		return fmt.Sprintf("OverwritePolicy(%d)", int(p))
+	}
+}
+
+func ParseOverwritePolicy(value string) (OverwritePolicy, error) {
+	switch value {
+	case "always":
+		return OverwriteAlways, nil
+	case "never":
+		return OverwriteNever, nil
+	case "if-newer":
+		return OverwriteIfNewer, nil
+	default:
+		return OverwriteAlways, fmt.Errorf("invalid overwrite policy %q", value)
+	}
+}
+
+// Overwriter is implemented by exporters that can apply an overwrite
+// policy, the others always replace existing files.
+type Overwriter interface {
+	// StoreFileWithPolicy stores fp at pathname unless policy keeps the
+	// file already there, and reports whether the file was stored.  The
+	// fileinfo is the one of the file being restored.
+	StoreFileWithPolicy(pathname string, fp io.Reader, fileinfo *objects.FileInfo, policy OverwritePolicy) (bool, error)
+}
+
+// ChecksumStorer is implemented by exporters that record the checksum of
+// the files they store, so that a file whose content is already at the
+// destination is not transferred again.
+type ChecksumStorer interface {
+	// StoreFileWithChecksum stores fp at pathname along with checksum,
+	// unless the file already there was stored with the same checksum,
+	// and reports whether the file was stored.
+	StoreFileWithChecksum(pathname string, fp io.Reader, checksum objects.MAC) (bool, error)
+}
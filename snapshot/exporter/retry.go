@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryDelay    = 500 * time.Millisecond
+)
+
+// RetryPolicy retries the operations of remote exporters that fail with a
+// transient error, waiting BaseDelay before the first retry and doubling
+// the delay before each of the next ones.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+
+	// Transient reports whether an error is worth retrying, it defaults
+	// to IsTransient.
+	Transient func(error) bool
+}
+
+// NewRetryPolicy builds the policy from the "retry_attempts" and
+// "retry_delay" keys of an exporter configuration.
+func NewRetryPolicy(config map[string]string) (*RetryPolicy, error) {
+	policy := &RetryPolicy{
+		Attempts:  DefaultRetryAttempts,
+		BaseDelay: DefaultRetryDelay,
+		Transient: IsTransient,
+	}
+
+	if value, ok := config["retry_attempts"]; ok {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("invalid retry_attempts value")
+		}
+		policy.Attempts = attempts
+	}
+
+	if value, ok := config["retry_delay"]; ok {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("invalid retry_delay value")
+		}
+		policy.BaseDelay = delay
+	}
+
+	return policy, nil
+}
+
+// IsTransient reports whether err looks like a temporary network
+// condition rather than a permanent failure.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var tempErr interface{ Temporary() bool }
+	if errors.As(err, &tempErr) && tempErr.Temporary() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT)
+}
+
+// Do runs op until it succeeds, fails with a permanent error or the
+// attempts are exhausted, in which case the last error is returned.
+func (p *RetryPolicy) Do(op func() error) error {
+	transient := p.Transient
+	if transient == nil {
+		transient = IsTransient
+	}
+
+	delay := p.BaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op()
+		if err == nil || attempt >= p.Attempts || !transient(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// StoreFile runs store with the content of fp, rewinding it before each
+// retry.  Only a reader that can't seek is spooled to a temporary file
+// first, so that a retry can send the same content again.
+func (p *RetryPolicy) StoreFile(fp io.Reader, store func(io.Reader) error) error {
+	if p.Attempts <= 1 {
+		return store(fp)
+	}
+
+	var start int64
+	rs, ok := fp.(io.ReadSeeker)
+	if ok {
+		// wrappers may implement Seek only when what they wrap does
+		var err error
+		start, err = rs.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+	if !ok {
+		spool, err := os.CreateTemp("", "plakar-exporter-*")
+		if err != nil {
+			return err
+		}
+		os.Remove(spool.Name())
+		defer spool.Close()
+
+		if _, err := io.Copy(spool, fp); err != nil {
+			return err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		rs, start = spool, 0
+	}
+
+	first := true
+	return p.Do(func() error {
+		if !first {
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return store(rs)
+	})
+}
@@ -0,0 +1,103 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore fails its first failures calls with err after consuming part
+// of the content, as a connection dropped during an upload would.
+type flakyStore struct {
+	failures int
+	err      error
+	calls    int
+	stored   []byte
+}
+
+func (f *flakyStore) store(rd io.Reader) error {
+	f.calls++
+	if f.calls <= f.failures {
+		io.CopyN(io.Discard, rd, 3)
+		return f.err
+	}
+	data, err := io.ReadAll(rd)
+	f.stored = data
+	return err
+}
+
+// unseekableReader implements Seek but always fails to.
+type unseekableReader struct {
+	io.Reader
+}
+
+func (unseekableReader) Seek(int64, int) (int64, error) {
+	return 0, errors.New("not seekable")
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	policy, err := NewRetryPolicy(map[string]string{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultRetryAttempts, policy.Attempts)
+	require.Equal(t, DefaultRetryDelay, policy.BaseDelay)
+
+	policy, err = NewRetryPolicy(map[string]string{"retry_attempts": "5", "retry_delay": "1s"})
+	require.NoError(t, err)
+	require.Equal(t, 5, policy.Attempts)
+	require.Equal(t, time.Second, policy.BaseDelay)
+
+	_, err = NewRetryPolicy(map[string]string{"retry_attempts": "0"})
+	require.Error(t, err)
+	_, err = NewRetryPolicy(map[string]string{"retry_delay": "soon"})
+	require.Error(t, err)
+}
+
+func TestRetryStoreFile(t *testing.T) {
+	policy, err := NewRetryPolicy(map[string]string{"retry_attempts": "3", "retry_delay": "1ms"})
+	require.NoError(t, err)
+
+	flaky := &flakyStore{failures: 2, err: syscall.ECONNRESET}
+	err = policy.StoreFile(strings.NewReader("hello world"), flaky.store)
+	require.NoError(t, err)
+	require.Equal(t, 3, flaky.calls)
+	require.Equal(t, "hello world", string(flaky.stored))
+
+	// readers that can't seek are spooled so that retries resend everything
+	flaky = &flakyStore{failures: 2, err: syscall.ECONNRESET}
+	err = policy.StoreFile(io.MultiReader(bytes.NewReader([]byte("hello world"))), flaky.store)
+	require.NoError(t, err)
+	require.Equal(t, 3, flaky.calls)
+	require.Equal(t, "hello world", string(flaky.stored))
+
+	// and so are those which fail to seek
+	flaky = &flakyStore{failures: 2, err: syscall.ECONNRESET}
+	err = policy.StoreFile(unseekableReader{strings.NewReader("hello world")}, flaky.store)
+	require.NoError(t, err)
+	require.Equal(t, 3, flaky.calls)
+	require.Equal(t, "hello world", string(flaky.stored))
+
+	flaky = &flakyStore{failures: 3, err: syscall.ECONNRESET}
+	err = policy.StoreFile(strings.NewReader("hello world"), flaky.store)
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+	require.Equal(t, 3, flaky.calls)
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	policy, err := NewRetryPolicy(map[string]string{"retry_delay": "1ms"})
+	require.NoError(t, err)
+
+	permanent := errors.New("permission denied")
+	calls := 0
+	err = policy.Do(func() error {
+		calls++
+		return permanent
+	})
+	require.ErrorIs(t, err, permanent)
+	require.Equal(t, 1, calls)
+}
@@ -17,22 +17,53 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/dustin/go-humanize"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
+const (
+	// DefaultPartSize is the size of the parts of multipart uploads.
+	DefaultPartSize = 16 << 20
+
+	// the bounds S3 puts on the parts, only the last one may be smaller
+	minPartSize = 5 << 20
+	maxPartSize = 5 << 30
+	maxParts    = 10000
+
+	// checksumKey is the user metadata holding the checksum recorded at
+	// backup time of the content of the objects stored with it.
+	checksumKey = "Plakar-Checksum"
+)
+
 type S3Exporter struct {
 	minioClient *minio.Client
 	rootDir     string
+	retry       *exporter.RetryPolicy
+	partSize    int
+
+	// buffers holds the part buffers of the uploads done, so that each
+	// file doesn't allocate its own.
+	buffers sync.Pool
+
+	// xattrs holds the attributes given to SetXattr until FlushXattrs
+	// applies them, by pathname.
+	xattrs      map[string]map[string]string
+	xattrsMutex sync.Mutex
 }
 
 func init() {
@@ -74,6 +105,21 @@ func NewS3Exporter(config map[string]string) (exporter.Exporter, error) {
 		useSsl = tmp
 	}
 
+	partSize := uint64(DefaultPartSize)
+	if value, ok := config["part_size"]; ok {
+		tmp, err := humanize.ParseBytes(value)
+		if err != nil || tmp < minPartSize || tmp > maxPartSize {
+			return nil, fmt.Errorf("invalid part_size value")
+		}
+		partSize = tmp
+	}
+
+	retry, err := exporter.NewRetryPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+	retry.Transient = isTransient
+
 	parsed, err := url.Parse(location)
 	if err != nil {
 		return nil, err
@@ -94,9 +140,29 @@ func NewS3Exporter(config map[string]string) (exporter.Exporter, error) {
 	return &S3Exporter{
 		rootDir:     parsed.Path,
 		minioClient: conn,
+		retry:       retry,
+		partSize:    int(partSize),
+		xattrs:      make(map[string]map[string]string),
+		buffers: sync.Pool{
+			New: func() any {
+				buf := make([]byte, partSize)
+				return &buf
+			},
+		},
 	}, nil
 }
 
+// isTransient also retries the throttling and server side errors reported
+// by the S3 API.
+func isTransient(err error) bool {
+	switch minio.ToErrorResponse(err).StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return exporter.IsTransient(err)
+}
+
 func (p *S3Exporter) Root() string {
 	return p.rootDir
 }
@@ -105,18 +171,201 @@ func (p *S3Exporter) CreateDirectory(pathname string) error {
 	return nil
 }
 
+// StoreFile uploads the content of fp one part at a time, so that at most
+// one part is held in memory and a transient error only retries the part
+// being sent.  A file that fits in a single part is sent as is.  The
+// checksum is explicitly cleared, for the stores which carry the metadata
+// of a replaced object over would otherwise keep a stale one.
 func (p *S3Exporter) StoreFile(pathname string, fp io.Reader) error {
-	_, err := p.minioClient.PutObject(context.Background(),
-		strings.TrimPrefix(p.rootDir, "/"),
-		strings.TrimPrefix(pathname, p.rootDir+"/"),
-		fp, -1, minio.PutObjectOptions{})
-	return err
+	bucket := strings.TrimPrefix(p.rootDir, "/")
+	object := strings.TrimPrefix(pathname, p.rootDir+"/")
+	return p.store(bucket, object, fp, map[string]string{checksumKey: ""})
+}
+
+// StoreFileWithChecksum looks the object up first and only uploads fp if
+// the object doesn't exist or wasn't stored with the same checksum, which
+// spares the transfer of unchanged files when restoring again to the same
+// bucket.
+func (p *S3Exporter) StoreFileWithChecksum(pathname string, fp io.Reader, checksum objects.MAC) (bool, error) {
+	bucket := strings.TrimPrefix(p.rootDir, "/")
+	object := strings.TrimPrefix(pathname, p.rootDir+"/")
+	value := hex.EncodeToString(checksum[:])
+
+	var info minio.ObjectInfo
+	err := p.retry.Do(func() error {
+		var err error
+		info, err = p.minioClient.StatObject(context.Background(), bucket, object, minio.StatObjectOptions{})
+		return err
+	})
+	if err == nil && info.UserMetadata[checksumKey] == value {
+		return false, nil
+	}
+	if err != nil && minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	if err := p.store(bucket, object, fp, map[string]string{checksumKey: value}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (p *S3Exporter) store(bucket, object string, fp io.Reader, metadata map[string]string) error {
+	bufp := p.buffers.Get().(*[]byte)
+	defer p.buffers.Put(bufp)
+
+	buf := *bufp
+	n, err := io.ReadFull(fp, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return p.retry.Do(func() error {
+			_, err := p.minioClient.PutObject(context.Background(), bucket, object,
+				bytes.NewReader(buf[:n]), int64(n), minio.PutObjectOptions{UserMetadata: metadata})
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return p.storeMultipart(bucket, object, buf, fp, metadata)
+}
+
+// storeMultipart uploads buf, which is full, as the first part then the
+// rest of fp.  On failure the upload is aborted so that the parts already
+// sent don't linger in the bucket.
+func (p *S3Exporter) storeMultipart(bucket, object string, buf []byte, fp io.Reader, metadata map[string]string) (err error) {
+	ctx := context.Background()
+	core := minio.Core{Client: p.minioClient}
+
+	var uploadID string
+	err = p.retry.Do(func() error {
+		var err error
+		uploadID, err = core.NewMultipartUpload(ctx, bucket, object, minio.PutObjectOptions{UserMetadata: metadata})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			core.AbortMultipartUpload(ctx, bucket, object, uploadID)
+		}
+	}()
+
+	parts := []minio.CompletePart{}
+	for n := len(buf); n > 0; {
+		partID := len(parts) + 1
+		if partID > maxParts {
+			return fmt.Errorf("%s: too large for %d parts of %s", object, maxParts, humanize.IBytes(uint64(len(buf))))
+		}
+
+		var part minio.ObjectPart
+		err = p.retry.Do(func() error {
+			var err error
+			part, err = core.PutObjectPart(ctx, bucket, object, uploadID, partID,
+				bytes.NewReader(buf[:n]), int64(n), minio.PutObjectPartOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		parts = append(parts, minio.CompletePart{PartNumber: partID, ETag: part.ETag})
+
+		n, err = io.ReadFull(fp, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return p.retry.Do(func() error {
+		_, err := core.CompleteMultipartUpload(ctx, bucket, object, uploadID, parts, minio.PutObjectOptions{})
+		return err
+	})
 }
 
 func (p *S3Exporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
 	return nil
 }
 
+func (p *S3Exporter) CreateSymlink(oldname string, newname string) error {
+	return exporter.ErrNotSupported
+}
+
+func (p *S3Exporter) CreateHardlink(oldname string, newname string) error {
+	return exporter.ErrNotSupported
+}
+
+// SetXattr records extended attributes as user metadata of the object.
+// Metadata can't be amended in place but only by copying the object onto
+// itself, so the attributes are kept until FlushXattrs copies it once.
+func (p *S3Exporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	if typ != objects.AttributeExtended {
+		return exporter.ErrNotSupported
+	}
+
+	p.xattrsMutex.Lock()
+	defer p.xattrsMutex.Unlock()
+	if p.xattrs[pathname] == nil {
+		p.xattrs[pathname] = make(map[string]string)
+	}
+	p.xattrs[pathname]["Xattr-"+name] = base64.StdEncoding.EncodeToString(value)
+	return nil
+}
+
+// FlushXattrs copies the object onto itself with the attributes recorded
+// for pathname merged into its existing metadata.
+func (p *S3Exporter) FlushXattrs(pathname string) error {
+	p.xattrsMutex.Lock()
+	xattrs := p.xattrs[pathname]
+	delete(p.xattrs, pathname)
+	p.xattrsMutex.Unlock()
+	if len(xattrs) == 0 {
+		return nil
+	}
+
+	bucket := strings.TrimPrefix(p.rootDir, "/")
+	object := strings.TrimPrefix(pathname, p.rootDir+"/")
+
+	var info minio.ObjectInfo
+	err := p.retry.Do(func() error {
+		var err error
+		info, err = p.minioClient.StatObject(context.Background(), bucket, object, minio.StatObjectOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]string, len(info.UserMetadata)+len(xattrs))
+	for k, v := range info.UserMetadata {
+		metadata[k] = v
+	}
+	for k, v := range xattrs {
+		metadata[k] = v
+	}
+
+	return p.retry.Do(func() error {
+		_, err := p.minioClient.CopyObject(context.Background(),
+			minio.CopyDestOptions{
+				Bucket:          bucket,
+				Object:          object,
+				UserMetadata:    metadata,
+				ReplaceMetadata: true,
+			},
+			minio.CopySrcOptions{
+				Bucket: bucket,
+				Object: object,
+			})
+		return err
+	})
+}
+
+func (p *S3Exporter) Capabilities() exporter.ExporterCaps {
+	// objects have no owner, mode or links, only metadata
+	return exporter.CapXattrs
+}
+
 func (p *S3Exporter) Close() error {
 	return nil
 }
@@ -1,14 +1,23 @@
 package s3
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,3 +60,160 @@ func TestExporter(t *testing.T) {
 	err = exporterInstance.SetPermissions("bucket/subdir", &objects.FileInfo{Lmode: 0644})
 	require.NoError(t, err)
 }
+
+// failingReader returns err once the content of rd is exhausted.
+type failingReader struct {
+	rd  io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.rd.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestExporterMultipart(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	defer ts.Close()
+
+	location := "s3://" + ts.Listener.Addr().String() + "/bucket"
+	config := map[string]string{"location": location, "access_key": "", "secret_access_key": "", "use_tls": "false", "part_size": "5MiB"}
+
+	exporterInstance, err := exporter.NewExporter(config)
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	// spans three parts, the last one partial, from a reader that can't seek
+	content := make([]byte, 12<<20)
+	rand.New(rand.NewSource(42)).Read(content)
+	err = exporterInstance.StoreFile("/bucket/large.bin", io.MultiReader(bytes.NewReader(content)))
+	require.NoError(t, err)
+
+	err = exporterInstance.StoreFile("/bucket/small.txt", bytes.NewBufferString("test exporter s3"))
+	require.NoError(t, err)
+
+	client := exporterInstance.(*S3Exporter).minioClient
+	for object, expected := range map[string][]byte{"large.bin": content, "small.txt": []byte("test exporter s3")} {
+		obj, err := client.GetObject(context.Background(), "bucket", object, minio.GetObjectOptions{})
+		require.NoError(t, err)
+		data, err := io.ReadAll(obj)
+		require.NoError(t, err)
+		obj.Close()
+		require.Equal(t, expected, data, object)
+	}
+
+	// a failure after the first part abandons the upload
+	err = exporterInstance.StoreFile("/bucket/failed.bin", &failingReader{
+		rd:  bytes.NewReader(content[:6<<20]),
+		err: errors.New("read failure"),
+	})
+	require.EqualError(t, err, "read failure")
+	_, err = client.StatObject(context.Background(), "bucket", "failed.bin", minio.StatObjectOptions{})
+	require.Error(t, err)
+	uploads, err := minio.Core{Client: client}.ListMultipartUploads(context.Background(), "bucket", "failed.bin", "", "", "", 10)
+	require.NoError(t, err)
+	require.Empty(t, uploads.Uploads)
+
+	for _, value := range []string{"1MiB", "6GiB", "lots"} {
+		config["part_size"] = value
+		_, err = exporter.NewExporter(config)
+		require.EqualError(t, err, "invalid part_size value", value)
+	}
+}
+
+func TestExporterUnchangedFiles(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	var puts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path != "/bucket" {
+			puts.Add(1)
+		}
+		faker.Server().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	location := "s3://" + ts.Listener.Addr().String() + "/bucket"
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": location, "access_key": "", "secret_access_key": "", "use_tls": "false"})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+	storer := exporterInstance.(exporter.ChecksumStorer)
+
+	files := map[string]objects.MAC{"/bucket/a.txt": {1}, "/bucket/subdir/b.txt": {2}}
+	restore := func() int32 {
+		puts.Store(0)
+		for pathname, checksum := range files {
+			_, err := storer.StoreFileWithChecksum(pathname, bytes.NewBufferString(pathname), checksum)
+			require.NoError(t, err)
+		}
+		return puts.Load()
+	}
+
+	require.Equal(t, int32(2), restore())
+	// the second restore to the same bucket uploads nothing
+	require.Equal(t, int32(0), restore())
+
+	// a file whose checksum differs is uploaded again, as is one stored
+	// without checksum
+	files["/bucket/a.txt"] = objects.MAC{3}
+	require.NoError(t, exporterInstance.StoreFile("/bucket/subdir/b.txt", bytes.NewBufferString("plain")))
+	// the fake store carries the metadata of a replaced object over
+	info, err := exporterInstance.(*S3Exporter).minioClient.StatObject(context.Background(), "bucket", "subdir/b.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	require.Empty(t, info.UserMetadata[checksumKey])
+	require.Equal(t, int32(2), restore())
+
+	// setting an attribute keeps the checksum
+	require.NoError(t, exporterInstance.SetXattr("/bucket/a.txt", "user.origin", []byte("plakar"), objects.AttributeExtended))
+	require.NoError(t, exporterInstance.(exporter.XattrFlusher).FlushXattrs("/bucket/a.txt"))
+	stored, err := storer.StoreFileWithChecksum("/bucket/a.txt", bytes.NewBufferString("a"), objects.MAC{3})
+	require.NoError(t, err)
+	require.False(t, stored)
+}
+
+func TestExporterXattrs(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	var copies atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			copies.Add(1)
+		}
+		faker.Server().ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	location := "s3://" + ts.Listener.Addr().String() + "/bucket"
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": location, "access_key": "", "secret_access_key": "", "use_tls": "false"})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+	flusher := exporterInstance.(exporter.XattrFlusher)
+
+	require.NoError(t, exporterInstance.StoreFile("/bucket/a.txt", bytes.NewBufferString("a")))
+	xattrs := map[string]string{"user.a": "1", "user.b": "2", "user.c": "3"}
+	for name, value := range xattrs {
+		require.NoError(t, exporterInstance.SetXattr("/bucket/a.txt", name, []byte(value), objects.AttributeExtended))
+	}
+	require.ErrorIs(t, exporterInstance.SetXattr("/bucket/a.txt", "stream", []byte("ads"), objects.AttributeADS), exporter.ErrNotSupported)
+	require.Equal(t, int32(0), copies.Load())
+
+	// all the attributes are applied by a single copy
+	require.NoError(t, flusher.FlushXattrs("/bucket/a.txt"))
+	require.Equal(t, int32(1), copies.Load())
+
+	info, err := exporterInstance.(*S3Exporter).minioClient.StatObject(context.Background(), "bucket", "a.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	for name, value := range xattrs {
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte(value)), info.UserMetadata[http.CanonicalHeaderKey("Xattr-"+name)], name)
+	}
+
+	// nothing is left to apply
+	require.NoError(t, flusher.FlushXattrs("/bucket/a.txt"))
+	require.NoError(t, flusher.FlushXattrs("/bucket/b.txt"))
+	require.Equal(t, int32(1), copies.Load())
+}
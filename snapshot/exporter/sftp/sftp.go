@@ -36,6 +36,7 @@ import (
 type SFTPExporter struct {
 	location string
 	client   *sftp.Client
+	retry    *exporter.RetryPolicy
 }
 
 func init() {
@@ -147,6 +148,11 @@ func NewSFTPExporter(config map[string]string) (exporter.Exporter, error) {
 		return nil, err
 	}
 
+	retry, err := exporter.NewRetryPolicy(config)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := connect(parsed)
 	if err != nil {
 		return nil, err
@@ -154,6 +160,7 @@ func NewSFTPExporter(config map[string]string) (exporter.Exporter, error) {
 	return &SFTPExporter{
 		location: parsed.Path,
 		client:   client,
+		retry:    retry,
 	}, nil
 }
 
@@ -163,10 +170,18 @@ func (p *SFTPExporter) Root() string {
 }
 
 func (p *SFTPExporter) CreateDirectory(pathname string) error {
-	return p.client.MkdirAll(pathname)
+	return p.retry.Do(func() error {
+		return p.client.MkdirAll(pathname)
+	})
 }
 
 func (p *SFTPExporter) StoreFile(pathname string, fp io.Reader) error {
+	return p.retry.StoreFile(fp, func(rd io.Reader) error {
+		return p.storeFile(pathname, rd)
+	})
+}
+
+func (p *SFTPExporter) storeFile(pathname string, fp io.Reader) error {
 	f, err := p.client.Create(pathname)
 	if err != nil {
 		return err
@@ -187,6 +202,10 @@ func (p *SFTPExporter) StoreFile(pathname string, fp io.Reader) error {
 }
 
 func (p *SFTPExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	// chmod and chown follow symlinks over SFTP, leave them alone
+	if fileinfo.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
 	if err := p.client.Chmod(pathname, fileinfo.Mode()); err != nil {
 		return err
 	}
@@ -198,6 +217,23 @@ func (p *SFTPExporter) SetPermissions(pathname string, fileinfo *objects.FileInf
 	return nil
 }
 
+func (p *SFTPExporter) CreateSymlink(oldname string, newname string) error {
+	return p.client.Symlink(oldname, newname)
+}
+
+func (p *SFTPExporter) CreateHardlink(oldname string, newname string) error {
+	return p.client.Link(oldname, newname)
+}
+
+func (p *SFTPExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	// the SFTP protocol version implemented by the server has no xattrs
+	return exporter.ErrNotSupported
+}
+
+func (p *SFTPExporter) Capabilities() exporter.ExporterCaps {
+	return exporter.CapPermissions | exporter.CapSymlinks | exporter.CapHardlinks
+}
+
 func (p *SFTPExporter) Close() error {
 	return p.client.Close()
 }
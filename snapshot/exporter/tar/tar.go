@@ -0,0 +1,329 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tar
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+)
+
+// TarExporter writes the restored entries into a single tar archive.
+//
+// A tar header must carry the size and metadata of the entry before its
+// content, whereas restore calls StoreFile before SetPermissions: file
+// content is spooled to a temporary file by StoreFile and the entry is
+// appended to the archive once SetPermissions provides its metadata.
+// Symlinks and extended attributes are deferred the same way, hard
+// links are written right away as restore only creates them once their
+// target has been stored.
+type TarExporter struct {
+	fp  *os.File
+	gzw *gzip.Writer
+	tw  *tar.Writer
+
+	mu          sync.Mutex
+	directories map[string]bool
+	pending     map[string]*os.File
+	symlinks    map[string]string
+	xattrs      map[string]map[string]string
+}
+
+func init() {
+	exporter.Register("tar", NewTarExporter)
+	exporter.Register("tar+gz", NewTarExporter)
+}
+
+func NewTarExporter(config map[string]string) (exporter.Exporter, error) {
+	location := config["location"]
+
+	compress := false
+	if strings.HasPrefix(location, "tar+gz://") {
+		location = location[9:]
+		compress = true
+	} else if strings.HasPrefix(location, "tar://") {
+		location = location[6:]
+	}
+	if location == "" {
+		return nil, fmt.Errorf("missing archive path")
+	}
+
+	fp, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &TarExporter{
+		fp:          fp,
+		directories: make(map[string]bool),
+		pending:     make(map[string]*os.File),
+		symlinks:    make(map[string]string),
+		xattrs:      make(map[string]map[string]string),
+	}
+	if compress {
+		p.gzw = gzip.NewWriter(fp)
+		p.tw = tar.NewWriter(p.gzw)
+	} else {
+		p.tw = tar.NewWriter(fp)
+	}
+	return p, nil
+}
+
+func (p *TarExporter) Root() string {
+	return "/"
+}
+
+// entryName maps a restore pathname to a relative archive member name.
+func entryName(pathname string) string {
+	return strings.TrimLeft(pathname, "/")
+}
+
+func (p *TarExporter) CreateDirectory(pathname string) error {
+	name := entryName(pathname)
+	if name == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.directories[name]; !exists {
+		// false until SetPermissions emits the header
+		p.directories[name] = false
+	}
+	return nil
+}
+
+func (p *TarExporter) StoreFile(pathname string, fp io.Reader) error {
+	spool, err := os.CreateTemp("", "plakar-tar-*")
+	if err != nil {
+		return err
+	}
+	os.Remove(spool.Name())
+
+	if _, err := io.Copy(spool, fp); err != nil {
+		spool.Close()
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if previous, exists := p.pending[pathname]; exists {
+		previous.Close()
+	}
+	p.pending[pathname] = spool
+	return nil
+}
+
+func tarMode(fileinfo *objects.FileInfo) int64 {
+	mode := fileinfo.Mode()
+	ret := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		ret |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		ret |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		ret |= 01000
+	}
+	return ret
+}
+
+func (p *TarExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	name := entryName(pathname)
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    tarMode(fileinfo),
+		Uid:     int(fileinfo.Uid()),
+		Gid:     int(fileinfo.Gid()),
+		Uname:   fileinfo.Username(),
+		Gname:   fileinfo.Groupname(),
+		ModTime: fileinfo.ModTime(),
+		Format:  tar.FormatPAX,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if records, exists := p.xattrs[pathname]; exists {
+		hdr.PAXRecords = records
+		delete(p.xattrs, pathname)
+	}
+
+	if fileinfo.IsDir() {
+		if name == "" || p.directories[name] {
+			return nil
+		}
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name = name + "/"
+		if err := p.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		p.directories[name] = true
+		return nil
+	}
+
+	if fileinfo.Mode()&os.ModeSymlink != 0 {
+		target, exists := p.symlinks[pathname]
+		if !exists {
+			return fmt.Errorf("%s: no symlink created", pathname)
+		}
+		delete(p.symlinks, pathname)
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		return p.tw.WriteHeader(hdr)
+	}
+
+	spool, exists := p.pending[pathname]
+	if !exists {
+		return fmt.Errorf("%s: no content stored", pathname)
+	}
+	delete(p.pending, pathname)
+	return p.writeFile(hdr, spool)
+}
+
+// writeFile appends a regular file entry with the content of spool, which
+// it closes.
+func (p *TarExporter) writeFile(hdr *tar.Header, spool *os.File) error {
+	defer spool.Close()
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	hdr.Typeflag = tar.TypeReg
+	hdr.Size = size
+	if err := p.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(p.tw, spool, size)
+	return err
+}
+
+func (p *TarExporter) CreateSymlink(oldname string, newname string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.symlinks[newname] = oldname
+	return nil
+}
+
+func (p *TarExporter) CreateHardlink(oldname string, newname string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     entryName(newname),
+		Linkname: entryName(oldname),
+		Format:   tar.FormatPAX,
+	})
+}
+
+// SetXattr records the attribute as a SCHILY.xattr PAX record, the form
+// GNU tar and bsdtar use, to be written with the header of the entry.
+func (p *TarExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	if typ != objects.AttributeExtended {
+		return exporter.ErrNotSupported
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.xattrs[pathname]; !exists {
+		p.xattrs[pathname] = make(map[string]string)
+	}
+	p.xattrs[pathname]["SCHILY.xattr."+name] = string(value)
+	return nil
+}
+
+func (p *TarExporter) Capabilities() exporter.ExporterCaps {
+	return exporter.CapAll
+}
+
+func (p *TarExporter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// entries that never had their permissions set still get a header
+	var errs []error
+	for pathname, spool := range p.pending {
+		delete(p.pending, pathname)
+		err := p.writeFile(&tar.Header{
+			Name:       entryName(pathname),
+			Mode:       0644,
+			PAXRecords: p.xattrs[pathname],
+			Format:     tar.FormatPAX,
+		}, spool)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+	for pathname, spool := range p.pending {
+		spool.Close()
+		delete(p.pending, pathname)
+	}
+	for pathname, target := range p.symlinks {
+		err := p.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     entryName(pathname),
+			Linkname: target,
+			Mode:     0777,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		delete(p.symlinks, pathname)
+	}
+	for name, emitted := range p.directories {
+		if emitted {
+			continue
+		}
+		err := p.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name + "/",
+			Mode:     0755,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		p.directories[name] = true
+	}
+
+	errs = append(errs, p.tw.Close())
+	if p.gzw != nil {
+		errs = append(errs, p.gzw.Close())
+	}
+	errs = append(errs, p.fp.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/stretchr/testify/require"
+)
+
+func populate(t *testing.T, exporterInstance exporter.Exporter, mtime time.Time) {
+	require.Equal(t, "/", exporterInstance.Root())
+
+	err := exporterInstance.CreateDirectory("/subdir")
+	require.NoError(t, err)
+	err = exporterInstance.SetPermissions("/subdir", &objects.FileInfo{Lname: "subdir", Lmode: os.ModeDir | 0750, Luid: 1000, Lgid: 1000, LmodTime: mtime})
+	require.NoError(t, err)
+
+	err = exporterInstance.CreateDirectory("/subdir")
+	require.NoError(t, err)
+	err = exporterInstance.StoreFile("/subdir/dummy.txt", bytes.NewBufferString("test exporter tar"))
+	require.NoError(t, err)
+	err = exporterInstance.SetPermissions("/subdir/dummy.txt", &objects.FileInfo{Lname: "dummy.txt", Lmode: 0640, Luid: 1000, Lgid: 1000, LmodTime: mtime})
+	require.NoError(t, err)
+
+	err = exporterInstance.Close()
+	require.NoError(t, err)
+}
+
+func checkArchive(t *testing.T, rd io.Reader, mtime time.Time) {
+	tr := tar.NewReader(rd)
+
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "subdir/", hdr.Name)
+	require.Equal(t, byte(tar.TypeDir), hdr.Typeflag)
+	require.Equal(t, int64(0750), hdr.Mode)
+	require.Equal(t, 1000, hdr.Uid)
+
+	hdr, err = tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "subdir/dummy.txt", hdr.Name)
+	require.Equal(t, byte(tar.TypeReg), hdr.Typeflag)
+	require.Equal(t, int64(0640), hdr.Mode)
+	require.Equal(t, 1000, hdr.Gid)
+	require.Equal(t, int64(len("test exporter tar")), hdr.Size)
+	require.True(t, mtime.Equal(hdr.ModTime))
+
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "test exporter tar", string(content))
+
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestExporter(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar")
+	mtime := time.Unix(1700000000, 0)
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": "tar://" + archive})
+	require.NoError(t, err)
+	populate(t, exporterInstance, mtime)
+
+	fp, err := os.Open(archive)
+	require.NoError(t, err)
+	defer fp.Close()
+	checkArchive(t, fp, mtime)
+}
+
+func TestExporterGzip(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	mtime := time.Unix(1700000000, 0)
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": "tar+gz://" + archive})
+	require.NoError(t, err)
+	populate(t, exporterInstance, mtime)
+
+	fp, err := os.Open(archive)
+	require.NoError(t, err)
+	defer fp.Close()
+
+	gzr, err := gzip.NewReader(fp)
+	require.NoError(t, err)
+	checkArchive(t, gzr, mtime)
+}
+
+func TestExporterExisting(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar")
+	err := os.WriteFile(archive, []byte("precious"), 0644)
+	require.NoError(t, err)
+
+	_, err = exporter.NewExporter(map[string]string{"location": "tar://" + archive})
+	require.Error(t, err)
+}
+
+func TestExporterClosePending(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "backup.tar")
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": "tar://" + archive})
+	require.NoError(t, err)
+
+	// the permissions of the file are never set, as when restore fails
+	require.NoError(t, exporterInstance.StoreFile("/pending.txt", bytes.NewBufferString("pending content")))
+	require.NoError(t, exporterInstance.Close())
+
+	fp, err := os.Open(archive)
+	require.NoError(t, err)
+	defer fp.Close()
+	tr := tar.NewReader(fp)
+
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "pending.txt", hdr.Name)
+	require.Equal(t, byte(tar.TypeReg), hdr.Typeflag)
+	require.Equal(t, int64(0644), hdr.Mode)
+
+	content, err := io.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "pending content", string(content))
+
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+}
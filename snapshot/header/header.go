@@ -30,6 +30,7 @@ type Importer struct {
 type Identity struct {
 	Identifier uuid.UUID `msgpack:"identifier" json:"identifier"`
 	PublicKey  []byte    `msgpack:"public_key" json:"public_key"`
+	Signature  []byte    `msgpack:"signature,omitempty" json:"signature,omitempty"`
 }
 
 type Class struct {
@@ -132,6 +133,17 @@ func (h *Header) Serialize() ([]byte, error) {
 	}
 }
 
+// SignedPayload returns the serialization of the header covered by its
+// signature, which includes the MACs of the VFS and indexes so that the
+// content of the snapshot can't be swapped.  The identifier is left out,
+// it is only the name of the header in the repository.
+func (h *Header) SignedPayload() ([]byte, error) {
+	signed := *h
+	signed.Identifier = objects.MAC{}
+	signed.Identity.Signature = nil
+	return signed.Serialize()
+}
+
 func (h *Header) SetContext(key, value string) {
 	h.Context = append(h.Context, KeyValue{Key: key, Value: value})
 }
@@ -23,14 +23,23 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 	"github.com/pkg/xattr"
 )
 
 type FSImporter struct {
-	rootDir string
+	rootDir       string
+	oneFileSystem bool
+}
+
+// deviceOf returns the device holding the file described by info, it is
+// overridden by the tests to simulate mount points.
+var deviceOf = func(info os.FileInfo) uint64 {
+	return objects.FileInfoFromStat(info).Dev()
 }
 
 func init() {
@@ -50,8 +59,18 @@ func NewFSImporter(config map[string]string) (importer.Importer, error) {
 
 	location = path.Clean(location)
 
+	oneFileSystem := false
+	if value, ok := config["one_file_system"]; ok {
+		tmp, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid one_file_system value")
+		}
+		oneFileSystem = tmp
+	}
+
 	return &FSImporter{
-		rootDir: location,
+		rootDir:       location,
+		oneFileSystem: oneFileSystem,
 	}, nil
 }
 
@@ -68,7 +87,7 @@ func (p *FSImporter) Type() string {
 }
 
 func (p *FSImporter) Scan() (<-chan *importer.ScanResult, error) {
-	return walkDir_walker(p.rootDir, 256)
+	return walkDir_walker(p.rootDir, 256, p.oneFileSystem)
 }
 
 func (p *FSImporter) NewReader(pathname string) (io.ReadCloser, error) {
@@ -83,7 +102,7 @@ func (p *FSImporter) NewExtendedAttributeReader(pathname string, attribute strin
 		pathname = pathname[1:]
 	}
 
-	data, err := xattr.Get(pathname, attribute)
+	data, err := xattr.LGet(pathname, attribute)
 	if err != nil {
 		return nil, err
 	}
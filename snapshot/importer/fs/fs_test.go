@@ -2,7 +2,10 @@ package fs
 
 import (
 	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -68,3 +71,53 @@ func TestFSImporter(t *testing.T) {
 	err = importer.Close()
 	require.NoError(t, err)
 }
+
+func TestFSImporterOneFileSystem(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"subdir", "mnt/nested"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	for _, file := range []string{"subdir/local.txt", "mnt/remote.txt", "mnt/nested/deep.txt", "top.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(file), 0644))
+	}
+
+	// mnt is the mount point of another device
+	defer func(orig func(os.FileInfo) uint64) { deviceOf = orig }(deviceOf)
+	deviceOf = func(info os.FileInfo) uint64 {
+		if info.Name() == "mnt" {
+			return 2
+		}
+		return 1
+	}
+
+	for _, oneFileSystem := range []bool{false, true} {
+		imp, err := NewFSImporter(map[string]string{
+			"location":        root,
+			"one_file_system": strconv.FormatBool(oneFileSystem),
+		})
+		require.NoError(t, err)
+
+		scanChan, err := imp.Scan()
+		require.NoError(t, err)
+
+		paths := []string{}
+		for record := range scanChan {
+			require.Nil(t, record.Error)
+			if record.Record.IsXattr || !strings.HasPrefix(record.Record.Pathname, root+"/") {
+				continue
+			}
+			paths = append(paths, record.Record.Pathname[len(root)+1:])
+		}
+
+		// the mount point is kept, its content is not
+		expected := []string{"mnt", "subdir", "subdir/local.txt", "top.txt"}
+		if !oneFileSystem {
+			expected = append(expected, "mnt/nested", "mnt/nested/deep.txt", "mnt/remote.txt")
+		}
+		require.ElementsMatch(t, expected, paths, "one file system: %v", oneFileSystem)
+		require.NoError(t, imp.Close())
+	}
+
+	_, err := NewFSImporter(map[string]string{"location": root, "one_file_system": "maybe"})
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// walkDir_readers bounds the directories read concurrently while walking
+// the tree, the entries found being handed to the workers for inspection.
+const walkDir_readers = 16
+
+// walkDir_traverse sends to jobs rootDir and every pathname below it,
+// without following symbolic links, reading up to numReaders directories
+// at once.  Pathnames are sent in no particular order.  With oneFileSystem,
+// the directories on another device than rootDir are sent but not read.
+func walkDir_traverse(rootDir string, numReaders int, oneFileSystem bool, jobs chan<- string, results chan<- *importer.ScanResult) {
+	info, err := os.Lstat(rootDir)
+	if err != nil {
+		results <- importer.NewScanError(rootDir, err)
+		return
+	}
+	jobs <- rootDir
+	if !info.IsDir() {
+		return
+	}
+
+	// the device subdirectories must be on to be read, when restricted
+	var rootDev *uint64
+	if oneFileSystem {
+		dev := deviceOf(info)
+		rootDev = &dev
+	}
+
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	queue := []string{rootDir}
+	// directories queued or being read, the walk is over when it drops
+	// to zero
+	pending := 1
+
+	var wg sync.WaitGroup
+	for range numReaders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(queue) == 0 && pending != 0 {
+					cond.Wait()
+				}
+				if pending == 0 {
+					mu.Unlock()
+					return
+				}
+				// depth first, so that the queue stays small
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				mu.Unlock()
+
+				subdirs := walkDir_readDir(dir, rootDev, jobs, results)
+
+				mu.Lock()
+				queue = append(queue, subdirs...)
+				pending += len(subdirs) - 1
+				if pending == 0 || len(subdirs) != 0 {
+					cond.Broadcast()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// walkDir_readDir sends to jobs the entries of dir and returns those which
+// are directories, on device rootDev if it is not nil.
+func walkDir_readDir(dir string, rootDev *uint64, jobs chan<- string, results chan<- *importer.ScanResult) []string {
+	// on error, the entries read so far are still returned
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		results <- importer.NewScanError(dir, err)
+	}
+
+	var subdirs []string
+	for _, entry := range entries {
+		pathname := filepath.Join(dir, entry.Name())
+		jobs <- pathname
+		if !entry.IsDir() {
+			continue
+		}
+		if rootDev != nil {
+			info, err := entry.Info()
+			if err != nil {
+				results <- importer.NewScanError(pathname, err)
+				continue
+			}
+			if deviceOf(info) != *rootDev {
+				continue
+			}
+		}
+		subdirs = append(subdirs, pathname)
+	}
+	return subdirs
+}
@@ -0,0 +1,96 @@
+package fs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/stretchr/testify/require"
+)
+
+// generateTree creates below root a tree of directories depth levels deep,
+// each directory holding fanout subdirectories and files.
+func generateTree(t testing.TB, root string, depth, fanout int) {
+	if depth == 0 {
+		return
+	}
+	for i := range fanout {
+		err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%d", i)), []byte("content"), 0644)
+		require.NoError(t, err)
+
+		subdir := filepath.Join(root, fmt.Sprintf("dir%d", i))
+		require.NoError(t, os.Mkdir(subdir, 0755))
+		generateTree(t, subdir, depth-1, fanout)
+	}
+}
+
+// traverse collects the pathnames and errors walkDir_traverse reports.
+func traverse(root string, numReaders int) ([]string, []*importer.ScanResult) {
+	jobs := make(chan string, 1000)
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(jobs)
+		walkDir_traverse(root, numReaders, false, jobs, results)
+	}()
+
+	pathnames := []string{}
+	for pathname := range jobs {
+		pathnames = append(pathnames, pathname)
+	}
+	close(results)
+
+	errors := []*importer.ScanResult{}
+	for result := range results {
+		errors = append(errors, result)
+	}
+	return pathnames, errors
+}
+
+func TestWalkDirTraverse(t *testing.T) {
+	root := t.TempDir()
+	generateTree(t, root, 4, 4)
+	require.NoError(t, os.Symlink(filepath.Join(root, "dir0"), filepath.Join(root, "link")))
+
+	expected := []string{}
+	err := filepath.WalkDir(root, func(pathname string, d fs.DirEntry, err error) error {
+		expected = append(expected, pathname)
+		return err
+	})
+	require.NoError(t, err)
+
+	for _, numReaders := range []int{1, 4, walkDir_readers} {
+		pathnames, errors := traverse(root, numReaders)
+		require.Empty(t, errors)
+		sort.Strings(pathnames)
+		require.Equal(t, expected, pathnames, "%d readers", numReaders)
+	}
+}
+
+func TestWalkDirTraverseErrors(t *testing.T) {
+	pathnames, errors := traverse(filepath.Join(t.TempDir(), "missing"), walkDir_readers)
+	require.Empty(t, pathnames)
+	require.Len(t, errors, 1)
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), []byte("content"), 0644))
+	pathnames, errors = traverse(filepath.Join(root, "file"), walkDir_readers)
+	require.Equal(t, []string{filepath.Join(root, "file")}, pathnames)
+	require.Empty(t, errors)
+}
+
+func BenchmarkWalkDirTraverse(b *testing.B) {
+	root := b.TempDir()
+	generateTree(b, root, 6, 4)
+
+	for _, numReaders := range []int{1, walkDir_readers} {
+		b.Run(fmt.Sprintf("readers=%d", numReaders), func(b *testing.B) {
+			for range b.N {
+				traverse(root, numReaders)
+			}
+		})
+	}
+}
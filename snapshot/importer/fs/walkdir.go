@@ -21,7 +21,6 @@ package fs
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -51,7 +50,7 @@ func walkDir_worker(jobs <-chan string, results chan<- *importer.ScanResult, wg
 			continue
 		}
 
-		extendedAttributes, err := xattr.List(path)
+		extendedAttributes, err := xattr.LList(path)
 		if err != nil {
 			results <- importer.NewScanError(path, err)
 			continue
@@ -123,7 +122,7 @@ func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results ch
 	}
 }
 
-func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult, error) {
+func walkDir_walker(rootDir string, numWorkers int, oneFileSystem bool) (<-chan *importer.ScanResult, error) {
 	results := make(chan *importer.ScanResult, 1000) // Larger buffer for results
 	jobs := make(chan string, 1000)                  // Buffered channel to feed paths to workers
 	namecache := &namecache{
@@ -169,17 +168,7 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult
 			walkDir_addPrefixDirectories(orig, jobs, results)
 		}
 
-		err = filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				results <- importer.NewScanError(path, err)
-				return nil
-			}
-			jobs <- path
-			return nil
-		})
-		if err != nil {
-			results <- importer.NewScanError(rootDir, err)
-		}
+		walkDir_traverse(rootDir, walkDir_readers, oneFileSystem, jobs, results)
 	}()
 
 	// Close the results channel when all workers are done
@@ -18,7 +18,6 @@ package fs
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -111,7 +110,7 @@ func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results ch
 	}
 }
 
-func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult, error) {
+func walkDir_walker(rootDir string, numWorkers int, oneFileSystem bool) (<-chan *importer.ScanResult, error) {
 	results := make(chan *importer.ScanResult, 1000) // Larger buffer for results
 	jobs := make(chan string, 1000)                  // Buffered channel to feed paths to workers
 	var wg sync.WaitGroup
@@ -148,17 +147,7 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan *importer.ScanResult
 		// Add prefix directories first
 		walkDir_addPrefixDirectories(rootDir, jobs, results)
 
-		err = filepath.WalkDir(rootDir, func(pathname string, d fs.DirEntry, err error) error {
-			if err != nil {
-				results <- importer.NewScanError(pathname, err)
-				return nil
-			}
-			jobs <- pathname
-			return nil
-		})
-		if err != nil {
-			results <- importer.NewScanError(rootDir, err)
-		}
+		walkDir_traverse(rootDir, walkDir_readers, oneFileSystem, jobs, results)
 	}()
 
 	// Close the results channel when all workers are done
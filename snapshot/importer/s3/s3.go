@@ -62,17 +62,21 @@ func NewS3Importer(config map[string]string) (importer.Importer, error) {
 
 	location := config["location"]
 	var accessKey string
-	if tmp, ok := config["access_key"]; !ok {
-		return nil, fmt.Errorf("missing access_key")
-	} else {
+	if tmp, ok := config["access_key"]; ok {
+		accessKey = tmp
+	} else if tmp, ok := os.LookupEnv("AWS_ACCESS_KEY_ID"); ok {
 		accessKey = tmp
+	} else {
+		return nil, fmt.Errorf("missing access_key")
 	}
 
 	var secretAccessKey string
-	if tmp, ok := config["secret_access_key"]; !ok {
-		return nil, fmt.Errorf("missing secret_access_key")
-	} else {
+	if tmp, ok := config["secret_access_key"]; ok {
+		secretAccessKey = tmp
+	} else if tmp, ok := os.LookupEnv("AWS_SECRET_ACCESS_KEY"); ok {
 		secretAccessKey = tmp
+	} else {
+		return nil, fmt.Errorf("missing secret_access_key")
 	}
 
 	useSsl := true
@@ -131,12 +135,10 @@ func (p *S3Importer) scanRecursive(prefix string, result chan *importer.ScanResu
 		}
 	}
 
-	var currentName string
-	if prefix == "" {
-		currentName = "/"
-	} else {
-		currentName = filepath.Base(prefix)
-	}
+	// the common prefixes listed end with a slash, the directories of the
+	// VFS don't
+	currentPath := "/" + strings.TrimSuffix(prefix, "/")
+	currentName := filepath.Base(currentPath)
 
 	fi := objects.NewFileInfo(
 		currentName,
@@ -149,7 +151,7 @@ func (p *S3Importer) scanRecursive(prefix string, result chan *importer.ScanResu
 		0,
 		0,
 	)
-	result <- importer.NewScanRecord("/"+prefix, "", fi, nil)
+	result <- importer.NewScanRecord(currentPath, "", fi, nil)
 }
 
 func (p *S3Importer) Scan() (<-chan *importer.ScanResult, error) {
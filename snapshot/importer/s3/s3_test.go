@@ -1,11 +1,17 @@
 package s3
 
 import (
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
 	"github.com/stretchr/testify/require"
@@ -78,3 +84,83 @@ func TestS3Importer(t *testing.T) {
 	err = importer.Close()
 	require.NoError(t, err)
 }
+
+func TestS3ImporterCredentialsFromEnvironment(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		// restored at the end of the test
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	_, err := NewS3Importer(map[string]string{"location": "s3://localhost/bucket"})
+	require.EqualError(t, err, "missing access_key")
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "access")
+	_, err = NewS3Importer(map[string]string{"location": "s3://localhost/bucket"})
+	require.EqualError(t, err, "missing secret_access_key")
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	importer, err := NewS3Importer(map[string]string{"location": "s3://localhost/bucket"})
+	require.NoError(t, err)
+	require.NotNil(t, importer)
+}
+
+func TestS3ImporterBackup(t *testing.T) {
+	backend := s3mem.New()
+	faker := gofakes3.New(backend)
+	ts := httptest.NewServer(faker.Server())
+	defer ts.Close()
+
+	mtime := time.Now().Truncate(time.Second)
+	objects := map[string]string{
+		"photos/2024/beach.jpg": "jpeg data",
+		"photos/2024/city.jpg":  "more jpeg data",
+		"notes.txt":             "hello s3",
+	}
+	require.NoError(t, backend.CreateBucket("bucket"))
+	// set by the server on uploads, but not when writing to the backend
+	meta := map[string]string{"Last-Modified": time.Now().UTC().Format(http.TimeFormat)}
+	for key, content := range objects {
+		_, err := backend.PutObject("bucket", key, meta, strings.NewReader(content), int64(len(content)))
+		require.NoError(t, err)
+	}
+
+	imp, err := NewS3Importer(map[string]string{"location": "s3://" + ts.Listener.Addr().String() + "/bucket", "access_key": "", "secret_access_key": "", "use_tls": "false"})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	base := ptesting.GenerateSnapshot(t, nil, nil, nil, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	snap.Close()
+
+	snap, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	for key, content := range objects {
+		entry, err := fs.GetEntry("/" + key)
+		require.NoError(t, err, key)
+		require.True(t, entry.Stat().Mode().IsRegular(), key)
+		require.Equal(t, int64(len(content)), entry.Stat().Size(), key)
+		require.False(t, entry.Stat().ModTime().Before(mtime), key)
+
+		rd, err := snap.NewReader("/" + key)
+		require.NoError(t, err, key)
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		rd.Close()
+		require.Equal(t, content, string(data), key)
+	}
+
+	entry, err := fs.GetEntry("/photos/2024")
+	require.NoError(t, err)
+	require.True(t, entry.Stat().IsDir())
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2025 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+const xattrPrefix = "SCHILY.xattr."
+
+// TarImporter backs up the entries of an uncompressed tar archive as if
+// they were extracted at the root of a file system.
+//
+// The archive is read once by Scan, which records where the content of
+// each regular file starts so that NewReader can read it directly from
+// the archive, and keeps the extended attributes found in the SCHILY.xattr
+// PAX records, the form written by the tar exporter.
+type TarImporter struct {
+	location string
+	fp       *os.File
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	record *importer.ScanRecord
+	offset int64
+	xattrs map[string][]byte
+}
+
+func init() {
+	importer.Register("tar", NewTarImporter)
+}
+
+func NewTarImporter(config map[string]string) (importer.Importer, error) {
+	location := strings.TrimPrefix(config["location"], "tar://")
+	if location == "" {
+		return nil, fmt.Errorf("missing archive path")
+	}
+
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+
+	fp, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TarImporter{
+		location: location,
+		fp:       fp,
+		entries:  make(map[string]*entry),
+	}, nil
+}
+
+func (p *TarImporter) Origin() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return hostname
+}
+
+func (p *TarImporter) Type() string {
+	return "tar"
+}
+
+func (p *TarImporter) Root() string {
+	return "/"
+}
+
+// isSparse reports whether the content of hdr is stored as a sparse map,
+// which can't be read as a contiguous section of the archive.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+func fileMode(hdr *tar.Header) os.FileMode {
+	mode := os.FileMode(hdr.Mode).Perm()
+	if hdr.Mode&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if hdr.Mode&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if hdr.Mode&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		mode |= os.ModeDir
+	case tar.TypeSymlink:
+		mode |= os.ModeSymlink
+	case tar.TypeChar:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case tar.TypeBlock:
+		mode |= os.ModeDevice
+	case tar.TypeFifo:
+		mode |= os.ModeNamedPipe
+	}
+	return mode
+}
+
+// read parses the whole archive, returning its entries and their pathnames
+// in archive order.  A pathname appearing several times keeps the last
+// entry, as it would when extracting.
+func (p *TarImporter) read(results chan<- *importer.ScanResult) (map[string]*entry, []string, error) {
+	fp, err := os.Open(p.location)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fp.Close()
+
+	entries := make(map[string]*entry)
+	pathnames := []string{}
+	var ino uint64
+
+	tr := tar.NewReader(fp)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pathname := path.Join("/", hdr.Name)
+		if isSparse(hdr) {
+			results <- importer.NewScanError(pathname, fmt.Errorf("sparse files are not supported"))
+			continue
+		}
+
+		// tar.Reader doesn't read ahead: the file now points at the content
+		offset, err := fp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		size := hdr.Size
+		target := ""
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeFifo, tar.TypeDir:
+		case tar.TypeSymlink:
+			target = hdr.Linkname
+		case tar.TypeLink:
+			// a hard link shares the content of an earlier entry
+			original, exists := entries[path.Join("/", hdr.Linkname)]
+			if !exists || !original.record.FileInfo.Mode().IsRegular() {
+				results <- importer.NewScanError(pathname, fmt.Errorf("hard link to unknown file %s", hdr.Linkname))
+				continue
+			}
+			hdr.Typeflag = tar.TypeReg
+			offset = original.offset
+			size = original.record.FileInfo.Size()
+		default:
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			size = 0
+		}
+
+		ino++
+		fileinfo := objects.NewFileInfo(
+			path.Base(pathname),
+			size,
+			fileMode(hdr),
+			hdr.ModTime,
+			0,
+			ino,
+			uint64(hdr.Uid),
+			uint64(hdr.Gid),
+			1,
+		)
+		fileinfo.Lusername = hdr.Uname
+		fileinfo.Lgroupname = hdr.Gname
+
+		e := &entry{
+			offset: offset,
+			xattrs: make(map[string][]byte),
+		}
+		for key, value := range hdr.PAXRecords {
+			if name, found := strings.CutPrefix(key, xattrPrefix); found {
+				e.xattrs[name] = []byte(value)
+			}
+		}
+		names := make([]string, 0, len(e.xattrs))
+		for name := range e.xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		e.record = importer.NewScanRecord(pathname, target, fileinfo, names).Record
+
+		if _, exists := entries[pathname]; !exists {
+			pathnames = append(pathnames, pathname)
+		}
+		entries[pathname] = e
+	}
+	return entries, pathnames, nil
+}
+
+// Scan emits the entries of the archive, followed by the directories that
+// only exist implicitly as the parent of an entry.
+func (p *TarImporter) Scan() (<-chan *importer.ScanResult, error) {
+	results := make(chan *importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		entries, pathnames, err := p.read(results)
+		if err != nil {
+			results <- importer.NewScanError(p.Root(), err)
+			return
+		}
+
+		p.mu.Lock()
+		p.entries = entries
+		p.mu.Unlock()
+
+		implicit := map[string]bool{"/": true}
+		for _, pathname := range pathnames {
+			for dir := path.Dir(pathname); dir != "/"; dir = path.Dir(dir) {
+				implicit[dir] = true
+			}
+		}
+
+		var mtime time.Time
+		if info, err := p.fp.Stat(); err == nil {
+			mtime = info.ModTime()
+		}
+
+		for _, pathname := range pathnames {
+			e := entries[pathname]
+			results <- &importer.ScanResult{Record: e.record}
+			for _, name := range e.record.ExtendedAttributes {
+				results <- importer.NewScanXattr(pathname, name, objects.AttributeExtended)
+			}
+		}
+
+		dirs := make([]string, 0, len(implicit))
+		for dir := range implicit {
+			if _, exists := entries[dir]; !exists {
+				dirs = append(dirs, dir)
+			}
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			fileinfo := objects.NewFileInfo(path.Base(dir), 0, 0755|os.ModeDir, mtime, 0, 0, 0, 0, 1)
+			results <- importer.NewScanRecord(dir, "", fileinfo, nil)
+		}
+	}()
+	return results, nil
+}
+
+func (p *TarImporter) lookup(pathname string) (*entry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, exists := p.entries[pathname]
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", pathname, os.ErrNotExist)
+	}
+	return e, nil
+}
+
+func (p *TarImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	e, err := p.lookup(pathname)
+	if err != nil {
+		return nil, err
+	}
+	if !e.record.FileInfo.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(p.fp, e.offset, e.record.FileInfo.Size())), nil
+}
+
+func (p *TarImporter) NewExtendedAttributeReader(pathname string, attribute string) (io.ReadCloser, error) {
+	e, err := p.lookup(pathname)
+	if err != nil {
+		return nil, err
+	}
+	value, exists := e.xattrs[attribute]
+	if !exists {
+		return nil, fmt.Errorf("%s: no extended attribute %s", pathname, attribute)
+	}
+	return io.NopCloser(bytes.NewReader(value)), nil
+}
+
+func (p *TarImporter) GetExtendedAttributes(pathname string) ([]importer.ExtendedAttributes, error) {
+	e, err := p.lookup(pathname)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([]importer.ExtendedAttributes, 0, len(e.xattrs))
+	for _, name := range e.record.ExtendedAttributes {
+		attrs = append(attrs, importer.ExtendedAttributes{Name: name, Value: e.xattrs[name]})
+	}
+	return attrs, nil
+}
+
+func (p *TarImporter) Close() error {
+	return p.fp.Close()
+}
@@ -0,0 +1,194 @@
+package tar
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+type archiveEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func archiveEntries(mtime time.Time) []archiveEntry {
+	return []archiveEntry{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0750, Uid: 1000, Gid: 1001, Uname: "alice", Gname: "staff", ModTime: mtime}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/hosts", Mode: 0640, Uid: 1000, Gid: 1001, ModTime: mtime,
+			PAXRecords: map[string]string{"SCHILY.xattr.user.origin": "plakar"}}, content: "127.0.0.1 localhost\n"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "etc/localhost", Linkname: "hosts", Mode: 0777, ModTime: mtime}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "etc/hosts.bak", Linkname: "etc/hosts", Mode: 0640, ModTime: mtime}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./usr/bin/run", Mode: 04755, ModTime: mtime}, content: strings.Repeat("#!/bin/sh\n", 1000)},
+	}
+}
+
+func writeArchive(t *testing.T, entries []archiveEntry) string {
+	archive := filepath.Join(t.TempDir(), "layer.tar")
+	fp, err := os.Create(archive)
+	require.NoError(t, err)
+	defer fp.Close()
+
+	tw := tar.NewWriter(fp)
+	for _, entry := range entries {
+		hdr := entry.hdr
+		hdr.Size = int64(len(entry.content))
+		hdr.Format = tar.FormatPAX
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return archive
+}
+
+func TestTarImporter(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	archive := writeArchive(t, archiveEntries(mtime))
+
+	imp, err := importer.NewImporter(map[string]string{"location": "tar://" + archive})
+	require.NoError(t, err)
+	defer imp.Close()
+	require.Equal(t, "tar", imp.Type())
+	require.Equal(t, "/", imp.Root())
+
+	scanChan, err := imp.Scan()
+	require.NoError(t, err)
+
+	records := map[string]*importer.ScanRecord{}
+	xattrs := []string{}
+	for result := range scanChan {
+		require.Nil(t, result.Error)
+		if result.Record.IsXattr {
+			xattrs = append(xattrs, result.Record.Pathname+":"+result.Record.XattrName)
+			continue
+		}
+		records[result.Record.Pathname] = result.Record
+	}
+	require.Equal(t, []string{"/etc/hosts:user.origin"}, xattrs)
+
+	pathnames := []string{}
+	for pathname := range records {
+		pathnames = append(pathnames, pathname)
+	}
+	require.ElementsMatch(t, []string{"/", "/etc", "/etc/hosts", "/etc/localhost", "/etc/hosts.bak", "/usr", "/usr/bin", "/usr/bin/run"}, pathnames)
+
+	etc := records["/etc"].FileInfo
+	require.True(t, etc.IsDir())
+	require.Equal(t, os.FileMode(0750), etc.Mode().Perm())
+	require.Equal(t, uint64(1000), etc.Uid())
+	require.Equal(t, uint64(1001), etc.Gid())
+	require.Equal(t, "alice", etc.Username())
+	require.Equal(t, "staff", etc.Groupname())
+	require.True(t, mtime.Equal(etc.ModTime()))
+
+	require.True(t, records["/usr/bin"].FileInfo.IsDir())
+	require.Equal(t, "hosts", records["/etc/localhost"].Target)
+	require.NotZero(t, records["/etc/localhost"].FileInfo.Mode()&os.ModeSymlink)
+	require.NotZero(t, records["/usr/bin/run"].FileInfo.Mode()&os.ModeSetuid)
+
+	for pathname, expected := range map[string]string{
+		"/etc/hosts":     "127.0.0.1 localhost\n",
+		"/etc/hosts.bak": "127.0.0.1 localhost\n",
+		"/usr/bin/run":   strings.Repeat("#!/bin/sh\n", 1000),
+	} {
+		require.True(t, records[pathname].FileInfo.Mode().IsRegular(), pathname)
+		require.Equal(t, int64(len(expected)), records[pathname].FileInfo.Size(), pathname)
+
+		rd, err := imp.NewReader(pathname)
+		require.NoError(t, err)
+		content, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		require.NoError(t, rd.Close())
+		require.Equal(t, expected, string(content), pathname)
+	}
+
+	_, err = imp.NewReader("/etc")
+	require.Error(t, err)
+
+	rd, err := imp.NewExtendedAttributeReader("/etc/hosts", "user.origin")
+	require.NoError(t, err)
+	value, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "plakar", string(value))
+}
+
+func TestTarImporterBackup(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	entries := archiveEntries(mtime)
+	archive := writeArchive(t, entries)
+
+	base := ptesting.GenerateSnapshot(t, nil, nil, nil, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	imp, err := importer.NewImporter(map[string]string{"location": "tar://" + archive})
+	require.NoError(t, err)
+	defer imp.Close()
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	require.NoError(t, snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1}))
+	snap.Close()
+
+	snap, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	// GetEntry follows symlinks, look the entries up in their parent instead
+	lookup := func(pathname string) *vfs.Entry {
+		children, err := fs.Children(path.Dir(pathname))
+		require.NoError(t, err, pathname)
+		for child, err := range children {
+			require.NoError(t, err)
+			if child.Path() == pathname {
+				return child
+			}
+		}
+		require.Fail(t, "entry not found", pathname)
+		return nil
+	}
+
+	for _, entry := range entries {
+		pathname := "/" + strings.Trim(strings.TrimPrefix(entry.hdr.Name, "./"), "/")
+		vfsEntry := lookup(pathname)
+
+		fileinfo := vfsEntry.Stat()
+		require.Equal(t, os.FileMode(entry.hdr.Mode).Perm(), fileinfo.Mode().Perm(), pathname)
+		require.Equal(t, uint64(entry.hdr.Uid), fileinfo.Uid(), pathname)
+		require.True(t, mtime.Equal(fileinfo.ModTime()), pathname)
+
+		switch entry.hdr.Typeflag {
+		case tar.TypeDir:
+			require.True(t, fileinfo.IsDir(), pathname)
+		case tar.TypeSymlink:
+			require.Equal(t, entry.hdr.Linkname, vfsEntry.SymlinkTarget, pathname)
+		default:
+			expected := entry.content
+			if entry.hdr.Typeflag == tar.TypeLink {
+				expected = entries[1].content
+			}
+			rd, err := snap.NewReader(pathname)
+			require.NoError(t, err, pathname)
+			content, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			rd.Close()
+			require.Equal(t, expected, string(content), pathname)
+		}
+	}
+
+	require.Equal(t, []string{"user.origin"}, lookup("/etc/hosts").ExtendedAttributes)
+}
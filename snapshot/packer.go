@@ -2,6 +2,7 @@ package snapshot
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/rand"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"io"
 	"math/big"
 	"runtime"
+	"slices"
 	"sync"
 	"time"
 
@@ -30,6 +32,11 @@ type PackerManager struct {
 	inflightMACs   map[resources.Type]*sync.Map
 	packerChan     chan interface{}
 	packerChanDone chan struct{}
+
+	// deterministic packs the blobs of each type through a single packer
+	// and writes them sorted by MAC, without padding, so that the same
+	// blobs always produce the same packfiles.
+	deterministic bool
 }
 
 func NewPackerManager(snapshot *Snapshot) *PackerManager {
@@ -58,7 +65,11 @@ func (mgr *PackerManager) Run() {
 				continue
 			}
 
-			packer.AddPadding(int(mgr.snapshot.repository.Configuration().Chunking.MinSize))
+			if mgr.deterministic {
+				packer = packer.sorted(mgr.snapshot.Repository().GetMACHasher())
+			} else {
+				packer.AddPadding(int(mgr.snapshot.repository.Configuration().Chunking.MinSize))
+			}
 
 			if err := mgr.snapshot.PutPackfile(packer); err != nil {
 				return fmt.Errorf("failed to flush packer: %w", err)
@@ -71,10 +82,17 @@ func (mgr *PackerManager) Run() {
 		return nil
 	})
 
+	workers := runtime.NumCPU()
+	if mgr.deterministic {
+		workers = 1
+	}
+
 	workerGroup, workerCtx := errgroup.WithContext(ctx)
-	for i := 0; i < runtime.NumCPU(); i++ {
+	for i := 0; i < workers; i++ {
 		workerGroup.Go(func() error {
-			var packer *Packer
+			// in deterministic mode, each type of blob gets its own
+			// packer so that metadata doesn't end up mixed with data.
+			packers := make(map[resources.Type]*Packer)
 
 			for {
 				select {
@@ -82,8 +100,10 @@ func (mgr *PackerManager) Run() {
 					return workerCtx.Err()
 				case msg, ok := <-mgr.packerChan:
 					if !ok {
-						if packer != nil && packer.Size() > 0 {
-							packerResultChan <- packer
+						for _, packer := range packers {
+							if packer.Size() > 0 {
+								packerResultChan <- packer
+							}
 						}
 						return nil
 					}
@@ -93,9 +113,18 @@ func (mgr *PackerManager) Run() {
 						return fmt.Errorf("unexpected message type")
 					}
 
-					if packer == nil {
+					var key resources.Type
+					if mgr.deterministic {
+						key = pm.Type
+					}
+
+					packer, ok := packers[key]
+					if !ok {
 						packer = NewPacker(mgr.snapshot.Repository().GetMACHasher())
-						packer.AddPadding(int(mgr.snapshot.repository.Configuration().Chunking.MinSize))
+						if !mgr.deterministic {
+							packer.AddPadding(int(mgr.snapshot.repository.Configuration().Chunking.MinSize))
+						}
+						packers[key] = packer
 					}
 
 					if !packer.AddBlobIfNotExists(pm.Type, pm.Version, pm.MAC, pm.Data, pm.Flags) {
@@ -104,7 +133,7 @@ func (mgr *PackerManager) Run() {
 
 					if packer.Size() > uint32(mgr.snapshot.repository.Configuration().Packfile.MaxSize) {
 						packerResultChan <- packer
-						packer = nil
+						delete(packers, key)
 					}
 				}
 			}
@@ -201,6 +230,27 @@ func (packer *Packer) AddBlobIfNotExists(Type resources.Type, version versioning
 	return true
 }
 
+// sorted returns a packer holding the same blobs ordered by MAC and dated
+// from the start of the day, so that packing the same blobs on the same day
+// yields the same packfile.  The packfile keeps a real date as maintenance
+// relies on it to spare the packfiles of the backups in progress.
+func (packer *Packer) sorted(hasher hash.Hash) *Packer {
+	index := slices.Clone(packer.Packfile.Index)
+	slices.SortFunc(index, func(a, b packfile.Blob) int {
+		if c := bytes.Compare(a.MAC[:], b.MAC[:]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Type, b.Type)
+	})
+
+	ret := NewPacker(hasher)
+	ret.Packfile.Footer.Timestamp = time.Now().UTC().Truncate(24 * time.Hour).UnixNano()
+	for _, blob := range index {
+		ret.AddBlobIfNotExists(blob.Type, blob.Version, blob.MAC, packer.Blobs[blob.Type][blob.MAC], blob.Flags)
+	}
+	return ret
+}
+
 func (packer *Packer) Size() uint32 {
 	return packer.Packfile.Size()
 }
@@ -213,17 +263,37 @@ func (packer *Packer) Types() []resources.Type {
 	return ret
 }
 
+// writable reports whether the snapshot is being built, the state it
+// writes to being swapped while a backup flushes it.
+func (snap *Snapshot) writable() bool {
+	snap.deltaMtx.RLock()
+	defer snap.deltaMtx.RUnlock()
+	return snap.deltaState != nil
+}
+
 func (snap *Snapshot) PutBlob(Type resources.Type, mac [32]byte, data []byte) error {
-	snap.Logger().Trace("snapshot", "%x: PutBlob(%s, %064x) len=%d", snap.Header.GetIndexShortID(), Type, mac, len(data))
+	return snap.putBlob(Type, mac, data, 0)
+}
 
-	if snap.deltaState != nil {
+// putBlob encodes and queues a blob for packing, blobs flagged with
+// packfile.FLAG_CLEARTEXT are compressed but not encrypted.
+func (snap *Snapshot) putBlob(Type resources.Type, mac [32]byte, data []byte, flags uint32) error {
+	snap.Logger().Trace("snapshot", "%x: PutBlob(%s, %064x) len=%d flags=%d", snap.Header.GetIndexShortID(), Type, mac, len(data), flags)
+
+	if snap.writable() {
 		if _, exists := snap.packerManager.inflightMACs[Type].LoadOrStore(mac, struct{}{}); exists {
 			// tell prom exporter that we collided a blob
 			return nil
 		}
 	}
 
-	encodedReader, err := snap.repository.Encode(bytes.NewReader(data))
+	var encodedReader io.Reader
+	var err error
+	if flags&packfile.FLAG_CLEARTEXT != 0 {
+		encodedReader, err = snap.repository.EncodeCleartext(bytes.NewReader(data))
+	} else {
+		encodedReader, err = snap.repository.Encode(bytes.NewReader(data))
+	}
 	if err != nil {
 		return err
 	}
@@ -233,7 +303,7 @@ func (snap *Snapshot) PutBlob(Type resources.Type, mac [32]byte, data []byte) er
 		return err
 	}
 
-	snap.packerManager.packerChan <- &PackerMsg{Type: Type, Version: versioning.GetCurrentVersion(Type), Timestamp: time.Now(), MAC: mac, Data: encoded}
+	snap.packerManager.packerChan <- &PackerMsg{Type: Type, Version: versioning.GetCurrentVersion(Type), Timestamp: time.Now(), MAC: mac, Data: encoded, Flags: flags}
 	return nil
 }
 
@@ -250,7 +320,7 @@ func (snap *Snapshot) GetBlob(Type resources.Type, mac [32]byte) ([]byte, error)
 func (snap *Snapshot) BlobExists(Type resources.Type, mac [32]byte) bool {
 	snap.Logger().Trace("snapshot", "%x: CheckBlob(%s, %064x)", snap.Header.GetIndexShortID(), Type, mac)
 
-	if snap.deltaState != nil {
+	if snap.writable() {
 		if _, exists := snap.packerManager.inflightMACs[Type].Load(mac); exists {
 			return true
 		}
@@ -1,10 +1,16 @@
 package snapshot
 
 import (
+	"errors"
 	"io"
 	"io/fs"
+	"iter"
 	"os"
 	"path"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/resources"
 )
 
 func (snapshot *Snapshot) NewReader(pathname string) (io.ReadCloser, error) {
@@ -30,3 +36,129 @@ func NewReader(snap *Snapshot, pathname string) (io.ReadCloser, error) {
 	}
 	return file, nil
 }
+
+// FileChunk is a chunk of a file along with the offset in the file at
+// which its content starts.
+type FileChunk struct {
+	Offset int64
+	objects.Chunk
+}
+
+// FileChunks yields the chunks of the regular file at pathname in file
+// order, their offsets being contiguous from zero to the file size.
+func (snap *Snapshot) FileChunks(pathname string) (iter.Seq2[FileChunk, error], error) {
+	fsc, err := snap.Filesystem()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := fsc.GetEntry(path.Clean(pathname))
+	if err != nil {
+		return nil, err
+	}
+	if !entry.Stat().Mode().IsRegular() {
+		return nil, os.ErrInvalid
+	}
+
+	return func(yield func(FileChunk, error) bool) {
+		if entry.ResolvedObject == nil {
+			return
+		}
+
+		offset := int64(0)
+		for _, chunk := range entry.ResolvedObject.Chunks {
+			if !yield(FileChunk{Offset: offset, Chunk: chunk}, nil) {
+				return
+			}
+			offset += int64(chunk.Length)
+		}
+	}, nil
+}
+
+// ReadRange returns a reader on the length bytes of the file at pathname
+// starting at offset, or up to the end of the file if fewer remain.  Only
+// the chunks overlapping the range are fetched.
+func (snap *Snapshot) ReadRange(pathname string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, os.ErrInvalid
+	}
+
+	chunks, err := snap.FileChunks(pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &rangeReader{repo: snap.repository}
+	end := offset + length
+	for chunk, err := range chunks {
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Offset+int64(chunk.Length) <= offset {
+			continue
+		}
+		if chunk.Offset >= end {
+			break
+		}
+		if len(rr.chunks) == 0 {
+			rr.skip = offset - chunk.Offset
+			rr.remaining = length
+		}
+		rr.chunks = append(rr.chunks, chunk.Chunk)
+	}
+	return rr, nil
+}
+
+type rangeReader struct {
+	repo      *repository.Repository
+	chunks    []objects.Chunk
+	skip      int64
+	remaining int64
+
+	current io.ReadCloser
+}
+
+func (rr *rangeReader) Read(p []byte) (int, error) {
+	for rr.remaining > 0 {
+		if rr.current == nil {
+			if len(rr.chunks) == 0 {
+				break
+			}
+			rd, err := rr.repo.GetBlobReader(resources.RT_CHUNK, rr.chunks[0].ContentMAC)
+			if err != nil {
+				return 0, err
+			}
+			rr.chunks = rr.chunks[1:]
+			if _, err := io.CopyN(io.Discard, rd, rr.skip); err != nil {
+				rd.Close()
+				return 0, err
+			}
+			rr.skip = 0
+			rr.current = rd
+		}
+
+		if int64(len(p)) > rr.remaining {
+			p = p[:rr.remaining]
+		}
+		n, err := rr.current.Read(p)
+		rr.remaining -= int64(n)
+		if errors.Is(err, io.EOF) {
+			err = rr.current.Close()
+			rr.current = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// Close releases the chunk being read.
+func (rr *rangeReader) Close() error {
+	if rr.current == nil {
+		return nil
+	}
+	err := rr.current.Close()
+	rr.current = nil
+	return err
+}
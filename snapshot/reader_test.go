@@ -2,10 +2,15 @@ package snapshot_test
 
 import (
 	"io"
+	"math/rand"
+	"os"
+	"path"
 	"strings"
 	"testing"
 
+	"github.com/PlakarKorp/plakar/resources"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
 
@@ -34,3 +39,93 @@ func TestNewReader(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "hello", string(content))
 }
+
+func TestReadRange(t *testing.T) {
+	content := make([]byte, 8<<20)
+	rand.New(rand.NewSource(42)).Read(content)
+
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockFile("disk.img", 0644, string(content)),
+	})
+	defer snap.Close()
+
+	pathname := path.Join(snap.Header.GetSource(0).Importer.Directory, "disk.img")
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	entry, err := fs.GetEntry(pathname)
+	require.NoError(t, err)
+	chunks := entry.ResolvedObject.Chunks
+	require.GreaterOrEqual(t, len(chunks), 3)
+
+	readRange := func(offset, length int64) []byte {
+		rd, err := snap.ReadRange(pathname, offset, length)
+		require.NoError(t, err)
+		defer rd.Close()
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		return data
+	}
+
+	// from the end of the first chunk to the start of the third one
+	offset := int64(chunks[0].Length) - 100
+	length := 100 + int64(chunks[1].Length) + 100
+	require.Equal(t, content[offset:offset+length], readRange(offset, length))
+
+	// within a single chunk
+	require.Equal(t, content[10:20], readRange(10, 10))
+
+	// truncated to the end of the file
+	size := int64(len(content))
+	require.Equal(t, content[size-10:], readRange(size-10, 100))
+	require.Empty(t, readRange(size+10, 100))
+	require.Empty(t, readRange(0, 0))
+
+	_, err = snap.ReadRange(pathname, -1, 10)
+	require.ErrorIs(t, err, os.ErrInvalid)
+}
+
+func TestFileChunks(t *testing.T) {
+	content := make([]byte, 8<<20)
+	rand.New(rand.NewSource(42)).Read(content)
+
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("disk.img", 0644, string(content)),
+		ptesting.NewMockFile("empty", 0644, ""),
+	})
+	defer snap.Close()
+
+	directory := snap.Header.GetSource(0).Importer.Directory
+	chunks, err := snap.FileChunks(path.Join(directory, "disk.img"))
+	require.NoError(t, err)
+
+	offset := int64(0)
+	n := 0
+	for chunk, err := range chunks {
+		require.NoError(t, err)
+		require.Equal(t, offset, chunk.Offset)
+
+		rd, err := snap.Repository().GetBlobReader(resources.RT_CHUNK, chunk.ContentMAC)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		rd.Close()
+		require.Equal(t, content[offset:offset+int64(chunk.Length)], data)
+
+		offset += int64(chunk.Length)
+		n++
+	}
+	require.Equal(t, int64(len(content)), offset)
+	require.GreaterOrEqual(t, n, 3)
+
+	chunks, err = snap.FileChunks(path.Join(directory, "empty"))
+	require.NoError(t, err)
+	for chunk, err := range chunks {
+		require.NoError(t, err)
+		require.Zero(t, chunk.Offset)
+		require.Zero(t, chunk.Length)
+	}
+
+	_, err = snap.FileChunks(path.Join(directory, "subdir"))
+	require.ErrorIs(t, err, os.ErrInvalid)
+}
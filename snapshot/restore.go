@@ -1,35 +1,444 @@
 package snapshot
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	iofs "io/fs"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/gobwas/glob"
 )
 
 type RestoreOptions struct {
 	MaxConcurrency uint64
 	Strip          string
+
+	// Overwrite tells what to do with the files already present at the
+	// target, it only applies to exporters implementing
+	// exporter.Overwriter.
+	Overwrite exporter.OverwritePolicy
+
+	// Force stores every file, even those an exporter implementing
+	// exporter.ChecksumStorer finds with the same content at the target.
+	Force bool
+
+	// Prefetch reads ahead the blobs that followed the ones being read
+	// in the access history, holding at most PrefetchMemory bytes or
+	// repository.DefaultPrefetchMemory if zero.
+	Prefetch       bool
+	PrefetchMemory uint64
+
+	// Progress, if set, is called as file contents are written with the
+	// number of bytes restored so far and the total size of the regular
+	// files to restore.  Calls are serialized.
+	Progress func(done, total int64)
+
+	// VerifyInline hashes the content of each file as it is written and
+	// fails the file with ErrChecksumMismatch if it doesn't match the
+	// checksum recorded at backup.
+	VerifyInline bool
+
+	// Includes and Excludes filter the entries on their path relative to
+	// Strip, without leading slash.  An entry is restored if it or one of
+	// its parent directories matches an include, or if there are none,
+	// and unless it matches an exclude.  They are compiled with
+	// CompileRestorePattern.
+	Includes []glob.Glob
+	Excludes []glob.Glob
+
+	// Events, if set, receives a RestoreEvent for each entry restored or
+	// failed, then a RestoreSummary once all of them are done.  Restore
+	// doesn't close it, so it can be shared by successive restores.
+	Events chan<- RestoreEvent
+}
+
+type RestoreEventKind uint8
+
+const (
+	RestoreDirectoryOK RestoreEventKind = iota
+	RestoreFileOK
+	RestoreError
+	RestoreSummary
+)
+
+func (k RestoreEventKind) String() string {
+	switch k {
+	case RestoreDirectoryOK:
+		return "directory"
+	case RestoreFileOK:
+		return "file"
+	case RestoreError:
+		return "error"
+	case RestoreSummary:
+		return "summary"
+	}
+	return "unknown"
+}
+
+// RestoreEvent reports the outcome of restoring the entry at Path, Size
+// being the size of a restored file.  The summary has no Path, it carries
+// the error returned by Restore if any, the number of bytes written and the
+// counters of the restore.
+type RestoreEvent struct {
+	Kind       RestoreEventKind
+	SnapshotID objects.MAC
+	Path       string
+	Size       int64
+	Err        error
+
+	Files       int64
+	Directories int64
+	Errors      int64
+}
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// hardlink tracks the first restored path of a set of hard links, done is
+// closed once its content has been stored so the other links can be created.
+type hardlink struct {
+	dest string
+	done chan struct{}
 }
 
 type restoreContext struct {
-	hardlinks      map[string]string
+	hardlinks      map[string]*hardlink
 	hardlinksMutex sync.Mutex
 	maxConcurrency chan bool
+
+	files       atomic.Int64
+	directories atomic.Int64
+	size        atomic.Int64
+	errors      atomic.Int64
+
+	events chan<- RestoreEvent
+
+	// caps are the capabilities of the exporter, the operations it lacks
+	// are skipped with a warning the first time.
+	caps        exporter.ExporterCaps
+	warned      exporter.ExporterCaps
+	warnedMutex sync.Mutex
+
+	// ownership counts the entries whose ownership the exporter was not
+	// permitted to restore, reported once at the end.
+	ownership atomic.Int64
+
+	progress      func(done, total int64)
+	progressMutex sync.Mutex
+	progressDone  int64
+	progressTotal int64
+}
+
+// advance accounts for n more restored bytes.
+func (rc *restoreContext) advance(n int64) {
+	if rc.progress == nil || n == 0 {
+		return
+	}
+	rc.progressMutex.Lock()
+	defer rc.progressMutex.Unlock()
+	rc.progressDone += n
+	rc.progress(rc.progressDone, rc.progressTotal)
+}
+
+func (rc *restoreContext) publish(event RestoreEvent) {
+	if rc.events != nil {
+		rc.events <- event
+	}
+}
+
+// unsupported reports whether the exporter lacks caps, in which case the
+// operation is to be skipped.
+func (rc *restoreContext) unsupported(snap *Snapshot, caps exporter.ExporterCaps) bool {
+	if rc.caps.Has(caps) {
+		return false
+	}
+
+	rc.warnedMutex.Lock()
+	defer rc.warnedMutex.Unlock()
+	if !rc.warned.Has(caps) {
+		rc.warned |= caps
+		snap.Logger().Warn("restore: exporter does not support %s, skipping", caps)
+	}
+	return true
+}
+
+// restoreMetadata applies the extended attributes and the permissions of
+// e to dest, as far as the exporter supports them.
+func (rc *restoreContext) restoreMetadata(snap *Snapshot, fs *vfs.Filesystem, exp exporter.Exporter, e *vfs.Entry, dest string) error {
+	if len(e.ExtendedAttributes) != 0 && !rc.unsupported(snap, exporter.CapXattrs) {
+		if err := restoreXattrs(fs, exp, e, dest); err != nil {
+			return err
+		}
+	}
+	if !rc.unsupported(snap, exporter.CapPermissions) {
+		err := exp.SetPermissions(dest, e.Stat())
+		if errors.Is(err, exporter.ErrOwnership) {
+			rc.ownership.Add(1)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// The following report the outcome of each entry both on the events of the
+// application context and to RestoreOptions.Events.
+
+func (rc *restoreContext) pathError(snap *Snapshot, entrypath string, err error) {
+	rc.errors.Add(1)
+	snap.Event(events.PathErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+	rc.publish(RestoreEvent{Kind: RestoreError, SnapshotID: snap.Header.Identifier, Path: entrypath, Err: err})
+}
+
+func (rc *restoreContext) directoryOK(snap *Snapshot, entrypath string) {
+	snap.Event(events.DirectoryOKEvent(snap.Header.Identifier, entrypath))
+	rc.publish(RestoreEvent{Kind: RestoreDirectoryOK, SnapshotID: snap.Header.Identifier, Path: entrypath})
+}
+
+func (rc *restoreContext) directoryError(snap *Snapshot, entrypath string, err error) {
+	rc.errors.Add(1)
+	snap.Event(events.DirectoryErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+	rc.publish(RestoreEvent{Kind: RestoreError, SnapshotID: snap.Header.Identifier, Path: entrypath, Err: err})
+}
+
+func (rc *restoreContext) fileOK(snap *Snapshot, entrypath string, size int64) {
+	snap.Event(events.FileOKEvent(snap.Header.Identifier, entrypath, size))
+	rc.publish(RestoreEvent{Kind: RestoreFileOK, SnapshotID: snap.Header.Identifier, Path: entrypath, Size: size})
+}
+
+func (rc *restoreContext) fileError(snap *Snapshot, entrypath string, err error) {
+	rc.errors.Add(1)
+	snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+	rc.publish(RestoreEvent{Kind: RestoreError, SnapshotID: snap.Header.Identifier, Path: entrypath, Err: err})
+}
+
+// errNotSeekable is returned by the readers handed to exporters when
+// asked to seek a reader that can't.
+var errNotSeekable = errors.New("reader can't seek")
+
+// progressReader reports the bytes read from the snapshot as they are
+// consumed by the exporter.  It seeks if the reader it wraps does, so that
+// exporters can retry without spooling, content read again after a seek
+// backwards not being reported twice.
+type progressReader struct {
+	rd             io.Reader
+	restoreContext *restoreContext
+
+	pos      int64
+	reported int64
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.rd.Read(buf)
+	p.pos += int64(n)
+	if p.pos > p.reported {
+		p.restoreContext.advance(p.pos - p.reported)
+		p.reported = p.pos
+	}
+	return n, err
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := p.rd.(io.Seeker)
+	if !ok {
+		return 0, errNotSeekable
+	}
+	if offset == 0 && whence == io.SeekCurrent {
+		return p.pos, nil
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	p.pos = pos
+	return pos, nil
+}
+
+// verifyReader hashes the content read from the snapshot and fails at
+// the end of the file if it doesn't match the recorded checksum, so that
+// the exporter sees an error rather than the end of the content.
+type verifyReader struct {
+	rd       io.Reader
+	hasher   hash.Hash
+	expected objects.MAC
+
+	pos int64
+}
+
+func (v *verifyReader) Read(buf []byte) (int, error) {
+	n, err := v.rd.Read(buf)
+	v.pos += int64(n)
+	v.hasher.Write(buf[:n])
+	if err == io.EOF && !bytes.Equal(v.hasher.Sum(nil), v.expected[:]) {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
+
+// Seek only rewinds to the start of the content, which is all a retry
+// needs, since the content skipped would not be hashed otherwise.
+func (v *verifyReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := v.rd.(io.Seeker)
+	if !ok {
+		return 0, errNotSeekable
+	}
+	if offset == 0 && whence == io.SeekCurrent {
+		return v.pos, nil
+	}
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errNotSeekable
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	v.pos = 0
+	v.hasher.Reset()
+	return 0, nil
+}
+
+// restorePattern matches if any of its variants does.
+type restorePattern []glob.Glob
+
+func (p restorePattern) Match(pathname string) bool {
+	return matchAny(p, pathname)
+}
+
+// CompileRestorePattern compiles an include or exclude pattern of
+// RestoreOptions, in which * and ? do not match / while **/ matches any
+// number of directories, none included.
+func CompileRestorePattern(pattern string) (glob.Glob, error) {
+	ret := restorePattern{}
+	for _, variant := range expandDoubleStar(pattern) {
+		g, err := glob.Compile(variant, '/')
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, g)
+	}
+	return ret, nil
+}
+
+func matchAny(patterns []glob.Glob, pathname string) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(pathname) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipEntry reports whether the entry at entrypath is filtered out by the
+// include and exclude patterns, and whether the walk must not descend below
+// it.  Directories which are not included are still walked since some of
+// their children may be.
+func skipEntry(opts *RestoreOptions, entrypath string) (skip bool, prune bool) {
+	if len(opts.Includes) == 0 && len(opts.Excludes) == 0 {
+		return false, false
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(entrypath, opts.Strip), "/")
+	if rel == "" {
+		return false, false
+	}
+
+	if matchAny(opts.Excludes, rel) {
+		return true, true
+	}
+
+	if len(opts.Includes) == 0 {
+		return false, false
+	}
+	for p := rel; p != "."; p = path.Dir(p) {
+		if matchAny(opts.Includes, p) {
+			return false, false
+		}
+	}
+	return true, false
+}
+
+// restoreSize sums the size of the regular files below pathname that pass
+// the filters of opts.
+func restoreSize(fs *vfs.Filesystem, pathname string, opts *RestoreOptions) (int64, error) {
+	var total int64
+	err := fs.WalkDir(pathname, func(entrypath string, e *vfs.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, prune := skipEntry(opts, entrypath); skip {
+			if prune && e.IsDir() {
+				return iofs.SkipDir
+			}
+			return nil
+		}
+		if e.Stat().Mode().IsRegular() {
+			total += e.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// restoreXattrs applies the extended attributes recorded for e to dest,
+// exporters which can't represent them are skipped silently.
+func restoreXattrs(fs *vfs.Filesystem, exp exporter.Exporter, e *vfs.Entry, dest string) (err error) {
+	if flusher, ok := exp.(exporter.XattrFlusher); ok {
+		defer func() {
+			if ferr := flusher.FlushXattrs(dest); err == nil && ferr != nil {
+				err = fmt.Errorf("xattrs: %w", ferr)
+			}
+		}()
+	}
+
+	for _, name := range e.ExtendedAttributes {
+		typ := objects.AttributeExtended
+		rd, err := e.XattrOfType(fs, name, typ)
+		if errors.Is(err, iofs.ErrNotExist) {
+			typ = objects.AttributeADS
+			rd, err = e.XattrOfType(fs, name, typ)
+		}
+		if err != nil {
+			return fmt.Errorf("xattr %s: %w", name, err)
+		}
+
+		value, err := io.ReadAll(rd)
+		if err != nil {
+			return fmt.Errorf("xattr %s: %w", name, err)
+		}
+
+		if err := exp.SetXattr(dest, name, value, typ); err != nil {
+			if errors.Is(err, exporter.ErrNotSupported) {
+				return nil
+			}
+			return fmt.Errorf("xattr %s: %w", name, err)
+		}
+	}
+	return nil
 }
 
-func snapshotRestorePath(snap *Snapshot, exp exporter.Exporter, target string, opts *RestoreOptions, restoreContext *restoreContext, wg *sync.WaitGroup) func(entrypath string, e *vfs.Entry, err error) error {
+func snapshotRestorePath(snap *Snapshot, fs *vfs.Filesystem, exp exporter.Exporter, target string, opts *RestoreOptions, restoreContext *restoreContext, wg *sync.WaitGroup) func(entrypath string, e *vfs.Entry, err error) error {
 	return func(entrypath string, e *vfs.Entry, err error) error {
 		if err != nil {
-			snap.Event(events.PathErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+			restoreContext.pathError(snap, entrypath, err)
 			return err
 		}
 
+		if skip, prune := skipEntry(opts, entrypath); skip {
+			if prune && e.IsDir() {
+				return iofs.SkipDir
+			}
+			return nil
+		}
+
 		snap.Event(events.PathEvent(snap.Header.Identifier, entrypath))
 
 		// Determine destination path by stripping the prefix.
@@ -41,25 +450,45 @@ func snapshotRestorePath(snap *Snapshot, exp exporter.Exporter, target string, o
 			// Create directory if not root.
 			if entrypath != "/" {
 				if err := exp.CreateDirectory(dest); err != nil {
-					snap.Event(events.DirectoryErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+					restoreContext.directoryError(snap, entrypath, err)
 					return err
 				}
 			}
 
 			// WalkDir handles recursion so we don’t need to iterate children manually.
 			if entrypath != "/" {
-				if err := exp.SetPermissions(dest, e.Stat()); err != nil {
-					snap.Event(events.DirectoryErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+				if err := restoreContext.restoreMetadata(snap, fs, exp, e, dest); err != nil {
+					restoreContext.directoryError(snap, entrypath, err)
 					return err
 				}
 			}
-			snap.Event(events.DirectoryOKEvent(snap.Header.Identifier, entrypath))
+			restoreContext.directories.Add(1)
+			restoreContext.directoryOK(snap, entrypath)
 			return nil
 		}
 
-		// For non-directory entries, only process regular files.
+		// Symbolic links are recreated as is, their target is not resolved.
+		if e.Stat().Mode()&os.ModeSymlink != 0 {
+			if restoreContext.unsupported(snap, exporter.CapSymlinks) {
+				return nil
+			}
+			snap.Event(events.FileEvent(snap.Header.Identifier, entrypath))
+			if err := exp.CreateDirectory(path.Dir(dest)); err != nil {
+				restoreContext.fileError(snap, entrypath, err)
+			} else if err := exp.CreateSymlink(e.SymlinkTarget, dest); err != nil {
+				restoreContext.fileError(snap, entrypath, err)
+			} else if err := restoreContext.restoreMetadata(snap, fs, exp, e, dest); err != nil {
+				restoreContext.fileError(snap, entrypath, err)
+			} else {
+				restoreContext.files.Add(1)
+				restoreContext.fileOK(snap, entrypath, 0)
+			}
+			return nil
+		}
+
+		// For other non-directory entries, only process regular files.
 		if !e.Stat().Mode().IsRegular() {
-			snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, "unexpected vfs entry type"))
+			restoreContext.fileError(snap, entrypath, errors.New("unexpected vfs entry type"))
 			return nil
 		}
 
@@ -70,54 +499,115 @@ func snapshotRestorePath(snap *Snapshot, exp exporter.Exporter, target string, o
 			defer wg.Done()
 			defer func() { <-restoreContext.maxConcurrency }()
 
-			// Handle hard links.
-			if e.Stat().Nlink() > 1 {
+			// Handle hard links, each one gets a copy of the content
+			// if the exporter can't link them.
+			if e.Stat().Nlink() > 1 && restoreContext.caps.Has(exporter.CapHardlinks) {
 				key := fmt.Sprintf("%d:%d", e.Stat().Dev(), e.Stat().Ino())
 				restoreContext.hardlinksMutex.Lock()
 				v, ok := restoreContext.hardlinks[key]
+				if !ok {
+					v = &hardlink{
+						dest: dest,
+						done: make(chan struct{}),
+					}
+					restoreContext.hardlinks[key] = v
+				}
 				restoreContext.hardlinksMutex.Unlock()
 				if ok {
-					// Create a new link and return.
-					if err := os.Link(v, dest); err != nil {
-						snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+					// Wait for the first link to be stored, then create
+					// a new link to it and return.
+					<-v.done
+					if err := exp.CreateDirectory(path.Dir(dest)); err != nil {
+						restoreContext.fileError(snap, entrypath, err)
+					} else if err := exp.CreateHardlink(v.dest, dest); err != nil {
+						restoreContext.fileError(snap, entrypath, err)
+					} else {
+						restoreContext.files.Add(1)
+						restoreContext.advance(e.Size())
+						restoreContext.fileOK(snap, entrypath, e.Size())
 					}
 					return
-				} else {
-					restoreContext.hardlinksMutex.Lock()
-					restoreContext.hardlinks[key] = dest
-					restoreContext.hardlinksMutex.Unlock()
 				}
+				defer close(v.done)
 			}
 
 			rd, err := snap.NewReader(entrypath)
 			if err != nil {
-				snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+				restoreContext.fileError(snap, entrypath, err)
 				return
 			}
 			defer rd.Close()
 
 			// Ensure the parent directory exists.
 			if err := exp.CreateDirectory(path.Dir(dest)); err != nil {
-				snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+				restoreContext.fileError(snap, entrypath, err)
+				return
+			}
+
+			storer, checksummed := exp.(exporter.ChecksumStorer)
+			checksummed = checksummed && !opts.Force
+
+			object := e.ResolvedObject
+			if object == nil && (opts.VerifyInline || checksummed) {
+				object, err = snap.LookupObject(e.Object)
+				if err != nil {
+					restoreContext.fileError(snap, entrypath, err)
+					return
+				}
 			}
 
 			// Restore the file content.
-			if err := exp.StoreFile(dest, rd); err != nil {
-				snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
-			} else if err := exp.SetPermissions(dest, e.Stat()); err != nil {
-				snap.Event(events.FileErrorEvent(snap.Header.Identifier, entrypath, err.Error()))
+			var content io.Reader = rd
+			if opts.VerifyInline {
+				content = &verifyReader{
+					rd:       content,
+					hasher:   snap.repository.GetMACHasher(),
+					expected: object.ContentMAC,
+				}
+			}
+			if restoreContext.progress != nil {
+				content = &progressReader{rd: content, restoreContext: restoreContext}
+			}
+			stored := true
+			if overwriter, ok := exp.(exporter.Overwriter); ok && opts.Overwrite != exporter.OverwriteAlways {
+				stored, err = overwriter.StoreFileWithPolicy(dest, content, e.Stat(), opts.Overwrite)
+			} else if checksummed {
+				stored, err = storer.StoreFileWithChecksum(dest, content, object.ContentMAC)
 			} else {
-				snap.Event(events.FileOKEvent(snap.Header.Identifier, entrypath, e.Size()))
+				err = exp.StoreFile(dest, content)
+			}
+			if err != nil {
+				restoreContext.fileError(snap, entrypath, err)
+			} else if !stored {
+				// the file already at dest is kept as is
+				restoreContext.files.Add(1)
+				restoreContext.advance(e.Size())
+				restoreContext.fileOK(snap, entrypath, e.Size())
+			} else if err := restoreContext.restoreMetadata(snap, fs, exp, e, dest); err != nil {
+				restoreContext.fileError(snap, entrypath, err)
+			} else {
+				restoreContext.files.Add(1)
+				restoreContext.size.Add(e.Size())
+				restoreContext.fileOK(snap, entrypath, e.Size())
 			}
 		}(e, entrypath)
 		return nil
 	}
 }
 
-func (snap *Snapshot) Restore(exp exporter.Exporter, base string, pathname string, opts *RestoreOptions) error {
+func (snap *Snapshot) Restore(exp exporter.Exporter, base string, pathname string, opts *RestoreOptions) (err error) {
 	snap.Event(events.StartEvent())
 	defer snap.Event(events.DoneEvent())
 
+	span := snap.AppContext().GetTracer().Start("restore")
+	span.SetString("snapshot.id", fmt.Sprintf("%x", snap.Header.Identifier))
+	span.SetString("path", pathname)
+	span.SetString("target", base)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	fs, err := snap.Filesystem()
 	if err != nil {
 		return err
@@ -129,19 +619,59 @@ func (snap *Snapshot) Restore(exp exporter.Exporter, base string, pathname strin
 	}
 
 	restoreContext := &restoreContext{
-		hardlinks:      make(map[string]string),
+		hardlinks:      make(map[string]*hardlink),
 		hardlinksMutex: sync.Mutex{},
 		maxConcurrency: make(chan bool, maxConcurrency),
+		events:         opts.Events,
+		caps:           exp.Capabilities(),
 	}
 	defer close(restoreContext.maxConcurrency)
 
+	if opts.Progress != nil {
+		total, err := restoreSize(fs, pathname, opts)
+		if err != nil {
+			return err
+		}
+		restoreContext.progress = opts.Progress
+		restoreContext.progressTotal = total
+	}
+
+	// the workers are waited for before returning
+	defer func() {
+		span.SetInt("files", restoreContext.files.Load())
+		span.SetInt("directories", restoreContext.directories.Load())
+		span.SetInt("bytes", restoreContext.size.Load())
+	}()
+
 	base = path.Clean(base)
 	if base != "/" && !strings.HasSuffix(base, "/") {
 		base = base + "/"
 	}
 
+	if opts.Prefetch && snap.repository.EnablePrefetch(opts.PrefetchMemory) {
+		defer func() {
+			stats := snap.repository.DisablePrefetch()
+			snap.Logger().Trace("snapshot", "%x: Restore(): prefetch: %d hits, %d waits",
+				snap.Header.GetIndexShortID(), stats.Hits, stats.Waits)
+		}()
+	}
+
 	wg := sync.WaitGroup{}
-	defer wg.Wait()
+	err = fs.WalkDir(pathname, snapshotRestorePath(snap, fs, exp, base, opts, restoreContext, &wg))
+	wg.Wait()
+
+	if n := restoreContext.ownership.Load(); n != 0 {
+		snap.Logger().Warn("restore: not permitted to restore the ownership of %d entries", n)
+	}
 
-	return fs.WalkDir(pathname, snapshotRestorePath(snap, exp, base, opts, restoreContext, &wg))
+	restoreContext.publish(RestoreEvent{
+		Kind:        RestoreSummary,
+		SnapshotID:  snap.Header.Identifier,
+		Size:        restoreContext.size.Load(),
+		Err:         err,
+		Files:       restoreContext.files.Load(),
+		Directories: restoreContext.directories.Load(),
+		Errors:      restoreContext.errors.Load(),
+	})
+	return err
 }
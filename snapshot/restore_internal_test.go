@@ -0,0 +1,47 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRestoreReadersRewind rewinds the readers handed to exporters as a
+// retry does, the content being reported and verified once.
+func TestRestoreReadersRewind(t *testing.T) {
+	const content = "hello world"
+
+	var done int64
+	rc := &restoreContext{progress: func(d, _ int64) { done = d }}
+	verify := &verifyReader{
+		rd:       strings.NewReader(content),
+		hasher:   sha256.New(),
+		expected: objects.MAC(sha256.Sum256([]byte(content))),
+	}
+	rd := &progressReader{rd: verify, restoreContext: rc}
+
+	_, err := io.CopyN(io.Discard, rd, 5)
+	require.NoError(t, err)
+	pos, err := rd.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), pos)
+
+	_, err = rd.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+	require.Equal(t, int64(len(content)), done)
+
+	// the content can't be skipped without being hashed
+	_, err = verify.Seek(3, io.SeekStart)
+	require.ErrorIs(t, err, errNotSeekable)
+
+	rd = &progressReader{rd: io.MultiReader(strings.NewReader(content)), restoreContext: rc}
+	_, err = rd.Seek(0, io.SeekCurrent)
+	require.ErrorIs(t, err, errNotSeekable)
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package snapshot_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/pkg/xattr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreXattr(t *testing.T) {
+	// user xattrs are not available on every filesystem, eg. some tmpfs
+	probe, err := os.CreateTemp("", "xattr_probe")
+	require.NoError(t, err)
+	probe.Close()
+	defer os.Remove(probe.Name())
+	if err := xattr.Set(probe.Name(), "user.plakar.probe", []byte("1")); err != nil {
+		t.Skipf("user xattrs unsupported: %s", err)
+	}
+
+	file := ptesting.NewMockFile("dummy.txt", 0644, "hello")
+	file.Xattrs = map[string][]byte{"user.plakar.test": []byte("random value")}
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{file})
+	defer snap.Close()
+
+	err = snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+	}
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts)
+	require.NoError(t, err)
+
+	value, err := xattr.Get(filepath.Join(exporterInstance.Root(), "dummy.txt"), "user.plakar.test")
+	require.NoError(t, err)
+	require.Equal(t, "random value", string(value))
+}
@@ -1,14 +1,29 @@
 package snapshot_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/exporter"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/null"
+	"github.com/PlakarKorp/plakar/storage"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/PlakarKorp/plakar/versioning"
+	"github.com/gobwas/glob"
 	"github.com/stretchr/testify/require"
 )
 
@@ -58,3 +73,655 @@ func TestRestore(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "hello", string(contents))
 }
+
+func TestRestoreLinks(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello"),
+		ptesting.NewMockSymlink("subdir/link.txt", "dummy.txt"),
+	})
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	tmpRestoreDir, err := os.MkdirTemp("", "tmp_to_restore")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpRestoreDir)
+	})
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+	}
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts)
+	require.NoError(t, err)
+
+	link := fmt.Sprintf("%s/subdir/link.txt", exporterInstance.Root())
+	fi, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.NotZero(t, fi.Mode()&os.ModeSymlink)
+
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, "dummy.txt", target)
+
+	contents, err := os.ReadFile(link)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+}
+
+func TestRestoreOverwrite(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/resized.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/newer.txt", 0644, "world"),
+		ptesting.NewMockFile("subdir/older.txt", 0644, "datum"),
+		ptesting.NewMockFile("subdir/missing.txt", 0644, "fresh"),
+	})
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	tests := []struct {
+		policy   exporter.OverwritePolicy
+		expected map[string]string
+	}{
+		{exporter.OverwriteAlways, map[string]string{
+			"resized.txt": "hello", "newer.txt": "world", "older.txt": "datum", "missing.txt": "fresh",
+		}},
+		{exporter.OverwriteNever, map[string]string{
+			"resized.txt": "partial content", "newer.txt": "WORLD", "older.txt": "DATUM", "missing.txt": "fresh",
+		}},
+		{exporter.OverwriteIfNewer, map[string]string{
+			"resized.txt": "hello", "newer.txt": "WORLD", "older.txt": "datum", "missing.txt": "fresh",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			tmpRestoreDir := t.TempDir()
+			exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+			require.NoError(t, err)
+			defer exporterInstance.Close()
+
+			// the target already holds a subset of the files
+			subdir := fmt.Sprintf("%s/subdir", tmpRestoreDir)
+			require.NoError(t, os.MkdirAll(subdir, 0755))
+			require.NoError(t, os.WriteFile(subdir+"/resized.txt", []byte("partial content"), 0644))
+			require.NoError(t, os.WriteFile(subdir+"/newer.txt", []byte("WORLD"), 0644))
+			require.NoError(t, os.WriteFile(subdir+"/older.txt", []byte("DATUM"), 0644))
+			past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			require.NoError(t, os.Chtimes(subdir+"/older.txt", past, past))
+
+			opts := &snapshot.RestoreOptions{
+				MaxConcurrency: 1,
+				Strip:          snap.Header.GetSource(0).Importer.Directory,
+				Overwrite:      test.policy,
+			}
+			err = snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts)
+			require.NoError(t, err)
+
+			for name, expected := range test.expected {
+				contents, err := os.ReadFile(subdir + "/" + name)
+				require.NoError(t, err)
+				require.Equal(t, expected, string(contents), name)
+			}
+		})
+	}
+}
+
+func TestRestoreProgress(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/other.txt", 0644, strings.Repeat("x", 100000)),
+		ptesting.NewMockSymlink("subdir/link.txt", "dummy.txt"),
+	})
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": "null://"})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	var calls int
+	var done, total int64
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 4,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+		Progress: func(d, tot int64) {
+			require.GreaterOrEqual(t, d, done)
+			calls++
+			done, total = d, tot
+		},
+	}
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts)
+	require.NoError(t, err)
+
+	require.NotZero(t, calls)
+	require.Equal(t, int64(100005), total)
+	require.Equal(t, total, done)
+}
+
+func TestRestoreEvents(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/other.txt", 0644, strings.Repeat("x", 100000)),
+		ptesting.NewMockSymlink("subdir/link.txt", "dummy.txt"),
+	})
+	defer snap.Close()
+
+	exporterInstance, err := exporter.NewExporter(map[string]string{"location": t.TempDir()})
+	require.NoError(t, err)
+	defer exporterInstance.Close()
+
+	ch := make(chan snapshot.RestoreEvent)
+	received := make(chan []snapshot.RestoreEvent)
+	go func() {
+		evts := []snapshot.RestoreEvent{}
+		for event := range ch {
+			evts = append(evts, event)
+		}
+		received <- evts
+	}()
+
+	root := snap.Header.GetSource(0).Importer.Directory
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 4,
+		Strip:          root,
+		Events:         ch,
+	}
+	err = snap.Restore(exporterInstance, exporterInstance.Root(), root, opts)
+	require.NoError(t, err)
+	close(ch)
+	evts := <-received
+
+	// one event per entry, in any order, then the summary
+	require.NotEmpty(t, evts)
+	summary := evts[len(evts)-1]
+	require.Equal(t, snapshot.RestoreSummary, summary.Kind)
+	require.Equal(t, snap.Header.Identifier, summary.SnapshotID)
+	require.NoError(t, summary.Err)
+	require.Equal(t, int64(3), summary.Files)
+	require.Equal(t, int64(2), summary.Directories)
+	require.Equal(t, int64(0), summary.Errors)
+	require.Equal(t, int64(100005), summary.Size)
+
+	paths := map[string]snapshot.RestoreEventKind{}
+	for _, event := range evts[:len(evts)-1] {
+		require.NotContains(t, paths, event.Path)
+		require.NoError(t, event.Err)
+		paths[event.Path] = event.Kind
+	}
+	require.Equal(t, map[string]snapshot.RestoreEventKind{
+		root:                       snapshot.RestoreDirectoryOK,
+		root + "/subdir":           snapshot.RestoreDirectoryOK,
+		root + "/subdir/dummy.txt": snapshot.RestoreFileOK,
+		root + "/subdir/other.txt": snapshot.RestoreFileOK,
+		root + "/subdir/link.txt":  snapshot.RestoreFileOK,
+	}, paths)
+}
+
+func TestRestoreVerifyInline(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/corrupted.txt", 0644, "hello"),
+		ptesting.NewMockFile("subdir/intact.txt", 0644, "world"),
+	})
+	defer snap.Close()
+
+	repo := snap.Repository()
+	require.NoError(t, repo.RebuildState())
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+	root := snap.Header.GetSource(0).Importer.Directory
+
+	chunkOf := func(name string) objects.MAC {
+		entry, err := fs.GetEntry(root + "/subdir/" + name)
+		require.NoError(t, err)
+		require.Len(t, entry.ResolvedObject.Chunks, 1)
+		return entry.ResolvedObject.Chunks[0].ContentMAC
+	}
+
+	// make the chunk of corrupted.txt resolve to the content of intact.txt,
+	// the blob decodes fine but doesn't match the recorded checksum
+	corrupted, intact := chunkOf("corrupted.txt"), chunkOf("intact.txt")
+	packfileMAC, exists, err := repo.GetPackfileForBlob(resources.RT_CHUNK, corrupted)
+	require.NoError(t, err)
+	require.True(t, exists)
+	location, exists, err := repo.GetLocationForBlob(resources.RT_CHUNK, intact)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, repo.RemoveBlob(resources.RT_CHUNK, corrupted, packfileMAC))
+	require.NoError(t, repo.PutStateDelta(&state.DeltaEntry{
+		Type:     resources.RT_CHUNK,
+		Version:  versioning.GetCurrentVersion(resources.RT_CHUNK),
+		Blob:     corrupted,
+		Location: location,
+	}))
+
+	var mu sync.Mutex
+	failed := map[string]string{}
+	stored := map[string]bool{}
+	listener := snap.AppContext().Events().Listen()
+	go func() {
+		for event := range listener {
+			mu.Lock()
+			switch event := event.(type) {
+			case events.FileError:
+				failed[path.Base(event.Pathname)] = event.Message
+			case events.FileOK:
+				stored[path.Base(event.Pathname)] = true
+			}
+			mu.Unlock()
+		}
+	}()
+
+	restore := func(verify bool) string {
+		tmpRestoreDir := t.TempDir()
+		exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+		require.NoError(t, err)
+		defer exporterInstance.Close()
+
+		opts := &snapshot.RestoreOptions{
+			MaxConcurrency: 1,
+			Strip:          root,
+			VerifyInline:   verify,
+		}
+		require.NoError(t, snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts))
+		return tmpRestoreDir
+	}
+
+	// without verification the wrong content goes unnoticed
+	tmpRestoreDir := restore(false)
+	contents, err := os.ReadFile(tmpRestoreDir + "/subdir/corrupted.txt")
+	require.NoError(t, err)
+	require.Equal(t, "world", string(contents))
+	mu.Lock()
+	require.Empty(t, failed)
+	clear(stored)
+	mu.Unlock()
+
+	restore(true)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, failed["corrupted.txt"], snapshot.ErrChecksumMismatch.Error())
+	require.False(t, stored["corrupted.txt"])
+	require.True(t, stored["intact.txt"])
+	require.NotContains(t, failed, "intact.txt")
+}
+
+func TestRestoreFilters(t *testing.T) {
+	files := []string{
+		"docs/readme.md",
+		"node_modules/x.js",
+		"src/lib/util.go",
+		"src/main.go",
+		"src/node_modules/lib/index.js",
+	}
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("docs"),
+		ptesting.NewMockDir("node_modules"),
+		ptesting.NewMockDir("src"),
+		ptesting.NewMockDir("src/lib"),
+		ptesting.NewMockDir("src/node_modules"),
+		ptesting.NewMockDir("src/node_modules/lib"),
+		ptesting.NewMockFile(files[0], 0644, "docs"),
+		ptesting.NewMockFile(files[1], 0644, "x"),
+		ptesting.NewMockFile(files[2], 0644, "util"),
+		ptesting.NewMockFile(files[3], 0644, "main"),
+		ptesting.NewMockFile(files[4], 0644, "index"),
+	})
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	compile := func(patterns ...string) []glob.Glob {
+		ret := []glob.Glob{}
+		for _, pattern := range patterns {
+			g, err := snapshot.CompileRestorePattern(pattern)
+			require.NoError(t, err)
+			ret = append(ret, g)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name     string
+		includes []glob.Glob
+		excludes []glob.Glob
+		expected []string
+	}{
+		{"none", nil, nil, files},
+		{"exclude", nil, compile("**/node_modules"),
+			[]string{"docs/readme.md", "src/lib/util.go", "src/main.go"}},
+		{"exclude top-level", nil, compile("node_modules"),
+			[]string{"docs/readme.md", "src/lib/util.go", "src/main.go", "src/node_modules/lib/index.js"}},
+		{"include directory", compile("src"), nil,
+			[]string{"src/lib/util.go", "src/main.go", "src/node_modules/lib/index.js"}},
+		{"include files", compile("**/*.go", "**/*.md"), nil,
+			[]string{"docs/readme.md", "src/lib/util.go", "src/main.go"}},
+		{"star within directory", compile("src/*.go"), nil,
+			[]string{"src/main.go"}},
+		{"star at top-level", compile("*.go"), nil, nil},
+		{"include and exclude", compile("src"), compile("**/node_modules"),
+			[]string{"src/lib/util.go", "src/main.go"}},
+		{"exclude wins", compile("src/node_modules"), compile("**/node_modules"), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpRestoreDir := t.TempDir()
+			exporterInstance, err := exporter.NewExporter(map[string]string{"location": tmpRestoreDir})
+			require.NoError(t, err)
+			defer exporterInstance.Close()
+
+			var total int64
+			opts := &snapshot.RestoreOptions{
+				MaxConcurrency: 1,
+				Strip:          snap.Header.GetSource(0).Importer.Directory,
+				Includes:       test.includes,
+				Excludes:       test.excludes,
+				Progress:       func(_, tot int64) { total = tot },
+			}
+			err = snap.Restore(exporterInstance, exporterInstance.Root(), "/", opts)
+			require.NoError(t, err)
+
+			var restored []string
+			var size int64
+			for _, name := range files {
+				contents, err := os.ReadFile(tmpRestoreDir + "/" + name)
+				if err == nil {
+					restored = append(restored, name)
+					size += int64(len(contents))
+				} else {
+					require.ErrorIs(t, err, os.ErrNotExist)
+				}
+			}
+			require.Equal(t, test.expected, restored)
+			require.Equal(t, size, total)
+		})
+	}
+}
+
+// slowStore delays the reads of blobs, as a remote store would.
+type slowStore struct {
+	storage.Store
+	latency time.Duration
+}
+
+func (s *slowStore) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
+	time.Sleep(s.latency)
+	return s.Store.GetPackfileBlob(mac, offset, length)
+}
+
+func BenchmarkRestorePrefetch(b *testing.B) {
+	files := []ptesting.MockFile{}
+	for i := 0; i < 50; i++ {
+		files = append(files, ptesting.NewMockFile(fmt.Sprintf("file%d.txt", i), 0644, fmt.Sprintf("content %d", i)))
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		snap := ptesting.GenerateSnapshot(b, nil, nil, nil, files)
+		snap.AppContext().AccessStats = true
+
+		store := &slowStore{Store: snap.Repository().Store(), latency: time.Millisecond}
+		serializedConfig, err := store.Open()
+		require.NoError(b, err)
+		repo, err := repository.New(snap.AppContext(), store, serializedConfig)
+		require.NoError(b, err)
+		slowSnap, err := snapshot.Load(repo, snap.Header.Identifier)
+		require.NoError(b, err)
+
+		exporterInstance, err := exporter.NewExporter(map[string]string{"location": "null://"})
+		require.NoError(b, err)
+
+		opts := &snapshot.RestoreOptions{
+			MaxConcurrency: 1,
+			Strip:          snap.Header.GetSource(0).Importer.Directory,
+			Prefetch:       true,
+		}
+		b.StartTimer()
+
+		// the first run has no history to follow and records it
+		repo.EnablePrefetch(0)
+		require.NoError(b, slowSnap.Restore(exporterInstance, exporterInstance.Root(), "/", opts))
+		cold := repo.DisablePrefetch()
+		require.NoError(b, repo.FlushAccessStats())
+
+		repo.EnablePrefetch(0)
+		require.NoError(b, slowSnap.Restore(exporterInstance, exporterInstance.Root(), "/", opts))
+		warm := repo.DisablePrefetch()
+
+		b.StopTimer()
+		b.ReportMetric(float64(cold.Waits), "waits/cold")
+		b.ReportMetric(float64(warm.Waits), "waits/warm")
+
+		// the history must spare at least half of the round trips to
+		// the store, or the prefetcher isn't worth its fetchers
+		require.Less(b, 2*warm.Waits, cold.Waits)
+
+		exporterInstance.Close()
+		slowSnap.Close()
+		require.NoError(b, repo.Close())
+		snap.Close()
+		b.StartTimer()
+	}
+}
+
+// limitedExporter only stores files and directories, like an object store,
+// and records the operations restore attempts.
+type limitedExporter struct {
+	mu    sync.Mutex
+	files map[string]string
+	calls []string
+}
+
+func (p *limitedExporter) Root() string { return "/" }
+
+func (p *limitedExporter) CreateDirectory(pathname string) error { return nil }
+
+func (p *limitedExporter) StoreFile(pathname string, fp io.Reader) error {
+	content, err := io.ReadAll(fp)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[pathname] = string(content)
+	return nil
+}
+
+func (p *limitedExporter) record(call string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call)
+	return fmt.Errorf("unexpected call to %s", call)
+}
+
+func (p *limitedExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	return p.record("SetPermissions")
+}
+
+func (p *limitedExporter) CreateSymlink(oldname string, newname string) error {
+	return p.record("CreateSymlink")
+}
+
+func (p *limitedExporter) CreateHardlink(oldname string, newname string) error {
+	return p.record("CreateHardlink")
+}
+
+func (p *limitedExporter) SetXattr(pathname string, name string, value []byte, typ objects.Attribute) error {
+	return p.record("SetXattr")
+}
+
+func (p *limitedExporter) Capabilities() exporter.ExporterCaps { return 0 }
+
+func (p *limitedExporter) Close() error { return nil }
+
+func TestRestoreCapabilities(t *testing.T) {
+	file := ptesting.NewMockFile("subdir/dummy.txt", 0600, "hello")
+	file.Xattrs = map[string][]byte{"user.origin": []byte("plakar")}
+
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		file,
+		ptesting.NewMockFile("subdir/other.txt", 0644, "world"),
+		ptesting.NewMockSymlink("subdir/link.txt", "dummy.txt"),
+	})
+	defer snap.Close()
+	bufErr.Reset()
+
+	exp := &limitedExporter{files: make(map[string]string)}
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+	}
+	require.NoError(t, snap.Restore(exp, "/restore", "/", opts))
+
+	require.Empty(t, exp.calls)
+	require.Equal(t, map[string]string{
+		"/restore/subdir/dummy.txt": "hello",
+		"/restore/subdir/other.txt": "world",
+	}, exp.files)
+
+	// each unsupported operation is warned about once
+	warnings := bufErr.String()
+	for _, caps := range []string{"permissions", "symlinks", "xattrs"} {
+		require.Equal(t, 1, strings.Count(warnings, "exporter does not support "+caps+", skipping"), caps)
+	}
+}
+
+// unprivilegedExporter restores permissions but is never permitted to
+// change the ownership.
+type unprivilegedExporter struct {
+	limitedExporter
+}
+
+func (p *unprivilegedExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	p.record("SetPermissions")
+	return exporter.ErrOwnership
+}
+
+func (p *unprivilegedExporter) Capabilities() exporter.ExporterCaps {
+	return exporter.CapPermissions
+}
+
+func TestRestoreOwnershipNotPermitted(t *testing.T) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0600, "hello"),
+		ptesting.NewMockFile("subdir/other.txt", 0644, "world"),
+	})
+	defer snap.Close()
+	bufErr.Reset()
+
+	events := make(chan snapshot.RestoreEvent, 100)
+	exp := &unprivilegedExporter{limitedExporter{files: make(map[string]string)}}
+	opts := &snapshot.RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          snap.Header.GetSource(0).Importer.Directory,
+		Events:         events,
+	}
+	require.NoError(t, snap.Restore(exp, "/restore", "/", opts))
+	close(events)
+
+	// the files are restored without errors and a single warning sums up
+	// the entries whose ownership was left alone
+	for event := range events {
+		require.NotEqual(t, snapshot.RestoreError, event.Kind, event.Path)
+		if event.Kind == snapshot.RestoreSummary {
+			require.Zero(t, event.Errors)
+		}
+	}
+	require.Len(t, exp.files, 2)
+	require.NotEmpty(t, exp.calls)
+	warning := fmt.Sprintf("not permitted to restore the ownership of %d entries", len(exp.calls))
+	require.Equal(t, 1, strings.Count(bufErr.String(), warning))
+}
+
+// checksumExporter records the checksum of the files it stores and skips
+// those it already holds with the same checksum.
+type checksumExporter struct {
+	limitedExporter
+	checksums map[string]objects.MAC
+	stores    int
+}
+
+func (p *checksumExporter) StoreFileWithChecksum(pathname string, fp io.Reader, checksum objects.MAC) (bool, error) {
+	p.mu.Lock()
+	existing, ok := p.checksums[pathname]
+	p.mu.Unlock()
+	if ok && existing == checksum {
+		return false, nil
+	}
+
+	if err := p.StoreFile(pathname, fp); err != nil {
+		return false, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checksums[pathname] = checksum
+	p.stores++
+	return true, nil
+}
+
+func TestRestoreUnchangedFiles(t *testing.T) {
+	snap := ptesting.GenerateSnapshot(t, nil, nil, nil, []ptesting.MockFile{
+		ptesting.NewMockDir("subdir"),
+		ptesting.NewMockFile("subdir/dummy.txt", 0600, "hello"),
+		ptesting.NewMockFile("subdir/other.txt", 0644, "world"),
+	})
+	defer snap.Close()
+
+	exp := &checksumExporter{
+		limitedExporter: limitedExporter{files: make(map[string]string)},
+		checksums:       make(map[string]objects.MAC),
+	}
+	restore := func(force bool) {
+		opts := &snapshot.RestoreOptions{
+			MaxConcurrency: 1,
+			Strip:          snap.Header.GetSource(0).Importer.Directory,
+			Force:          force,
+		}
+		require.NoError(t, snap.Restore(exp, "/restore", "/", opts))
+	}
+
+	restore(false)
+	require.Equal(t, 2, exp.stores)
+	require.Equal(t, map[string]string{
+		"/restore/subdir/dummy.txt": "hello",
+		"/restore/subdir/other.txt": "world",
+	}, exp.files)
+
+	// a second restore finds every file already there
+	restore(false)
+	require.Equal(t, 2, exp.stores)
+
+	// a changed file is stored again
+	exp.checksums["/restore/subdir/dummy.txt"] = objects.MAC{}
+	restore(false)
+	require.Equal(t, 3, exp.stores)
+
+	// unless forced, in which case the checksums are not consulted
+	clear(exp.files)
+	restore(true)
+	require.Equal(t, 3, exp.stores)
+	require.Len(t, exp.files, 2)
+}
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
@@ -24,11 +25,13 @@ import (
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/tracing"
 	"github.com/google/uuid"
 )
 
 var (
-	ErrNotFound = errors.New("snapshot not found")
+	ErrNotFound  = errors.New("snapshot not found")
+	ErrUnchanged = errors.New("snapshot unchanged")
 )
 
 type Snapshot struct {
@@ -47,6 +50,17 @@ type Snapshot struct {
 	Header *header.Header
 
 	packerManager *PackerManager
+
+	// flushRequest asks the flusher of a backup in progress to push the
+	// state early, unflushedPackfiles and unflushedBytes accounting for the
+	// packfiles written since the last push.
+	flushRequest       chan struct{}
+	unflushedPackfiles atomic.Int64
+	unflushedBytes     atomic.Int64
+
+	// span of the operation in progress, the packfile and commit spans
+	// are attached to it
+	span *tracing.Span
 }
 
 func New(repo *repository.Repository) (*Snapshot, error) {
@@ -98,6 +112,10 @@ func Load(repo *repository.Repository, Identifier objects.MAC) (*Snapshot, error
 	snapshot.repository = repo
 	snapshot.Header = hdr
 
+	if err := snapshot.verifyOnLoad(); err != nil {
+		return nil, err
+	}
+
 	repo.Logger().Trace("snapshot", "%x: Load()", snapshot.Header.GetIndexShortID())
 	return snapshot, nil
 }
@@ -217,24 +235,34 @@ func getPackfileForBlobWithError(snap *Snapshot, res resources.Type, mac objects
 	}
 }
 
-func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
+// BlobRef designates a blob by its type and MAC.
+type BlobRef struct {
+	Type resources.Type
+	MAC  objects.MAC
+}
+
+// ListBlobs yields every blob the snapshot depends on: its header, the VFS,
+// errors and xattrs trees along with the entries, objects and chunks they
+// reference, and the indexes.
+func (snap *Snapshot) ListBlobs() (iter.Seq2[BlobRef, error], error) {
 	pvfs, err := snap.Filesystem()
 	if err != nil {
 		return nil, err
 	}
 
-	return func(yield func(objects.MAC, error) bool) {
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_SNAPSHOT, snap.Header.Identifier)) {
+	return func(yield func(BlobRef, error) bool) {
+		if !yield(BlobRef{resources.RT_SNAPSHOT, snap.Header.Identifier}, nil) {
 			return
 		}
 
-		if snap.Header.Identity.Identifier != uuid.Nil {
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_SIGNATURE, snap.Header.Identifier)) {
+		// signatures used to be stored apart from the header
+		if snap.Header.Identity.Identifier != uuid.Nil && snap.repository.BlobExists(resources.RT_SIGNATURE, snap.Header.Identifier) {
+			if !yield(BlobRef{resources.RT_SIGNATURE, snap.Header.Identifier}, nil) {
 				return
 			}
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_BTREE, snap.Header.Sources[0].VFS.Root)) {
+		if !yield(BlobRef{resources.RT_VFS_BTREE, snap.Header.Sources[0].VFS.Root}, nil) {
 			return
 		}
 
@@ -242,29 +270,29 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 		fsIter := pvfs.IterNodes()
 		for fsIter.Next() {
 			macNode, node := fsIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_NODE, macNode)) {
+			if !yield(BlobRef{resources.RT_VFS_NODE, macNode}, nil) {
 				return
 			}
 
 			for _, entry := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_VFS_ENTRY, entry)) {
+				if !yield(BlobRef{resources.RT_VFS_ENTRY, entry}, nil) {
 					return
 				}
 
 				vfsEntry, err := pvfs.ResolveEntry(entry)
 				if err != nil {
-					if !yield(objects.MAC{}, fmt.Errorf("Failed to resolve entry %x", entry)) {
+					if !yield(BlobRef{}, fmt.Errorf("Failed to resolve entry %x", entry)) {
 						return
 					}
 				}
 
 				if vfsEntry.HasObject() {
-					if !yield(getPackfileForBlobWithError(snap, resources.RT_OBJECT, vfsEntry.Object)) {
+					if !yield(BlobRef{resources.RT_OBJECT, vfsEntry.Object}, nil) {
 						return
 					}
 
 					for _, chunk := range vfsEntry.ResolvedObject.Chunks {
-						if !yield(getPackfileForBlobWithError(snap, resources.RT_CHUNK, chunk.ContentMAC)) {
+						if !yield(BlobRef{resources.RT_CHUNK, chunk.ContentMAC}, nil) {
 							return
 						}
 					}
@@ -275,47 +303,47 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_BTREE, snap.Header.Sources[0].VFS.Errors)) {
+		if !yield(BlobRef{resources.RT_ERROR_BTREE, snap.Header.Sources[0].VFS.Errors}, nil) {
 			return
 		}
 		errIter := pvfs.IterErrorNodes()
 		for errIter.Next() {
 			macNode, node := errIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_NODE, macNode)) {
+			if !yield(BlobRef{resources.RT_ERROR_NODE, macNode}, nil) {
 				return
 			}
 
 			for _, error := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_ERROR_ENTRY, error)) {
+				if !yield(BlobRef{resources.RT_ERROR_ENTRY, error}, nil) {
 					return
 				}
 			}
 		}
 
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_BTREE, snap.Header.Sources[0].VFS.Xattrs)) {
+		if !yield(BlobRef{resources.RT_XATTR_BTREE, snap.Header.Sources[0].VFS.Xattrs}, nil) {
 			return
 		}
 		xattrIter := pvfs.XattrNodes()
 		for xattrIter.Next() {
 			mac, node := xattrIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_NODE, mac)) {
+			if !yield(BlobRef{resources.RT_XATTR_NODE, mac}, nil) {
 				return
 			}
 
 			for _, error := range node.Values {
-				if !yield(getPackfileForBlobWithError(snap, resources.RT_XATTR_ENTRY, error)) {
+				if !yield(BlobRef{resources.RT_XATTR_ENTRY, error}, nil) {
 					return
 				}
 			}
 		}
 
 		// Lastly going over the indexes.
-		if !yield(getPackfileForBlobWithError(snap, resources.RT_BTREE_ROOT, snap.Header.GetSource(0).Indexes[0].Value)) {
+		if !yield(BlobRef{resources.RT_BTREE_ROOT, snap.Header.GetSource(0).Indexes[0].Value}, nil) {
 			return
 		}
 		rd, err := snap.Repository().GetBlob(resources.RT_BTREE_ROOT, snap.Header.GetSource(0).Indexes[0].Value)
 		if err != nil {
-			if !yield(objects.MAC{}, fmt.Errorf("Failed to load Index root entry %s", err)) {
+			if !yield(BlobRef{}, fmt.Errorf("Failed to load Index root entry %s", err)) {
 				return
 			}
 		}
@@ -323,7 +351,7 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 		store := repository.NewRepositoryStore[string, objects.MAC](snap.Repository(), resources.RT_BTREE_NODE)
 		tree, err := btree.Deserialize(rd, store, strings.Compare)
 		if err != nil {
-			if !yield(objects.MAC{}, fmt.Errorf("Failed to deserialize root entry %s", err)) {
+			if !yield(BlobRef{}, fmt.Errorf("Failed to deserialize root entry %s", err)) {
 				return
 			}
 		}
@@ -331,7 +359,7 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 		indexIter := tree.IterDFS()
 		for indexIter.Next() {
 			mac, _ := indexIter.Current()
-			if !yield(getPackfileForBlobWithError(snap, resources.RT_BTREE_NODE, mac)) {
+			if !yield(BlobRef{resources.RT_BTREE_NODE, mac}, nil) {
 				return
 			}
 		}
@@ -339,12 +367,38 @@ func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
 	}, nil
 }
 
-func (snap *Snapshot) Lock() (chan bool, error) {
+func (snap *Snapshot) ListPackfiles() (iter.Seq2[objects.MAC, error], error) {
+	blobs, err := snap.ListBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(objects.MAC, error) bool) {
+		for blob, err := range blobs {
+			if err != nil {
+				if !yield(objects.MAC{}, err) {
+					return
+				}
+				continue
+			}
+			if !yield(getPackfileForBlobWithError(snap, blob.Type, blob.MAC)) {
+				return
+			}
+		}
+	}, nil
+}
+
+// Lock installs a shared lock for the snapshot being written and checks that
+// no other writer holds the repository: a backup can't run alongside
+// maintenance nor another backup.  With force, the conflicting locks are
+// broken instead, which is meant to recover from a writer that died
+// without releasing its lock before it goes stale.
+func (snap *Snapshot) Lock(force bool) (chan bool, error) {
 	lockless, _ := strconv.ParseBool(os.Getenv("PLAKAR_LOCKLESS"))
-	lockDone := make(chan bool)
 	if lockless {
-		return lockDone, nil
+		return nil, nil
 	}
+	lockDone := make(chan bool)
 
 	lock := repository.NewSharedLock(snap.AppContext().Hostname)
 
@@ -368,6 +422,10 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 	}
 
 	for _, lockID := range locksID {
+		if lockID == snap.Header.Identifier {
+			continue
+		}
+
 		version, rd, err := snap.repository.GetLock(lockID)
 		if err != nil {
 			snap.repository.DeleteLock(snap.Header.Identifier)
@@ -381,23 +439,25 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 		}
 
 		/* Kick out stale locks */
-		if lock.IsStale() {
+		if lock.IsStale() || force {
+			if !lock.IsStale() {
+				snap.Logger().Warn("breaking the repository lock held by %s", lock)
+			}
 			err := snap.repository.DeleteLock(lockID)
 			if err != nil {
 				snap.repository.DeleteLock(snap.Header.Identifier)
 				return nil, err
 			}
+			continue
 		}
 
-		// There is an exclusive lock in place, we need to abort.
-		if lock.Exclusive {
-			err := snap.repository.DeleteLock(snap.Header.Identifier)
-			if err != nil {
-				return nil, err
-			}
-
-			return nil, fmt.Errorf("Can't take repository lock, it's already locked by maintenance.")
+		// There is another writer in place, we need to abort.
+		err = snap.repository.DeleteLock(snap.Header.Identifier)
+		if err != nil {
+			return nil, err
 		}
+
+		return nil, fmt.Errorf("Can't take repository lock: %w by %s", repository.ErrLocked, lock)
 	}
 
 	// The following bit is a "ping" mechanism, Lock() is a bit badly named at this point,
@@ -407,6 +467,7 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 			select {
 			case <-lockDone:
 				snap.repository.DeleteLock(snap.Header.Identifier)
+				close(lockDone)
 				return
 			case <-time.After(repository.LOCK_REFRESH_RATE):
 				lock := repository.NewSharedLock(snap.AppContext().Hostname)
@@ -425,8 +486,14 @@ func (snap *Snapshot) Lock() (chan bool, error) {
 	return lockDone, nil
 }
 
+// Unlock releases the lock and waits for it to be removed, so that another
+// writer can take it as soon as Unlock returns.
 func (snap *Snapshot) Unlock(ping chan bool) {
-	close(ping)
+	if ping == nil {
+		return
+	}
+	ping <- true
+	<-ping
 }
 
 func (snap *Snapshot) Logger() *logging.Logger {
@@ -1,11 +1,17 @@
 package snapshot_test
 
 import (
+	"bytes"
+	"fmt"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
@@ -54,3 +60,65 @@ func TestSnapshot(t *testing.T) {
 
 	require.NotEqual(t, snap.Header.Identifier, snap4.Header.Identifier)
 }
+
+func TestSnapshotLock(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	first, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer first.Close()
+	firstDone, err := first.Lock(false)
+	require.NoError(t, err)
+
+	// a second writer fails and doesn't leave its lock behind
+	second, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = second.Lock(false)
+	require.ErrorIs(t, err, repository.ErrLocked)
+	require.Contains(t, err.Error(), fmt.Sprintf("(pid %d)", os.Getpid()))
+
+	locks, err := repo.GetLocks()
+	require.NoError(t, err)
+	require.Equal(t, []objects.MAC{first.Header.Identifier}, locks)
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": t.TempDir()})
+	require.NoError(t, err)
+	err = second.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+	require.ErrorIs(t, err, repository.ErrLocked)
+
+	// forcing breaks the lock of the first writer
+	secondDone, err := second.Lock(true)
+	require.NoError(t, err)
+	locks, err = repo.GetLocks()
+	require.NoError(t, err)
+	require.Equal(t, []objects.MAC{second.Header.Identifier}, locks)
+	second.Unlock(secondDone)
+	first.Unlock(firstDone)
+}
+
+func TestSnapshotLockStale(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	stale := repository.NewSharedLock("elsewhere")
+	stale.Timestamp = time.Now().Add(-repository.LOCK_TTL)
+	buffer := &bytes.Buffer{}
+	require.NoError(t, stale.SerializeToStream(buffer))
+	staleID := objects.RandomMAC()
+	require.NoError(t, repo.PutLock(staleID, buffer))
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+	done, err := snap.Lock(false)
+	require.NoError(t, err)
+	defer snap.Unlock(done)
+
+	locks, err := repo.GetLocks()
+	require.NoError(t, err)
+	require.NotContains(t, locks, staleID)
+}
@@ -1,17 +1,27 @@
 package snapshot
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/PlakarKorp/plakar/btree"
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
-	"github.com/google/uuid"
+	"github.com/PlakarKorp/plakar/tracing"
 )
 
+type SynchronizeOptions struct {
+	MaxConcurrency uint64
+
+	// Span, if set, is the parent of the spans recorded while
+	// transferring the snapshot and committing the destination.
+	Span *tracing.Span
+}
+
 func persistObject(src, dst *Snapshot, object *objects.Object) (objects.MAC, error) {
 	hasher := dst.Repository().GetMACHasher()
 	newObject := *object
@@ -59,7 +69,7 @@ func persistObject(src, dst *Snapshot, object *objects.Object) (objects.MAC, err
 	return mac, nil
 }
 
-func persistVFS(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem, ctidx *btree.BTree[string, int, objects.MAC]) func(objects.MAC) (objects.MAC, error) {
+func persistVFS(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem, ctidx *btree.BTree[string, int, objects.MAC], ctidxMtx *sync.Mutex) func(objects.MAC) (objects.MAC, error) {
 	return func(mac objects.MAC) (objects.MAC, error) {
 		entry, err := fs.ResolveEntry(mac)
 		if err != nil {
@@ -69,7 +79,7 @@ func persistVFS(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem, ctidx *btree.B
 		if entry.HasObject() {
 			entry.Object, err = persistObject(src, dst, entry.ResolvedObject)
 			if err != nil {
-				return objects.MAC{}, nil
+				return objects.MAC{}, err
 			}
 		}
 
@@ -90,7 +100,10 @@ func persistVFS(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem, ctidx *btree.B
 			parts := strings.SplitN(entry.ResolvedObject.ContentType, ";", 2)
 			mime := parts[0]
 			k := fmt.Sprintf("/%s%s", mime, entry.Path())
-			if err := ctidx.Insert(k, entryMAC); err != nil {
+			ctidxMtx.Lock()
+			err := ctidx.Insert(k, entryMAC)
+			ctidxMtx.Unlock()
+			if err != nil {
 				return objects.MAC{}, err
 			}
 		}
@@ -138,22 +151,61 @@ func persistXattrs(src *Snapshot, dst *Snapshot, fs *vfs.Filesystem) func(object
 	}
 }
 
-func (src *Snapshot) Synchronize(dst *Snapshot) error {
-	if src.Header.Identity.Identifier != uuid.Nil {
-		data, err := src.GetBlob(resources.RT_SIGNATURE, src.Header.Identifier)
-		if err != nil {
-			return err
-		}
+// transferAll applies transfer to every MAC using at most maxConcurrency
+// workers, and returns the mapping from the source to the destination MACs.
+// All the errors returned by transfer are collected.
+func transferAll(macs []objects.MAC, maxConcurrency uint64, transfer func(objects.MAC) (objects.MAC, error)) (map[objects.MAC]objects.MAC, error) {
+	if maxConcurrency == 0 {
+		maxConcurrency = 1
+	}
 
-		newmac := dst.Repository().ComputeMAC(data)
-		dst.Header.Identifier = newmac
-		if dst.BlobExists(resources.RT_SIGNATURE, newmac) {
-			err = dst.PutBlob(resources.RT_SIGNATURE, newmac, data)
-			if err != nil {
-				return err
+	results := make(map[objects.MAC]objects.MAC, len(macs))
+	var resultsMtx sync.Mutex
+	var errs []error
+
+	queue := make(chan objects.MAC)
+	wg := sync.WaitGroup{}
+	for i := uint64(0); i < maxConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mac := range queue {
+				newmac, err := transfer(mac)
+				resultsMtx.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					results[mac] = newmac
+				}
+				resultsMtx.Unlock()
 			}
+		}()
+	}
+
+	seen := make(map[objects.MAC]struct{}, len(macs))
+	for _, mac := range macs {
+		if _, ok := seen[mac]; ok {
+			continue
 		}
+		seen[mac] = struct{}{}
+		queue <- mac
 	}
+	close(queue)
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+func (src *Snapshot) Synchronize(dst *Snapshot, opts *SynchronizeOptions) error {
+	maxConcurrency := opts.MaxConcurrency
+	if maxConcurrency == 0 {
+		maxConcurrency = uint64(src.AppContext().MaxConcurrency)
+	}
+
+	dst.span = opts.Span
 
 	fs, err := src.Filesystem()
 	if err != nil {
@@ -164,8 +216,50 @@ func (src *Snapshot) Synchronize(dst *Snapshot) error {
 
 	ctidx, err := btree.New(&btree.InMemoryStore[string, objects.MAC]{}, strings.Compare, 50)
 
+	// The entries are independent from each other, so they are transferred
+	// by a pool of workers first.  The btree is then persisted by looking
+	// up the new MAC of each entry, which keeps the nodes ordering intact.
+	span := opts.Span.Start("enumerate")
+	entries := []objects.MAC{}
+	iter, err := vfs.ScanAll()
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return err
+	}
+	for iter.Next() {
+		_, mac := iter.Current()
+		entries = append(entries, mac)
+	}
+	if err := iter.Err(); err != nil {
+		span.SetError(err)
+		span.End()
+		return err
+	}
+	span.SetInt("entries", int64(len(entries)))
+	span.End()
+
+	span = opts.Span.Start("transfer")
+	span.SetInt("entries", int64(len(entries)))
+	var ctidxMtx sync.Mutex
+	transferred, err := transferAll(entries, maxConcurrency, persistVFS(src, dst, fs, ctidx, &ctidxMtx))
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	span = opts.Span.Start("index")
+	defer span.End()
+
 	dst.Header.GetSource(0).VFS.Root, err = persistIndex(dst, vfs, resources.RT_VFS_BTREE,
-		resources.RT_VFS_NODE, persistVFS(src, dst, fs, ctidx))
+		resources.RT_VFS_NODE, func(mac objects.MAC) (objects.MAC, error) {
+			newmac, ok := transferred[mac]
+			if !ok {
+				return objects.MAC{}, fmt.Errorf("vfs entry %x was not transferred", mac)
+			}
+			return newmac, nil
+		})
 	if err != nil {
 		return err
 	}
@@ -193,5 +287,6 @@ func (src *Snapshot) Synchronize(dst *Snapshot) error {
 		},
 	}
 
+	dst.dropStaleSignature()
 	return nil
 }
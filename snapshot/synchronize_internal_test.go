@@ -0,0 +1,64 @@
+package snapshot
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferAllConcurrent(t *testing.T) {
+	macs := []objects.MAC{}
+	for i := 0; i < 64; i++ {
+		macs = append(macs, objects.MAC{byte(i)})
+	}
+	// duplicates are only transferred once
+	macs = append(macs, macs[0], macs[1])
+
+	var active, peak, calls atomic.Int32
+	results, err := transferAll(macs, 4, func(mac objects.MAC) (objects.MAC, error) {
+		calls.Add(1)
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		// give the other workers a chance to pick up work
+		deadline := time.Now().Add(time.Second)
+		for peak.Load() < 4 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		mac[31] = 0xff
+		return mac, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(4), peak.Load())
+	require.Equal(t, int32(64), calls.Load())
+	require.Len(t, results, 64)
+	for _, mac := range macs {
+		expected := mac
+		expected[31] = 0xff
+		require.Equal(t, expected, results[mac])
+	}
+}
+
+func TestTransferAllErrors(t *testing.T) {
+	macs := []objects.MAC{{1}, {2}, {3}}
+
+	errOdd := errors.New("odd")
+	_, err := transferAll(macs, 2, func(mac objects.MAC) (objects.MAC, error) {
+		if mac[0]%2 == 1 {
+			return objects.MAC{}, errOdd
+		}
+		return mac, nil
+	})
+	require.ErrorIs(t, err, errOdd)
+}
@@ -0,0 +1,84 @@
+package snapshot_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	ptesting "github.com/PlakarKorp/plakar/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSynchronize(t *testing.T) {
+	files := []ptesting.MockFile{}
+	for i := 0; i < 10; i++ {
+		files = append(files, ptesting.NewMockDir(fmt.Sprintf("dir%d", i)))
+		for j := 0; j < 10; j++ {
+			files = append(files, ptesting.NewMockFile(fmt.Sprintf("dir%d/file%d.txt", i, j), 0644, fmt.Sprintf("content %d/%d", i, j)))
+		}
+	}
+
+	src := ptesting.GenerateSnapshot(t, nil, nil, nil, files)
+	defer src.Close()
+
+	peer := generateSnapshot(t, nil)
+	defer peer.Close()
+	dstRepo := peer.Repository()
+
+	srcFs, err := src.Filesystem()
+	require.NoError(t, err)
+	expected := map[string]string{}
+	for pathname, err := range srcFs.Pathnames() {
+		require.NoError(t, err)
+		expected[pathname] = ""
+		entry, err := srcFs.GetEntry(pathname)
+		require.NoError(t, err)
+		if entry.Stat().Mode().IsRegular() {
+			rd, err := src.NewReader(pathname)
+			require.NoError(t, err)
+			content, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			rd.Close()
+			expected[pathname] = string(content)
+		}
+	}
+	require.Greater(t, len(expected), 100)
+
+	dst, err := snapshot.New(dstRepo)
+	require.NoError(t, err)
+	dst.Header = src.Header
+
+	err = src.Synchronize(dst, &snapshot.SynchronizeOptions{MaxConcurrency: 8})
+	require.NoError(t, err)
+	err = dst.Commit(nil)
+	require.NoError(t, err)
+	dst.Close()
+
+	err = dstRepo.RebuildState()
+	require.NoError(t, err)
+
+	synced, err := snapshot.Load(dstRepo, dst.Header.Identifier)
+	require.NoError(t, err)
+	defer synced.Close()
+
+	syncedFs, err := synced.Filesystem()
+	require.NoError(t, err)
+
+	found := map[string]string{}
+	for pathname, err := range syncedFs.Pathnames() {
+		require.NoError(t, err)
+		found[pathname] = ""
+		entry, err := syncedFs.GetEntry(pathname)
+		require.NoError(t, err)
+		if entry.Stat().Mode().IsRegular() {
+			rd, err := synced.NewReader(pathname)
+			require.NoError(t, err)
+			content, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			rd.Close()
+			found[pathname] = string(content)
+		}
+	}
+	require.Equal(t, expected, found)
+}
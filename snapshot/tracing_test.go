@@ -0,0 +1,72 @@
+package snapshot_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	"github.com/PlakarKorp/plakar/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupTracing(t *testing.T) {
+	base := generateSnapshot(t, nil)
+	defer base.Close()
+	repo := base.Repository()
+
+	tmpBackupDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(tmpBackupDir, "subdir"), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpBackupDir, "subdir", "a.txt"), []byte("hello"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpBackupDir, "b.txt"), []byte("world!"), 0644)
+	require.NoError(t, err)
+
+	exporter := tracing.NewInMemoryExporter()
+	tracer := tracing.NewTracer(exporter, repo.Logger())
+	repo.AppContext().SetTracer(tracer)
+	defer repo.AppContext().SetTracer(nil)
+
+	snap, err := snapshot.New(repo)
+	require.NoError(t, err)
+	defer snap.Close()
+
+	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
+	require.NoError(t, err)
+	err = snap.Backup(imp, &snapshot.BackupOptions{Name: "traced", MaxConcurrency: 1})
+	require.NoError(t, err)
+	require.NoError(t, tracer.Close())
+
+	spans := map[string]tracing.SpanData{}
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+	for _, name := range []string{"backup", "scan", "chunk", "index", "pack", "commit"} {
+		require.Contains(t, spans, name)
+	}
+
+	root := spans["backup"]
+	require.Equal(t, tracing.SpanID{}, root.ParentID)
+	require.Empty(t, root.Error)
+	for name, span := range spans {
+		require.Equal(t, root.TraceID, span.TraceID, name)
+		if name != "backup" {
+			require.Equal(t, root.SpanID, span.ParentID, name)
+		}
+	}
+
+	attributes := func(span tracing.SpanData) map[string]any {
+		ret := map[string]any{}
+		for _, attr := range span.Attributes {
+			ret[attr.Key] = attr.Value
+		}
+		return ret
+	}
+	require.Equal(t, int64(2), attributes(spans["scan"])["files"])
+	require.Equal(t, int64(11), attributes(spans["scan"])["bytes"])
+	require.Equal(t, int64(2), attributes(spans["chunk"])["files"])
+	require.Equal(t, int64(11), attributes(spans["chunk"])["bytes"])
+	require.Equal(t, "fs", attributes(root)["importer.type"])
+}
@@ -1,11 +1,13 @@
 package snapshot
 
 import (
+	"bytes"
 	"crypto/ed25519"
+	"errors"
+	"fmt"
 
 	"github.com/PlakarKorp/plakar/resources"
 	"github.com/PlakarKorp/plakar/versioning"
-	"github.com/google/uuid"
 )
 
 const SIGNATURE_VERSION = "1.0.0"
@@ -14,21 +16,113 @@ func init() {
 	versioning.Register(resources.RT_SIGNATURE, versioning.FromString(SIGNATURE_VERSION))
 }
 
+var (
+	ErrInvalidSignature   = errors.New("invalid snapshot signature")
+	ErrUnsignedSnapshot   = errors.New("snapshot is not signed")
+	ErrUntrustedSignature = errors.New("snapshot is signed by an untrusted key")
+)
+
+// Signed reports whether the header carries a signature.
+func (snap *Snapshot) Signed() bool {
+	return len(snap.Header.Identity.Signature) != 0
+}
+
+// sign signs the header with the keypair of the application context, if
+// it is the one the header was created with.
+func (snap *Snapshot) sign() error {
+	kp := snap.AppContext().Keypair
+	if kp == nil || !bytes.Equal(kp.PublicKey, snap.Header.Identity.PublicKey) {
+		return nil
+	}
+
+	payload, err := snap.Header.SignedPayload()
+	if err != nil {
+		return err
+	}
+	snap.Header.Identity.Signature = kp.Sign(payload)
+	return nil
+}
+
+// dropStaleSignature removes the signature of a header synced to a
+// repository computing other MACs when it can't be signed again, that is
+// when the application context doesn't hold the key of its author.
+func (snap *Snapshot) dropStaleSignature() {
+	kp := snap.AppContext().Keypair
+	if !snap.Signed() || (kp != nil && bytes.Equal(kp.PublicKey, snap.Header.Identity.PublicKey)) {
+		return
+	}
+	if ok, err := snap.Verify(); err != nil || !ok {
+		snap.Logger().Warn("snapshot %x: dropping the signature, it can't be renewed without the key of its author",
+			snap.Header.GetIndexShortID())
+		snap.Header.Identity.Signature = nil
+	}
+}
+
+// Verify checks the signature of the header against the public key it
+// carries, an unsigned snapshot doesn't verify.  Anyone can sign a header
+// with their own key, Trusted tells whether that key is one to rely on.
 func (snap *Snapshot) Verify() (bool, error) {
-	if snap.Header.Identity.Identifier == uuid.Nil {
+	if !snap.Signed() {
 		return false, nil
 	}
 
-	signature, err := snap.GetBlob(resources.RT_SIGNATURE, snap.Header.Identifier)
+	payload, err := snap.Header.SignedPayload()
 	if err != nil {
 		return false, err
 	}
 
-	serializedHdr, err := snap.Header.Serialize()
-	if err != nil {
-		return false, err
+	return ed25519.Verify(snap.Header.Identity.PublicKey, payload, snap.Header.Identity.Signature), nil
+}
+
+// Trusted reports whether the header carries the public key of the
+// application context or one of its trusted keys.
+func (snap *Snapshot) Trusted() bool {
+	publicKey := snap.Header.Identity.PublicKey
+	if len(publicKey) == 0 {
+		return false
+	}
+	if kp := snap.AppContext().Keypair; kp != nil && bytes.Equal(kp.PublicKey, publicKey) {
+		return true
+	}
+	for _, key := range snap.AppContext().TrustedKeys {
+		if bytes.Equal(key, publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyOnLoad checks the signature of a snapshot being loaded.  If the
+// application context asks for strict signatures, the load fails unless
+// the snapshot is signed by a trusted key.  Otherwise only an invalid
+// signature is warned about: an unsigned snapshot or one signed by an
+// unknown key is no less trustworthy than before signatures existed.
+func (snap *Snapshot) verifyOnLoad() error {
+	strict := snap.AppContext().StrictSignatures
+
+	var err error
+	if !snap.Signed() {
+		if !strict {
+			return nil
+		}
+		err = ErrUnsignedSnapshot
+	} else {
+		var ok bool
+		ok, err = snap.Verify()
+		if err == nil && !ok {
+			err = ErrInvalidSignature
+		}
+		if err == nil && strict && !snap.Trusted() {
+			err = ErrUntrustedSignature
+		}
+	}
+	if err == nil {
+		return nil
 	}
-	serializedHdrmac := snap.repository.ComputeMAC(serializedHdr)
 
-	return ed25519.Verify(snap.Header.Identity.PublicKey, serializedHdrmac[:], signature), nil
+	if strict {
+		return fmt.Errorf("snapshot %x: %w", snap.Header.GetIndexShortID(), err)
+	}
+	snap.Logger().Warn("snapshot %x: %s", snap.Header.GetIndexShortID(), err)
+	return nil
 }
@@ -1,21 +1,258 @@
 package snapshot_test
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"slices"
 	"testing"
 
 	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/header"
+	ptesting "github.com/PlakarKorp/plakar/testing"
 	"github.com/stretchr/testify/require"
 )
 
-// will be fixed when signed snapshots are back post beta
-func _TestVerify(t *testing.T) {
+func TestVerify(t *testing.T) {
 	defaultKeyPair, err := keypair.Generate()
 	require.NoError(t, err)
 
 	snap := generateSnapshot(t, defaultKeyPair)
 	defer snap.Close()
 
-	verified, err := snap.Verify()
+	repo := snap.Repository()
+	repo.AppContext().StrictSignatures = true
+
+	loaded, err := snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.True(t, loaded.Signed())
+	require.Equal(t, []byte(defaultKeyPair.PublicKey), loaded.Header.Identity.PublicKey)
+
+	verified, err := loaded.Verify()
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	// the identifier is only the name of the header in the repository
+	loaded.Header.Identifier[0] ^= 0xff
+	verified, err = loaded.Verify()
 	require.NoError(t, err)
 	require.True(t, verified)
+
+	// the content is covered
+	root := loaded.Header.GetSource(0).VFS.Root
+	loaded.Header.GetSource(0).VFS.Root[0] ^= 0xff
+	verified, err = loaded.Verify()
+	require.NoError(t, err)
+	require.False(t, verified)
+	loaded.Header.GetSource(0).VFS.Root = root
+
+	loaded.Header.Name = "tampered"
+	verified, err = loaded.Verify()
+	require.NoError(t, err)
+	require.False(t, verified)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	defaultKeyPair, err := keypair.Generate()
+	require.NoError(t, err)
+
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+	snap := ptesting.GenerateSnapshot(t, bufOut, bufErr, defaultKeyPair, []ptesting.MockFile{
+		ptesting.NewMockFile("dummy.txt", 0644, "hello"),
+	})
+	defer snap.Close()
+
+	// commit a copy of the header with another name and the original
+	// signature, from a context without the key to sign it again
+	repo := snap.Repository()
+	ctx := repo.AppContext()
+	ctx.Keypair, err = keypair.Generate()
+	require.NoError(t, err)
+	tampered, err := snapshot.New(repo)
+	require.NoError(t, err)
+	hdr := *snap.Header
+	hdr.Identifier = tampered.Header.Identifier
+	hdr.Name = "tampered"
+	tampered.Header = &hdr
+	require.NoError(t, tampered.Commit(nil))
+	tampered.Close()
+	require.NoError(t, repo.RebuildState())
+
+	bufErr.Reset()
+	loaded, err := snapshot.Load(repo, tampered.Header.Identifier)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.Contains(t, bufErr.String(), snapshot.ErrInvalidSignature.Error())
+
+	verified, err := loaded.Verify()
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	ctx.Keypair = defaultKeyPair
+	ctx.StrictSignatures = true
+	_, err = snapshot.Load(repo, tampered.Header.Identifier)
+	require.ErrorIs(t, err, snapshot.ErrInvalidSignature)
+
+	_, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	snap := generateSnapshot(t, nil)
+	defer snap.Close()
+
+	repo := snap.Repository()
+
+	loaded, err := snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.False(t, loaded.Signed())
+
+	verified, err := loaded.Verify()
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	repo.AppContext().StrictSignatures = true
+	_, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.ErrorIs(t, err, snapshot.ErrUnsignedSnapshot)
+}
+
+// commitCopy commits a copy of the header of snap under a new identifier,
+// altered by fn, and signed if the application context holds the key of
+// the public key left in the header.
+func commitCopy(t *testing.T, snap *snapshot.Snapshot, fn func(*header.Header)) objects.MAC {
+	repo := snap.Repository()
+	dst, err := snapshot.New(repo)
+	require.NoError(t, err)
+	hdr := *snap.Header
+	hdr.Identifier = dst.Header.Identifier
+	fn(&hdr)
+	dst.Header = &hdr
+	require.NoError(t, dst.Commit(nil))
+	dst.Close()
+	require.NoError(t, repo.RebuildState())
+	return hdr.Identifier
+}
+
+func TestVerifyStripped(t *testing.T) {
+	defaultKeyPair, err := keypair.Generate()
+	require.NoError(t, err)
+
+	snap := generateSnapshot(t, defaultKeyPair)
+	defer snap.Close()
+
+	// a context without the key can't sign the header again
+	repo := snap.Repository()
+	ctx := repo.AppContext()
+	ctx.Keypair, err = keypair.Generate()
+	require.NoError(t, err)
+	stripped := commitCopy(t, snap, func(hdr *header.Header) {
+		hdr.Name = "tampered"
+		hdr.Identity.Signature = nil
+	})
+
+	ctx.Keypair = defaultKeyPair
+	loaded, err := snapshot.Load(repo, stripped)
+	require.NoError(t, err)
+	defer loaded.Close()
+	require.False(t, loaded.Signed())
+
+	ctx.StrictSignatures = true
+	_, err = snapshot.Load(repo, stripped)
+	require.ErrorIs(t, err, snapshot.ErrUnsignedSnapshot)
+
+	_, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+}
+
+func TestVerifyForeignKey(t *testing.T) {
+	defaultKeyPair, err := keypair.Generate()
+	require.NoError(t, err)
+	foreignKeyPair, err := keypair.Generate()
+	require.NoError(t, err)
+
+	snap := generateSnapshot(t, defaultKeyPair)
+	defer snap.Close()
+
+	// the header is signed again with another key, which the header
+	// now carries
+	repo := snap.Repository()
+	ctx := repo.AppContext()
+	ctx.Keypair = foreignKeyPair
+	forged := commitCopy(t, snap, func(hdr *header.Header) {
+		hdr.Name = "tampered"
+		hdr.Identity.PublicKey = foreignKeyPair.PublicKey
+	})
+
+	ctx.Keypair = defaultKeyPair
+	loaded, err := snapshot.Load(repo, forged)
+	require.NoError(t, err)
+	defer loaded.Close()
+	verified, err := loaded.Verify()
+	require.NoError(t, err)
+	require.True(t, verified)
+	require.False(t, loaded.Trusted())
+
+	ctx.StrictSignatures = true
+	_, err = snapshot.Load(repo, forged)
+	require.ErrorIs(t, err, snapshot.ErrUntrustedSignature)
+
+	_, err = snapshot.Load(repo, snap.Header.Identifier)
+	require.NoError(t, err)
+
+	ctx.TrustedKeys = []ed25519.PublicKey{foreignKeyPair.PublicKey}
+	_, err = snapshot.Load(repo, forged)
+	require.NoError(t, err)
+}
+
+func TestVerifySynchronized(t *testing.T) {
+	defaultKeyPair, err := keypair.Generate()
+	require.NoError(t, err)
+
+	src := generateSnapshot(t, defaultKeyPair)
+	defer src.Close()
+
+	for _, withKey := range []bool{true, false} {
+		peer := generateSnapshot(t, nil)
+		defer peer.Close()
+		dstRepo := peer.Repository()
+		dstRepo.AppContext().StrictSignatures = true
+		if withKey {
+			dstRepo.AppContext().Keypair = defaultKeyPair
+		}
+
+		dst, err := snapshot.New(dstRepo)
+		require.NoError(t, err)
+		hdr := *src.Header
+		hdr.Sources = slices.Clone(src.Header.Sources)
+		dst.Header = &hdr
+		require.NoError(t, src.Synchronize(dst, &snapshot.SynchronizeOptions{MaxConcurrency: 1}))
+		require.NoError(t, dst.Commit(nil))
+		dst.Close()
+		require.NoError(t, dstRepo.RebuildState())
+
+		// the MACs differ in the other repository
+		require.NotEqual(t, src.Header.GetSource(0).VFS.Root, dst.Header.GetSource(0).VFS.Root)
+
+		// without the key, the snapshot is no longer signed
+		if !withKey {
+			_, err = snapshot.Load(dstRepo, dst.Header.Identifier)
+			require.ErrorIs(t, err, snapshot.ErrUnsignedSnapshot)
+			dstRepo.AppContext().StrictSignatures = false
+		}
+
+		synced, err := snapshot.Load(dstRepo, dst.Header.Identifier)
+		require.NoError(t, err)
+		defer synced.Close()
+
+		// the author signs the snapshot again, anyone else can only
+		// drop the signature
+		require.Equal(t, withKey, synced.Signed())
+		verified, err := synced.Verify()
+		require.NoError(t, err)
+		require.Equal(t, withKey, verified)
+	}
 }
@@ -2,7 +2,7 @@ package vfs
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"io/fs"
 	"iter"
@@ -224,21 +224,41 @@ func (e *Entry) Info() (fs.FileInfo, error) {
 }
 
 func (e *Entry) Xattr(fsc *Filesystem, xattrName string) (io.ReadSeeker, error) {
-	p := fmt.Sprintf("%s%s:", e.Path(), xattrName)
-	mac, found, err := fsc.xattrs.Find(p)
+	return e.XattrOfType(fsc, xattrName, objects.AttributeExtended)
+}
+
+// XattrOfType is like Xattr but looks up an attribute of the given type,
+// such as a Windows alternate data stream.
+func (e *Entry) XattrOfType(fsc *Filesystem, xattrName string, xattrType objects.Attribute) (io.ReadSeeker, error) {
+	xattr, err := e.lookupXattr(fsc, xattrName, xattrType)
 	if err != nil {
 		return nil, err
 	}
-	if !found {
-		return nil, fs.ErrNotExist
+
+	return NewObjectReader(fsc.repo, xattr.ResolvedObject, xattr.Size), nil
+}
+
+// LookupXattr returns the record of the attribute named xattrName, which
+// is either an extended attribute or an alternate data stream.
+func (e *Entry) LookupXattr(fsc *Filesystem, xattrName string) (*Xattr, error) {
+	xattr, err := e.lookupXattr(fsc, xattrName, objects.AttributeExtended)
+	if errors.Is(err, fs.ErrNotExist) {
+		xattr, err = e.lookupXattr(fsc, xattrName, objects.AttributeADS)
 	}
+	return xattr, err
+}
 
-	xattr, err := fsc.ResolveXattr(mac)
+func (e *Entry) lookupXattr(fsc *Filesystem, xattrName string, xattrType objects.Attribute) (*Xattr, error) {
+	p := (&Xattr{Path: e.Path(), Name: xattrName, Type: xattrType}).ToPath()
+	mac, found, err := fsc.xattrs.Find(p)
 	if err != nil {
 		return nil, err
 	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
 
-	return NewObjectReader(fsc.repo, xattr.ResolvedObject, xattr.Size), nil
+	return fsc.ResolveXattr(mac)
 }
 
 // FileEntry implements fs.File, FSEntry and ReadSeeker
@@ -298,7 +318,7 @@ func (vf *vfile) Close() error {
 		return fs.ErrClosed
 	}
 	vf.closed = true
-	return nil
+	return vf.rd.Close()
 }
 
 type vdir struct {
@@ -17,6 +17,11 @@ type ObjectReader struct {
 	objoff int
 	off    int64
 	rd     io.ReadSeeker
+
+	// stream is the chunk being read sequentially when rd isn't set by
+	// Seek, streamoff the position in that chunk.
+	stream    io.ReadCloser
+	streamoff int64
 }
 
 func NewObjectReader(repo *repository.Repository, object *objects.Object, size int64) *ObjectReader {
@@ -29,31 +34,72 @@ func NewObjectReader(repo *repository.Repository, object *objects.Object, size i
 
 func (or *ObjectReader) Read(p []byte) (int, error) {
 	for or.objoff < len(or.object.Chunks) {
-		if or.rd == nil {
-			rd, err := or.repo.GetBlob(resources.RT_CHUNK,
-				or.object.Chunks[or.objoff].ContentMAC)
-			if err != nil {
-				return -1, err
+		var rd io.Reader = or.rd
+		if rd == nil {
+			if or.stream == nil {
+				stream, err := or.repo.GetBlobReader(resources.RT_CHUNK,
+					or.object.Chunks[or.objoff].ContentMAC)
+				if err != nil {
+					return -1, err
+				}
+				or.stream = stream
+				or.streamoff = 0
 			}
-			or.rd = rd
+			rd = or.stream
 		}
 
-		n, err := or.rd.Read(p)
+		n, err := rd.Read(p)
+		or.off += int64(n)
+		or.streamoff += int64(n)
 		if errors.Is(err, io.EOF) {
+			or.closeStream()
 			or.objoff++
 			or.rd = nil
+			if n > 0 {
+				return n, nil
+			}
 			continue
 		}
-		or.off += int64(n)
 		return n, err
 	}
 
 	return 0, io.EOF
 }
 
+func (or *ObjectReader) closeStream() error {
+	if or.stream == nil {
+		return nil
+	}
+	err := or.stream.Close()
+	or.stream = nil
+	return err
+}
+
+// Close releases the chunk being read.
+func (or *ObjectReader) Close() error {
+	return or.closeStream()
+}
+
 func (or *ObjectReader) Seek(offset int64, whence int) (int64, error) {
 	chunks := or.object.Chunks
 
+	// position a seekable reader where the stream was
+	if or.stream != nil {
+		streamoff := or.streamoff
+		or.closeStream()
+		if whence == io.SeekCurrent {
+			rd, err := or.repo.GetBlob(resources.RT_CHUNK,
+				chunks[or.objoff].ContentMAC)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := rd.Seek(streamoff, io.SeekStart); err != nil {
+				return 0, err
+			}
+			or.rd = rd
+		}
+	}
+
 	switch whence {
 	case io.SeekStart:
 		or.rd = nil
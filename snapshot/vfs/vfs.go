@@ -311,6 +311,49 @@ func (fsc *Filesystem) Pathnames() iter.Seq2[string, error] {
 	}
 }
 
+// PathnamesWithPrefix returns the pathnames starting with prefix.
+// Since the tree is sorted by depth first, the matching pathnames of
+// a given depth are contiguous: each range is found with a ScanFrom,
+// and the children of every match are then looked up the same way.
+func (fsc *Filesystem) PathnamesWithPrefix(prefix string) iter.Seq2[string, error] {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	return func(yield func(string, error) bool) {
+		prefixes := []string{prefix}
+		for len(prefixes) != 0 {
+			prefix := prefixes[0]
+			prefixes = prefixes[1:]
+
+			iter, err := fsc.tree.ScanFrom(prefix)
+			if err != nil {
+				yield("", err)
+				return
+			}
+
+			for iter.Next() {
+				pathname, _ := iter.Current()
+				if !strings.HasPrefix(pathname, prefix) ||
+					strings.Count(pathname, "/") != strings.Count(prefix, "/") {
+					break
+				}
+				if !yield(pathname, nil) {
+					return
+				}
+				if !strings.HasSuffix(pathname, "/") {
+					prefixes = append(prefixes, pathname+"/")
+				}
+			}
+
+			if err := iter.Err(); err != nil {
+				yield("", err)
+				return
+			}
+		}
+	}
+}
+
 func (fsc *Filesystem) GetEntry(entrypath string) (*Entry, error) {
 	if !strings.HasPrefix(entrypath, "/") {
 		entrypath = "/" + entrypath
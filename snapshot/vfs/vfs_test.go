@@ -176,6 +176,33 @@ func TestPathnames(t *testing.T) {
 	require.NotEmpty(t, filepath)
 }
 
+func TestPathnamesWithPrefix(t *testing.T) {
+	snap := generateSnapshot(t)
+	defer snap.Close()
+
+	err := snap.Repository().RebuildState()
+	require.NoError(t, err)
+
+	fs, err := snap.Filesystem()
+	require.NoError(t, err)
+
+	backupDir := snap.Header.GetSource(0).Importer.Directory
+
+	var pathnames []string
+	for pathname, err := range fs.PathnamesWithPrefix(backupDir + "/sub") {
+		require.NoError(t, err)
+		pathnames = append(pathnames, pathname)
+	}
+	require.Equal(t, []string{backupDir + "/subdir", backupDir + "/subdir/dummy.txt"}, pathnames)
+
+	pathnames = nil
+	for pathname, err := range fs.PathnamesWithPrefix(backupDir + "/nonexistent") {
+		require.NoError(t, err)
+		pathnames = append(pathnames, pathname)
+	}
+	require.Empty(t, pathnames)
+}
+
 func TestOpen(t *testing.T) {
 	snap := generateSnapshot(t)
 	defer snap.Close()
@@ -104,6 +104,26 @@ func (buckets *Buckets) Get(mac objects.MAC) (io.Reader, error) {
 	return ClosingReader(fp)
 }
 
+func (buckets *Buckets) GetFrom(mac objects.MAC, offset uint64) (io.Reader, error) {
+	fp, err := os.Open(buckets.Path(mac))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fp.Seek(int64(offset), io.SeekStart); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return ClosingReader(fp)
+}
+
+func (buckets *Buckets) Size(mac objects.MAC) (uint64, error) {
+	fi, err := os.Stat(buckets.Path(mac))
+	if err != nil {
+		return 0, err
+	}
+	return uint64(fi.Size()), nil
+}
+
 func (buckets *Buckets) GetBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
 	fp, err := os.Open(buckets.Path(mac))
 	if err != nil {
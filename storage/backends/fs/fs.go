@@ -154,6 +154,28 @@ func (s *Store) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (
 	return res, nil
 }
 
+func (s *Store) GetPackfileFrom(mac objects.MAC, offset uint64) (io.Reader, error) {
+	res, err := s.packfiles.GetFrom(mac, offset)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = repository.ErrPackfileNotFound
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Store) GetPackfileSize(mac objects.MAC) (uint64, error) {
+	size, err := s.packfiles.Size(mac)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = repository.ErrPackfileNotFound
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
 func (s *Store) DeletePackfile(mac objects.MAC) error {
 	return s.packfiles.Remove(mac)
 }
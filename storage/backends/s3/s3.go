@@ -313,6 +313,29 @@ func (s *Store) GetPackfile(mac objects.MAC) (io.Reader, error) {
 	return object, nil
 }
 
+func (s *Store) GetPackfileFrom(mac objects.MAC, offset uint64) (io.Reader, error) {
+	// a range of 0-0 is the first byte, not the whole object
+	opts := minio.GetObjectOptions{}
+	if offset != 0 {
+		if err := opts.SetRange(int64(offset), 0); err != nil {
+			return nil, err
+		}
+	}
+	object, err := s.minioClient.GetObject(context.Background(), s.bucketName, fmt.Sprintf("packfiles/%02x/%016x", mac[0], mac), opts)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *Store) GetPackfileSize(mac objects.MAC) (uint64, error) {
+	info, err := s.minioClient.StatObject(context.Background(), s.bucketName, fmt.Sprintf("packfiles/%02x/%016x", mac[0], mac), minio.StatObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(info.Size), nil
+}
+
 func (s *Store) GetPackfileBlob(mac objects.MAC, offset uint64, length uint32) (io.Reader, error) {
 	opts := minio.GetObjectOptions{}
 	object, err := s.minioClient.GetObject(context.Background(), s.bucketName, fmt.Sprintf("packfiles/%02x/%016x", mac[0], mac), opts)
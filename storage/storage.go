@@ -134,6 +134,18 @@ type Store interface {
 	Close() error
 }
 
+// PackfileRanger is implemented by the stores which can read a packfile
+// from an offset, which allows resuming an interrupted transfer.
+type PackfileRanger interface {
+	GetPackfileFrom(mac objects.MAC, offset uint64) (io.Reader, error)
+}
+
+// PackfileSizer is implemented by the stores which can tell the size of a
+// packfile without reading it, which allows reading only its footer.
+type PackfileSizer interface {
+	GetPackfileSize(mac objects.MAC) (uint64, error)
+}
+
 type backend struct {
 	name string
 	fn   func(map[string]string) (Store, error)
@@ -55,6 +55,11 @@ var behaviors = map[string]mockedBackendBehavior{
 		header:        nil,
 		packfilesMACs: nil,
 	},
+	"brokenPutPackfile": {
+		statesMACs:    nil,
+		header:        nil,
+		packfilesMACs: nil,
+	},
 	"nopackfile": {
 		statesMACs:    []objects.MAC{{0x01}, {0x02}, {0x03}},
 		header:        nil,
@@ -149,6 +154,9 @@ func (mb *MockBackend) GetPackfiles() ([]objects.MAC, error) {
 }
 
 func (mb *MockBackend) PutPackfile(MAC objects.MAC, rd io.Reader) error {
+	if mb.behavior == "brokenPutPackfile" {
+		return errors.New("broken put packfile")
+	}
 	return nil
 }
 
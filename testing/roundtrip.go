@@ -0,0 +1,115 @@
+package testing
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot"
+	fsexporter "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+	"github.com/pkg/xattr"
+	"github.com/stretchr/testify/require"
+)
+
+// AssertRoundTrip backs up files, restores the snapshot with the fs
+// exporter and checks that the restored tree is identical to the one that
+// was backed up: same entries, types, permissions, contents, symlink
+// targets and extended attributes, and same modification times for files.
+// Directory modification times are not compared, creating the entries
+// they contain changes them.
+func AssertRoundTrip(t testing.TB, files []MockFile) {
+	bufOut := bytes.NewBuffer(nil)
+	bufErr := bytes.NewBuffer(nil)
+
+	snap := GenerateSnapshot(t, bufOut, bufErr, nil, files)
+	defer snap.Close()
+
+	source := snap.Header.GetSource(0).Importer.Directory
+	target := t.TempDir()
+
+	exp, err := fsexporter.NewFSExporter(map[string]string{"location": target})
+	require.NoError(t, err)
+	defer exp.Close()
+
+	err = snap.Restore(exp, exp.Root(), source, &snapshot.RestoreOptions{
+		MaxConcurrency: 1,
+		Strip:          source,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, listTree(t, source), listTree(t, target), "restored entries")
+
+	for _, name := range listTree(t, source) {
+		assertSameEntry(t, filepath.Join(source, name), filepath.Join(target, name), name)
+	}
+}
+
+// listTree returns the paths of the entries below root, relative to it.
+func listTree(t testing.TB, root string) []string {
+	var ret []string
+	err := filepath.WalkDir(root, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if pathname == root {
+			return nil
+		}
+		name, err := filepath.Rel(root, pathname)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, filepath.ToSlash(name))
+		return nil
+	})
+	require.NoError(t, err)
+	return ret
+}
+
+func assertSameEntry(t testing.TB, expected, actual, name string) {
+	want, err := os.Lstat(expected)
+	require.NoError(t, err)
+	got, err := os.Lstat(actual)
+	require.NoError(t, err)
+
+	require.Equal(t, want.Mode().Type(), got.Mode().Type(), "%s: type", name)
+
+	switch {
+	case want.Mode()&os.ModeSymlink != 0:
+		wantTarget, err := os.Readlink(expected)
+		require.NoError(t, err)
+		gotTarget, err := os.Readlink(actual)
+		require.NoError(t, err)
+		require.Equal(t, wantTarget, gotTarget, "%s: symlink target", name)
+
+	case want.Mode().IsRegular():
+		require.Equal(t, want.Mode().Perm(), got.Mode().Perm(), "%s: permissions", name)
+		require.True(t, want.ModTime().Equal(got.ModTime()), "%s: modification time %s != %s",
+			name, want.ModTime(), got.ModTime())
+
+		wantContent, err := os.ReadFile(expected)
+		require.NoError(t, err)
+		gotContent, err := os.ReadFile(actual)
+		require.NoError(t, err)
+		require.Equal(t, wantContent, gotContent, "%s: content", name)
+
+	default:
+		require.Equal(t, want.Mode().Perm(), got.Mode().Perm(), "%s: permissions", name)
+	}
+
+	require.Equal(t, listXattrs(t, expected), listXattrs(t, actual), "%s: extended attributes", name)
+}
+
+func listXattrs(t testing.TB, pathname string) map[string][]byte {
+	names, err := xattr.LList(pathname)
+	require.NoError(t, err)
+
+	ret := make(map[string][]byte, len(names))
+	for _, name := range names {
+		value, err := xattr.LGet(pathname, name)
+		require.NoError(t, err)
+		ret[name] = value
+	}
+	return ret
+}
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/PlakarKorp/plakar/appcontext"
 	"github.com/PlakarKorp/plakar/caching"
+	"github.com/PlakarKorp/plakar/encryption"
 	"github.com/PlakarKorp/plakar/encryption/keypair"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/logging"
@@ -20,6 +22,7 @@ import (
 	bfs "github.com/PlakarKorp/plakar/storage/backends/fs"
 	"github.com/PlakarKorp/plakar/versioning"
 	"github.com/google/uuid"
+	"github.com/pkg/xattr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,6 +31,12 @@ type MockFile struct {
 	IsDir   bool
 	Mode    os.FileMode
 	Content []byte
+	Target  string
+	Xattrs  map[string][]byte
+
+	// ModTime, if set, is the modification time of the file, it is
+	// ignored for symlinks.
+	ModTime time.Time
 }
 
 func NewMockDir(path string) MockFile {
@@ -46,7 +55,25 @@ func NewMockFile(path string, mode os.FileMode, content string) MockFile {
 	}
 }
 
-func GenerateSnapshot(t *testing.T, bufout *bytes.Buffer, buferr *bytes.Buffer, keyPair *keypair.KeyPair, files []MockFile) *snapshot.Snapshot {
+func NewMockSymlink(path string, target string) MockFile {
+	return MockFile{
+		Path:   path,
+		Mode:   os.ModeSymlink | 0777,
+		Target: target,
+	}
+}
+
+func GenerateSnapshot(t testing.TB, bufout *bytes.Buffer, buferr *bytes.Buffer, keyPair *keypair.KeyPair, files []MockFile) *snapshot.Snapshot {
+	return generateSnapshot(t, bufout, buferr, keyPair, files, nil, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+}
+
+// GenerateEncryptedSnapshot backs up files with opts in a repository
+// encrypted with passphrase.
+func GenerateEncryptedSnapshot(t testing.TB, passphrase []byte, files []MockFile, opts *snapshot.BackupOptions) *snapshot.Snapshot {
+	return generateSnapshot(t, nil, nil, nil, files, passphrase, opts)
+}
+
+func generateSnapshot(t testing.TB, bufout *bytes.Buffer, buferr *bytes.Buffer, keyPair *keypair.KeyPair, files []MockFile, passphrase []byte, opts *snapshot.BackupOptions) *snapshot.Snapshot {
 	// init temporary directories
 	tmpRepoDirRoot, err := os.MkdirTemp("", "tmp_repo")
 	require.NoError(t, err)
@@ -66,9 +93,18 @@ func GenerateSnapshot(t *testing.T, bufout *bytes.Buffer, buferr *bytes.Buffer,
 		dest := filepath.Join(tmpBackupDir, filepath.FromSlash(file.Path))
 		if file.IsDir {
 			err = os.MkdirAll(dest, file.Mode)
+		} else if file.Mode&os.ModeSymlink != 0 {
+			err = os.Symlink(file.Target, dest)
 		} else {
 			err = os.WriteFile(dest, file.Content, file.Mode)
 		}
+		require.NoError(t, err)
+		for name, value := range file.Xattrs {
+			require.NoError(t, xattr.LSet(dest, name, value))
+		}
+		if !file.ModTime.IsZero() && file.Mode&os.ModeSymlink == 0 {
+			require.NoError(t, os.Chtimes(dest, file.ModTime, file.ModTime))
+		}
 	}
 
 	// create a storage
@@ -76,11 +112,22 @@ func GenerateSnapshot(t *testing.T, bufout *bytes.Buffer, buferr *bytes.Buffer,
 	require.NotNil(t, r)
 	require.NoError(t, err)
 	config := storage.NewConfiguration()
-	config.Encryption = nil
+	var secret []byte
+	if passphrase == nil {
+		config.Encryption = nil
+	} else {
+		secret, err = encryption.DeriveKey(config.Encryption.KDFParams, passphrase)
+		require.NoError(t, err)
+		config.Encryption.Canary, err = encryption.DeriveCanary(config.Encryption, secret)
+		require.NoError(t, err)
+	}
 	serialized, err := config.ToBytes()
 	require.NoError(t, err)
 
 	hasher := hashing.GetHasher(hashing.DEFAULT_HASHING_ALGORITHM)
+	if secret != nil {
+		hasher = hashing.GetMACHasher(hashing.DEFAULT_HASHING_ALGORITHM, secret)
+	}
 	wrappedConfigRd, err := storage.Serialize(hasher, resources.RT_CONFIG, versioning.GetCurrentVersion(resources.RT_CONFIG), bytes.NewReader(serialized))
 	require.NoError(t, err)
 
@@ -102,6 +149,9 @@ func GenerateSnapshot(t *testing.T, bufout *bytes.Buffer, buferr *bytes.Buffer,
 	}
 	cache := caching.NewManager(tmpCacheDir)
 	ctx.SetCache(cache)
+	if secret != nil {
+		ctx.SetSecret(secret)
+	}
 	if keyPair != nil {
 		ctx.Identity = uuid.New()
 		ctx.Keypair = keyPair
@@ -126,7 +176,7 @@ func GenerateSnapshot(t *testing.T, bufout *bytes.Buffer, buferr *bytes.Buffer,
 
 	imp, err := fs.NewFSImporter(map[string]string{"location": tmpBackupDir})
 	require.NoError(t, err)
-	snap.Backup(imp, &snapshot.BackupOptions{Name: "test_backup", MaxConcurrency: 1})
+	snap.Backup(imp, opts)
 
 	err = snap.Repository().RebuildState()
 	require.NoError(t, err)
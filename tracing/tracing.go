@@ -0,0 +1,243 @@
+// Package tracing records spans around the major pipeline stages and
+// exports them to an OpenTelemetry collector.
+//
+// A nil *Tracer and a nil *Span are valid and do nothing, so callers don't
+// have to check whether tracing is enabled.
+package tracing
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logging"
+)
+
+// number of ended spans buffered before they are handed to the exporter
+const batchSize = 256
+
+// number of batches waiting to be exported, spans ended while the queue
+// is full are dropped rather than slowing down the traced work
+const queueSize = 16
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+type SpanData struct {
+	Name       string
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Error      string
+}
+
+type Exporter interface {
+	ExportSpans(spans []SpanData) error
+	Shutdown() error
+}
+
+// Tracer buffers the ended spans and exports them in batches from a
+// goroutine of its own, export failures are logged.
+type Tracer struct {
+	exporter Exporter
+	logger   *logging.Logger
+
+	mu      sync.Mutex
+	pending []SpanData
+	closed  bool
+
+	batches chan []SpanData
+	done    chan struct{}
+}
+
+type Span struct {
+	tracer *Tracer
+
+	mu   sync.Mutex
+	data SpanData
+}
+
+func NewTracer(exporter Exporter, logger *logging.Logger) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		logger:   logger,
+		batches:  make(chan []SpanData, queueSize),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	for batch := range t.batches {
+		if err := t.exporter.ExportSpans(batch); err != nil {
+			t.logger.Warn("tracing: could not export %d spans: %s", len(batch), err)
+		}
+	}
+}
+
+// Start begins a root span in a new trace.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	var traceID TraceID
+	rand.Read(traceID[:])
+	return t.newSpan(name, traceID, SpanID{})
+}
+
+func (t *Tracer) newSpan(name string, traceID TraceID, parentID SpanID) *Span {
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:     name,
+			TraceID:  traceID,
+			ParentID: parentID,
+			Start:    time.Now(),
+		},
+	}
+	rand.Read(span.data.SpanID[:])
+	return span
+}
+
+func (t *Tracer) record(data SpanData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.pending = append(t.pending, data)
+	if len(t.pending) < batchSize {
+		return
+	}
+
+	select {
+	case t.batches <- t.pending:
+	default:
+		t.logger.Warn("tracing: export queue full, dropping %d spans", len(t.pending))
+	}
+	t.pending = nil
+}
+
+// Close exports the buffered spans, waits for the exports in progress and
+// shuts the exporter down.  The spans ended afterwards are dropped.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	if len(t.pending) != 0 {
+		// the exporter goroutine drains the queue, this doesn't block
+		// for long
+		t.batches <- t.pending
+		t.pending = nil
+	}
+	close(t.batches)
+	t.mu.Unlock()
+
+	<-t.done
+	return t.exporter.Shutdown()
+}
+
+// Start begins a child span of s.
+func (s *Span) Start(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.newSpan(name, s.data.TraceID, s.data.SpanID)
+}
+
+func (s *Span) set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+func (s *Span) SetString(key string, value string) {
+	if s == nil {
+		return
+	}
+	s.set(key, value)
+}
+
+func (s *Span) SetInt(key string, value int64) {
+	if s == nil {
+		return
+	}
+	s.set(key, value)
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End records the span, only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.data.End.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.record(data)
+}
+
+// InMemoryExporter keeps the exported spans around, it is meant for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpans(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *InMemoryExporter) Shutdown() error {
+	return nil
+}
+
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ret := make([]SpanData, len(e.spans))
+	copy(ret, e.spans)
+	return ret
+}
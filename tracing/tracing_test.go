@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+
+	span := tracer.Start("noop")
+	require.Nil(t, span)
+
+	child := span.Start("child")
+	require.Nil(t, child)
+	child.SetInt("bytes", 42)
+	child.SetString("path", "/")
+	child.SetError(errors.New("failure"))
+	child.End()
+	span.End()
+
+	require.NoError(t, tracer.Close())
+}
+
+func TestSpans(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, logging.NewLogger(io.Discard, io.Discard))
+
+	root := tracer.Start("root")
+	child := root.Start("child")
+	child.SetInt("bytes", 1)
+	child.SetInt("bytes", 42)
+	child.SetError(errors.New("failure"))
+	child.End()
+	child.End()
+	root.End()
+
+	// nothing is exported until a batch is full or the tracer is closed
+	require.Empty(t, exporter.Spans())
+	require.NoError(t, tracer.Close())
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, "root", spans[1].Name)
+
+	require.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentID)
+	require.Equal(t, SpanID{}, spans[1].ParentID)
+	require.Equal(t, []Attribute{{Key: "bytes", Value: int64(42)}}, spans[0].Attributes)
+	require.Equal(t, "failure", spans[0].Error)
+	require.False(t, spans[0].End.Before(spans[0].Start))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var received otlpRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(server.URL, "plakar")
+	require.NoError(t, err)
+	tracer := NewTracer(exporter, logging.NewLogger(io.Discard, io.Discard))
+
+	root := tracer.Start("backup")
+	root.SetInt("files", 3)
+	root.SetString("importer", "fs")
+	root.End()
+	require.NoError(t, tracer.Close())
+
+	require.Equal(t, "/v1/traces", path)
+	require.Len(t, received.ResourceSpans, 1)
+	require.Len(t, received.ResourceSpans[0].ScopeSpans, 1)
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	require.Equal(t, "backup", spans[0].Name)
+	require.Len(t, spans[0].TraceID, 32)
+	require.Len(t, spans[0].SpanID, 16)
+	require.Empty(t, spans[0].ParentSpanID)
+	require.Equal(t, "files", spans[0].Attributes[0].Key)
+	require.Equal(t, "3", *spans[0].Attributes[0].Value.IntValue)
+	require.Equal(t, "fs", *spans[0].Attributes[1].Value.StringValue)
+}
+
+func TestOTLPExporterFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(server.URL+"/custom", "plakar")
+	require.NoError(t, err)
+	require.Error(t, exporter.ExportSpans([]SpanData{{Name: "span"}}))
+
+	// the failures of the exports are logged
+	bufErr := &bytes.Buffer{}
+	tracer := NewTracer(exporter, logging.NewLogger(io.Discard, bufErr))
+	tracer.Start("span").End()
+	require.NoError(t, tracer.Close())
+	require.Contains(t, bufErr.String(), "could not export 1 spans")
+
+	_, err = NewOTLPExporter("localhost:4318", "plakar")
+	require.Error(t, err)
+}
+
+// blockingExporter holds the exports until released.
+type blockingExporter struct {
+	InMemoryExporter
+	release chan struct{}
+}
+
+func (e *blockingExporter) ExportSpans(spans []SpanData) error {
+	<-e.release
+	return e.InMemoryExporter.ExportSpans(spans)
+}
+
+func TestSpansAsync(t *testing.T) {
+	exporter := &blockingExporter{release: make(chan struct{})}
+	tracer := NewTracer(exporter, logging.NewLogger(io.Discard, io.Discard))
+
+	// ending the spans doesn't wait for a slow exporter
+	for range 2 * batchSize {
+		tracer.Start("span").End()
+	}
+	require.Empty(t, exporter.Spans())
+
+	close(exporter.release)
+	require.NoError(t, tracer.Close())
+	require.Len(t, exporter.Spans(), 2*batchSize)
+
+	// spans ended once closed are dropped
+	tracer.Start("late").End()
+	require.NoError(t, tracer.Close())
+	require.Len(t, exporter.Spans(), 2*batchSize)
+}